@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +29,22 @@ type Config struct {
 	WorkspacesRoot     string
 	SharedDir          string
 
+	// Background claude jobs: concurrently running per user, stream-json kept
+	// per job, and how long one may run before it is killed (0 = no limit).
+	ClaudeJobsPerUser    int
+	ClaudeJobLogMaxBytes int64
+	ClaudeJobTimeout     time.Duration
+
+	// Remote approval of claude permission prompts: how long the hook waits
+	// for a decision from the web or Telegram (0 = off, the default: opt in
+	// with e.g. CLAUDE_APPROVAL_TIMEOUT=2m), and what then: "ask" (claude asks
+	// in the terminal as usual), "deny" or "allow".
+	ClaudeApprovalTimeout time.Duration
+	ClaudeApprovalDefault string
+
+	// Timeline of claude hook events. Retention 0 = keep forever.
+	ClaudeEventRetention time.Duration
+
 	RedisURL       string
 	AllowedOrigins []string
 
@@ -46,6 +63,50 @@ type Config struct {
 	ZaiBaseURL  string
 	ZaiModel    string
 	ZaiUsageURL string
+
+	// Terminal recordings (asciicast v2). Retention 0 = keep forever, MaxBytes 0 = no size cap.
+	TerminalRecordingsDir      string
+	TerminalRecordByDefault    bool
+	TerminalRecordingRetention time.Duration
+	TerminalRecordingsMaxBytes int64
+
+	// Per-session cap on the compressed scrollback log (0 = unlimited).
+	TerminalScrollbackMaxBytes int64
+
+	// Run shells in pty-holder processes so they survive backend restarts (unix only).
+	TerminalPtyHolders bool
+
+	// Per-user cgroup v2 limits of sandboxed terminals (0 = unlimited). When on,
+	// the backend won't start unless the cgroup tree is writable.
+	TerminalCgroups    bool
+	TerminalCgroupRoot string
+	TerminalCPUPercent int
+	TerminalMemoryMB   int64
+	TerminalPidsMax    int
+
+	// Per-user terminal policy defaults (users may override, see models.User):
+	// attached sessions at once (0 = unlimited) and how long an unattached,
+	// idle shell lives before it is hibernated (SIGHUP, scrollback kept).
+	// Hibernation is off unless enabled, e.g. TERMINAL_HIBERNATE_AFTER=24h,
+	// or set per user; TERMINAL_HIBERNATE_WARNING is the notice given ahead.
+	TerminalMaxSessions      int
+	TerminalHibernateAfter   time.Duration
+	TerminalHibernateWarning time.Duration
+
+	// Native terminal sandbox for non-admin users (Linux).
+	TerminalSandboxUser    string
+	TerminalSandboxTmpSize string
+	TerminalSandboxSeccomp bool
+
+	// POST /api/exec limits (requests may lower them).
+	ExecTimeout        time.Duration
+	ExecMaxTimeout     time.Duration
+	ExecMaxOutputBytes int64
+
+	// Embedded SSH gateway into terminals (empty address = disabled). The
+	// host key is generated on first start.
+	SSHListenAddr  string
+	SSHHostKeyPath string
 }
 
 func Load() *Config {
@@ -70,6 +131,15 @@ func Load() *Config {
 		WorkspacesRoot:     getEnv("WORKSPACES_ROOT", defaultWorkspacesRoot()),
 		SharedDir:          getEnv("SHARED_DIR", defaultSharedDir()),
 
+		ClaudeJobsPerUser:    int(parseInt64(getEnv("CLAUDE_JOBS_PER_USER", "2"))),
+		ClaudeJobLogMaxBytes: parseInt64(getEnv("CLAUDE_JOB_LOG_MAX_MB", "8")) * 1024 * 1024,
+		ClaudeJobTimeout:     parseDuration(getEnv("CLAUDE_JOB_TIMEOUT", "1h")),
+
+		ClaudeApprovalTimeout: parseDuration(getEnv("CLAUDE_APPROVAL_TIMEOUT", "0")),
+		ClaudeApprovalDefault: getEnv("CLAUDE_APPROVAL_DEFAULT", "ask"),
+
+		ClaudeEventRetention: parseDuration(getEnv("CLAUDE_EVENT_RETENTION", "30d")),
+
 		RedisURL:       getEnv("REDIS_URL", "localhost:6379"),
 		AllowedOrigins: parseOrigins(getEnv("ALLOWED_ORIGINS", defaultOrigins())),
 
@@ -85,6 +155,31 @@ func Load() *Config {
 		ZaiBaseURL:  getEnv("ZAI_BASE_URL", "https://api.z.ai/api/anthropic"),
 		ZaiModel:    getEnv("ZAI_MODEL", "glm-5.2[1m]"),
 		ZaiUsageURL: getEnv("ZAI_USAGE_URL", "https://api.z.ai/api/monitor/usage/quota/limit"),
+
+		TerminalRecordingsDir:      getEnv("TERMINAL_RECORDINGS_DIR", defaultRecordingsDir()),
+		TerminalRecordByDefault:    getEnv("TERMINAL_RECORD_DEFAULT", "false") == "true",
+		TerminalRecordingRetention: parseDuration(getEnv("TERMINAL_RECORDING_RETENTION", "14d")),
+		TerminalRecordingsMaxBytes: parseInt64(getEnv("TERMINAL_RECORDINGS_MAX_MB", "2048")) * 1024 * 1024,
+		TerminalScrollbackMaxBytes: parseInt64(getEnv("TERMINAL_SCROLLBACK_MAX_MB", "64")) * 1024 * 1024,
+		TerminalPtyHolders:         getEnv("TERMINAL_PTY_HOLDERS", strconv.FormatBool(runtime.GOOS != "windows")) == "true",
+		TerminalCgroups:            getEnv("TERMINAL_CGROUPS", strconv.FormatBool(runtime.GOOS == "linux")) == "true",
+		TerminalCgroupRoot:         getEnv("TERMINAL_CGROUP_ROOT", "/sys/fs/cgroup/nebulide-terminals"),
+		TerminalCPUPercent:         int(parseInt64(getEnv("TERMINAL_CPU_PERCENT", "200"))),
+		TerminalMemoryMB:           parseInt64(getEnv("TERMINAL_MEMORY_MB", "2048")),
+		TerminalPidsMax:            int(parseInt64(getEnv("TERMINAL_PIDS_MAX", "512"))),
+		TerminalMaxSessions:        int(parseInt64(getEnv("TERMINAL_MAX_SESSIONS", "15"))),
+		TerminalHibernateAfter:     parseDuration(getEnv("TERMINAL_HIBERNATE_AFTER", "0")),
+		TerminalHibernateWarning:   parseDuration(getEnv("TERMINAL_HIBERNATE_WARNING", "15m")),
+		TerminalSandboxUser:        getEnv("TERMINAL_SANDBOX_USER", "nebulide"),
+		TerminalSandboxTmpSize:     getEnv("TERMINAL_SANDBOX_TMP_SIZE", "1g"),
+		TerminalSandboxSeccomp:     getEnv("TERMINAL_SANDBOX_SECCOMP", "true") == "true",
+
+		ExecTimeout:        parseDuration(getEnv("EXEC_TIMEOUT", "1m")),
+		ExecMaxTimeout:     parseDuration(getEnv("EXEC_MAX_TIMEOUT", "30m")),
+		ExecMaxOutputBytes: parseInt64(getEnv("EXEC_MAX_OUTPUT_MB", "10")) * 1024 * 1024,
+
+		SSHListenAddr:  getEnv("SSH_LISTEN_ADDR", ""),
+		SSHHostKeyPath: getEnv("SSH_HOST_KEY", defaultSSHHostKeyPath()),
 	}
 }
 
@@ -147,6 +242,23 @@ func (c *Config) GetUserWorkspaceDir(username string) string {
 	return filepath.Join(c.WorkspacesRoot, safe)
 }
 
+func defaultRecordingsDir() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.TempDir(), "terminal-recordings")
+	}
+	return "/tmp/terminal-recordings"
+}
+
+func defaultSSHHostKeyPath() string {
+	if runtime.GOOS == "windows" {
+		if root := findProjectRoot(); root != "" {
+			return filepath.Join(root, "ssh_host_ed25519_key")
+		}
+		return filepath.Join(os.Getenv("USERPROFILE"), "ssh_host_ed25519_key")
+	}
+	return "/home/nebulide/.ssh-gateway/ssh_host_ed25519_key"
+}
+
 func defaultWorkingDir() string {
 	if runtime.GOOS == "windows" {
 		if root := findProjectRoot(); root != "" {
@@ -179,6 +291,14 @@ func parseDuration(s string) time.Duration {
 	return d
 }
 
+func parseInt64(s string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
 func defaultOrigins() string {
 	if os.Getenv("GIN_MODE") != "release" {
 		return "https://nebulide.ru,https://mega.nebulide.ru,http://localhost:5173,http://localhost:5174,http://localhost:8080"
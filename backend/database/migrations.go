@@ -17,6 +17,18 @@ func Migrate() {
 		&models.WorkspaceSession{},
 		&models.LLMSession{},
 		&models.LLMMessage{},
+		&models.ExecRun{},
+		&models.TerminalTrigger{},
+		&models.ProcessWatcher{},
+		&models.TerminalProfile{},
+		&models.TerminalInstance{},
+		&models.SSHKey{},
+		&models.ClaudeJob{},
+		&models.ClaudeSchedule{},
+		&models.ClaudeApproval{},
+		&models.ClaudePolicyRule{},
+		&models.ClaudePolicyDenial{},
+		&models.ClaudeEvent{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
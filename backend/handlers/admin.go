@@ -110,6 +110,79 @@ func (h *AdminHandler) GetUser(c *gin.Context) {
 		"workspace_size_bytes": size,
 		"workspace_file_count": fileCount,
 		"active_pty_count":     ptyCount,
+		"terminal_cpu_percent": user.TerminalCPUPercent,
+		"terminal_memory_mb":   user.TerminalMemoryMB,
+		"terminal_pids_max":    user.TerminalPidsMax,
+
+		"terminal_max_sessions":    user.TerminalMaxSessions,
+		"terminal_hibernate_hours": user.TerminalHibernateHours,
+	})
+}
+
+type userLimitsRequest struct {
+	TerminalCPUPercent *int `json:"terminal_cpu_percent"`
+	TerminalMemoryMB   *int `json:"terminal_memory_mb"`
+	TerminalPidsMax    *int `json:"terminal_pids_max"`
+
+	TerminalMaxSessions    *int `json:"terminal_max_sessions"`
+	TerminalHibernateHours *int `json:"terminal_hibernate_hours"`
+}
+
+// SetUserLimits updates a user's terminal cgroup and policy overrides
+// (0 = default, -1 = unlimited/never) and applies them to the live cgroup.
+// The policy applies from the next terminal start / idle check.
+func (h *AdminHandler) SetUserLimits(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var req userLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	updates := map[string]interface{}{}
+	for col, v := range map[string]*int{
+		"terminal_cpu_percent": req.TerminalCPUPercent,
+		"terminal_memory_mb":   req.TerminalMemoryMB,
+		"terminal_pids_max":    req.TerminalPidsMax,
+
+		"terminal_max_sessions":    req.TerminalMaxSessions,
+		"terminal_hibernate_hours": req.TerminalHibernateHours,
+	} {
+		if v == nil {
+			continue
+		}
+		if *v < -1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": col + " must be -1, 0 or positive"})
+			return
+		}
+		updates[col] = *v
+	}
+	if len(updates) > 0 {
+		if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update limits"})
+			return
+		}
+		database.DB.First(&user, "id = ?", user.ID)
+	}
+	if h.terminal.Cgroups != nil {
+		if err := h.terminal.Cgroups.Apply(user.ID.String()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Saved, but applying failed: %v", err)})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"terminal_cpu_percent": user.TerminalCPUPercent,
+		"terminal_memory_mb":   user.TerminalMemoryMB,
+		"terminal_pids_max":    user.TerminalPidsMax,
+
+		"terminal_max_sessions":    user.TerminalMaxSessions,
+		"terminal_hibernate_hours": user.TerminalHibernateHours,
 	})
 }
 
@@ -184,6 +257,10 @@ type terminalDetail struct {
 	Command     string  `json:"command"`
 	WriterCount int     `json:"writer_count"`
 	Status      string  `json:"status"` // "active" | "hidden" | "offline"
+
+	Writers []services.WriterStats `json:"writers"` // per-device output lag
+
+	Screen string `json:"screen,omitempty"` // visible screen as text, with ?screen=1 (thumbnails)
 }
 
 func (h *AdminHandler) ListTerminals(c *gin.Context) {
@@ -194,6 +271,7 @@ func (h *AdminHandler) ListTerminals(c *gin.Context) {
 	id := c.Param("id")
 	allSessions := h.terminal.ListSessionsWithPID()
 	prefix := "term:" + id + ":"
+	withScreen := c.Query("screen") == "1"
 	var result []terminalDetail
 	var pids []int
 	for _, s := range allSessions {
@@ -206,6 +284,12 @@ func (h *AdminHandler) ListTerminals(c *gin.Context) {
 			Alive:       s.Alive,
 			PID:         s.PID,
 			WriterCount: s.WriterCount,
+			Writers:     s.Writers,
+		}
+		if withScreen {
+			if snap, ok := h.terminal.Screen(s.Key, false); ok {
+				td.Screen = snap.Text
+			}
 		}
 		if runtime.GOOS == "linux" && s.PID > 0 {
 			td.MemoryRSS, td.Command, _ = readProcInfo(s.PID)
@@ -240,6 +324,15 @@ func (h *AdminHandler) ListTerminals(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// TerminalScreen shows what one of the user's terminals displays, in the
+// formats of GET /terminals/:instanceId/screen.
+func (h *AdminHandler) TerminalScreen(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	writeScreen(c, h.terminal, "term:"+c.Param("id")+":"+c.Param("instanceId"))
+}
+
 func (h *AdminHandler) KillTerminal(c *gin.Context) {
 	if !requireAdmin(c) {
 		return
@@ -387,6 +480,12 @@ type processInfo struct {
 type monitoringResponse struct {
 	System    systemInfo    `json:"system"`
 	Processes []processInfo `json:"processes"`
+	Cgroups   []cgroupInfo  `json:"cgroups"` // per-user terminal cgroups (empty when disabled)
+}
+
+type cgroupInfo struct {
+	services.CgroupUsage
+	Username string `json:"username"`
 }
 
 type systemInfo struct {
@@ -521,9 +620,21 @@ func (h *AdminHandler) Monitoring(c *gin.Context) {
 		}
 	}
 
+	cgroups := []cgroupInfo{}
+	if h.terminal.Cgroups != nil {
+		for _, u := range h.terminal.Cgroups.Usage() {
+			name := userMap[u.UserID]
+			if name == "" {
+				name = u.UserID
+			}
+			cgroups = append(cgroups, cgroupInfo{CgroupUsage: u, Username: name})
+		}
+	}
+
 	c.JSON(http.StatusOK, monitoringResponse{
 		System:    sys,
 		Processes: processes,
+		Cgroups:   cgroups,
 	})
 }
 
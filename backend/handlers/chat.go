@@ -59,7 +59,7 @@ func (h *ChatHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	claims, err := utils.ParseToken(h.cfg.JWTSecret, token)
-	if err != nil || claims.Partial {
+	if err != nil || claims.Partial || claims.Purpose != "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
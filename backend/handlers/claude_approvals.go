@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+type ClaudeApprovalsHandler struct {
+	approvals *services.ApprovalService
+}
+
+func NewClaudeApprovalsHandler(approvals *services.ApprovalService) *ClaudeApprovalsHandler {
+	return &ClaudeApprovalsHandler{approvals: approvals}
+}
+
+// List returns the user's permission prompts, newest first.
+// Query: ?status= (e.g. pending), ?limit= (default 50, max 500).
+func (h *ClaudeApprovalsHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	q := database.DB.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var approvals []models.ClaudeApproval
+	if err := q.Order("created_at DESC").Limit(limit).Find(&approvals).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list approvals"})
+		return
+	}
+	c.JSON(http.StatusOK, approvals)
+}
+
+type approvalDecisionRequest struct {
+	Decision string `json:"decision" binding:"required"` // "allow" or "deny"
+	Message  string `json:"message"`                     // told to claude on deny
+}
+
+// Decide answers a pending permission prompt; the waiting claude goes on
+// right away.
+func (h *ClaudeApprovalsHandler) Decide(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	var req approvalDecisionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Decision != "allow" && req.Decision != "deny") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be allow or deny"})
+		return
+	}
+	if len(req.Message) > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message must be at most 1000 characters"})
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approval not found"})
+		return
+	}
+	switch err := h.approvals.Decide(userID, id, req.Decision == "allow", "web", req.Message); {
+	case errors.Is(err, services.ErrApprovalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approval not found"})
+	case errors.Is(err, services.ErrApprovalDecided):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Decision sent"})
+	}
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+	"nebulide/utils"
+)
+
+type approvalsTest struct {
+	router    *gin.Engine
+	approvals *services.ApprovalService
+	tc        *testutil.TestContext
+	events    chan services.ApprovalEvent
+	userToken string
+	hookToken string
+}
+
+func setupApprovalsTest(t *testing.T, timeout time.Duration, fallback string) *approvalsTest {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	cfg.ClaudeApprovalTimeout = timeout
+	cfg.ClaudeApprovalDefault = fallback
+	approvals := services.NewApprovalService()
+	events := make(chan services.ApprovalEvent, 10)
+	approvals.OnEvent = func(ev services.ApprovalEvent) { events <- ev }
+	hooks := NewHookHandler(cfg, approvals, nil, nil)
+	handler := NewClaudeApprovalsHandler(approvals)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/hooks/claude", hooks.HandleClaudeHook)
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/claude-approvals", handler.List)
+	protected.POST("/claude-approvals/:id/decision", handler.Decide)
+
+	user := testutil.CreateTestUser(db)
+	hookToken, err := utils.GenerateScopedToken(cfg.JWTSecret, user.ID, user.Username, "claude-hook", time.Hour)
+	require.NoError(t, err)
+	return &approvalsTest{
+		router:    r,
+		approvals: approvals,
+		tc:        &testutil.TestContext{DB: db, Cfg: cfg},
+		events:    events,
+		userToken: testutil.GenerateTestToken(cfg, user.ID, user.Username, false),
+		hookToken: hookToken,
+	}
+}
+
+func (at *approvalsTest) do(token, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	at.router.ServeHTTP(w, req)
+	return w
+}
+
+// hook sends a PermissionRequest like nebulide-hook.mjs and returns the
+// hook_output the backend answers with, once it answers.
+func (at *approvalsTest) hook() chan json.RawMessage {
+	out := make(chan json.RawMessage, 1)
+	go func() {
+		w := at.do(at.hookToken, "POST", "/api/hooks/claude",
+			`{"event":"PermissionRequest","session_id":"s1","instance_id":"t1","cwd":"/ws/app","tool":"Bash","tool_input":{"command":"rm -rf build"}}`)
+		var resp struct {
+			HookOutput json.RawMessage `json:"hook_output"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		out <- resp.HookOutput
+	}()
+	return out
+}
+
+func (at *approvalsTest) waitRequested(t *testing.T) *models.ClaudeApproval {
+	t.Helper()
+	return at.waitEvent(t, "requested")
+}
+
+func (at *approvalsTest) waitEvent(t *testing.T, event string) *models.ClaudeApproval {
+	t.Helper()
+	for {
+		select {
+		case ev := <-at.events:
+			if ev.Event == event {
+				return ev.Approval
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no approval %s", event)
+			return nil
+		}
+	}
+}
+
+func TestClaudeApprovals_AllowFromWeb(t *testing.T) {
+	at := setupApprovalsTest(t, time.Minute, "ask")
+	out := at.hook()
+	a := at.waitRequested(t)
+
+	var pending []models.ClaudeApproval
+	require.NoError(t, json.Unmarshal(at.do(at.userToken, "GET", "/api/claude-approvals?status=pending", "").Body.Bytes(), &pending))
+	require.Len(t, pending, 1)
+	assert.Equal(t, "Bash", pending[0].Tool)
+	assert.JSONEq(t, `{"command":"rm -rf build"}`, string(pending[0].ToolInput))
+
+	assert.Equal(t, http.StatusBadRequest, at.do(at.userToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"maybe"}`).Code)
+	require.Equal(t, http.StatusOK, at.do(at.userToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"allow"}`).Code)
+	select {
+	case output := <-out:
+		assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PermissionRequest","decision":{"behavior":"allow"}}}`, string(output))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hook is still waiting")
+	}
+	assert.Equal(t, http.StatusConflict, at.do(at.userToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"deny"}`).Code)
+
+	// Someone else's approval is not found.
+	other := models.User{ID: uuid.New(), Username: "other", PasswordHash: "x"}
+	require.NoError(t, at.tc.DB.Create(&other).Error)
+	otherToken := testutil.GenerateTestToken(at.tc.Cfg, other.ID, other.Username, false)
+	assert.Equal(t, http.StatusNotFound, at.do(otherToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"deny"}`).Code)
+}
+
+func TestClaudeApprovals_DenyWithMessage(t *testing.T) {
+	at := setupApprovalsTest(t, time.Minute, "ask")
+	out := at.hook()
+	a := at.waitRequested(t)
+
+	require.Equal(t, http.StatusOK, at.do(at.userToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"deny","message":"not on main"}`).Code)
+	assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PermissionRequest","decision":{"behavior":"deny","message":"not on main"}}}`, string(<-out))
+
+	var all []models.ClaudeApproval
+	require.NoError(t, json.Unmarshal(at.do(at.userToken, "GET", "/api/claude-approvals", "").Body.Bytes(), &all))
+	require.Len(t, all, 1)
+	assert.Equal(t, models.ApprovalDenied, all[0].Status)
+	assert.Equal(t, "web", all[0].DecidedVia)
+	assert.NotNil(t, all[0].DecidedAt)
+}
+
+func TestClaudeApprovals_TimeoutDefault(t *testing.T) {
+	at := setupApprovalsTest(t, 100*time.Millisecond, "deny")
+	out := at.hook()
+	at.waitRequested(t)
+	assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PermissionRequest","decision":{"behavior":"deny","message":"No decision in time"}}}`, string(<-out))
+
+	// "ask": no decision, claude asks in the terminal.
+	at.tc.Cfg.ClaudeApprovalDefault = "ask"
+	out = at.hook()
+	at.waitRequested(t)
+	assert.Equal(t, "null", string(<-out))
+
+	var expired []models.ClaudeApproval
+	require.NoError(t, json.Unmarshal(at.do(at.userToken, "GET", "/api/claude-approvals?status=expired", "").Body.Bytes(), &expired))
+	assert.Len(t, expired, 2)
+}
+
+func TestClaudeApprovals_TelegramMessageRacesDecision(t *testing.T) {
+	at := setupApprovalsTest(t, time.Minute, "ask")
+
+	// Sent while pending: "decided" will find the message and close it.
+	out := at.hook()
+	a := at.waitRequested(t)
+	decided, err := at.approvals.SetTelegramMessage(a.ID, 42, 7)
+	require.NoError(t, err)
+	assert.Nil(t, decided)
+	require.Equal(t, http.StatusOK, at.do(at.userToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"allow"}`).Code)
+	<-out
+	assert.Equal(t, 7, at.waitEvent(t, "decided").TelegramMessageID)
+
+	// Decided before the send returned: the caller gets it back to close.
+	out = at.hook()
+	a = at.waitRequested(t)
+	require.Equal(t, http.StatusOK, at.do(at.userToken, "POST", "/api/claude-approvals/"+a.ID.String()+"/decision", `{"decision":"deny"}`).Code)
+	<-out
+	decided, err = at.approvals.SetTelegramMessage(a.ID, 42, 8)
+	require.NoError(t, err)
+	require.NotNil(t, decided)
+	assert.Equal(t, models.ApprovalDenied, decided.Status)
+	assert.Equal(t, int64(42), decided.TelegramChatID)
+	assert.Equal(t, 8, decided.TelegramMessageID)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ClaudeEventsHandler serves the timeline of the user's claude hook events
+// (stored by HookHandler through services.ClaudeEventService).
+type ClaudeEventsHandler struct{}
+
+func NewClaudeEventsHandler() *ClaudeEventsHandler {
+	return &ClaudeEventsHandler{}
+}
+
+// List returns the user's hook events, newest first.
+// Query: ?session_id=, ?instance_id=, ?tool= and ?event= (comma-separated
+// lists), ?since= and ?until= (RFC 3339), ?order=asc for oldest first,
+// ?limit= (default 200, max 1000).
+// E.g. everything claude wrote today: ?event=PostToolUse&tool=Write,Edit&since=2026-10-16T00:00:00Z
+func (h *ClaudeEventsHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "200"))
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+
+	q := database.DB.Where("user_id = ?", userID)
+	for _, col := range []string{"session_id", "instance_id"} {
+		if v := c.Query(col); v != "" {
+			q = q.Where(col+" = ?", v)
+		}
+	}
+	for _, col := range []string{"tool", "event"} {
+		if v := c.Query(col); v != "" {
+			q = q.Where(col+" IN ?", strings.Split(v, ","))
+		}
+	}
+	for param, op := range map[string]string{"since": ">=", "until": "<"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 time"})
+			return
+		}
+		q = q.Where("created_at "+op+" ?", t.UTC())
+	}
+	order := "created_at DESC"
+	if c.Query("order") == "asc" {
+		order = "created_at ASC"
+	}
+
+	var events []models.ClaudeEvent
+	if err := q.Order(order).Limit(limit).Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list events"})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
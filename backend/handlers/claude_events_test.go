@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+	"nebulide/utils"
+)
+
+func TestClaudeEvents_Timeline(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	hooks := NewHookHandler(cfg, nil, nil, services.NewClaudeEventService(0))
+	handler := NewClaudeEventsHandler()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/hooks/claude", hooks.HandleClaudeHook)
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/claude-events", handler.List)
+
+	user := testutil.CreateTestUser(db)
+	hookToken, err := utils.GenerateScopedToken(cfg.JWTSecret, user.ID, user.Username, "claude-hook", time.Hour)
+	require.NoError(t, err)
+	userToken := testutil.GenerateTestToken(cfg, user.ID, user.Username, false)
+	do := func(token, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	list := func(query string) []models.ClaudeEvent {
+		t.Helper()
+		w := do(userToken, "GET", "/api/claude-events"+query, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var events []models.ClaudeEvent
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+		return events
+	}
+
+	start := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+	for _, body := range []string{
+		`{"event":"SessionStart","session_id":"s1","instance_id":"t1","cwd":"/ws/app"}`,
+		`{"event":"PreToolUse","session_id":"s1","instance_id":"t1","cwd":"/ws/app","tool":"Write","tool_input":{"file_path":"/ws/app/big.txt","content":"` + strings.Repeat("x", 5000) + `"}}`,
+		`{"event":"StatusLine","session_id":"s1","instance_id":"t1","model":"opus"}`,
+		`{"event":"PostToolUse","session_id":"s1","instance_id":"t1","cwd":"/ws/app","tool":"Bash","tool_input":{"command":"go test ./..."}}`,
+		`{"event":"Stop","session_id":"s2","instance_id":"t2","cwd":"/ws/lib"}`,
+	} {
+		require.Equal(t, http.StatusOK, do(hookToken, "POST", "/api/hooks/claude", body).Code, body)
+	}
+
+	// Everything but the status line, newest first, once the writer caught up.
+	var events []models.ClaudeEvent
+	require.Eventually(t, func() bool {
+		events = list("")
+		return len(events) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "Stop", events[0].Event)
+	assert.Equal(t, "SessionStart", events[3].Event)
+
+	session := list("?session_id=s1&order=asc")
+	require.Len(t, session, 3)
+	assert.Equal(t, []string{"SessionStart", "PreToolUse", "PostToolUse"}, []string{session[0].Event, session[1].Event, session[2].Event})
+	var input map[string]string
+	require.NoError(t, json.Unmarshal(session[1].ToolInput, &input))
+	assert.Equal(t, "/ws/app/big.txt", input["file_path"])
+	assert.Less(t, len(input["content"]), 1000)
+
+	touched := list("?tool=Write,Edit&since=" + start)
+	require.Len(t, touched, 1)
+	assert.Equal(t, "/ws/app", touched[0].Cwd)
+	assert.Len(t, list("?instance_id=t2"), 1)
+	assert.Empty(t, list("?until="+start))
+	assert.Equal(t, http.StatusBadRequest, do(userToken, "GET", "/api/claude-events?since=yesterday", "").Code)
+
+	// Another user's timeline is their own.
+	other := models.User{ID: uuid.New(), Username: "other", PasswordHash: "x"}
+	require.NoError(t, db.Create(&other).Error)
+	w := do(testutil.GenerateTestToken(cfg, other.ID, other.Username, false), "GET", "/api/claude-events", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+const (
+	maxQueuedJobsPerUser = 100
+	maxJobPromptBytes    = 100 << 10 // one argv string must stay under the 128KB MAX_ARG_STRLEN
+)
+
+var (
+	jobModelRe     = regexp.MustCompile(`^[A-Za-z0-9._:\[\]-]{1,100}$`)
+	jobSessionIDRe = regexp.MustCompile(`^[A-Za-z0-9-]{1,100}$`)
+)
+
+type ClaudeJobsHandler struct {
+	cfg   *config.Config
+	jobs  *services.ClaudeJobService
+	files *FilesHandler // path checks for cwd
+}
+
+func NewClaudeJobsHandler(cfg *config.Config, jobs *services.ClaudeJobService) *ClaudeJobsHandler {
+	return &ClaudeJobsHandler{cfg: cfg, jobs: jobs, files: NewFilesHandler(cfg)}
+}
+
+// ClaudeJobShell runs a user's jobs like their terminals: same sandbox and
+// environment (for ClaudeJobService.UserShell).
+func ClaudeJobShell(cfg *config.Config) func(userID uuid.UUID, provider string) (services.JobShell, error) {
+	return func(userID uuid.UUID, provider string) (services.JobShell, error) {
+		var user models.User
+		if err := database.DB.Select("id", "username").First(&user, "id = ?", userID).Error; err != nil {
+			return services.JobShell{}, errors.New("job owner not found")
+		}
+		_, sandboxed := userShellDir(cfg, user.Username)
+		return services.JobShell{
+			Username:  user.Username,
+			Sandboxed: sandboxed,
+			Env:       userShellEnv(cfg, userID, user.Username, "job", provider),
+		}, nil
+	}
+}
+
+type claudeJobRequest struct {
+	Prompt          string `json:"prompt" binding:"required"`
+	Cwd             string `json:"cwd"` // relative to the workspace
+	Model           string `json:"model"`
+	AllowedTools    string `json:"allowed_tools"` // default: the server's CLAUDE_ALLOWED_TOOLS
+	ResumeSessionID string `json:"resume_session_id"`
+	Provider        string `json:"provider"` // as ?provider= of terminals, e.g. "glm"
+}
+
+// Create queues a background `claude -p` job. Progress arrives on the sync
+// WebSocket as claude_job events; the result stays on the job.
+func (h *ClaudeJobsHandler) Create(c *gin.Context) {
+	var req claudeJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prompt is required"})
+		return
+	}
+	switch {
+	case len(req.Prompt) > maxJobPromptBytes:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prompt is too long"})
+		return
+	case req.Model != "" && !jobModelRe.MatchString(req.Model):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid model"})
+		return
+	case req.ResumeSessionID != "" && !jobSessionIDRe.MatchString(req.ResumeSessionID):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resume_session_id"})
+		return
+	case len(req.AllowedTools) > 1000:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "allowed_tools is too long"})
+		return
+	case req.Provider != "" && req.Provider != "glm":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider must be empty or glm"})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	workDir, _ := userShellDir(h.cfg, c.GetString("username"))
+	if req.Cwd != "" {
+		dir, err := h.files.safePathWithBase(req.Cwd, workDir)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cwd is outside the workspace"})
+			return
+		}
+		workDir = dir
+	}
+
+	var count int64
+	database.DB.Model(&models.ClaudeJob{}).Where("user_id = ? AND status = ?", userID, models.JobQueued).Count(&count)
+	if count >= maxQueuedJobsPerUser {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many queued jobs"})
+		return
+	}
+
+	job := &models.ClaudeJob{
+		UserID:          userID,
+		Prompt:          req.Prompt,
+		WorkDir:         workDir,
+		Model:           req.Model,
+		AllowedTools:    req.AllowedTools,
+		ResumeSessionID: req.ResumeSessionID,
+		Provider:        req.Provider,
+		Source:          "api",
+	}
+	if err := h.jobs.Submit(job); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+		return
+	}
+	c.JSON(http.StatusCreated, job)
+}
+
+// List returns the user's jobs, newest first, without logs.
+// Query: ?status=, ?limit= (default 50, max 500), ?offset=.
+func (h *ClaudeJobsHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	q := database.DB.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var jobs []models.ClaudeJob
+	if err := q.Omit("log").Order("created_at DESC").Limit(limit).Offset(max(offset, 0)).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// Get returns one job with its result.
+func (h *ClaudeJobsHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var job models.ClaudeJob
+	if err := database.DB.Omit("log").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// Log returns the job's stream-json output as NDJSON, as far as it has been
+// saved (a running job's log lags a couple of seconds).
+func (h *ClaudeJobsHandler) Log(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var job models.ClaudeJob
+	if err := database.DB.Select("id", "log").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.Data(http.StatusOK, "application/x-ndjson", []byte(job.Log))
+}
+
+// Cancel drops a queued job or kills a running one.
+func (h *ClaudeJobsHandler) Cancel(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	switch err := h.jobs.Cancel(userID, jobID); {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, services.ErrJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Job canceled"})
+	}
+}
+
+// Retry queues a copy of a finished job (retry_of points at the original).
+func (h *ClaudeJobsHandler) Retry(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	jobID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	job, err := h.jobs.Retry(userID, jobID, "api")
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case errors.Is(err, services.ErrJobActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+	default:
+		c.JSON(http.StatusCreated, job)
+	}
+}
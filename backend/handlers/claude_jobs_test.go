@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"nebulide/config"
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+// fakeClaude prints stream-json like `claude -p`; the prompt (stdin) picks
+// the behavior.
+const fakeClaude = `#!/bin/sh
+prompt="$(cat)"
+echo '{"type":"system","subtype":"init","session_id":"s-1"}'
+case "$prompt" in
+slow) sleep 30 ;;
+fail) echo boom >&2; exit 2 ;;
+esac
+printf '{"type":"result","subtype":"success","is_error":false,"result":"%s | args: %s","session_id":"s-1","num_turns":2,"total_cost_usd":0.25}\n' "$prompt" "$*"
+`
+
+// newFakeClaudeJobs returns a job service running fakeClaude.
+func newFakeClaudeJobs(t *testing.T, cfg *config.Config, maxPerUser int) *services.ClaudeJobService {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake claude is a shell script")
+	}
+	cfg.ClaudeWorkingDir = t.TempDir()
+	bin := filepath.Join(t.TempDir(), "claude")
+	require.NoError(t, os.WriteFile(bin, []byte(fakeClaude), 0o755))
+
+	jobs := services.NewClaudeJobService(services.NewTerminalService(), "Read,Write")
+	jobs.Binary = bin
+	jobs.MaxPerUser = maxPerUser
+	jobs.UserShell = ClaudeJobShell(cfg)
+	return jobs
+}
+
+// jobsTestRequester creates the admin user, whose jobs run unsandboxed, and
+// returns a client for r authenticated as them.
+func jobsTestRequester(t *testing.T, db *gorm.DB, cfg *config.Config, r *gin.Engine) func(method, path, body string) *httptest.ResponseRecorder {
+	user := testutil.CreateTestUser(db)
+	require.NoError(t, db.Model(&user).Update("username", cfg.AdminUsername).Error)
+	token := testutil.GenerateTestToken(cfg, user.ID, cfg.AdminUsername, false)
+	return func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func setupClaudeJobsTest(t *testing.T, maxPerUser int, timeout ...time.Duration) (func(method, path, body string) *httptest.ResponseRecorder, chan services.ClaudeJobEvent) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	jobs := newFakeClaudeJobs(t, cfg, maxPerUser)
+	if len(timeout) > 0 {
+		jobs.Timeout = timeout[0]
+	}
+	events := make(chan services.ClaudeJobEvent, 100)
+	jobs.OnEvent = func(ev services.ClaudeJobEvent) { events <- ev }
+	handler := NewClaudeJobsHandler(cfg, jobs)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/claude-jobs", handler.List)
+	protected.POST("/claude-jobs", handler.Create)
+	protected.GET("/claude-jobs/:id", handler.Get)
+	protected.GET("/claude-jobs/:id/log", handler.Log)
+	protected.POST("/claude-jobs/:id/cancel", handler.Cancel)
+	protected.POST("/claude-jobs/:id/retry", handler.Retry)
+
+	return jobsTestRequester(t, db, cfg, r), events
+}
+
+func submitJob(t *testing.T, do func(method, path, body string) *httptest.ResponseRecorder, body string) models.ClaudeJob {
+	t.Helper()
+	w := do("POST", "/api/claude-jobs", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var job models.ClaudeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	return job
+}
+
+func waitJob(t *testing.T, do func(method, path, body string) *httptest.ResponseRecorder, id, status string) models.ClaudeJob {
+	t.Helper()
+	var job models.ClaudeJob
+	require.Eventually(t, func() bool {
+		json.Unmarshal(do("GET", "/api/claude-jobs/"+id, "").Body.Bytes(), &job)
+		return job.Status == status
+	}, 5*time.Second, 20*time.Millisecond, "job %s never became %s", id, status)
+	return job
+}
+
+func TestClaudeJobs_RunToResult(t *testing.T) {
+	do, events := setupClaudeJobsTest(t, 2)
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/api/claude-jobs", `{"prompt":"hi","model":"x; rm -rf /"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do("POST", "/api/claude-jobs", `{"prompt":"hi","cwd":"../.."}`).Code)
+
+	job := submitJob(t, do, `{"prompt":"hello","model":"sonnet"}`)
+	assert.Equal(t, models.JobQueued, job.Status)
+	done := waitJob(t, do, job.ID.String(), models.JobSucceeded)
+	assert.Equal(t, "hello | args: -p --output-format stream-json --verbose --model sonnet --allowedTools Read,Write", done.Result)
+	assert.Equal(t, "s-1", done.SessionID)
+	assert.Equal(t, 0.25, done.CostUSD)
+	assert.Equal(t, 2, done.NumTurns)
+
+	log := do("GET", "/api/claude-jobs/"+job.ID.String()+"/log", "").Body.String()
+	assert.Equal(t, 2, strings.Count(log, "\n"))
+	assert.Contains(t, log, `"type":"result"`)
+
+	var seen []string
+	for len(events) > 0 {
+		ev := <-events
+		seen = append(seen, ev.Event+":"+ev.Job.Status)
+	}
+	assert.Equal(t, []string{"status:queued", "status:running", "output:running", "output:running", "status:succeeded"}, seen)
+}
+
+func TestClaudeJobs_PromptIsNotAFlag(t *testing.T) {
+	do, _ := setupClaudeJobsTest(t, 2)
+	job := submitJob(t, do, `{"prompt":"--model opus -r"}`)
+	done := waitJob(t, do, job.ID.String(), models.JobSucceeded)
+	assert.Equal(t, "--model opus -r | args: -p --output-format stream-json --verbose --allowedTools Read,Write", done.Result)
+}
+
+func TestClaudeJobs_Timeout(t *testing.T) {
+	do, _ := setupClaudeJobsTest(t, 1, 300*time.Millisecond)
+	slow := submitJob(t, do, `{"prompt":"slow"}`)
+	next := submitJob(t, do, `{"prompt":"quick"}`)
+
+	failed := waitJob(t, do, slow.ID.String(), models.JobFailed)
+	assert.Equal(t, "timed out after 300ms", failed.Error)
+	waitJob(t, do, next.ID.String(), models.JobSucceeded) // the slot is free again
+}
+
+func TestClaudeJobs_QueueCancelRetry(t *testing.T) {
+	do, _ := setupClaudeJobsTest(t, 1)
+
+	slow := submitJob(t, do, `{"prompt":"slow"}`)
+	waitJob(t, do, slow.ID.String(), models.JobRunning)
+	next := submitJob(t, do, `{"prompt":"fail"}`)
+	time.Sleep(100 * time.Millisecond)
+	waitJob(t, do, next.ID.String(), models.JobQueued) // one at a time
+
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/claude-jobs/"+slow.ID.String()+"/retry", "").Code)
+	require.Equal(t, http.StatusOK, do("POST", "/api/claude-jobs/"+slow.ID.String()+"/cancel", "").Code)
+	waitJob(t, do, slow.ID.String(), models.JobCanceled)
+
+	failed := waitJob(t, do, next.ID.String(), models.JobFailed)
+	assert.Equal(t, "boom", failed.Error)
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/claude-jobs/"+next.ID.String()+"/cancel", "").Code)
+
+	w := do("POST", "/api/claude-jobs/"+next.ID.String()+"/retry", "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var retry models.ClaudeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &retry))
+	require.NotNil(t, retry.RetryOf)
+	assert.Equal(t, next.ID, *retry.RetryOf)
+	waitJob(t, do, retry.ID.String(), models.JobFailed)
+
+	var list []models.ClaudeJob
+	require.NoError(t, json.Unmarshal(do("GET", "/api/claude-jobs?status=failed", "").Body.Bytes(), &list))
+	assert.Len(t, list, 2)
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+const maxPolicyRules = 500
+
+// ClaudePolicyHandler manages the policy rules for claude tool calls.
+// Admin only (see requireAdmin).
+type ClaudePolicyHandler struct {
+	policy *services.PolicyService
+}
+
+func NewClaudePolicyHandler(policy *services.PolicyService) *ClaudePolicyHandler {
+	return &ClaudePolicyHandler{policy: policy}
+}
+
+// policyRuleRequest is the body of CreateRule and UpdateRule; on update,
+// omitted fields keep their values.
+type policyRuleRequest struct {
+	UserID           *string `json:"user_id"` // empty: a global rule
+	Name             *string `json:"name"`
+	Tool             *string `json:"tool"`
+	CommandPattern   *string `json:"command_pattern"`
+	PathGlob         *string `json:"path_glob"`
+	OutsideWorkspace *bool   `json:"outside_workspace"`
+	Action           *string `json:"action"`
+	Reason           *string `json:"reason"`
+	Enabled          *bool   `json:"enabled"`
+}
+
+// apply copies the set fields onto r and validates the result.
+func (req *policyRuleRequest) apply(r *models.ClaudePolicyRule) string {
+	if req.UserID != nil {
+		r.UserID = nil
+		if *req.UserID != "" {
+			id, err := uuid.Parse(*req.UserID)
+			if err != nil {
+				return "Invalid user_id"
+			}
+			var count int64
+			database.DB.Model(&models.User{}).Where("id = ?", id).Count(&count)
+			if count == 0 {
+				return "User not found"
+			}
+			r.UserID = &id
+		}
+	}
+	for _, f := range []struct {
+		src *string
+		dst *string
+	}{
+		{req.Name, &r.Name},
+		{req.Tool, &r.Tool},
+		{req.CommandPattern, &r.CommandPattern},
+		{req.PathGlob, &r.PathGlob},
+		{req.Action, &r.Action},
+		{req.Reason, &r.Reason},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if req.OutsideWorkspace != nil {
+		r.OutsideWorkspace = *req.OutsideWorkspace
+	}
+	if req.Enabled != nil {
+		r.Enabled = *req.Enabled
+	}
+
+	if len(r.Name) > 100 || len(r.Reason) > 500 {
+		return "name must be at most 100 and reason at most 500 characters"
+	}
+	if err := services.ValidatePolicyRule(r); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// ListRules returns the policy rules, global ones first.
+// Query: ?user_id=<id> for one user's rules, ?user_id=global for the global ones.
+func (h *ClaudePolicyHandler) ListRules(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	q := database.DB.Order("user_id IS NOT NULL, created_at")
+	switch userID := c.Query("user_id"); userID {
+	case "":
+	case "global":
+		q = q.Where("user_id IS NULL")
+	default:
+		q = q.Where("user_id = ?", userID)
+	}
+	var rules []models.ClaudePolicyRule
+	if err := q.Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateRule adds a rule. It applies to the next tool call of every claude.
+func (h *ClaudePolicyHandler) CreateRule(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	var req policyRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.ClaudePolicyRule{}).Count(&count)
+	if count >= maxPolicyRules {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many rules"})
+		return
+	}
+
+	rule := models.ClaudePolicyRule{Enabled: true}
+	if msg := req.apply(&rule); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Select("*") so Enabled=false is stored instead of the column default.
+	if err := database.DB.Select("*").Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rule"})
+		return
+	}
+	h.policy.Invalidate()
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule changes the fields present in the body.
+func (h *ClaudePolicyHandler) UpdateRule(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	var req policyRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var rule models.ClaudePolicyRule
+	if err := database.DB.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	if msg := req.apply(&rule); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := database.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update rule"})
+		return
+	}
+	h.policy.Invalidate()
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule removes a rule.
+func (h *ClaudePolicyHandler) DeleteRule(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	result := database.DB.Where("id = ?", c.Param("id")).Delete(&models.ClaudePolicyRule{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	h.policy.Invalidate()
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted"})
+}
+
+// ListDenials returns the tool calls the rules blocked, newest first.
+// Query: ?user_id=, ?rule_id=, ?limit= (default 100, max 1000).
+func (h *ClaudePolicyHandler) ListDenials(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	q := database.DB.Order("created_at DESC").Limit(limit)
+	if userID := c.Query("user_id"); userID != "" {
+		q = q.Where("user_id = ?", userID)
+	}
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		q = q.Where("rule_id = ?", ruleID)
+	}
+	var denials []models.ClaudePolicyDenial
+	if err := q.Find(&denials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list denials"})
+		return
+	}
+	c.JSON(http.StatusOK, denials)
+}
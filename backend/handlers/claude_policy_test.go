@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/database"
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+	"nebulide/utils"
+)
+
+func setupPolicyTest(t *testing.T) (do func(token, method, path, body string) *httptest.ResponseRecorder, adminToken, userToken, hookToken string) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	cfg.WorkspacesRoot = "/workspaces"
+	policy := services.NewPolicyService()
+	hooks := NewHookHandler(cfg, nil, policy, nil)
+	handler := NewClaudePolicyHandler(policy)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/hooks/claude", hooks.HandleClaudeHook)
+	admin := r.Group("/api/admin")
+	admin.Use(middleware.AuthRequired(cfg.JWTSecret))
+	admin.GET("/claude-policy/rules", handler.ListRules)
+	admin.POST("/claude-policy/rules", handler.CreateRule)
+	admin.PUT("/claude-policy/rules/:id", handler.UpdateRule)
+	admin.DELETE("/claude-policy/rules/:id", handler.DeleteRule)
+	admin.GET("/claude-policy/denials", handler.ListDenials)
+
+	user := testutil.CreateTestUser(db)
+	root := models.User{ID: uuid.New(), Username: cfg.AdminUsername, PasswordHash: "x", IsAdmin: true}
+	require.NoError(t, db.Create(&root).Error)
+	hookToken, err := utils.GenerateScopedToken(cfg.JWTSecret, user.ID, user.Username, "claude-hook", time.Hour)
+	require.NoError(t, err)
+
+	do = func(token, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	return do,
+		testutil.GenerateTestToken(cfg, root.ID, root.Username, false),
+		testutil.GenerateTestToken(cfg, user.ID, user.Username, false),
+		hookToken
+}
+
+// preToolUse sends a PreToolUse hook and returns the hook_output.
+func preToolUse(t *testing.T, do func(token, method, path, body string) *httptest.ResponseRecorder, hookToken, tool, input string) string {
+	t.Helper()
+	w := do(hookToken, "POST", "/api/hooks/claude",
+		`{"event":"PreToolUse","session_id":"s1","instance_id":"t1","cwd":"/workspaces/testuser/app","tool":"`+tool+`","tool_input":`+input+`}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		HookOutput json.RawMessage `json:"hook_output"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return string(resp.HookOutput)
+}
+
+func TestClaudePolicy_RulesDecidePreToolUse(t *testing.T) {
+	do, adminToken, userToken, hookToken := setupPolicyTest(t)
+
+	assert.Equal(t, http.StatusForbidden, do(userToken, "POST", "/api/admin/claude-policy/rules", `{"tool":"Bash","action":"deny"}`).Code)
+	for _, body := range []string{
+		`{"action":"deny"}`,
+		`{"tool":"Bash","action":"block"}`,
+		`{"command_pattern":"rm (","action":"deny"}`,
+		`{"tool":"Bash","action":"deny","user_id":"nobody"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(adminToken, "POST", "/api/admin/claude-policy/rules", body).Code, body)
+	}
+
+	w := do(adminToken, "POST", "/api/admin/claude-policy/rules",
+		`{"name":"no .env writes","tool":"Write|Edit","path_glob":".env*","action":"deny","reason":"Secrets are managed outside claude"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var envRule models.ClaudePolicyRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &envRule))
+	assert.Nil(t, envRule.UserID)
+	w = do(adminToken, "POST", "/api/admin/claude-policy/rules",
+		`{"name":"rm -rf outside","command_pattern":"\\brm\\s+-\\w*r","outside_workspace":true,"action":"deny"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = do(adminToken, "POST", "/api/admin/claude-policy/rules", `{"name":"reads","tool":"Read","action":"allow"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"Secrets are managed outside claude"}}`,
+		preToolUse(t, do, hookToken, "Write", `{"file_path":".env","content":"X=1"}`))
+	assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"deny","permissionDecisionReason":"Blocked by Nebulide policy rule \"rm -rf outside\""}}`,
+		preToolUse(t, do, hookToken, "Bash", `{"command":"rm -rf /workspaces"}`))
+	assert.Equal(t, "", preToolUse(t, do, hookToken, "Bash", `{"command":"rm -rf build"}`))
+	assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"allow"}}`,
+		preToolUse(t, do, hookToken, "Read", `{"file_path":"main.go"}`))
+
+	var denials []models.ClaudePolicyDenial
+	require.NoError(t, json.Unmarshal(do(adminToken, "GET", "/api/admin/claude-policy/denials", "").Body.Bytes(), &denials))
+	require.Len(t, denials, 2)
+	assert.Equal(t, "Bash", denials[0].Tool)
+	assert.Equal(t, "Write", denials[1].Tool)
+	assert.Equal(t, envRule.ID, denials[1].RuleID)
+	assert.Equal(t, "/workspaces/testuser/app", denials[1].Cwd)
+
+	// Disabling a rule takes effect on the next call.
+	require.Equal(t, http.StatusOK, do(adminToken, "PUT", "/api/admin/claude-policy/rules/"+envRule.ID.String(), `{"enabled":false}`).Code)
+	assert.Equal(t, "", preToolUse(t, do, hookToken, "Write", `{"file_path":".env"}`))
+
+	var rules []models.ClaudePolicyRule
+	require.NoError(t, json.Unmarshal(do(adminToken, "GET", "/api/admin/claude-policy/rules?user_id=global", "").Body.Bytes(), &rules))
+	require.Len(t, rules, 3)
+	assert.False(t, rules[0].Enabled)
+	assert.Equal(t, http.StatusOK, do(adminToken, "DELETE", "/api/admin/claude-policy/rules/"+envRule.ID.String(), "").Code)
+	assert.Equal(t, http.StatusNotFound, do(adminToken, "DELETE", "/api/admin/claude-policy/rules/"+envRule.ID.String(), "").Code)
+}
+
+func TestClaudePolicy_FailsClosed(t *testing.T) {
+	do, _, _, hookToken := setupPolicyTest(t)
+
+	// The rules can't be loaded: the user is asked, the call isn't let through.
+	sqlDB, err := database.DB.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+	assert.JSONEq(t, `{"hookSpecificOutput":{"hookEventName":"PreToolUse","permissionDecision":"ask","permissionDecisionReason":"Nebulide could not check its policy rules"}}`,
+		preToolUse(t, do, hookToken, "Bash", `{"command":"ls"}`))
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+const maxSchedulesPerUser = 50
+
+type ClaudeSchedulesHandler struct {
+	cfg       *config.Config
+	schedules *services.ClaudeScheduleService
+	files     *FilesHandler // path checks for cwd
+}
+
+func NewClaudeSchedulesHandler(cfg *config.Config, schedules *services.ClaudeScheduleService) *ClaudeSchedulesHandler {
+	return &ClaudeSchedulesHandler{cfg: cfg, schedules: schedules, files: NewFilesHandler(cfg)}
+}
+
+// scheduleRequest is the body of Create and Update; on Update, omitted
+// fields keep their values.
+type scheduleRequest struct {
+	Name         *string `json:"name"`
+	WorkspaceID  *string `json:"workspace_id"`
+	Cron         *string `json:"cron"`
+	Timezone     *string `json:"timezone"`
+	Prompt       *string `json:"prompt"`
+	Cwd          *string `json:"cwd"` // relative to the workspace
+	Model        *string `json:"model"`
+	AllowedTools *string `json:"allowed_tools"`
+	Provider     *string `json:"provider"`
+	Notify       *string `json:"notify"`
+	Enabled      *bool   `json:"enabled"`
+}
+
+// apply copies the set fields (but cwd) onto s and validates the result.
+func (r *scheduleRequest) apply(s *models.ClaudeSchedule) string {
+	if r.Name != nil {
+		s.Name = *r.Name
+	}
+	if r.WorkspaceID != nil {
+		s.WorkspaceID = *r.WorkspaceID
+	}
+	if r.Cron != nil {
+		s.Cron = *r.Cron
+	}
+	if r.Timezone != nil {
+		s.Timezone = *r.Timezone
+	}
+	if r.Prompt != nil {
+		s.Prompt = *r.Prompt
+	}
+	if r.Model != nil {
+		s.Model = *r.Model
+	}
+	if r.AllowedTools != nil {
+		s.AllowedTools = *r.AllowedTools
+	}
+	if r.Provider != nil {
+		s.Provider = *r.Provider
+	}
+	if r.Notify != nil {
+		s.Notify = *r.Notify
+	}
+	if r.Enabled != nil {
+		s.Enabled = *r.Enabled
+	}
+
+	switch {
+	case len(s.Name) > 100 || len(s.WorkspaceID) > 100:
+		return "name and workspace_id must be at most 100 characters"
+	case s.Prompt == "":
+		return "prompt is required"
+	case len(s.Prompt) > maxJobPromptBytes:
+		return "prompt is too long"
+	case s.Model != "" && !jobModelRe.MatchString(s.Model):
+		return "Invalid model"
+	case len(s.AllowedTools) > 1000:
+		return "allowed_tools is too long"
+	case s.Provider != "" && s.Provider != "glm":
+		return "provider must be empty or glm"
+	case s.Notify != models.ScheduleNotifyWS && s.Notify != models.ScheduleNotifyTelegram:
+		return "notify must be ws or telegram"
+	}
+	if _, err := services.NextCronRun(s.Cron, s.Timezone, time.Now()); err != nil {
+		return "Invalid cron: " + err.Error()
+	}
+	return ""
+}
+
+// prepare applies the request, resolves cwd and sets the next run time.
+func (h *ClaudeSchedulesHandler) prepare(c *gin.Context, sched *models.ClaudeSchedule, req *scheduleRequest) bool {
+	if msg := req.apply(sched); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return false
+	}
+	if req.Cwd != nil || sched.WorkDir == "" {
+		workDir, _ := userShellDir(h.cfg, c.GetString("username"))
+		if req.Cwd != nil && *req.Cwd != "" {
+			dir, err := h.files.safePathWithBase(*req.Cwd, workDir)
+			if err != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": "cwd is outside the workspace"})
+				return false
+			}
+			workDir = dir
+		}
+		sched.WorkDir = workDir
+	}
+	sched.NextRunAt = nil
+	if sched.Enabled {
+		next, _ := services.NextCronRun(sched.Cron, sched.Timezone, time.Now())
+		next = next.UTC()
+		sched.NextRunAt = &next
+	}
+	return true
+}
+
+// List returns the current user's schedules (?workspace_id= filters).
+func (h *ClaudeSchedulesHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	q := database.DB.Where("user_id = ?", userID)
+	if ws := c.Query("workspace_id"); ws != "" {
+		q = q.Where("workspace_id = ?", ws)
+	}
+	var schedules []models.ClaudeSchedule
+	q.Order("created_at ASC").Find(&schedules)
+	c.JSON(http.StatusOK, schedules)
+}
+
+// Create adds a schedule; its first run is the next match of cron.
+func (h *ClaudeSchedulesHandler) Create(c *gin.Context) {
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var count int64
+	database.DB.Model(&models.ClaudeSchedule{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxSchedulesPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many schedules"})
+		return
+	}
+
+	sched := models.ClaudeSchedule{UserID: userID, Notify: models.ScheduleNotifyWS, Enabled: true}
+	if !h.prepare(c, &sched, &req) {
+		return
+	}
+	// Select("*") so Enabled=false is stored instead of the column default.
+	if err := database.DB.Select("*").Create(&sched).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
+		return
+	}
+	c.JSON(http.StatusCreated, sched)
+}
+
+// Update changes the fields present in the body and recomputes the next run.
+func (h *ClaudeSchedulesHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	var sched models.ClaudeSchedule
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&sched).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	if !h.prepare(c, &sched, &req) {
+		return
+	}
+	// Not the last_* columns: a run may be recording itself meanwhile.
+	err := database.DB.Model(&sched).Select("workspace_id", "name", "cron", "timezone", "prompt", "work_dir",
+		"model", "allowed_tools", "provider", "notify", "enabled", "next_run_at").Updates(&sched).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, sched)
+}
+
+// Delete removes a schedule. Its runs stay in the job list.
+func (h *ClaudeSchedulesHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Delete(&models.ClaudeSchedule{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+// Run queues a run now, enabled or not; 409 while the previous run is active.
+func (h *ClaudeSchedulesHandler) Run(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	job, err := h.schedules.RunNow(userID, id)
+	switch {
+	case errors.Is(err, services.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+	case errors.Is(err, services.ErrScheduleBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+	default:
+		c.JSON(http.StatusCreated, job)
+	}
+}
+
+// Runs returns the schedule's run history: its jobs, newest first, without
+// logs (read them at /claude-jobs/:id/log). Query: ?limit= (default 50, max 500).
+func (h *ClaudeSchedulesHandler) Runs(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var jobs []models.ClaudeJob
+	if err := database.DB.Omit("log").Where("schedule_id = ? AND user_id = ?", c.Param("id"), userID).
+		Order("created_at DESC").Limit(limit).Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list runs"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
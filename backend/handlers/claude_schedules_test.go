@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/database"
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+func setupSchedulesTest(t *testing.T) (func(method, path, body string) *httptest.ResponseRecorder, *services.ClaudeScheduleService, chan services.ClaudeScheduleEvent) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	jobs := newFakeClaudeJobs(t, cfg, 2)
+	schedules := services.NewClaudeScheduleService(jobs)
+	jobs.OnEvent = func(ev services.ClaudeJobEvent) {
+		if ev.Event == "status" {
+			schedules.JobFinished(ev.Job)
+		}
+	}
+	events := make(chan services.ClaudeScheduleEvent, 100)
+	schedules.OnEvent = func(ev services.ClaudeScheduleEvent) { events <- ev }
+	handler := NewClaudeSchedulesHandler(cfg, schedules)
+	jobsHandler := NewClaudeJobsHandler(cfg, jobs)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/claude-jobs/:id", jobsHandler.Get)
+	protected.POST("/claude-jobs/:id/cancel", jobsHandler.Cancel)
+	protected.GET("/claude-schedules", handler.List)
+	protected.POST("/claude-schedules", handler.Create)
+	protected.PUT("/claude-schedules/:id", handler.Update)
+	protected.DELETE("/claude-schedules/:id", handler.Delete)
+	protected.POST("/claude-schedules/:id/run", handler.Run)
+	protected.GET("/claude-schedules/:id/runs", handler.Runs)
+	return jobsTestRequester(t, db, cfg, r), schedules, events
+}
+
+func TestClaudeSchedules_CRUD(t *testing.T) {
+	do, _, _ := setupSchedulesTest(t)
+
+	for _, body := range []string{
+		`{"cron":"0 9 * * *"}`,
+		`{"cron":"0 25 * * *","prompt":"x"}`,
+		`{"cron":"0 9 * * *","prompt":"x","timezone":"Nowhere/City"}`,
+		`{"cron":"0 9 * * *","prompt":"x","notify":"email"}`,
+		`{"cron":"0 9 * * *","prompt":"x","provider":"openai"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/api/claude-schedules", body).Code, body)
+	}
+	assert.Equal(t, http.StatusForbidden, do("POST", "/api/claude-schedules", `{"cron":"0 9 * * *","prompt":"x","cwd":"../.."}`).Code)
+
+	w := do("POST", "/api/claude-schedules", `{"name":"triage","workspace_id":"ws1","cron":"30 8 * * mon-fri","timezone":"UTC","prompt":"triage TODO.md","notify":"telegram"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var sched models.ClaudeSchedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sched))
+	assert.True(t, sched.Enabled)
+	require.NotNil(t, sched.NextRunAt)
+	assert.True(t, sched.NextRunAt.After(time.Now()))
+	assert.Equal(t, 8, sched.NextRunAt.UTC().Hour())
+	assert.Equal(t, 30, sched.NextRunAt.UTC().Minute())
+	assert.NotEmpty(t, sched.WorkDir)
+
+	w = do("PUT", "/api/claude-schedules/"+sched.ID.String(), `{"enabled":false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list []models.ClaudeSchedule
+	require.NoError(t, json.Unmarshal(do("GET", "/api/claude-schedules?workspace_id=ws1", "").Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.False(t, list[0].Enabled)
+	assert.Nil(t, list[0].NextRunAt)
+	assert.Equal(t, "triage TODO.md", list[0].Prompt)
+	require.NoError(t, json.Unmarshal(do("GET", "/api/claude-schedules?workspace_id=ws2", "").Body.Bytes(), &list))
+	assert.Empty(t, list)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", "/api/claude-schedules/"+sched.ID.String(), "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/claude-schedules/"+sched.ID.String(), "").Code)
+}
+
+func TestClaudeSchedules_RunsWithoutOverlap(t *testing.T) {
+	do, schedules, events := setupSchedulesTest(t)
+
+	w := do("POST", "/api/claude-schedules", `{"name":"nightly","cron":"@daily","prompt":"slow"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var sched models.ClaudeSchedule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &sched))
+
+	// Manual trigger; a second one overlaps and is refused.
+	w = do("POST", "/api/claude-schedules/"+sched.ID.String()+"/run", "")
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var first models.ClaudeJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	require.NotNil(t, first.ScheduleID)
+	assert.Equal(t, sched.ID, *first.ScheduleID)
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/claude-schedules/"+sched.ID.String()+"/run", "").Code)
+
+	// Due while the first run is active: skipped, but moved to its next time.
+	due := time.Now().Add(-time.Minute)
+	require.NoError(t, database.DB.Model(&sched).Update("next_run_at", due.UTC()).Error)
+	schedules.RunDue(time.Now())
+	var reloaded models.ClaudeSchedule
+	require.NoError(t, database.DB.First(&reloaded, "id = ?", sched.ID).Error)
+	require.NotNil(t, reloaded.NextRunAt)
+	assert.True(t, reloaded.NextRunAt.After(time.Now()))
+	assert.Equal(t, first.ID, *reloaded.LastJobID)
+
+	require.Equal(t, http.StatusOK, do("POST", "/api/claude-jobs/"+first.ID.String()+"/cancel", "").Code)
+	waitJob(t, do, first.ID.String(), models.JobCanceled)
+
+	// Due again with the first run over: a new run. Change the prompt so it finishes.
+	require.Equal(t, http.StatusOK, do("PUT", "/api/claude-schedules/"+sched.ID.String(), `{"prompt":"quick"}`).Code)
+	require.NoError(t, database.DB.Model(&sched).Update("next_run_at", due.UTC()).Error)
+	schedules.RunDue(time.Now())
+	require.Eventually(t, func() bool {
+		database.DB.First(&reloaded, "id = ?", sched.ID)
+		return reloaded.LastStatus == models.JobSucceeded
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.NotEqual(t, first.ID, *reloaded.LastJobID)
+
+	// Missed by more than the grace period (backend down): not caught up.
+	require.NoError(t, database.DB.Model(&sched).Update("next_run_at", time.Now().Add(-3*time.Hour).UTC()).Error)
+	schedules.RunDue(time.Now())
+	require.NoError(t, database.DB.First(&reloaded, "id = ?", sched.ID).Error)
+	assert.True(t, reloaded.NextRunAt.After(time.Now()))
+
+	var runs []models.ClaudeJob
+	require.NoError(t, json.Unmarshal(do("GET", "/api/claude-schedules/"+sched.ID.String()+"/runs", "").Body.Bytes(), &runs))
+	require.Len(t, runs, 2)
+	assert.Equal(t, models.JobSucceeded, runs[0].Status)
+	assert.Equal(t, "schedule", runs[0].Source)
+
+	// Events come from their own goroutines, in any order.
+	var summaries []string
+	skipped := 0
+	require.Eventually(t, func() bool {
+		for len(events) > 0 {
+			switch ev := <-events; ev.Event {
+			case "finished":
+				summaries = append(summaries, ev.Summary())
+			case "skipped":
+				skipped++
+			}
+		}
+		return len(summaries) == 2 && skipped == 2 // the refused manual run and the due one
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Contains(t, summaries, "❌ nightly ($0.00)\ncanceled")
+	assert.Contains(t, summaries, "✅ nightly ($0.25)\nquick | args: -p --output-format stream-json --verbose --allowedTools Read,Write")
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+type ExecHandler struct {
+	cfg   *config.Config
+	exec  *services.ExecService
+	files *FilesHandler // path checks for cwd
+}
+
+func NewExecHandler(cfg *config.Config, exec *services.ExecService) *ExecHandler {
+	return &ExecHandler{cfg: cfg, exec: exec, files: NewFilesHandler(cfg)}
+}
+
+type execRequest struct {
+	Command        string `json:"command" binding:"required"`
+	Cwd            string `json:"cwd"` // relative to the workspace
+	Stdin          string `json:"stdin"`
+	TimeoutSec     int    `json:"timeout_sec"`
+	MaxOutputBytes int64  `json:"max_output_bytes"`
+	Provider       string `json:"provider"`
+}
+
+// Run executes a command in the user's workspace, in the same sandbox and
+// environment as their terminals, and streams its output.
+//
+// The response is NDJSON (one services.ExecEvent per line) or, with
+// `Accept: text/event-stream` or ?format=sse, SSE with the event type as the
+// SSE event name. The last event is always "exit".
+func (h *ExecHandler) Run(c *gin.Context) {
+	var req execRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "command is required"})
+		return
+	}
+	if req.TimeoutSec < 0 || req.MaxOutputBytes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timeout_sec and max_output_bytes must not be negative"})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	username := c.GetString("username")
+	workDir, sandboxed := userShellDir(h.cfg, username)
+	if req.Cwd != "" {
+		if dir, err := h.files.safePathWithBase(req.Cwd, workDir); err == nil {
+			workDir = dir
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cwd is outside the workspace"})
+			return
+		}
+	}
+
+	sse := c.Query("format") == "sse" || strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+	started := false
+	emit := func(ev services.ExecEvent) {
+		if !started {
+			started = true
+			if sse {
+				c.Header("Content-Type", "text/event-stream")
+			} else {
+				c.Header("Content-Type", "application/x-ndjson")
+			}
+			c.Header("Cache-Control", "no-cache")
+			c.Header("X-Accel-Buffering", "no")
+			c.Status(http.StatusOK)
+		}
+		data, _ := json.Marshal(ev)
+		if sse {
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", ev.Type, data)
+		} else {
+			c.Writer.Write(append(data, '\n'))
+		}
+		c.Writer.Flush()
+	}
+
+	run, err := h.exec.Run(c.Request.Context(), services.ExecRequest{
+		UserID:         userID,
+		Username:       username,
+		Command:        req.Command,
+		WorkDir:        workDir,
+		Sandboxed:      sandboxed,
+		Env:            userShellEnv(h.cfg, userID, username, "exec", req.Provider),
+		Stdin:          req.Stdin,
+		Source:         "api",
+		Timeout:        time.Duration(req.TimeoutSec) * time.Second,
+		MaxOutputBytes: req.MaxOutputBytes,
+	}, emit)
+	if err != nil && !started {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrExecLimit) {
+			status = http.StatusTooManyRequests
+		}
+		resp := gin.H{"error": err.Error()}
+		if run != nil {
+			resp["id"] = run.ID
+		}
+		c.JSON(status, resp)
+	}
+}
+
+// List returns the user's exec history, newest first, without output.
+// Query: ?status=, ?limit= (default 50, max 500), ?offset=.
+func (h *ExecHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	q := database.DB.Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var runs []models.ExecRun
+	if err := q.Omit("output").Order("started_at DESC").Limit(limit).Offset(max(offset, 0)).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// Get returns one run with the tail of its output.
+func (h *ExecHandler) Get(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	var run models.ExecRun
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&run).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+func setupExecTestRouter(t *testing.T) (*gin.Engine, *testutil.TestContext) {
+	if runtime.GOOS == "windows" {
+		t.Skip("exec tests use sh")
+	}
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	cfg.ClaudeWorkingDir = t.TempDir()
+	cfg.WorkspacesRoot = t.TempDir()
+	handler := NewExecHandler(cfg, services.NewExecService(services.NewTerminalService()))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	{
+		protected.POST("/exec", handler.Run)
+		protected.GET("/exec", handler.List)
+		protected.GET("/exec/:id", handler.Get)
+	}
+	return r, &testutil.TestContext{DB: db, Cfg: cfg}
+}
+
+// execAsAdmin runs a command as the (unsandboxed) admin user and returns the
+// raw response.
+func execAsAdmin(t *testing.T, r *gin.Engine, tc *testutil.TestContext, userID uuid.UUID, body map[string]interface{}, accept string) *httptest.ResponseRecorder {
+	token := testutil.GenerateTestToken(tc.Cfg, userID, tc.Cfg.AdminUsername, false)
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/exec", bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func parseExecEvents(t *testing.T, body string) []services.ExecEvent {
+	var events []services.ExecEvent
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		var ev services.ExecEvent
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &ev), sc.Text())
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestExec_StreamsOutputAndExitCode(t *testing.T) {
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+
+	w := execAsAdmin(t, router, tc, user.ID, map[string]interface{}{
+		"command": "echo out; echo err >&2; read x; echo \"in=$x\"; exit 3",
+		"stdin":   "hello\n",
+	}, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	events := parseExecEvents(t, w.Body.String())
+	require.GreaterOrEqual(t, len(events), 2)
+	assert.Equal(t, "start", events[0].Type)
+	last := events[len(events)-1]
+	assert.Equal(t, "exit", last.Type)
+	assert.Equal(t, models.ExecExited, last.Status)
+	require.NotNil(t, last.ExitCode)
+	assert.Equal(t, 3, *last.ExitCode)
+
+	var stdout, stderr string
+	for _, ev := range events {
+		switch ev.Type {
+		case "stdout":
+			stdout += ev.Data
+		case "stderr":
+			stderr += ev.Data
+		}
+	}
+	assert.Equal(t, "out\nin=hello\n", stdout)
+	assert.Equal(t, "err\n", stderr)
+
+	// History
+	token := testutil.GenerateTestToken(tc.Cfg, user.ID, tc.Cfg.AdminUsername, false)
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/exec", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var runs []models.ExecRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+	require.Len(t, runs, 1)
+	assert.Equal(t, last.ID, runs[0].ID.String())
+	assert.Equal(t, int64(len("out\nin=hello\nerr\n")), runs[0].OutputBytes)
+	assert.Empty(t, runs[0].Output)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/exec/"+last.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var run models.ExecRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+	assert.Contains(t, run.Output, "in=hello")
+	require.NotNil(t, run.ExitCode)
+	assert.Equal(t, 3, *run.ExitCode)
+}
+
+func TestExec_SplitAndTruncatedUTF8(t *testing.T) {
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+
+	// "ж" (\320\266) split across two writes, then a lone lead byte at the end.
+	w := execAsAdmin(t, router, tc, user.ID, map[string]interface{}{
+		"command": `printf '\320'; sleep 0.2; printf '\266\320'`,
+	}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var stdout []string
+	for _, ev := range parseExecEvents(t, w.Body.String()) {
+		if ev.Type == "stdout" {
+			stdout = append(stdout, ev.Data)
+		}
+	}
+	assert.Equal(t, []string{"ж", "\uFFFD"}, stdout)
+}
+
+func TestExec_Timeout(t *testing.T) {
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+
+	w := execAsAdmin(t, router, tc, user.ID, map[string]interface{}{
+		"command":     "echo before; sleep 30",
+		"timeout_sec": 1,
+	}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	events := parseExecEvents(t, w.Body.String())
+	last := events[len(events)-1]
+	assert.Equal(t, models.ExecTimeout, last.Status)
+	assert.Contains(t, last.Error, "timed out")
+	assert.Less(t, last.DurationMs, int64(10000))
+}
+
+func TestExec_OutputLimit(t *testing.T) {
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+
+	w := execAsAdmin(t, router, tc, user.ID, map[string]interface{}{
+		"command":          "yes",
+		"max_output_bytes": 1000,
+	}, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	events := parseExecEvents(t, w.Body.String())
+	last := events[len(events)-1]
+	assert.Equal(t, models.ExecOutputLimit, last.Status)
+	assert.Equal(t, int64(1000), last.OutputBytes)
+}
+
+func TestExec_SSE(t *testing.T) {
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+
+	w := execAsAdmin(t, router, tc, user.ID, map[string]interface{}{"command": "echo hi"}, "text/event-stream")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "event: stdout\ndata: {\"type\":\"stdout\",\"data\":\"hi\\n\"}\n\n")
+	assert.Contains(t, w.Body.String(), "event: exit\n")
+}
+
+func TestExec_RejectsCwdOutsideWorkspace(t *testing.T) {
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+
+	w := execAsAdmin(t, router, tc, user.ID, map[string]interface{}{"command": "pwd", "cwd": "../.."}, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestExec_SandboxedUserFailsWithoutSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox is Linux-only")
+	}
+	router, tc := setupExecTestRouter(t)
+	user := testutil.CreateTestUser(tc.DB)
+	token := testutil.GenerateTestToken(tc.Cfg, user.ID, user.Username, false)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/exec", strings.NewReader(`{"command":"id"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "sandbox")
+	var runs []models.ExecRun
+	tc.DB.Find(&runs)
+	require.Len(t, runs, 1)
+	assert.Equal(t, models.ExecFailed, runs[0].Status)
+}
@@ -18,6 +18,7 @@ import (
 	"nebulide/config"
 	"nebulide/database"
 	"nebulide/models"
+	"nebulide/services"
 	"nebulide/utils"
 )
 
@@ -122,11 +123,14 @@ func GetLiveSession(instanceID string) (sessionID, cwd, transcriptPath string, o
 // Auth: scoped JWT with purpose "claude-hook" (injected as NEBULIDE_HOOK_TOKEN env var).
 
 type HookHandler struct {
-	cfg *config.Config
+	cfg       *config.Config
+	approvals *services.ApprovalService
+	policy    *services.PolicyService
+	events    *services.ClaudeEventService
 }
 
-func NewHookHandler(cfg *config.Config) *HookHandler {
-	return &HookHandler{cfg: cfg}
+func NewHookHandler(cfg *config.Config, approvals *services.ApprovalService, policy *services.PolicyService, events *services.ClaudeEventService) *HookHandler {
+	return &HookHandler{cfg: cfg, approvals: approvals, policy: policy, events: events}
 }
 
 type ClaudeHookEvent struct {
@@ -192,6 +196,19 @@ func (h *HookHandler) HandleClaudeHook(c *gin.Context) {
 	log.Printf("[Hook] event=%s instance=%s tool=%s session=%s user=%s",
 		event.Event, event.InstanceID, event.Tool, event.SessionID, claims.Username)
 
+	// Persist to the timeline: unlike the WS push below, it is there later too.
+	if h.events != nil {
+		h.events.Record(&models.ClaudeEvent{
+			UserID:     claims.UserID,
+			InstanceID: event.InstanceID,
+			SessionID:  event.SessionID,
+			Event:      event.Event,
+			Tool:       event.Tool,
+			Cwd:        event.CWD,
+			Status:     event.Status,
+		}, event.ToolInput)
+	}
+
 	// Track instance → live session so the chat-view wrapper can resolve the JSONL.
 	// On SessionEnd, CLEAR the entry (claude exited) — иначе переиспользованный терминал
 	// держит старую сессию и резолвер отдаёт древний чат вместо открытого.
@@ -232,6 +249,31 @@ func (h *HookHandler) HandleClaudeHook(c *gin.Context) {
 		database.RDB.Publish(context.Background(), channel, string(data))
 	}
 
+	// PreToolUse: the policy rules decide before claude's own permission check.
+	if event.Event == "PreToolUse" && h.policy != nil {
+		workDir, _ := userShellDir(h.cfg, claims.Username)
+		decision := h.policy.Evaluate(services.PolicyCall{
+			UserID:     claims.UserID,
+			InstanceID: event.InstanceID,
+			SessionID:  event.SessionID,
+			Cwd:        event.CWD,
+			Workspace:  workDir,
+			Tool:       event.Tool,
+			ToolInput:  event.ToolInput,
+		})
+		if decision != nil {
+			c.JSON(http.StatusOK, gin.H{"ok": true, "hook_output": preToolUseDecision(decision)})
+			return
+		}
+	}
+
+	// PermissionRequest: hold the hook until the user decides from any device;
+	// the Telegram prompt with buttons replaces the plain notification.
+	if event.Event == "PermissionRequest" && h.approvals != nil && h.cfg.ClaudeApprovalTimeout > 0 {
+		c.JSON(http.StatusOK, gin.H{"ok": true, "hook_output": h.awaitApproval(c, claims.UserID, event)})
+		return
+	}
+
 	// Opt-in Telegram notification: claude finished a turn or needs the user.
 	switch event.Event {
 	case "Stop", "SessionEnd", "Notification", "PermissionRequest":
@@ -241,6 +283,74 @@ func (h *HookHandler) HandleClaudeHook(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
 
+// awaitApproval blocks until the permission prompt is decided, times out or
+// the hook disconnects, and returns the hook output for claude.
+func (h *HookHandler) awaitApproval(c *gin.Context, userID uuid.UUID, event ClaudeHookEvent) map[string]interface{} {
+	approval := &models.ClaudeApproval{
+		UserID:     userID,
+		InstanceID: event.InstanceID,
+		SessionID:  event.SessionID,
+		Cwd:        event.CWD,
+		Tool:       event.Tool,
+	}
+	if len(event.ToolInput) > 0 {
+		approval.ToolInput, _ = json.Marshal(event.ToolInput)
+	}
+	resolved, err := h.approvals.Request(c.Request.Context(), approval, h.cfg.ClaudeApprovalTimeout)
+	if err != nil {
+		log.Printf("[Hook] approval request failed: %v", err)
+		return nil
+	}
+	return permissionDecision(resolved, h.cfg.ClaudeApprovalDefault)
+}
+
+// permissionDecision is the PermissionRequest hook output Claude Code acts
+// on. nil (no decision) makes claude ask in the terminal as usual: after a
+// timeout with the "ask" default, or when nobody is waiting any more.
+func permissionDecision(a *models.ClaudeApproval, fallback string) map[string]interface{} {
+	behavior, message := "", a.Message
+	switch a.Status {
+	case models.ApprovalAllowed:
+		behavior = "allow"
+	case models.ApprovalDenied:
+		behavior = "deny"
+		if message == "" {
+			message = "Denied by the user (" + a.DecidedVia + ")"
+		}
+	case models.ApprovalExpired:
+		if fallback == "allow" || fallback == "deny" {
+			behavior, message = fallback, "No decision in time"
+		}
+	}
+	if behavior == "" {
+		return nil
+	}
+	decision := map[string]interface{}{"behavior": behavior}
+	if behavior == "deny" {
+		decision["message"] = message
+	}
+	return map[string]interface{}{
+		"hookSpecificOutput": map[string]interface{}{
+			"hookEventName": "PermissionRequest",
+			"decision":      decision,
+		},
+	}
+}
+
+// preToolUseDecision is the PreToolUse hook output Claude Code enforces:
+// allow skips the permission prompt, ask forces it, deny blocks the call and
+// tells claude the reason.
+func preToolUseDecision(d *services.PolicyDecision) map[string]interface{} {
+	output := map[string]interface{}{
+		"hookEventName":      "PreToolUse",
+		"permissionDecision": d.Action,
+	}
+	if d.Reason != "" {
+		output["permissionDecisionReason"] = d.Reason
+	}
+	return map[string]interface{}{"hookSpecificOutput": output}
+}
+
 // forwardStatus публикует живой контекст/токены/стоимость (из statusLine) в чат через
 // Redis (тип claude_status). Дебаунс на инстанс — statusLine срабатывает часто.
 func (h *HookHandler) forwardStatus(userID uuid.UUID, event ClaudeHookEvent) {
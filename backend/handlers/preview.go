@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/config"
+	"nebulide/services"
+	"nebulide/utils"
+)
+
+const (
+	previewCookie = "nebulide-preview-auth"
+	// previewTokenTTL bounds a preview link and the cookie it leaves behind.
+	previewTokenTTL = 2 * time.Hour
+)
+
+// previewPurpose scopes a token to the preview of one port: it opens
+// /preview/<port>/ and nothing else, neither other ports nor the API.
+func previewPurpose(port int) string {
+	return "preview:" + strconv.Itoa(port)
+}
+
+// PreviewAuthMiddleware authenticates the /preview/* proxy with a token from
+// PreviewHandler.Token: open /preview/<port>/?token=<token> once and a cookie
+// scoped to that port carries the dev server's own requests. Previews are
+// sandboxed to an opaque origin (see middleware.SecurityHeaders), whose
+// requests browsers treat as cross-site, hence SameSite=None — which lets any
+// site send the cookie too, so it never holds more than that one port's
+// preview token. Regular access tokens are refused here.
+func PreviewAuthMiddleware(jwtSecret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		port, err := strconv.Atoi(c.Param("port"))
+		if err != nil || port < 1 || port > 65535 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid port"})
+			c.Abort()
+			return
+		}
+		cookiePath := "/preview/" + strconv.Itoa(port)
+
+		var tokenString string
+		var setCookie bool
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			tokenString = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if tokenString == "" {
+			if t := c.Query("token"); t != "" {
+				tokenString = t
+				setCookie = true
+			}
+		}
+		if tokenString == "" {
+			if cookie, err := c.Cookie(previewCookie); err == nil {
+				tokenString = cookie
+			}
+		}
+		if tokenString == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+			c.Abort()
+			return
+		}
+
+		claims, err := utils.ParseToken(jwtSecret, tokenString)
+		if err != nil || claims.Purpose != previewPurpose(port) {
+			c.SetSameSite(http.SameSiteNoneMode)
+			c.SetCookie(previewCookie, "", -1, cookiePath, "", true, true)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// The token itself goes into the cookie: it expires with the link.
+		if setCookie {
+			c.SetSameSite(http.SameSiteNoneMode)
+			c.SetCookie(previewCookie, tokenString, int(time.Until(claims.ExpiresAt.Time).Seconds()), cookiePath, "", true, true)
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Next()
+	}
+}
+
+type PreviewHandler struct {
+	cfg   *config.Config
+	ports *services.PortService
+}
+
+func NewPreviewHandler(cfg *config.Config, ports *services.PortService) *PreviewHandler {
+	return &PreviewHandler{cfg: cfg, ports: ports}
+}
+
+// Ports lists the TCP ports listened on by the current user's terminals.
+func (h *PreviewHandler) Ports(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	ports := h.ports.UserPorts(userID.String())
+	if ports == nil {
+		ports = []services.ListeningPort{}
+	}
+	c.JSON(http.StatusOK, ports)
+}
+
+// Token mints the link that opens one of the user's ports in a preview.
+func (h *PreviewHandler) Token(c *gin.Context) {
+	port, err := strconv.Atoi(c.Param("port"))
+	if err != nil || port < 1 || port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid port"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+	username, _ := c.Get("username")
+	if _, ok := h.ports.Lookup(userID.String(), port); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Port is not open in your terminals"})
+		return
+	}
+
+	name, _ := username.(string)
+	token, err := utils.GenerateScopedToken(h.cfg.JWTSecret, userID, name, previewPurpose(port), previewTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":       token,
+		"preview_url": "/preview/" + strconv.Itoa(port) + "/?token=" + token,
+	})
+}
+
+// Proxy reverse-proxies /preview/:port/*path to a port listened on by one of
+// the user's terminals (a dev server started there), WebSockets included.
+// Ports of other users' processes are indistinguishable from closed ones.
+//
+// Upstream sees Host "localhost:<port>" (dev servers reject unknown hosts)
+// and X-Forwarded-Prefix; apps that emit absolute paths need their base path
+// set to /preview/<port>/.
+func (h *PreviewHandler) Proxy(c *gin.Context) {
+	port, err := strconv.Atoi(c.Param("port"))
+	if err != nil || port < 1 || port > 65535 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid port"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+	lp, ok := h.ports.Lookup(userID.String(), port)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Port is not open in your terminals"})
+		return
+	}
+
+	target := lp.DialAddr()
+	host := "localhost:" + strconv.Itoa(port)
+	prefix := "/preview/" + strconv.Itoa(port)
+	path := c.Param("path")
+	if path == "" {
+		path = "/"
+	}
+	q := c.Request.URL.Query()
+	q.Del("token")
+	stripPreviewAuth(c.Request)
+
+	if strings.EqualFold(c.Request.Header.Get("Upgrade"), "websocket") {
+		proxyWebSocket(c, target, path, q.Encode(), host)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = target
+			req.URL.Path = path
+			req.URL.RawPath = ""
+			req.URL.RawQuery = q.Encode()
+			req.Host = host
+			req.Header.Set("X-Forwarded-Prefix", prefix)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			// Keep redirects inside the preview
+			if loc := resp.Header.Get("Location"); loc != "" {
+				loc = strings.TrimPrefix(loc, "http://"+host)
+				if strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+					resp.Header.Set("Location", prefix+loc)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// stripPreviewAuth keeps the user's credentials away from the dev server.
+func stripPreviewAuth(req *http.Request) {
+	req.Header.Del("Authorization")
+	cookies := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, ck := range cookies {
+		if ck.Name != previewCookie {
+			req.AddCookie(ck)
+		}
+	}
+}
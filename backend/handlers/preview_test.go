@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/services"
+	"nebulide/testutil"
+	"nebulide/utils"
+)
+
+func TestPreview_AuthAndOwnership(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewPreviewHandler(cfg, services.NewPortService())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	group := r.Group("/preview")
+	group.Use(PreviewAuthMiddleware(cfg.JWTSecret))
+	group.Any("/:port/*path", handler.Proxy)
+	get := func(path, bearer string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("/preview/5173/", "").Code)
+
+	// The user's regular access token doesn't open previews, in any form.
+	user := testutil.CreateTestUser(db)
+	access := testutil.GenerateTestToken(cfg, user.ID, user.Username, false)
+	assert.Equal(t, http.StatusUnauthorized, get("/preview/5173/?token="+access, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get("/preview/5173/", access).Code)
+
+	// Nor does the preview token of another port.
+	token, err := utils.GenerateScopedToken(cfg.JWTSecret, user.ID, user.Username, previewPurpose(5173), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, get("/preview/3000/?token="+token, "").Code)
+
+	// A port that no terminal of the user listens on looks closed; the first
+	// ?token= request still leaves a cookie for that port behind.
+	w := get("/preview/5173/index.html?token="+token, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	cookie := w.Header().Get("Set-Cookie")
+	assert.Contains(t, cookie, previewCookie+"="+token)
+	assert.Contains(t, cookie, "Path=/preview/5173;")
+	assert.Contains(t, cookie, "SameSite=None")
+
+	assert.Equal(t, http.StatusBadRequest, get("/preview/99999/", token).Code)
+}
+
+func TestPreview_Token(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewPreviewHandler(cfg, services.NewPortService())
+	user := testutil.CreateTestUser(db)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/ports/:port/preview-token", func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		handler.Token(c)
+	})
+
+	for path, want := range map[string]int{
+		"/api/ports/5173/preview-token": http.StatusNotFound, // not one of the user's ports
+		"/api/ports/0/preview-token":    http.StatusBadRequest,
+		"/api/ports/x/preview-token":    http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, nil)
+		r.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, path)
+	}
+}
+
+func TestStripPreviewAuth(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer x")
+	req.Header.Set("Cookie", previewCookie+"=jwt; session=app")
+	stripPreviewAuth(req)
+	assert.Empty(t, req.Header.Get("Authorization"))
+	assert.Equal(t, "session=app", req.Header.Get("Cookie"))
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+const maxWatchersPerUser = 50
+
+type ProcessWatchersHandler struct {
+	cfg      *config.Config
+	watchers *services.ProcessWatchService
+}
+
+func NewProcessWatchersHandler(cfg *config.Config, watchers *services.ProcessWatchService) *ProcessWatchersHandler {
+	return &ProcessWatchersHandler{cfg: cfg, watchers: watchers}
+}
+
+// watcherRequest is the body of Create and Update; on Update, omitted fields
+// keep their values.
+type watcherRequest struct {
+	Name    *string `json:"name"`
+	Pattern *string `json:"pattern"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// apply copies the set fields onto w and validates the result.
+func (r *watcherRequest) apply(w *models.ProcessWatcher) string {
+	if r.Name != nil {
+		w.Name = *r.Name
+	}
+	if r.Pattern != nil {
+		w.Pattern = *r.Pattern
+	}
+	if r.Enabled != nil {
+		w.Enabled = *r.Enabled
+	}
+
+	if len(w.Name) > 100 {
+		return "name must be at most 100 characters"
+	}
+	if _, err := services.CompileWatcherPattern(w.Pattern); err != nil {
+		return "Invalid pattern: " + err.Error()
+	}
+	return ""
+}
+
+// List returns the current user's process watchers.
+func (h *ProcessWatchersHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var watchers []models.ProcessWatcher
+	database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&watchers)
+	c.JSON(http.StatusOK, watchers)
+}
+
+// Create adds a process watcher. Processes already running are reported as
+// started on the next poll.
+func (h *ProcessWatchersHandler) Create(c *gin.Context) {
+	var req watcherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var count int64
+	database.DB.Model(&models.ProcessWatcher{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxWatchersPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many watchers"})
+		return
+	}
+
+	watcher := models.ProcessWatcher{UserID: userID, Enabled: true}
+	if msg := req.apply(&watcher); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Select("*") so Enabled=false is stored instead of the column default.
+	if err := database.DB.Select("*").Create(&watcher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create watcher"})
+		return
+	}
+	h.watchers.Invalidate(userID.String())
+	c.JSON(http.StatusCreated, watcher)
+}
+
+// Update changes the fields present in the body.
+func (h *ProcessWatchersHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req watcherRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var watcher models.ProcessWatcher
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&watcher).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watcher not found"})
+		return
+	}
+	if msg := req.apply(&watcher); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := database.DB.Save(&watcher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update watcher"})
+		return
+	}
+	h.watchers.Invalidate(userID.String())
+	c.JSON(http.StatusOK, watcher)
+}
+
+// Delete removes a process watcher.
+func (h *ProcessWatchersHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Delete(&models.ProcessWatcher{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Watcher not found"})
+		return
+	}
+	h.watchers.Invalidate(userID.String())
+	c.JSON(http.StatusOK, gin.H{"message": "Watcher deleted"})
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+func TestProcessWatchers_CRUD(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewProcessWatchersHandler(cfg, services.NewProcessWatchService())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/process-watchers", handler.List)
+	protected.POST("/process-watchers", handler.Create)
+	protected.PUT("/process-watchers/:id", handler.Update)
+	protected.DELETE("/process-watchers/:id", handler.Delete)
+
+	user := testutil.CreateTestUser(db)
+	token := testutil.GenerateTestToken(cfg, user.ID, user.Username, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/process-watchers", `{"name":"dev server","pattern":"npm run dev"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.ProcessWatcher
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, created.Enabled)
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/api/process-watchers", `{"pattern":"[bad"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/api/process-watchers/"+created.ID.String(), `{"pattern":""}`).Code)
+
+	w = do("PUT", "/api/process-watchers/"+created.ID.String(), `{"pattern":"^(pytest|go test)\\b"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var list []models.ProcessWatcher
+	require.NoError(t, json.Unmarshal(do("GET", "/api/process-watchers", "").Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, `^(pytest|go test)\b`, list[0].Pattern)
+	assert.Equal(t, "dev server", list[0].Name)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", "/api/process-watchers/"+created.ID.String(), "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/process-watchers/"+created.ID.String(), "").Code)
+}
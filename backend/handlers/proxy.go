@@ -52,7 +52,7 @@ func CodeServerAuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		}
 
 		claims, err := utils.ParseToken(jwtSecret, tokenString)
-		if err != nil || claims.Partial {
+		if err != nil || claims.Partial || claims.Purpose != "" {
 			// Clear stale cookie
 			c.SetSameSite(http.SameSiteLaxMode)
 			c.SetCookie("nebulide-code-auth", "", -1, "/code", "", true, true)
@@ -156,7 +156,7 @@ func CodeServerProxy() gin.HandlerFunc {
 			}
 			q := c.Request.URL.Query()
 			q.Del("token")
-			proxyWebSocket(c, targetHost, path, q.Encode())
+			proxyWebSocket(c, targetHost, path, q.Encode(), "")
 			return
 		}
 
@@ -175,7 +175,8 @@ func CodeServerProxy() gin.HandlerFunc {
 //   The browser WebSocket sees the connection close without an upgrade response → 1006.
 //
 // Fix: hijack both sides manually, forward the handshake, then copy frames bidirectionally.
-func proxyWebSocket(c *gin.Context, targetHost, path, rawQuery string) {
+// host overrides the Host header sent upstream ("" keeps the client's).
+func proxyWebSocket(c *gin.Context, targetHost, path, rawQuery, host string) {
 	// Hijack the client TCP connection from Gin
 	hj, ok := c.Writer.(http.Hijacker)
 	if !ok {
@@ -202,6 +203,9 @@ func proxyWebSocket(c *gin.Context, targetHost, path, rawQuery string) {
 	// DNS-rebinding check (Host vs Origin match) passes even with auth: none.
 	req := c.Request.Clone(c.Request.Context())
 	req.URL = &url.URL{Path: path, RawQuery: rawQuery}
+	if host != "" {
+		req.Host = host
+	}
 	if err := req.Write(backendConn); err != nil {
 		return
 	}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+// SSHGateway lets users reach their terminals with plain ssh:
+//
+//	ssh -t alice@host            # terminal "default", like the browser's first tab
+//	ssh -t alice@host <instance> # a terminal by instanceId
+//	ssh alice@host ls            # list running terminals
+//
+// The login name must be the owner of the public key (see SSHKey). A
+// connection attaches to the same session as /ws/terminal, so browser tabs
+// and SSH share one live PTY; shells start with the same sandbox, workdir
+// and env as from the browser.
+type SSHGateway struct {
+	cfg      *config.Config
+	terminal *services.TerminalService
+	server   *ssh.ServerConfig
+}
+
+func NewSSHGateway(cfg *config.Config, terminal *services.TerminalService) (*SSHGateway, error) {
+	signer, err := loadOrCreateHostKey(cfg.SSHHostKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("host key: %w", err)
+	}
+	g := &SSHGateway{cfg: cfg, terminal: terminal}
+	g.server = &ssh.ServerConfig{
+		PublicKeyCallback: g.authenticate,
+		ServerVersion:     "SSH-2.0-Nebulide",
+	}
+	g.server.AddHostKey(signer)
+	return g, nil
+}
+
+// loadOrCreateHostKey reads the gateway's host key, generating an ed25519
+// key on first start.
+func loadOrCreateHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "nebulide ssh gateway")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		return nil, err
+	}
+	log.Printf("[SSH] generated host key %s", path)
+	return ssh.NewSignerFromKey(priv)
+}
+
+// ListenAndServe accepts SSH connections on addr until the listener fails.
+func (g *SSHGateway) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("[SSH] gateway listening on %s", addr)
+	return g.Serve(ln)
+}
+
+// Serve accepts SSH connections on ln.
+func (g *SSHGateway) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go g.serveConn(conn)
+	}
+}
+
+// authenticate accepts a key registered by the user named in the login.
+func (g *SSHGateway) authenticate(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	var k models.SSHKey
+	err := database.DB.Preload("User").Where("fingerprint = ?", ssh.FingerprintSHA256(key)).First(&k).Error
+	if err != nil || k.User.Username != meta.User() {
+		return nil, errors.New("unknown key")
+	}
+	return &ssh.Permissions{Extensions: map[string]string{
+		"key-id":  k.ID.String(),
+		"user-id": k.UserID.String(),
+	}}, nil
+}
+
+func (g *SSHGateway) serveConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second)) // handshake
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, g.server)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	userID, _ := uuid.Parse(sconn.Permissions.Extensions["user-id"])
+	database.DB.Model(&models.SSHKey{}).Where("id = ?", sconn.Permissions.Extensions["key-id"]).
+		Update("last_used_at", time.Now())
+	log.Printf("[SSH] %s logged in from %s", sconn.User(), sconn.RemoteAddr())
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go g.serveSession(ch, chReqs, userID, sconn.User())
+	}
+}
+
+// SSH request payloads (RFC 4254).
+type sshPtyRequest struct {
+	Term          string
+	Columns, Rows uint32
+	Width, Height uint32
+	Modes         string
+}
+
+type sshWindowChange struct {
+	Columns, Rows uint32
+	Width, Height uint32
+}
+
+type sshExecRequest struct {
+	Command string
+}
+
+// serveSession handles the requests of one session channel: pty-req,
+// window-change and a shell or exec that attaches the terminal.
+func (g *SSHGateway) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request, userID uuid.UUID, username string) {
+	var pty *sshPtyRequest
+	sessionKey := ""
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var p sshPtyRequest
+			ok := ssh.Unmarshal(req.Payload, &p) == nil && sessionKey == ""
+			if ok {
+				pty = &p
+			}
+			req.Reply(ok, nil)
+		case "window-change":
+			var wc sshWindowChange
+			if ssh.Unmarshal(req.Payload, &wc) != nil {
+				continue
+			}
+			if pty != nil {
+				pty.Columns, pty.Rows = wc.Columns, wc.Rows
+			}
+			if sessionKey != "" {
+				g.terminal.Resize(sessionKey, uint16(wc.Rows), uint16(wc.Columns))
+			}
+		case "shell", "exec":
+			if sessionKey != "" {
+				req.Reply(false, nil)
+				continue
+			}
+			var cmd sshExecRequest
+			if req.Type == "exec" && ssh.Unmarshal(req.Payload, &cmd) != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			instanceID := cmd.Command
+			if instanceID == "" {
+				instanceID = "default"
+			}
+			switch {
+			case instanceID == "ls":
+				g.listTerminals(ch, userID)
+				continue
+			case !validInstanceID(instanceID):
+				g.fail(ch, "invalid terminal id")
+				continue
+			case pty == nil:
+				g.fail(ch, "a terminal is required, connect with ssh -t")
+				continue
+			}
+			sessionKey = "term:" + userID.String() + ":" + instanceID
+			go g.attach(ch, userID, username, instanceID, *pty)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// attach connects the channel to the terminal's session until either side
+// goes away.
+func (g *SSHGateway) attach(ch ssh.Channel, userID uuid.UUID, username, instanceID string, pty sshPtyRequest) {
+	defer ch.Close()
+	sessionKey := "term:" + userID.String() + ":" + instanceID
+
+	workDir, sandboxed := userShellDir(g.cfg, username)
+	extraEnv := userShellEnv(g.cfg, userID, username, instanceID, "")
+	prev, had := g.terminal.Get(sessionKey)
+	fresh := !had || !prev.IsAlive()
+	if fresh {
+		if cwd, ok := hibernatedCwd(userID, instanceID, workDir, sandboxed); ok {
+			workDir = cwd
+		}
+	}
+	ts, err := g.terminal.GetOrCreate(sessionKey, workDir, sandboxed, username, extraEnv, services.ShellOptions{})
+	if err != nil {
+		log.Printf("[SSH] failed to create session: %v (key=%s)", err, sessionKey)
+		fmt.Fprintf(ch.Stderr(), "nebulide: %v\r\n", err)
+		sendExitStatus(ch, 1)
+		return
+	}
+	touchTerminalInstance(userID, instanceID, "", ts.WorkDir, "", fresh)
+	if pty.Columns > 0 && pty.Rows > 0 {
+		g.terminal.Resize(sessionKey, uint16(pty.Rows), uint16(pty.Columns))
+	}
+
+	log.Printf("[SSH] attach key=%s", sessionKey)
+	ts.AddWriter(ch, ch, "")
+	defer ts.RemoveWriter(ch)
+
+	input := make(chan struct{})
+	go func() {
+		io.Copy(ts.Pty, ch)
+		close(input)
+	}()
+	select {
+	case <-input:
+		log.Printf("[SSH] client detached key=%s", sessionKey)
+	case <-ts.Done:
+		ts.DrainWriter(ch, 2*time.Second)
+		sendExitStatus(ch, 0)
+		log.Printf("[SSH] shell exited key=%s", sessionKey)
+	}
+}
+
+// listTerminals prints the user's running terminals.
+func (g *SSHGateway) listTerminals(ch ssh.Channel, userID uuid.UUID) {
+	defer ch.Close()
+	var names []models.TerminalInstance
+	database.DB.Where("user_id = ?", userID).Find(&names)
+	nameOf := make(map[string]string, len(names))
+	for _, t := range names {
+		nameOf[t.InstanceID] = t.Name
+	}
+	sessions := g.terminal.ListUserSessions(userID.String())
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].InstanceID < sessions[j].InstanceID })
+	for _, s := range sessions {
+		if s.Alive {
+			fmt.Fprintf(ch, "%s\t%s\r\n", s.InstanceID, nameOf[s.InstanceID])
+		}
+	}
+	sendExitStatus(ch, 0)
+}
+
+func (g *SSHGateway) fail(ch ssh.Channel, msg string) {
+	fmt.Fprintf(ch.Stderr(), "nebulide: %s\r\n", msg)
+	sendExitStatus(ch, 1)
+	ch.Close()
+}
+
+func sendExitStatus(ch ssh.Channel, code uint32) {
+	ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{code}))
+}
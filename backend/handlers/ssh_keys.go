@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ssh"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+)
+
+const maxSSHKeysPerUser = 20
+
+type SSHKeysHandler struct {
+	cfg *config.Config
+}
+
+func NewSSHKeysHandler(cfg *config.Config) *SSHKeysHandler {
+	return &SSHKeysHandler{cfg: cfg}
+}
+
+// List returns the current user's SSH gateway keys.
+func (h *SSHKeysHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var keys []models.SSHKey
+	database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&keys)
+	c.JSON(http.StatusOK, keys)
+}
+
+type sshKeyRequest struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key" binding:"required"` // one authorized_keys line
+}
+
+// Create adds a public key. Without a name, the key's comment is used.
+func (h *SSHKeysHandler) Create(c *gin.Context) {
+	var req sshKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "public_key is required"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	pub, comment, _, rest, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+	if err != nil || strings.TrimSpace(string(rest)) != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "public_key must be a single key in authorized_keys format"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = comment
+	}
+	if len(name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be at most 100 characters"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.SSHKey{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxSSHKeysPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many SSH keys"})
+		return
+	}
+	key := models.SSHKey{
+		UserID:      userID,
+		Name:        name,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))),
+		Fingerprint: ssh.FingerprintSHA256(pub),
+	}
+	database.DB.Model(&models.SSHKey{}).Where("fingerprint = ?", key.Fingerprint).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This key is already registered"})
+		return
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add SSH key"})
+		return
+	}
+	c.JSON(http.StatusCreated, key)
+}
+
+// Delete removes a key. Open SSH connections made with it stay open.
+func (h *SSHKeysHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.SSHKey{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSH key not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "SSH key deleted"})
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+func newTestSSHSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return signer
+}
+
+func TestSSHKeys_CRUD(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewSSHKeysHandler(cfg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/ssh-keys", handler.List)
+	protected.POST("/ssh-keys", handler.Create)
+	protected.DELETE("/ssh-keys/:id", handler.Delete)
+
+	user := testutil.CreateTestUser(db)
+	token := testutil.GenerateTestToken(cfg, user.ID, user.Username, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	pub := newTestSSHSigner(t).PublicKey()
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub))) + " me@laptop"
+	body, _ := json.Marshal(map[string]string{"public_key": line})
+
+	w := do("POST", "/api/ssh-keys", string(body))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.SSHKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "me@laptop", created.Name)
+	assert.Equal(t, ssh.FingerprintSHA256(pub), created.Fingerprint)
+
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/ssh-keys", string(body)).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/api/ssh-keys", `{"public_key":"ssh-ed25519 garbage"}`).Code)
+
+	var list []models.SSHKey
+	require.NoError(t, json.Unmarshal(do("GET", "/api/ssh-keys", "").Body.Bytes(), &list))
+	require.Len(t, list, 1)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", "/api/ssh-keys/"+created.ID.String(), "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/ssh-keys/"+created.ID.String(), "").Code)
+}
+
+func TestSSHGateway_Auth(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	cfg.SSHHostKeyPath = filepath.Join(t.TempDir(), "host_key")
+	user := testutil.CreateTestUser(db)
+
+	known := newTestSSHSigner(t)
+	require.NoError(t, db.Create(&models.SSHKey{
+		UserID:      user.ID,
+		PublicKey:   string(ssh.MarshalAuthorizedKey(known.PublicKey())),
+		Fingerprint: ssh.FingerprintSHA256(known.PublicKey()),
+	}).Error)
+
+	gateway, err := NewSSHGateway(cfg, services.NewTerminalService())
+	require.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go gateway.Serve(ln)
+
+	dial := func(username string, signer ssh.Signer) (*ssh.Client, error) {
+		return ssh.Dial("tcp", ln.Addr().String(), &ssh.ClientConfig{
+			User:            username,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+	}
+
+	_, err = dial(user.Username, newTestSSHSigner(t))
+	assert.Error(t, err, "unknown key")
+	_, err = dial("someone-else", known)
+	assert.Error(t, err, "key of another user")
+
+	client, err := dial(user.Username, known)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// No running terminals, and no shell is started by ls
+	sess, err := client.NewSession()
+	require.NoError(t, err)
+	out, err := sess.Output("ls")
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	// A shell needs a pty
+	sess, err = client.NewSession()
+	require.NoError(t, err)
+	err = sess.Run("default")
+	var exitErr *ssh.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 1, exitErr.ExitStatus())
+
+	var key models.SSHKey
+	require.NoError(t, db.First(&key).Error)
+	assert.NotNil(t, key.LastUsedAt)
+}
@@ -22,20 +22,29 @@ import (
 // ---------- types ----------
 
 type syncClientMsg struct {
-	Type       string `json:"type"`                  // device_register | heartbeat | force_takeover | terminal_rename
+	Type       string `json:"type"`                  // device_register | heartbeat | force_takeover | terminal_rename | terminal_broadcast
 	DeviceID   string `json:"device_id,omitempty"`
 	DeviceType string `json:"device_type,omitempty"` // phone | tablet | desktop
 	SessionID  string `json:"session_id,omitempty"`  // workspace session UUID
 	InstanceID string `json:"instance_id,omitempty"` // terminal instanceId
 	// terminal_rename fields
 	Name       string `json:"name,omitempty"`        // new terminal name
+	// terminal_broadcast fields (all terminals of session_id if instance_ids is empty)
+	InstanceIDs []string `json:"instance_ids,omitempty"`
+	Text        string   `json:"text,omitempty"`
+	Enter       *bool    `json:"enter,omitempty"`
+	RequestID   string   `json:"request_id,omitempty"` // echoed in terminal_broadcast_result
 }
 
 type syncServerMsg struct {
-	Type                  string    `json:"type"`                                    // register_ok | workspace_locked | workspace_unlocked | force_disconnected | terminal_reconcile
+	Type                  string    `json:"type"`                                    // register_ok | workspace_locked | workspace_unlocked | force_disconnected | terminal_reconcile | terminal_broadcast_result
 	SessionID             string    `json:"session_id,omitempty"`
 	LockedBy              *LockInfo `json:"locked_by,omitempty"`
 	ActiveClaudeTerminals []string  `json:"active_claude_terminals,omitempty"`       // instanceIds where a claude descendant is alive (register_ok + terminal_reconcile)
+	// terminal_broadcast_result fields
+	RequestID string                 `json:"request_id,omitempty"`
+	Results   []services.InputResult `json:"results,omitempty"`
+	Error     string                 `json:"error,omitempty"`
 }
 
 // LockInfo describes the device currently holding a workspace lock.
@@ -104,7 +113,7 @@ func (h *SyncHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	claims, err := utils.ParseToken(h.cfg.JWTSecret, token)
-	if err != nil || claims.Partial {
+	if err != nil || claims.Partial || claims.Purpose != "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
@@ -346,17 +355,23 @@ func (h *SyncHandler) HandleWebSocket(c *gin.Context) {
 		// exclusively by the backend's childWatchLoop (see main.go).
 
 		case "terminal_rename":
-			// Broadcast terminal rename to all devices
-			if msg.InstanceID != "" {
-				payload, _ := json.Marshal(map[string]string{
-					"type":        "terminal_rename",
-					"instance_id": msg.InstanceID,
-					"name":        msg.Name,
-					"device_id":   deviceID,
-				})
-				database.RDB.Publish(context.Background(), "ws:user:"+userID, string(payload))
+			// Persist the name (see TerminalInstance) and broadcast it to all devices
+			if validInstanceID(msg.InstanceID) && len(msg.Name) <= 100 {
+				if err := renameTerminalInstance(claims.UserID, msg.InstanceID, msg.Name); err != nil {
+					log.Printf("[Sync] terminal_rename save failed: %v instanceId=%s", err, msg.InstanceID)
+				}
+				publishTerminalRename(claims.UserID, msg.InstanceID, msg.Name, deviceID)
 				log.Printf("[Sync] terminal_rename broadcast: instanceId=%s name=%q from=%s", msg.InstanceID, msg.Name, deviceID)
 			}
+
+		case "terminal_broadcast":
+			// Same input to several terminals; the result goes back to this device only
+			req := broadcastInputRequest{InstanceIDs: msg.InstanceIDs, SessionID: msg.SessionID, Text: msg.Text, Enter: msg.Enter}
+			go func(requestID string) {
+				results, errMsg := broadcastInput(h.terminal, userID, &req)
+				log.Printf("[Sync] terminal_broadcast: %d terminal(s) from=%s err=%q", len(results), deviceID, errMsg)
+				sendJSON(syncServerMsg{Type: "terminal_broadcast_result", RequestID: requestID, Results: results, Error: errMsg})
+			}(msg.RequestID)
 		}
 	}
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +14,8 @@ import (
 	"github.com/gorilla/websocket"
 
 	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
 	"nebulide/services"
 	"nebulide/utils"
 )
@@ -23,15 +26,17 @@ const (
 )
 
 type TerminalHandler struct {
-	cfg      *config.Config
-	terminal *services.TerminalService
-	upgrader websocket.Upgrader
+	cfg        *config.Config
+	terminal   *services.TerminalService
+	spectators *services.SpectatorRegistry
+	upgrader   websocket.Upgrader
 }
 
 func NewTerminalHandler(cfg *config.Config, terminal *services.TerminalService) *TerminalHandler {
 	return &TerminalHandler{
-		cfg:      cfg,
-		terminal: terminal,
+		cfg:        cfg,
+		terminal:   terminal,
+		spectators: services.NewSpectatorRegistry(),
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -64,6 +69,15 @@ func (w *wsWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// CloseResync implements services.ResyncCloser: the client fell too far behind,
+// so close with 4002 — the frontend reconnects and gets a fresh screen snapshot.
+// WriteControl/Close are safe while a Write is blocked on the slow connection.
+func (w *wsWriter) CloseResync() {
+	w.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(4002, "resync"), time.Now().Add(time.Second))
+	w.conn.Close()
+}
+
 func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	token := c.Query("token")
 	if token == "" {
@@ -72,7 +86,8 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	}
 
 	claims, err := utils.ParseToken(h.cfg.JWTSecret, token)
-	if err != nil || claims.Partial {
+	// Scoped tokens (spectator links, hook/tg tokens) must not open a writable shell
+	if err != nil || claims.Partial || claims.Purpose != "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 		return
 	}
@@ -91,6 +106,16 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	}
 	sessionKey := "term:" + claims.UserID.String() + ":" + instanceID
 
+	// ?profile=<name> presets a new shell (see models.TerminalProfile).
+	var profile *models.TerminalProfile
+	if name := c.Query("profile"); name != "" {
+		var ok bool
+		if profile, ok = findTerminalProfile(claims.UserID, name); !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Terminal profile not found"})
+			return
+		}
+	}
+
 	log.Printf("[Terminal] NEW WS connection: remote=%s rawInstance=%q instance=%q wsId=%q sessionKey=%s",
 		c.Request.RemoteAddr, rawInstanceID, instanceID, wsId, sessionKey)
 
@@ -104,47 +129,51 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 		conn.Close()
 	}()
 
-	// Per-user workspace directory
-	workDir := h.cfg.ClaudeWorkingDir
-	if claims.Username != h.cfg.AdminUsername {
-		workDir = h.cfg.GetUserWorkspaceDir(claims.Username)
-	}
-
-	// Non-admin users get sandboxed shell (mount namespace isolation on Linux)
-	sandboxed := claims.Username != h.cfg.AdminUsername
-
-	// Build extra env vars for the terminal session
-	extraEnv := map[string]string{}
-
-	// Generate TG_SEND_TOKEN — a scoped 30-day JWT restricted to telegram/send endpoint only
-	tgToken, tgErr := utils.GenerateScopedToken(h.cfg.JWTSecret, claims.UserID, claims.Username, "tg-send", 30*24*time.Hour)
-	if tgErr == nil {
-		extraEnv["TG_SEND_TOKEN"] = tgToken
-	}
-
-	// Generate NEBULIDE_HOOK_TOKEN — scoped JWT for Claude Code hooks
-	hookToken, hookErr := utils.GenerateScopedToken(h.cfg.JWTSecret, claims.UserID, claims.Username, "claude-hook", 30*24*time.Hour)
-	if hookErr == nil {
-		extraEnv["NEBULIDE_HOOK_TOKEN"] = hookToken
+	workDir, sandboxed := userShellDir(h.cfg, claims.Username)
+	provider := c.Query("provider")
+	var opts services.ShellOptions
+	if profile != nil {
+		workDir = filepath.Join(workDir, filepath.FromSlash(profile.WorkDir))
+		if provider == "" {
+			provider = profile.Provider
+		}
+		opts = services.ShellOptions{Shell: profile.Shell, StartupCommand: profile.StartupCommand}
 	}
-	extraEnv["NEBULIDE_INSTANCE_ID"] = instanceID
-	extraEnv["NEBULIDE_HOOK_URL"] = "http://localhost:" + h.cfg.Port + "/api/hooks/claude"
-
-	// Провайдер модели (?provider=glm) — вливаем ANTHROPIC_* для GLM (Z.ai). Пусто => Anthropic.
-	// claude наследует эти переменные из шелла и стартует под выбранной моделью.
-	for k, v := range providerEnv(c.Query("provider"), h.cfg) {
-		extraEnv[k] = v
+	extraEnv := userShellEnv(h.cfg, claims.UserID, claims.Username, instanceID, provider)
+	if profile != nil {
+		for k, v := range profile.Env.Data() {
+			extraEnv[k] = v
+		}
 	}
 
 	// Reuse existing shell or create new one.
 	// Shell lives independently of WebSocket — survives reconnections.
 	log.Printf("[Terminal] calling GetOrCreate key=%s dir=%s sandboxed=%v user=%s", sessionKey, workDir, sandboxed, claims.Username)
-	termSession, err := h.terminal.GetOrCreate(sessionKey, workDir, sandboxed, claims.Username, extraEnv)
+	prev, had := h.terminal.Get(sessionKey)
+	fresh := !had || !prev.IsAlive()
+	if fresh && profile == nil {
+		if cwd, ok := hibernatedCwd(claims.UserID, instanceID, workDir, sandboxed); ok {
+			workDir = cwd
+		}
+	}
+	termSession, err := h.terminal.GetOrCreate(sessionKey, workDir, sandboxed, claims.Username, extraEnv, opts)
 	if err != nil {
 		log.Printf("[Terminal] failed to create session: %v (key=%s)", err, sessionKey)
 		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","message":"Failed to create terminal"}`))
 		return
 	}
+	profileName := ""
+	if profile != nil {
+		profileName = profile.Name
+	}
+	touchTerminalInstance(claims.UserID, instanceID, wsId, termSession.WorkDir, profileName, fresh)
+
+	// Opt-in asciicast recording (?record=1) — no-op if already recording.
+	if c.Query("record") == "1" {
+		if _, err := h.terminal.StartRecording(sessionKey); err != nil {
+			log.Printf("[Terminal] recording start failed: %v (key=%s)", err, sessionKey)
+		}
+	}
 
 	// Register this WS as an output destination for the persistent PTY reader.
 	// pumpOutput broadcasts to all writers via multiWriter.
@@ -180,6 +209,7 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	// If admin killed the session, send close code 4001 to prevent frontend auto-reconnect.
 	go func() {
 		<-termSession.Done
+		termSession.DrainWriter(writer, 2*time.Second)
 		if termSession.Killed {
 			log.Printf("[Terminal] admin-killed, sending 4001 key=%s", sessionKey)
 			conn.WriteControl(websocket.CloseMessage,
@@ -227,6 +257,43 @@ func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	// Session stays alive — shell persists for reconnection.
 }
 
+// userShellDir returns where a user's shells start and whether they are
+// sandboxed: non-admin users get their own workspace and a sandboxed shell
+// (namespace isolation on Linux, see services/sandbox.go).
+func userShellDir(cfg *config.Config, username string) (workDir string, sandboxed bool) {
+	if username != cfg.AdminUsername {
+		return cfg.GetUserWorkspaceDir(username), true
+	}
+	return cfg.ClaudeWorkingDir, false
+}
+
+// userShellEnv builds the extra env vars of a user's shell. Shared by
+// terminals and the exec API.
+func userShellEnv(cfg *config.Config, userID uuid.UUID, username, instanceID, provider string) map[string]string {
+	extraEnv := map[string]string{}
+
+	// Generate TG_SEND_TOKEN — a scoped 30-day JWT restricted to telegram/send endpoint only
+	tgToken, tgErr := utils.GenerateScopedToken(cfg.JWTSecret, userID, username, "tg-send", 30*24*time.Hour)
+	if tgErr == nil {
+		extraEnv["TG_SEND_TOKEN"] = tgToken
+	}
+
+	// Generate NEBULIDE_HOOK_TOKEN — scoped JWT for Claude Code hooks
+	hookToken, hookErr := utils.GenerateScopedToken(cfg.JWTSecret, userID, username, "claude-hook", 30*24*time.Hour)
+	if hookErr == nil {
+		extraEnv["NEBULIDE_HOOK_TOKEN"] = hookToken
+	}
+	extraEnv["NEBULIDE_INSTANCE_ID"] = instanceID
+	extraEnv["NEBULIDE_HOOK_URL"] = "http://localhost:" + cfg.Port + "/api/hooks/claude"
+
+	// Провайдер модели (?provider=glm) — вливаем ANTHROPIC_* для GLM (Z.ai). Пусто => Anthropic.
+	// claude наследует эти переменные из шелла и стартует под выбранной моделью.
+	for k, v := range providerEnv(provider, cfg) {
+		extraEnv[k] = v
+	}
+	return extraEnv
+}
+
 // KillTerminal allows a user to kill their own terminal session(s) by instanceId.
 // Uses prefix match because the actual session key includes "@ws:{sessionId}" suffix.
 func (h *TerminalHandler) KillTerminal(c *gin.Context) {
@@ -239,6 +306,7 @@ func (h *TerminalHandler) KillTerminal(c *gin.Context) {
 
 	prefix := "term:" + userID.(uuid.UUID).String() + ":" + instanceID
 	killed := h.terminal.KillSessionsByPrefix(prefix)
+	database.DB.Where("user_id = ? AND instance_id = ?", userID, instanceID).Delete(&models.TerminalInstance{})
 
 	log.Printf("[Terminal] user killed %d sessions prefix=%s", killed, prefix)
 	c.JSON(http.StatusOK, gin.H{"killed": killed})
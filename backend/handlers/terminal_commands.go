@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/services"
+)
+
+const (
+	commandsDefaultLimit = 100
+	commandOutputMax     = 1 << 20
+)
+
+// Commands lists the commands run in a terminal (shell integration), newest
+// first. ?failed=1 keeps only commands that exited non-zero, ?limit= caps the list.
+func (h *TerminalHandler) Commands(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(commandsDefaultLimit)))
+	if err != nil || limit <= 0 {
+		limit = commandsDefaultLimit
+	}
+	failed := c.Query("failed") == "1"
+
+	cmds, ok := h.terminal.ListCommands(sessionKey)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No command log for this terminal"})
+		return
+	}
+	out := make([]services.TerminalCommand, 0, min(limit, len(cmds)))
+	for i := len(cmds) - 1; i >= 0 && len(out) < limit; i-- {
+		if failed && (cmds[i].ExitCode == nil || *cmds[i].ExitCode == 0) {
+			continue
+		}
+		out = append(out, cmds[i])
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// CommandOutput returns one logged command with its output (escape sequences
+// stripped; ?raw=1 sends the raw bytes as they went to the terminal instead).
+func (h *TerminalHandler) CommandOutput(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+	seq, err := strconv.Atoi(c.Param("seq"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid command number"})
+		return
+	}
+
+	cmd, out, ok := h.terminal.CommandOutput(sessionKey, seq, commandOutputMax)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Command not found"})
+		return
+	}
+	if c.Query("raw") == "1" {
+		c.Data(http.StatusOK, "application/octet-stream", out.Raw)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"command": cmd, "output": out})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/services"
+)
+
+const (
+	maxBroadcastTerminals = 50
+	maxBroadcastText      = 64 << 10
+)
+
+// broadcastInputRequest selects terminals by instance_ids or, with
+// session_id, every terminal of a workspace session.
+type broadcastInputRequest struct {
+	InstanceIDs []string `json:"instance_ids"`
+	SessionID   string   `json:"session_id"`
+	Text        string   `json:"text"`
+	Enter       *bool    `json:"enter"` // submit with Enter after the text; default true
+}
+
+// broadcastInput sends the request's input to its terminals. Shared by the
+// REST endpoint and the sync WS message.
+func broadcastInput(terminal *services.TerminalService, userID string, req *broadcastInputRequest) ([]services.InputResult, string) {
+	if len(req.Text) > maxBroadcastText {
+		return nil, "text is too long"
+	}
+	enter := req.Enter == nil || *req.Enter
+	if req.Text == "" && !enter {
+		return nil, "text is required"
+	}
+
+	ids := req.InstanceIDs
+	if len(ids) == 0 && req.SessionID != "" {
+		ids = terminal.WorkspaceTerminals(userID, req.SessionID)
+	}
+	if len(ids) > maxBroadcastTerminals {
+		return nil, "Too many terminals"
+	}
+	seen := make(map[string]bool, len(ids))
+	targets := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] && validInstanceID(id) {
+			seen[id] = true
+			targets = append(targets, id)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, "No terminals selected"
+	}
+	return terminal.SendInput(userID, targets, req.Text, enter), ""
+}
+
+// BroadcastInput types the same input into several of the user's terminals
+// and reports per terminal whether it was delivered.
+func (h *TerminalHandler) BroadcastInput(c *gin.Context) {
+	var req broadcastInputRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	results, msg := broadcastInput(h.terminal, userID.String(), &req)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+type TerminalInstancesHandler struct {
+	cfg      *config.Config
+	terminal *services.TerminalService
+}
+
+func NewTerminalInstancesHandler(cfg *config.Config, terminal *services.TerminalService) *TerminalInstancesHandler {
+	return &TerminalInstancesHandler{cfg: cfg, terminal: terminal}
+}
+
+type terminalInstanceResponse struct {
+	models.TerminalInstance
+	Running bool `json:"running"` // a shell is alive for it right now
+}
+
+func (h *TerminalInstancesHandler) response(t models.TerminalInstance) terminalInstanceResponse {
+	sess, ok := h.terminal.Get("term:" + t.UserID.String() + ":" + t.InstanceID)
+	return terminalInstanceResponse{TerminalInstance: t, Running: ok && sess.IsAlive()}
+}
+
+// validInstanceID accepts instanceIds as /ws/terminal uses them in session keys.
+func validInstanceID(id string) bool {
+	return id != "" && len(id) <= 100 && !strings.Contains(id, "@ws:")
+}
+
+// upsertTerminalInstance inserts t or, if the user already has the
+// instanceId, updates the given columns of the existing row.
+func upsertTerminalInstance(t *models.TerminalInstance, columns ...string) error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(t).Error
+}
+
+// touchTerminalInstance records a /ws/terminal attach. workDir and profile
+// describe the shell and are only updated when it was just started.
+func touchTerminalInstance(userID uuid.UUID, instanceID, wsID, workDir, profile string, fresh bool) {
+	now := time.Now()
+	t := models.TerminalInstance{
+		UserID: userID, InstanceID: instanceID, WorkspaceSessionID: wsID,
+		WorkDir: workDir, Profile: profile, LastAttachedAt: &now,
+	}
+	columns := []string{"last_attached_at"}
+	if wsID != "" {
+		columns = append(columns, "workspace_session_id")
+	}
+	if fresh {
+		columns = append(columns, "work_dir", "profile", "hibernated_at", "hibernated_cwd")
+	}
+	if err := upsertTerminalInstance(&t, columns...); err != nil {
+		log.Printf("[Terminal] saving terminal metadata: %v (instance=%s)", err, instanceID)
+	}
+}
+
+// hibernatedCwd returns where to respawn a hibernated terminal: the cwd its
+// shell had. The cwd comes from the shell (OSC 7), so for a sandboxed user it
+// only counts inside baseDir — it decides what the sandbox exposes.
+func hibernatedCwd(userID uuid.UUID, instanceID, baseDir string, sandboxed bool) (string, bool) {
+	var t models.TerminalInstance
+	err := database.DB.Where("user_id = ? AND instance_id = ?", userID, instanceID).First(&t).Error
+	if err != nil || t.HibernatedAt == nil || t.HibernatedCwd == "" {
+		return "", false
+	}
+	dir, err := filepath.EvalSymlinks(t.HibernatedCwd)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", false
+	}
+	if sandboxed {
+		base, err := filepath.EvalSymlinks(baseDir)
+		if err != nil {
+			return "", false
+		}
+		rel, err := filepath.Rel(base, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+	}
+	return dir, true
+}
+
+// renameTerminalInstance stores a terminal's display name.
+func renameTerminalInstance(userID uuid.UUID, instanceID, name string) error {
+	return upsertTerminalInstance(&models.TerminalInstance{UserID: userID, InstanceID: instanceID, Name: name}, "name")
+}
+
+// publishTerminalRename tells all of the user's devices about a new name.
+func publishTerminalRename(userID uuid.UUID, instanceID, name, deviceID string) {
+	if database.RDB == nil {
+		return
+	}
+	payload, _ := json.Marshal(map[string]string{
+		"type":        "terminal_rename",
+		"instance_id": instanceID,
+		"name":        name,
+		"device_id":   deviceID,
+	})
+	database.RDB.Publish(context.Background(), "ws:user:"+userID.String(), string(payload))
+}
+
+// List returns the current user's terminals, oldest first; ?session_id=
+// narrows it to one workspace session.
+func (h *TerminalInstancesHandler) List(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	q := database.DB.Where("user_id = ?", userID)
+	if sid := c.Query("session_id"); sid != "" {
+		q = q.Where("workspace_session_id = ?", sid)
+	}
+	var instances []models.TerminalInstance
+	q.Order("created_at ASC").Find(&instances)
+
+	result := make([]terminalInstanceResponse, len(instances))
+	for i, t := range instances {
+		result[i] = h.response(t)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Get returns one terminal by instanceId.
+func (h *TerminalInstancesHandler) Get(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var t models.TerminalInstance
+	if err := database.DB.Where("user_id = ? AND instance_id = ?", userID, c.Param("instanceId")).First(&t).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	}
+	c.JSON(http.StatusOK, h.response(t))
+}
+
+type terminalInstanceRequest struct {
+	InstanceID         string  `json:"instance_id"` // Create only
+	Name               *string `json:"name"`
+	WorkspaceSessionID *string `json:"workspace_session_id"`
+}
+
+// apply copies the set fields onto t and validates the result.
+func (r *terminalInstanceRequest) apply(t *models.TerminalInstance) string {
+	if r.Name != nil {
+		t.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.WorkspaceSessionID != nil {
+		t.WorkspaceSessionID = *r.WorkspaceSessionID
+	}
+	if len(t.Name) > 100 {
+		return "name must be at most 100 characters"
+	}
+	if len(t.WorkspaceSessionID) > 64 {
+		return "Invalid workspace_session_id"
+	}
+	return ""
+}
+
+// Create registers a terminal before its first connect, e.g. to give it a
+// name right away.
+func (h *TerminalInstancesHandler) Create(c *gin.Context) {
+	var req terminalInstanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validInstanceID(req.InstanceID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	t := models.TerminalInstance{UserID: userID, InstanceID: req.InstanceID}
+	if msg := req.apply(&t); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	var count int64
+	database.DB.Model(&models.TerminalInstance{}).
+		Where("user_id = ? AND instance_id = ?", userID, t.InstanceID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Terminal already exists"})
+		return
+	}
+	if err := database.DB.Create(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create terminal"})
+		return
+	}
+	if t.Name != "" {
+		publishTerminalRename(userID, t.InstanceID, t.Name, "server")
+	}
+	c.JSON(http.StatusCreated, h.response(t))
+}
+
+// Update changes the name and/or workspace session; a new name is broadcast
+// like a terminal_rename from a device.
+func (h *TerminalInstancesHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req terminalInstanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var t models.TerminalInstance
+	if err := database.DB.Where("user_id = ? AND instance_id = ?", userID, c.Param("instanceId")).First(&t).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	}
+	oldName := t.Name
+	if msg := req.apply(&t); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := database.DB.Save(&t).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update terminal"})
+		return
+	}
+	if t.Name != oldName {
+		publishTerminalRename(userID, t.InstanceID, t.Name, "server")
+	}
+	c.JSON(http.StatusOK, h.response(t))
+}
+
+// Delete forgets a terminal's metadata. A running shell is not affected;
+// DELETE /terminals/:instanceId kills it and forgets it.
+func (h *TerminalInstancesHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := database.DB.Where("user_id = ? AND instance_id = ?", userID, c.Param("instanceId")).
+		Delete(&models.TerminalInstance{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Terminal deleted"})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+func TestTerminalInstances_CRUD(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewTerminalInstancesHandler(cfg, services.NewTerminalService())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/terminal-instances", handler.List)
+	protected.POST("/terminal-instances", handler.Create)
+	protected.GET("/terminal-instances/:instanceId", handler.Get)
+	protected.PUT("/terminal-instances/:instanceId", handler.Update)
+	protected.DELETE("/terminal-instances/:instanceId", handler.Delete)
+
+	user := testutil.CreateTestUser(db)
+	token := testutil.GenerateTestToken(cfg, user.ID, user.Username, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	get := func(instanceID string) terminalInstanceResponse {
+		t.Helper()
+		w := do("GET", "/api/terminal-instances/"+instanceID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var got terminalInstanceResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		return got
+	}
+
+	w := do("POST", "/api/terminal-instances", `{"instance_id":"t1","name":"build","workspace_session_id":"ws-a"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/terminal-instances", `{"instance_id":"t1"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/api/terminal-instances", `{"instance_id":"t2@ws:x"}`).Code)
+
+	// An attach of a new shell records where it started; a reattach only the time.
+	touchTerminalInstance(user.ID, "t1", "ws-b", "/work/api", "api", true)
+	touchTerminalInstance(user.ID, "t1", "", "/elsewhere", "", false)
+	got := get("t1")
+	assert.Equal(t, "build", got.Name)
+	assert.Equal(t, "ws-b", got.WorkspaceSessionID)
+	assert.Equal(t, "/work/api", got.WorkDir)
+	assert.Equal(t, "api", got.Profile)
+	assert.NotNil(t, got.LastAttachedAt)
+	assert.False(t, got.Running)
+
+	// A rename from a device creates the row if the terminal is unknown.
+	require.NoError(t, renameTerminalInstance(user.ID, "t2", "logs"))
+	require.NoError(t, renameTerminalInstance(user.ID, "t1", "server"))
+	assert.Equal(t, "server", get("t1").Name)
+
+	w = do("PUT", "/api/terminal-instances/t2", `{"name":"tail"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusNotFound, do("PUT", "/api/terminal-instances/t3", `{"name":"x"}`).Code)
+
+	var list []terminalInstanceResponse
+	require.NoError(t, json.Unmarshal(do("GET", "/api/terminal-instances?session_id=ws-b", "").Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "t1", list[0].InstanceID)
+	require.NoError(t, json.Unmarshal(do("GET", "/api/terminal-instances", "").Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "tail", list[1].Name)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", "/api/terminal-instances/t1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/api/terminal-instances/t1", "").Code)
+}
+
+func TestHibernatedCwd(t *testing.T) {
+	db := testutil.SetupTestDB()
+	user := testutil.CreateTestUser(db)
+	base := t.TempDir()
+	inside := filepath.Join(base, "src")
+	require.NoError(t, os.Mkdir(inside, 0o755))
+
+	touchTerminalInstance(user.ID, "t1", "", base, "", true)
+	_, ok := hibernatedCwd(user.ID, "t1", base, true)
+	assert.False(t, ok, "not hibernated")
+
+	hibernate := func(cwd string) {
+		require.NoError(t, db.Model(&models.TerminalInstance{}).Where("user_id = ? AND instance_id = ?", user.ID, "t1").
+			Updates(map[string]interface{}{"hibernated_at": time.Now(), "hibernated_cwd": cwd}).Error)
+	}
+	hibernate(inside)
+	dir, ok := hibernatedCwd(user.ID, "t1", base, true)
+	require.True(t, ok)
+	assert.Equal(t, inside, dir)
+
+	outside := t.TempDir()
+	hibernate(outside)
+	_, ok = hibernatedCwd(user.ID, "t1", base, true)
+	assert.False(t, ok, "outside the sandboxed workspace")
+	dir, ok = hibernatedCwd(user.ID, "t1", base, false)
+	assert.True(t, ok)
+	assert.Equal(t, outside, dir)
+
+	// The respawned shell clears the mark
+	touchTerminalInstance(user.ID, "t1", "", outside, "", true)
+	_, ok = hibernatedCwd(user.ID, "t1", base, false)
+	assert.False(t, ok)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/services"
+)
+
+// clockTicks is USER_HZ, the unit of /proc/<pid>/stat times (100 on Linux).
+const clockTicks = 100
+
+type terminalProcess struct {
+	PID        int        `json:"pid"`
+	PPID       int        `json:"ppid"` // 0 for the shell
+	Cmdline    string     `json:"cmdline"`
+	State      string     `json:"state,omitempty"` // R, S, T (stopped), Z, ...
+	CPUPercent float64    `json:"cpu_percent"`
+	MemoryRSS  int64      `json:"memory_rss_bytes"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	AgeSec     int64      `json:"age_sec"`
+}
+
+// Processes returns the terminal's shell and all its descendants, parents
+// before children (build the tree from ppid). CPU is sampled over 500ms;
+// ?cpu=0 skips the sample.
+func (h *TerminalHandler) Processes(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+
+	tree, ok := h.terminal.ProcessTree(sessionKey)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not running"})
+		return
+	}
+
+	now := time.Now()
+	boot := bootTime()
+	result := make([]terminalProcess, len(tree))
+	pids := make([]int, len(tree))
+	for i, p := range tree {
+		pids[i] = p.PID
+		result[i] = terminalProcess{PID: p.PID, PPID: p.PPID, Cmdline: p.Cmdline}
+		if runtime.GOOS != "linux" {
+			continue
+		}
+		result[i].MemoryRSS, _, _ = readProcInfo(p.PID)
+		if state, ticks, ok := readProcStart(p.PID); ok {
+			result[i].State = state
+			if !boot.IsZero() {
+				started := boot.Add(time.Duration(ticks) * time.Second / clockTicks)
+				result[i].StartedAt = &started
+				result[i].AgeSec = int64(now.Sub(started).Seconds())
+			}
+		}
+	}
+	if runtime.GOOS == "linux" && c.Query("cpu") != "0" {
+		_, procCPU := measureAllCPU(pids)
+		for i := range result {
+			result[i].CPUPercent = procCPU[result[i].PID]
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"shell_pid": tree[0].PID, "processes": result})
+}
+
+type signalRequest struct {
+	PID    int    `json:"pid" binding:"required"`
+	Signal string `json:"signal" binding:"required"` // SIGINT, SIGTERM, SIGSTOP or SIGCONT
+}
+
+// SignalProcess sends a signal to one process running in the terminal (not
+// the shell itself), e.g. to interrupt a stuck subprocess and keep the shell.
+func (h *TerminalHandler) SignalProcess(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+
+	var req signalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "pid and signal are required"})
+		return
+	}
+	err := h.terminal.SignalProcess(sessionKey, req.PID, req.Signal)
+	switch {
+	case errors.Is(err, services.ErrBadSignal):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotDescendant):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send signal: " + err.Error()})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Signal sent", "pid": req.PID})
+	}
+}
+
+// readProcStart reads the state and start time (clock ticks after boot) from
+// /proc/{pid}/stat.
+func readProcStart(pid int) (state string, ticks int64, ok bool) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", 0, false
+	}
+	s := string(stat)
+	idx := strings.LastIndex(s, ") ")
+	if idx < 0 {
+		return "", 0, false
+	}
+	fields := strings.Fields(s[idx+2:])
+	if len(fields) < 20 {
+		return "", 0, false
+	}
+	ticks, err = strconv.ParseInt(fields[19], 10, 64)
+	return fields[0], ticks, err == nil
+}
+
+// bootTime reads the system boot time (btime in /proc/stat).
+func bootTime() time.Time {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			if sec, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return time.Unix(sec, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
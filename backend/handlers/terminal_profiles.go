@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+)
+
+const (
+	maxProfilesPerUser = 50
+	maxProfileEnvVars  = 50
+)
+
+var (
+	envNameRe   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	shellNameRe = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+)
+
+type TerminalProfilesHandler struct {
+	cfg *config.Config
+}
+
+func NewTerminalProfilesHandler(cfg *config.Config) *TerminalProfilesHandler {
+	return &TerminalProfilesHandler{cfg: cfg}
+}
+
+// profileRequest is the body of Create and Update; on Update, omitted fields
+// keep their values.
+type profileRequest struct {
+	Name           *string            `json:"name"`
+	Shell          *string            `json:"shell"`
+	WorkDir        *string            `json:"workdir"`
+	Env            *map[string]string `json:"env"`
+	StartupCommand *string            `json:"startup_command"`
+	Provider       *string            `json:"provider"`
+}
+
+// apply copies the set fields onto p and validates the result.
+func (r *profileRequest) apply(p *models.TerminalProfile) string {
+	if r.Name != nil {
+		p.Name = strings.TrimSpace(*r.Name)
+	}
+	if r.Shell != nil {
+		p.Shell = strings.TrimSpace(*r.Shell)
+	}
+	if r.WorkDir != nil {
+		p.WorkDir = strings.Trim(filepath.ToSlash(strings.TrimSpace(*r.WorkDir)), "/")
+	}
+	if r.Env != nil {
+		p.Env = datatypes.NewJSONType(*r.Env)
+	}
+	if r.StartupCommand != nil {
+		p.StartupCommand = strings.TrimRight(*r.StartupCommand, " \t\r\n")
+	}
+	if r.Provider != nil {
+		p.Provider = *r.Provider
+	}
+
+	if p.Name == "" || len(p.Name) > 100 {
+		return "name is required (at most 100 characters)"
+	}
+	if len(p.Shell) > 255 || (p.Shell != "" && !shellNameRe.MatchString(p.Shell) &&
+		!(filepath.IsAbs(p.Shell) && filepath.Clean(p.Shell) == p.Shell)) {
+		return "shell must be a program name or a clean absolute path"
+	}
+	if len(p.WorkDir) > 512 || (p.WorkDir != "" && !filepath.IsLocal(filepath.FromSlash(p.WorkDir))) {
+		return "workdir must be a path inside the workspace"
+	}
+	env := p.Env.Data()
+	if len(env) > maxProfileEnvVars {
+		return "Too many env vars"
+	}
+	for k, v := range env {
+		if !envNameRe.MatchString(k) || reservedShellEnv(k) {
+			return "Invalid env var name: " + k
+		}
+		if len(v) > 4096 || strings.ContainsRune(v, 0) {
+			return "Invalid value of env var " + k
+		}
+	}
+	if len(p.StartupCommand) > 2000 {
+		return "startup_command must be at most 2000 characters"
+	}
+	switch p.Provider {
+	case "", "glm":
+	default:
+		return "provider must be empty or glm"
+	}
+	return ""
+}
+
+// reservedShellEnv reports whether a profile may not set the env var: the
+// ones userShellEnv sets for the app's own integrations.
+func reservedShellEnv(name string) bool {
+	return strings.HasPrefix(name, "NEBULIDE_") || name == "TG_SEND_TOKEN"
+}
+
+// findTerminalProfile loads one of the user's profiles by name.
+func findTerminalProfile(userID uuid.UUID, name string) (*models.TerminalProfile, bool) {
+	var p models.TerminalProfile
+	if err := database.DB.Where("user_id = ? AND name = ?", userID, name).First(&p).Error; err != nil {
+		return nil, false
+	}
+	return &p, true
+}
+
+// nameTaken reports whether the user has another profile with p's name.
+func nameTaken(p *models.TerminalProfile) bool {
+	var count int64
+	database.DB.Model(&models.TerminalProfile{}).
+		Where("user_id = ? AND name = ? AND id <> ?", p.UserID, p.Name, p.ID).Count(&count)
+	return count > 0
+}
+
+// List returns the current user's terminal profiles.
+func (h *TerminalProfilesHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var profiles []models.TerminalProfile
+	database.DB.Where("user_id = ?", userID).Order("name ASC").Find(&profiles)
+	c.JSON(http.StatusOK, profiles)
+}
+
+// Create adds a terminal profile.
+func (h *TerminalProfilesHandler) Create(c *gin.Context) {
+	var req profileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var count int64
+	database.DB.Model(&models.TerminalProfile{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxProfilesPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many profiles"})
+		return
+	}
+
+	profile := models.TerminalProfile{UserID: userID, Env: datatypes.NewJSONType(map[string]string{})}
+	if msg := req.apply(&profile); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if nameTaken(&profile) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A profile with this name already exists"})
+		return
+	}
+	if err := database.DB.Create(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create profile"})
+		return
+	}
+	c.JSON(http.StatusCreated, profile)
+}
+
+// Update changes the fields present in the body. Running terminals keep the
+// settings they were started with.
+func (h *TerminalProfilesHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req profileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var profile models.TerminalProfile
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&profile).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+	if msg := req.apply(&profile); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if nameTaken(&profile) {
+		c.JSON(http.StatusConflict, gin.H{"error": "A profile with this name already exists"})
+		return
+	}
+	if err := database.DB.Save(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// Delete removes a terminal profile.
+func (h *TerminalProfilesHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Delete(&models.TerminalProfile{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Profile deleted"})
+}
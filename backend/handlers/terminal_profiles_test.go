@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/testutil"
+)
+
+func TestTerminalProfiles_CRUD(t *testing.T) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewTerminalProfilesHandler(cfg)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	protected.GET("/terminal-profiles", handler.List)
+	protected.POST("/terminal-profiles", handler.Create)
+	protected.PUT("/terminal-profiles/:id", handler.Update)
+	protected.DELETE("/terminal-profiles/:id", handler.Delete)
+
+	user := testutil.CreateTestUser(db)
+	token := testutil.GenerateTestToken(cfg, user.ID, user.Username, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/terminal-profiles", `{"name":"api","workdir":"/api/","env":{"NODE_ENV":"development"},"startup_command":"claude --resume\n","provider":"glm"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.TerminalProfile
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "api", created.WorkDir)
+	assert.Equal(t, "claude --resume", created.StartupCommand)
+
+	for _, body := range []string{
+		`{"name":""}`,
+		`{"name":"x","workdir":"../other"}`,
+		`{"name":"x","shell":"bash -c id"}`,
+		`{"name":"x","shell":"/bin/../bin/zsh"}`,
+		`{"name":"x","env":{"NEBULIDE_HOOK_TOKEN":"forged"}}`,
+		`{"name":"x","env":{"1BAD":"v"}}`,
+		`{"name":"x","provider":"openai"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do("POST", "/api/terminal-profiles", body).Code, body)
+	}
+	assert.Equal(t, http.StatusConflict, do("POST", "/api/terminal-profiles", `{"name":"api"}`).Code)
+
+	w = do("POST", "/api/terminal-profiles", `{"name":"zsh","shell":"zsh"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, do("PUT", "/api/terminal-profiles/"+created.ID.String(), `{"name":"zsh"}`).Code)
+
+	w = do("PUT", "/api/terminal-profiles/"+created.ID.String(), `{"shell":"/bin/bash","env":{}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	p, ok := findTerminalProfile(user.ID, "api")
+	require.True(t, ok)
+	assert.Equal(t, "/bin/bash", p.Shell)
+	assert.Empty(t, p.Env.Data())
+	assert.Equal(t, "glm", p.Provider)
+
+	var list []models.TerminalProfile
+	require.NoError(t, json.Unmarshal(do("GET", "/api/terminal-profiles", "").Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "api", list[0].Name)
+
+	assert.Equal(t, http.StatusOK, do("DELETE", "/api/terminal-profiles/"+created.ID.String(), "").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/api/terminal-profiles/"+created.ID.String(), "").Code)
+	_, ok = findTerminalProfile(user.ID, "api")
+	assert.False(t, ok)
+}
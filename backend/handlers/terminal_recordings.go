@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Terminal recordings (asciicast v2) — post-mortems of what ran in a shell.
+// Files live under cfg.TerminalRecordingsDir/{userID}/ and are scoped to the owner.
+
+// StartRecording begins recording a live terminal by instanceId.
+func (h *TerminalHandler) StartRecording(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+
+	id, err := h.terminal.StartRecording(sessionKey)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("[Terminal] recording started id=%s key=%s", id, sessionKey)
+	c.JSON(http.StatusOK, gin.H{"recording_id": id})
+}
+
+// StopRecording finishes the active recording of a terminal.
+func (h *TerminalHandler) StopRecording(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+
+	id := h.terminal.StopRecording(sessionKey)
+	if id == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal is not being recorded"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recording_id": id})
+}
+
+// ListRecordings returns the current user's recordings, newest first.
+func (h *TerminalHandler) ListRecordings(c *gin.Context) {
+	if h.terminal.Recordings == nil {
+		c.JSON(http.StatusOK, []interface{}{})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	c.JSON(http.StatusOK, h.terminal.Recordings.List(userID.(uuid.UUID).String()))
+}
+
+// DownloadRecording serves the raw .cast file (playable with asciinema / asciinema-player).
+func (h *TerminalHandler) DownloadRecording(c *gin.Context) {
+	path := h.recordingPath(c)
+	if path == "" {
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+c.Param("id")+`.cast"`)
+	c.File(path)
+}
+
+// ReplayRecording streams the recording with its original timing as NDJSON
+// (asciicast lines). ?speed=2 plays twice as fast, ?max_idle=2 caps pauses at 2s.
+func (h *TerminalHandler) ReplayRecording(c *gin.Context) {
+	path := h.recordingPath(c)
+	if path == "" {
+		return
+	}
+	speed, _ := strconv.ParseFloat(c.DefaultQuery("speed", "1"), 64)
+	maxIdle, _ := strconv.ParseFloat(c.DefaultQuery("max_idle", "2"), 64)
+
+	c.Header("Content-Type", "application/x-asciicast")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	err := h.terminal.Recordings.Replay(path, c.Writer, c.Writer.Flush, speed,
+		time.Duration(maxIdle*float64(time.Second)), c.Request.Context().Done())
+	if err != nil {
+		log.Printf("[Terminal] replay error: %v", err)
+	}
+}
+
+// DeleteRecording removes a finished recording.
+func (h *TerminalHandler) DeleteRecording(c *gin.Context) {
+	if h.terminal.Recordings == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		return
+	}
+	userID, _ := c.Get("user_id")
+	if err := h.terminal.Recordings.Delete(userID.(uuid.UUID).String(), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// recordingPath resolves :id for the current user, writing a 404 if missing.
+func (h *TerminalHandler) recordingPath(c *gin.Context) string {
+	if h.terminal.Recordings == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		return ""
+	}
+	userID, _ := c.Get("user_id")
+	path := h.terminal.Recordings.Path(userID.(uuid.UUID).String(), c.Param("id"))
+	if path == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recording not found"})
+		return ""
+	}
+	return path
+}
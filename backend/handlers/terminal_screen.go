@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/services"
+)
+
+// Screen returns what the terminal shows right now, see writeScreen.
+func (h *TerminalHandler) Screen(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	writeScreen(c, h.terminal, "term:"+userID.String()+":"+c.Param("instanceId"))
+}
+
+// writeScreen renders a terminal's visible screen in the ?format= asked for:
+//
+//	text          plain text, one line per row (default)
+//	html          a <pre> of inline-styled spans, to embed
+//	png-less-html a standalone page: a screenshot without an image
+//	json          size, title and both text and html
+func writeScreen(c *gin.Context, terminal *services.TerminalService, sessionKey string) {
+	format := c.DefaultQuery("format", "text")
+	switch format {
+	case "text", "html", "png-less-html", "json":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be text, html, png-less-html or json"})
+		return
+	}
+	snap, ok := terminal.Screen(sessionKey, format != "text")
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal not running"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	switch format {
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(snap.Text))
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(snap.HTML))
+	case "png-less-html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(screenPage(snap)))
+	default:
+		c.JSON(http.StatusOK, snap)
+	}
+}
+
+// screenPage wraps a screen's HTML in a page sized to the terminal.
+func screenPage(snap services.ScreenSnapshot) string {
+	title := snap.Title
+	if title == "" {
+		title = "Terminal"
+	}
+	return `<!DOCTYPE html><html><head><meta charset="utf-8"><title>` + html.EscapeString(title) + `</title>` +
+		`<style>body{margin:0;background:#000}pre{display:inline-block;min-width:100%;box-sizing:border-box;` +
+		`padding:8px;font:13px/1.2 ui-monospace,Menlo,Consolas,monospace}</style></head><body>` +
+		snap.HTML + `</body></html>`
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	scrollbackDefaultLimit = 200
+	scrollbackMaxLimit     = 2000
+)
+
+// Scrollback pages through a terminal's persistent output log, newest first.
+// ?q= filters lines (case-insensitive substring, escape sequences stripped),
+// ?before= is the next_before offset of the previous page, ?limit= caps lines.
+func (h *TerminalHandler) Scrollback(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+
+	before, _ := strconv.ParseInt(c.Query("before"), 10, 64)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(scrollbackDefaultLimit)))
+	if err != nil || limit <= 0 {
+		limit = scrollbackDefaultLimit
+	}
+	if limit > scrollbackMaxLimit {
+		limit = scrollbackMaxLimit
+	}
+
+	page, ok := h.terminal.SearchScrollback(sessionKey, c.Query("q"), before, limit)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No scrollback for this terminal"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"nebulide/services"
+	"nebulide/utils"
+)
+
+// Read-only spectator links: the owner mints a scoped token bound to one
+// terminal, anyone holding it can watch /ws/terminal/watch but never type.
+
+const (
+	spectatorDefaultTTL = time.Hour
+	spectatorMaxTTL     = 24 * time.Hour
+)
+
+type createSpectatorRequest struct {
+	Label      string `json:"label"`
+	TTLMinutes int    `json:"ttl_minutes"`
+}
+
+// spectatorWriter is a watcher's output sink; the session doesn't count it as
+// attached (see services.SpectatorWriter).
+type spectatorWriter struct {
+	wsWriter
+}
+
+func (*spectatorWriter) Spectating() {}
+
+// CreateSpectator mints a watch link for a live terminal.
+func (h *TerminalHandler) CreateSpectator(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	username, _ := c.Get("username")
+	uid := userID.(uuid.UUID)
+	sessionKey := "term:" + uid.String() + ":" + c.Param("instanceId")
+
+	var req createSpectatorRequest
+	c.ShouldBindJSON(&req) // body is optional
+	ttl := spectatorDefaultTTL
+	if req.TTLMinutes > 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	if ttl > spectatorMaxTTL {
+		ttl = spectatorMaxTTL
+	}
+
+	if sess, ok := h.terminal.Get(sessionKey); !ok || !sess.IsAlive() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Terminal is not running"})
+		return
+	}
+
+	name, _ := username.(string)
+	token, err := utils.GenerateScopedToken(h.cfg.JWTSecret, uid, name, services.SpectatorPurpose, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	claims, err := utils.ParseToken(h.cfg.JWTSecret, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	sp := h.spectators.Register(claims.ID, sessionKey, req.Label, claims.ExpiresAt.Time)
+	log.Printf("[Terminal] spectator link created id=%s key=%s ttl=%s", sp.ID, sessionKey, ttl)
+
+	c.JSON(http.StatusOK, gin.H{
+		"spectator": sp,
+		"token":     token,
+		"watch_url": "/ws/terminal/watch?token=" + token,
+	})
+}
+
+// ListSpectators returns the watch links of one terminal.
+func (h *TerminalHandler) ListSpectators(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	instanceID := c.Param("instanceId")
+	result := []services.Spectator{}
+	for _, sp := range h.spectators.List("term:" + userID.(uuid.UUID).String() + ":") {
+		if sp.InstanceID == instanceID {
+			result = append(result, sp)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RevokeSpectator invalidates a watch link and disconnects its viewers.
+func (h *TerminalHandler) RevokeSpectator(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionKey := "term:" + userID.(uuid.UUID).String() + ":" + c.Param("instanceId")
+	if !h.spectators.Revoke(sessionKey, c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Spectator link not found"})
+		return
+	}
+	log.Printf("[Terminal] spectator link revoked id=%s key=%s", c.Param("id"), sessionKey)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// HandleWatch attaches a spectator as an output-only writer. Everything the
+// client sends (input, resize) is discarded.
+func (h *TerminalHandler) HandleWatch(c *gin.Context) {
+	claims, err := utils.ParseToken(h.cfg.JWTSecret, c.Query("token"))
+	if err != nil || claims.Purpose != services.SpectatorPurpose {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[Terminal] watch WS upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sessionKey := h.spectators.Attach(claims.ID, conn)
+	if sessionKey == "" {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(4001, "link revoked or expired"), time.Now().Add(time.Second))
+		return
+	}
+	defer h.spectators.Detach(claims.ID, conn)
+
+	termSession, ok := h.terminal.Get(sessionKey)
+	if !ok || !termSession.IsAlive() {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(4001, "terminal not running"), time.Now().Add(time.Second))
+		return
+	}
+
+	writer := &spectatorWriter{wsWriter{conn: conn}}
+	termSession.AddWriter(writer, conn, "")
+	defer termSession.RemoveWriter(writer)
+	log.Printf("[Terminal] spectator attached id=%s key=%s", claims.ID, sessionKey)
+
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+		return nil
+	})
+	go func() {
+		ticker := time.NewTicker(wsPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+					return
+				}
+			case <-termSession.Done:
+				termSession.DrainWriter(writer, 2*time.Second)
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	// Read only to process control frames; input and resize are ignored.
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	log.Printf("[Terminal] spectator detached id=%s key=%s", claims.ID, sessionKey)
+}
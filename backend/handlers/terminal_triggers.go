@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"nebulide/config"
+	"nebulide/database"
+	"nebulide/models"
+	"nebulide/services"
+)
+
+const maxTriggersPerUser = 50
+
+type TerminalTriggersHandler struct {
+	cfg      *config.Config
+	triggers *services.TriggerService
+}
+
+func NewTerminalTriggersHandler(cfg *config.Config, triggers *services.TriggerService) *TerminalTriggersHandler {
+	return &TerminalTriggersHandler{cfg: cfg, triggers: triggers}
+}
+
+// triggerRequest is the body of Create and Update; on Update, omitted fields
+// keep their values.
+type triggerRequest struct {
+	Name        *string `json:"name"`
+	Pattern     *string `json:"pattern"`
+	InstanceID  *string `json:"instance_id"`
+	Action      *string `json:"action"`
+	DebounceSec *int    `json:"debounce_sec"`
+	Enabled     *bool   `json:"enabled"`
+}
+
+// apply copies the set fields onto t and validates the result.
+func (r *triggerRequest) apply(t *models.TerminalTrigger) string {
+	if r.Name != nil {
+		t.Name = *r.Name
+	}
+	if r.Pattern != nil {
+		t.Pattern = *r.Pattern
+	}
+	if r.InstanceID != nil {
+		t.InstanceID = *r.InstanceID
+	}
+	if r.Action != nil {
+		t.Action = *r.Action
+	}
+	if r.DebounceSec != nil {
+		t.DebounceSec = *r.DebounceSec
+	}
+	if r.Enabled != nil {
+		t.Enabled = *r.Enabled
+	}
+
+	if len(t.Name) > 100 || len(t.InstanceID) > 100 {
+		return "name and instance_id must be at most 100 characters"
+	}
+	if _, err := services.CompileTriggerPattern(t.Pattern); err != nil {
+		return "Invalid pattern: " + err.Error()
+	}
+	switch t.Action {
+	case models.TriggerNotify, models.TriggerSync, models.TriggerTelegram:
+	default:
+		return "action must be notify, sync or telegram"
+	}
+	if t.DebounceSec < 0 || t.DebounceSec > 86400 {
+		return "debounce_sec must be between 0 and 86400"
+	}
+	return ""
+}
+
+// List returns the current user's trigger rules.
+func (h *TerminalTriggersHandler) List(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var triggers []models.TerminalTrigger
+	database.DB.Where("user_id = ?", userID).Order("created_at ASC").Find(&triggers)
+	c.JSON(http.StatusOK, triggers)
+}
+
+// Create adds a trigger rule. It applies to terminal output from now on.
+func (h *TerminalTriggersHandler) Create(c *gin.Context) {
+	var req triggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var count int64
+	database.DB.Model(&models.TerminalTrigger{}).Where("user_id = ?", userID).Count(&count)
+	if count >= maxTriggersPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many triggers"})
+		return
+	}
+
+	trigger := models.TerminalTrigger{UserID: userID, Action: models.TriggerNotify, Enabled: true}
+	if msg := req.apply(&trigger); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	// Select("*") so Enabled=false is stored instead of the column default.
+	if err := database.DB.Select("*").Create(&trigger).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trigger"})
+		return
+	}
+	h.triggers.Invalidate(userID.String())
+	c.JSON(http.StatusCreated, trigger)
+}
+
+// Update changes the fields present in the body.
+func (h *TerminalTriggersHandler) Update(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var req triggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var trigger models.TerminalTrigger
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&trigger).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trigger not found"})
+		return
+	}
+	if msg := req.apply(&trigger); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if err := database.DB.Save(&trigger).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update trigger"})
+		return
+	}
+	h.triggers.Invalidate(userID.String())
+	c.JSON(http.StatusOK, trigger)
+}
+
+// Delete removes a trigger rule.
+func (h *TerminalTriggersHandler) Delete(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		Delete(&models.TerminalTrigger{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Trigger not found"})
+		return
+	}
+	h.triggers.Invalidate(userID.String())
+	c.JSON(http.StatusOK, gin.H{"message": "Trigger deleted"})
+}
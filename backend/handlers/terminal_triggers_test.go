@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/middleware"
+	"nebulide/models"
+	"nebulide/services"
+	"nebulide/testutil"
+)
+
+func setupTriggersTestRouter() (*gin.Engine, *testutil.TestContext) {
+	db := testutil.SetupTestDB()
+	cfg := testutil.TestConfig()
+	handler := NewTerminalTriggersHandler(cfg, services.NewTriggerService())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api")
+	protected.Use(middleware.AuthRequired(cfg.JWTSecret))
+	{
+		protected.GET("/terminal-triggers", handler.List)
+		protected.POST("/terminal-triggers", handler.Create)
+		protected.PUT("/terminal-triggers/:id", handler.Update)
+		protected.DELETE("/terminal-triggers/:id", handler.Delete)
+	}
+	return r, &testutil.TestContext{DB: db, Cfg: cfg}
+}
+
+func TestTerminalTriggers_CRUD(t *testing.T) {
+	router, tc := setupTriggersTestRouter()
+	user := testutil.CreateTestUser(tc.DB)
+	token := testutil.GenerateTestToken(tc.Cfg, user.ID, user.Username, false)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/terminal-triggers", `{"name":"tests","pattern":"--- FAIL","action":"telegram"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.TerminalTrigger
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, created.Enabled)
+	assert.Equal(t, models.TriggerTelegram, created.Action)
+
+	w = do("PUT", "/api/terminal-triggers/"+created.ID.String(), `{"enabled":false,"debounce_sec":5}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = do("GET", "/api/terminal-triggers", "")
+	var list []models.TerminalTrigger
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.False(t, list[0].Enabled)
+	assert.Equal(t, 5, list[0].DebounceSec)
+	assert.Equal(t, "--- FAIL", list[0].Pattern)
+
+	w = do("DELETE", "/api/terminal-triggers/"+created.ID.String(), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", "/api/terminal-triggers/"+created.ID.String(), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestTerminalTriggers_Validation(t *testing.T) {
+	router, tc := setupTriggersTestRouter()
+	user := testutil.CreateTestUser(tc.DB)
+	token := testutil.GenerateTestToken(tc.Cfg, user.ID, user.Username, false)
+
+	for _, body := range []string{
+		`{"pattern":"(unclosed"}`,
+		`{"pattern":""}`,
+		`{"pattern":"x","action":"email"}`,
+		`{"pattern":"x","debounce_sec":-1}`,
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/terminal-triggers", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,6 +22,16 @@ import (
 )
 
 func main() {
+	// `nebulide pty-holder` — the per-terminal process that keeps a shell alive
+	// across backend restarts (spawned by TerminalService, never run by hand).
+	if len(os.Args) > 1 && os.Args[1] == "pty-holder" {
+		os.Exit(services.RunPTYHolder())
+	}
+	// `nebulide sandbox-init` — PID 1 of a sandboxed terminal (see services/sandbox.go).
+	if len(os.Args) > 1 && os.Args[1] == "sandbox-init" {
+		os.Exit(services.RunSandboxInit())
+	}
+
 	cfg := config.Load()
 
 	// Database
@@ -48,6 +59,71 @@ func main() {
 	// Services
 	claudeService := services.NewClaudeService(cfg.ClaudeAllowedTools)
 	terminalService := services.NewTerminalService()
+	terminalService.ScrollbackMaxBytes = cfg.TerminalScrollbackMaxBytes
+	terminalService.Recordings = services.NewRecordingService(cfg.TerminalRecordingsDir, cfg.TerminalRecordingRetention, cfg.TerminalRecordingsMaxBytes)
+	terminalService.Recordings.RecordByDefault = cfg.TerminalRecordByDefault
+	triggerService := services.NewTriggerService()
+	terminalService.Triggers = triggerService
+	watchService := services.NewProcessWatchService()
+	terminalService.Watchers = watchService
+	portService := services.NewPortService()
+	terminalService.Ports = portService
+	if runtime.GOOS == "linux" {
+		sb := services.NewSandbox(cfg.TerminalSandboxUser, []string{cfg.WorkspacesRoot, cfg.ClaudeWorkingDir, "/root"})
+		sb.TmpSize = cfg.TerminalSandboxTmpSize
+		sb.Seccomp = cfg.TerminalSandboxSeccomp
+		if err := sb.Init(); err != nil {
+			log.Printf("[Main] terminal sandbox unavailable, non-admin terminals will fail: %v", err)
+		}
+		terminalService.Sandbox = sb
+	}
+	if cfg.TerminalCgroups {
+		cg := services.NewCgroupManager(cfg.TerminalCgroupRoot, services.CgroupLimits{
+			CPUPercent:  cfg.TerminalCPUPercent,
+			MemoryBytes: cfg.TerminalMemoryMB * 1024 * 1024,
+			PidsMax:     cfg.TerminalPidsMax,
+		})
+		cg.LimitsFor = func(userID string) services.CgroupLimits {
+			var u models.User
+			if err := database.DB.Select("terminal_cpu_percent", "terminal_memory_mb", "terminal_pids_max").
+				First(&u, "id = ?", userID).Error; err != nil {
+				return services.CgroupLimits{}
+			}
+			mem := int64(u.TerminalMemoryMB) * 1024 * 1024
+			if u.TerminalMemoryMB < 0 {
+				mem = -1
+			}
+			return services.CgroupLimits{CPUPercent: u.TerminalCPUPercent, MemoryBytes: mem, PidsMax: u.TerminalPidsMax}
+		}
+		// Limits that are on but silently not applied are worse than none:
+		// refuse to start instead.
+		if err := cg.Init(); err != nil {
+			log.Fatalf("[Main] terminal cgroups: %v (set TERMINAL_CGROUPS=false to run terminals without limits)", err)
+		}
+		terminalService.Cgroups = cg
+	}
+	terminalService.Policy = services.SessionPolicy{
+		MaxSessions:    cfg.TerminalMaxSessions,
+		HibernateAfter: cfg.TerminalHibernateAfter,
+	}
+	terminalService.PolicyFor = func(userID string) services.SessionPolicy {
+		var u models.User
+		if err := database.DB.Select("terminal_max_sessions", "terminal_hibernate_hours").
+			First(&u, "id = ?", userID).Error; err != nil {
+			return services.SessionPolicy{}
+		}
+		return services.SessionPolicy{
+			MaxSessions:    u.TerminalMaxSessions,
+			HibernateAfter: time.Duration(u.TerminalHibernateHours) * time.Hour,
+		}
+	}
+	terminalService.HibernateWarning = cfg.TerminalHibernateWarning
+	if cfg.TerminalPtyHolders {
+		terminalService.UsePtyHolders = true
+		if n := terminalService.AdoptHolders(); n > 0 {
+			log.Printf("[Main] reattached %d terminal(s) from pty-holders", n)
+		}
+	}
 	// childWatchLoop is the single source of truth for pet existence:
 	// claude descendant appears/disappears → broadcast pet_event to all devices.
 	broadcastPetEvent := func(action, userID, instanceID, workspaceID string) {
@@ -67,7 +143,94 @@ func main() {
 	terminalService.OnChildStarted = func(userID, instanceID, workspaceID string) {
 		broadcastPetEvent("launched", userID, instanceID, workspaceID)
 	}
+	// Shell exits (Ctrl+D, crash, kill) → last exit status of the terminal.
+	terminalService.OnShellExited = func(userID, instanceID string, exitCode int) {
+		err := database.DB.Model(&models.TerminalInstance{}).
+			Where("user_id = ? AND instance_id = ?", userID, instanceID).
+			Updates(map[string]interface{}{"last_exit_code": exitCode, "last_exit_at": time.Now()}).Error
+		if err != nil {
+			log.Printf("[Main] terminal exit status: %v", err)
+		}
+	}
+	// Idle terminals: warn all devices, then remember where the shell was so
+	// the next attach respawns it there.
+	terminalService.OnHibernate = func(ev services.HibernateEvent) {
+		if ev.Event == "hibernated" {
+			err := database.DB.Model(&models.TerminalInstance{}).
+				Where("user_id = ? AND instance_id = ?", ev.UserID, ev.InstanceID).
+				Updates(map[string]interface{}{"hibernated_at": ev.At, "hibernated_cwd": ev.Cwd}).Error
+			if err != nil {
+				log.Printf("[Main] terminal hibernation: %v", err)
+			}
+		}
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":        "terminal_hibernate",
+			"event":       ev.Event,
+			"instance_id": ev.InstanceID,
+			"session_id":  ev.WorkspaceID,
+			"at":          ev.At,
+		})
+		database.RDB.Publish(context.Background(), "ws:user:"+ev.UserID, string(payload))
+	}
+	// Watched processes (npm run dev, pytest, ...) starting/exiting → all devices.
+	watchService.OnEvent = func(ev services.ProcessEvent) {
+		msg := map[string]interface{}{
+			"type":        "process_event",
+			"event":       ev.Event,
+			"instance_id": ev.InstanceID,
+			"session_id":  ev.WorkspaceID,
+			"process":     ev.Process,
+		}
+		if ev.Event == "exited" {
+			msg["duration_ms"] = ev.DurationMs
+			msg["exit_code"] = ev.ExitCode
+		}
+		payload, _ := json.Marshal(msg)
+		database.RDB.Publish(context.Background(), "ws:user:"+ev.UserID, string(payload))
+	}
+	// Dev-server ports opening/closing in terminals → all devices (open via /preview with a token from /api/ports/:port/preview-token).
+	portService.OnEvent = func(ev services.PortEvent) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":        "port_event",
+			"event":       ev.Event,
+			"instance_id": ev.Port.InstanceID,
+			"session_id":  ev.WorkspaceID,
+			"port":        ev.Port,
+			"url":         "/preview/" + strconv.Itoa(ev.Port.Port) + "/",
+		})
+		database.RDB.Publish(context.Background(), "ws:user:"+ev.UserID, string(payload))
+	}
 	presenceService := services.NewPresenceService()
+	execService := services.NewExecService(terminalService)
+	execService.DefaultTimeout = cfg.ExecTimeout
+	execService.MaxTimeout = cfg.ExecMaxTimeout
+	execService.MaxOutputBytes = cfg.ExecMaxOutputBytes
+	// Background claude jobs: status and stream-json lines → all devices;
+	// the status of scheduled runs also goes to their schedule.
+	claudeJobService := services.NewClaudeJobService(terminalService, cfg.ClaudeAllowedTools)
+	claudeJobService.MaxPerUser = cfg.ClaudeJobsPerUser
+	claudeJobService.MaxLogBytes = cfg.ClaudeJobLogMaxBytes
+	claudeJobService.Timeout = cfg.ClaudeJobTimeout
+	claudeJobService.UserShell = handlers.ClaudeJobShell(cfg)
+	claudeScheduleService := services.NewClaudeScheduleService(claudeJobService)
+	approvalService := services.NewApprovalService()
+	policyService := services.NewPolicyService()
+	claudeEventService := services.NewClaudeEventService(cfg.ClaudeEventRetention)
+	claudeJobService.OnEvent = func(ev services.ClaudeJobEvent) {
+		msg := map[string]interface{}{
+			"type":  "claude_job",
+			"event": ev.Event,
+			"job":   ev.Job,
+		}
+		if ev.Event == "output" {
+			msg["line"] = ev.Line
+		}
+		payload, _ := json.Marshal(msg)
+		database.RDB.Publish(context.Background(), "ws:user:"+ev.Job.UserID.String(), string(payload))
+		if ev.Event == "status" {
+			claudeScheduleService.JobFinished(ev.Job)
+		}
+	}
 
 	// Telegram bot (optional — only starts if TELEGRAM_BOT_TOKEN is set)
 	var telegramBot *services.TelegramBot
@@ -77,11 +240,105 @@ func main() {
 			log.Printf("Telegram bot init failed: %v", err)
 		} else {
 			telegramBot = bot
+			telegramBot.Terminal = terminalService
+			telegramBot.Approvals = approvalService
 			go telegramBot.Start()
 			log.Println("Telegram bot started")
 		}
 	}
 
+	// Output triggers: every match goes to all of the user's devices as
+	// terminal_trigger; Telegram rules also message the linked account.
+	triggerService.OnMatch = func(m services.TriggerMatch) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":        "terminal_trigger",
+			"trigger_id":  m.TriggerID,
+			"name":        m.Name,
+			"action":      m.Action,
+			"instance_id": m.InstanceID,
+			"line":        m.Line,
+			"time":        m.Time,
+		})
+		database.RDB.Publish(context.Background(), "ws:user:"+m.UserID, string(payload))
+		if m.Action != models.TriggerTelegram || telegramBot == nil {
+			return
+		}
+		var u models.User
+		if err := database.DB.Select("telegram_id").First(&u, "id = ?", m.UserID).Error; err != nil || u.TelegramID == 0 {
+			return
+		}
+		title := m.Name
+		if title == "" {
+			title = "Terminal trigger"
+		}
+		if err := telegramBot.SendText(u.TelegramID, "🔔 "+title+"\n"+m.Line); err != nil {
+			log.Printf("[Main] trigger telegram: %v", err)
+		}
+	}
+
+	// Scheduled claude runs: every run → all devices as claude_schedule; a
+	// finished run of a Telegram schedule also messages the linked account.
+	claudeScheduleService.OnEvent = func(ev services.ClaudeScheduleEvent) {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":       "claude_schedule",
+			"event":      ev.Event,
+			"schedule":   ev.Schedule,
+			"job":        ev.Job,
+			"session_id": ev.Schedule.WorkspaceID,
+		})
+		database.RDB.Publish(context.Background(), "ws:user:"+ev.Schedule.UserID.String(), string(payload))
+		if ev.Event != "finished" || ev.Schedule.Notify != models.ScheduleNotifyTelegram || telegramBot == nil {
+			return
+		}
+		var u models.User
+		if err := database.DB.Select("telegram_id").First(&u, "id = ?", ev.Schedule.UserID).Error; err != nil || u.TelegramID == 0 {
+			return
+		}
+		if err := telegramBot.SendText(u.TelegramID, ev.Summary()); err != nil {
+			log.Printf("[Main] schedule telegram: %v", err)
+		}
+	}
+	// Claude permission prompts: to all devices as claude_approval; with
+	// Telegram notifications on, also to the linked account with buttons.
+	approvalService.OnEvent = func(ev services.ApprovalEvent) {
+		a := ev.Approval
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":        "claude_approval",
+			"event":       ev.Event,
+			"approval":    a,
+			"instance_id": a.InstanceID,
+		})
+		database.RDB.Publish(context.Background(), "ws:user:"+a.UserID.String(), string(payload))
+		if telegramBot == nil {
+			return
+		}
+		if ev.Event == "decided" {
+			telegramBot.CloseApproval(a)
+			return
+		}
+		var u models.User
+		if err := database.DB.Select("telegram_id", "notify_telegram").First(&u, "id = ?", a.UserID).Error; err != nil || u.TelegramID == 0 || !u.NotifyTelegram {
+			return
+		}
+		msgID, err := telegramBot.SendApproval(u.TelegramID, a)
+		if err != nil {
+			log.Printf("[Main] approval telegram: %v", err)
+			return
+		}
+		decided, err := approvalService.SetTelegramMessage(a.ID, u.TelegramID, msgID)
+		if err != nil {
+			log.Printf("[Main] approval telegram: %v", err)
+			return
+		}
+		if decided != nil {
+			telegramBot.CloseApproval(decided)
+		}
+	}
+	claudeJobService.Start()
+	claudeScheduleService.Start()
+	approvalService.Start()
+	claudeEventService.Start()
+
 	// Handlers
 	lockout := services.NewLoginLockout(database.RDB)
 	authHandler := handlers.NewAuthHandler(cfg, lockout)
@@ -94,10 +351,36 @@ func main() {
 	workspaceSessionsHandler := handlers.NewWorkspaceSessionsHandler(cfg)
 	claudeSessionsHandler := handlers.NewClaudeSessionsHandler(cfg)
 	syncHandler := handlers.NewSyncHandler(cfg, presenceService, terminalService)
-	hookHandler := handlers.NewHookHandler(cfg)
+	hookHandler := handlers.NewHookHandler(cfg, approvalService, policyService, claudeEventService)
+	claudeEventsHandler := handlers.NewClaudeEventsHandler()
+	claudeApprovalsHandler := handlers.NewClaudeApprovalsHandler(approvalService)
+	claudePolicyHandler := handlers.NewClaudePolicyHandler(policyService)
 	llmHandler := handlers.NewLLMHandler(cfg)
 	skillsHandler := handlers.NewSkillsHandler(cfg)
 	glmStatusHandler := handlers.NewGLMStatusHandler(cfg)
+	execHandler := handlers.NewExecHandler(cfg, execService)
+	claudeJobsHandler := handlers.NewClaudeJobsHandler(cfg, claudeJobService)
+	claudeSchedulesHandler := handlers.NewClaudeSchedulesHandler(cfg, claudeScheduleService)
+	triggersHandler := handlers.NewTerminalTriggersHandler(cfg, triggerService)
+	profilesHandler := handlers.NewTerminalProfilesHandler(cfg)
+	instancesHandler := handlers.NewTerminalInstancesHandler(cfg, terminalService)
+	watchersHandler := handlers.NewProcessWatchersHandler(cfg, watchService)
+	previewHandler := handlers.NewPreviewHandler(cfg, portService)
+	sshKeysHandler := handlers.NewSSHKeysHandler(cfg)
+
+	// SSH gateway into the same terminals (see handlers.SSHGateway)
+	if cfg.SSHListenAddr != "" {
+		gateway, err := handlers.NewSSHGateway(cfg, terminalService)
+		if err != nil {
+			log.Printf("[Main] SSH gateway disabled: %v", err)
+		} else {
+			go func() {
+				if err := gateway.ListenAndServe(cfg.SSHListenAddr); err != nil {
+					log.Printf("[Main] SSH gateway stopped: %v", err)
+				}
+			}()
+		}
+	}
 
 	// Router
 	r := gin.Default()
@@ -197,8 +480,10 @@ func main() {
 		admin.GET("/users", adminHandler.ListUsers)
 		admin.GET("/users/:id", adminHandler.GetUser)
 		admin.DELETE("/users/:id", adminHandler.DeleteUser)
+		admin.PUT("/users/:id/limits", adminHandler.SetUserLimits)
 		admin.GET("/users/:id/terminals", adminHandler.ListTerminals)
 		admin.DELETE("/users/:id/terminals/:instanceId", adminHandler.KillTerminal)
+		admin.GET("/users/:id/terminals/:instanceId/screen", adminHandler.TerminalScreen)
 		admin.GET("/users/:id/sessions", adminHandler.ListUserSessions)
 		admin.DELETE("/users/:id/sessions/:sessionId", adminHandler.DeleteUserSession)
 		admin.GET("/users/:id/workspace/stats", adminHandler.WorkspaceStats)
@@ -206,6 +491,11 @@ func main() {
 		admin.GET("/stats", adminHandler.Stats)
 		admin.GET("/monitoring", adminHandler.Monitoring)
 		admin.DELETE("/kill-process/:pid", adminHandler.KillProcess)
+		admin.GET("/claude-policy/rules", claudePolicyHandler.ListRules)
+		admin.POST("/claude-policy/rules", claudePolicyHandler.CreateRule)
+		admin.PUT("/claude-policy/rules/:id", claudePolicyHandler.UpdateRule)
+		admin.DELETE("/claude-policy/rules/:id", claudePolicyHandler.DeleteRule)
+		admin.GET("/claude-policy/denials", claudePolicyHandler.ListDenials)
 
 		// Files
 		protected.GET("/files", filesHandler.List)
@@ -230,7 +520,85 @@ func main() {
 		protected.GET("/skills/read", skillsHandler.Read)
 
 		// Terminal management (user kills own sessions)
+		protected.POST("/terminal-input", terminalHandler.BroadcastInput)
 		protected.DELETE("/terminals/:instanceId", terminalHandler.KillTerminal)
+		protected.POST("/terminals/:instanceId/recording", terminalHandler.StartRecording)
+		protected.DELETE("/terminals/:instanceId/recording", terminalHandler.StopRecording)
+		protected.GET("/terminals/:instanceId/scrollback", terminalHandler.Scrollback)
+		protected.GET("/terminals/:instanceId/screen", terminalHandler.Screen)
+		protected.GET("/terminals/:instanceId/commands", terminalHandler.Commands)
+		protected.GET("/terminals/:instanceId/commands/:seq", terminalHandler.CommandOutput)
+		protected.GET("/terminals/:instanceId/processes", terminalHandler.Processes)
+		protected.POST("/terminals/:instanceId/processes/signal", terminalHandler.SignalProcess)
+		protected.POST("/terminals/:instanceId/spectators", terminalHandler.CreateSpectator)
+		protected.GET("/terminals/:instanceId/spectators", terminalHandler.ListSpectators)
+		protected.DELETE("/terminals/:instanceId/spectators/:id", terminalHandler.RevokeSpectator)
+
+		// Non-interactive exec (streams NDJSON/SSE) + history
+		protected.POST("/exec", execHandler.Run)
+		protected.GET("/exec", execHandler.List)
+		protected.GET("/exec/:id", execHandler.Get)
+
+		// Background claude jobs
+		protected.GET("/claude-jobs", claudeJobsHandler.List)
+		protected.POST("/claude-jobs", claudeJobsHandler.Create)
+		protected.GET("/claude-jobs/:id", claudeJobsHandler.Get)
+		protected.GET("/claude-jobs/:id/log", claudeJobsHandler.Log)
+		protected.POST("/claude-jobs/:id/cancel", claudeJobsHandler.Cancel)
+		protected.POST("/claude-jobs/:id/retry", claudeJobsHandler.Retry)
+
+		// Scheduled claude runs
+		protected.GET("/claude-schedules", claudeSchedulesHandler.List)
+		protected.POST("/claude-schedules", claudeSchedulesHandler.Create)
+		protected.PUT("/claude-schedules/:id", claudeSchedulesHandler.Update)
+		protected.DELETE("/claude-schedules/:id", claudeSchedulesHandler.Delete)
+		protected.POST("/claude-schedules/:id/run", claudeSchedulesHandler.Run)
+		protected.GET("/claude-schedules/:id/runs", claudeSchedulesHandler.Runs)
+
+		// Claude permission prompts answered from the web
+		protected.GET("/claude-approvals", claudeApprovalsHandler.List)
+		protected.POST("/claude-approvals/:id/decision", claudeApprovalsHandler.Decide)
+		protected.GET("/claude-events", claudeEventsHandler.List)
+
+		// Output triggers
+		protected.GET("/terminal-triggers", triggersHandler.List)
+		protected.POST("/terminal-triggers", triggersHandler.Create)
+		protected.PUT("/terminal-triggers/:id", triggersHandler.Update)
+		protected.DELETE("/terminal-triggers/:id", triggersHandler.Delete)
+
+		// Terminal profiles (?profile= on /ws/terminal)
+		protected.GET("/terminal-profiles", profilesHandler.List)
+		protected.POST("/terminal-profiles", profilesHandler.Create)
+		protected.PUT("/terminal-profiles/:id", profilesHandler.Update)
+		protected.DELETE("/terminal-profiles/:id", profilesHandler.Delete)
+
+		// Terminal metadata (names, workdir, last exit) shared by all devices
+		protected.GET("/terminal-instances", instancesHandler.List)
+		protected.POST("/terminal-instances", instancesHandler.Create)
+		protected.GET("/terminal-instances/:instanceId", instancesHandler.Get)
+		protected.PUT("/terminal-instances/:instanceId", instancesHandler.Update)
+		protected.DELETE("/terminal-instances/:instanceId", instancesHandler.Delete)
+
+		// Ports listened on by the user's terminals (see /preview)
+		protected.GET("/ports", previewHandler.Ports)
+		protected.POST("/ports/:port/preview-token", previewHandler.Token)
+
+		// Public keys for the SSH gateway
+		protected.GET("/ssh-keys", sshKeysHandler.List)
+		protected.POST("/ssh-keys", sshKeysHandler.Create)
+		protected.DELETE("/ssh-keys/:id", sshKeysHandler.Delete)
+
+		// Process watchers
+		protected.GET("/process-watchers", watchersHandler.List)
+		protected.POST("/process-watchers", watchersHandler.Create)
+		protected.PUT("/process-watchers/:id", watchersHandler.Update)
+		protected.DELETE("/process-watchers/:id", watchersHandler.Delete)
+
+		// Terminal recordings (asciicast v2)
+		protected.GET("/terminal-recordings", terminalHandler.ListRecordings)
+		protected.GET("/terminal-recordings/:id", terminalHandler.DownloadRecording)
+		protected.GET("/terminal-recordings/:id/replay", terminalHandler.ReplayRecording)
+		protected.DELETE("/terminal-recordings/:id", terminalHandler.DeleteRecording)
 
 		// Claude CLI sessions & plans
 		protected.GET("/claude-sessions", claudeSessionsHandler.List)
@@ -257,6 +625,7 @@ func main() {
 	// WebSocket routes (auth via query param)
 	r.GET("/ws/chat/:id", chatHandler.HandleWebSocket)
 	r.GET("/ws/terminal", terminalHandler.HandleWebSocket)
+	r.GET("/ws/terminal/watch", terminalHandler.HandleWatch)
 	r.GET("/ws/sync", syncHandler.HandleWebSocket)
 
 	// Code-server reverse proxy (auth via ?token= query param or cookie)
@@ -264,6 +633,11 @@ func main() {
 	codeGroup.Use(handlers.CodeServerAuthMiddleware(cfg.JWTSecret))
 	codeGroup.Any("/*path", handlers.CodeServerProxy())
 
+	// Dev-server preview: ports owned by the user's terminals (own auth — port-scoped preview tokens)
+	previewGroup := r.Group("/preview")
+	previewGroup.Use(handlers.PreviewAuthMiddleware(cfg.JWTSecret))
+	previewGroup.Any("/:port/*path", previewHandler.Proxy)
+
 	// Serve frontend static files
 	r.Static("/assets", "./static/assets")
 	r.Static("/sprites", "./static/sprites")
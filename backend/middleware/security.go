@@ -6,6 +6,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// previewCSP is the policy of /preview/*: scripts, forms and popups work,
+// but the page never shares the IDE's origin.
+const previewCSP = "sandbox allow-scripts allow-forms allow-popups allow-modals allow-downloads"
+
 func SecurityHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("X-Content-Type-Options", "nosniff")
@@ -14,8 +18,15 @@ func SecurityHeaders() gin.HandlerFunc {
 		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
 		c.Header("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
 
-		// Skip CSP for code-server proxy (it sets its own via ModifyResponse in proxy.go)
-		if !strings.HasPrefix(c.Request.URL.Path, "/code/") {
+		// code-server sets its own CSP via ModifyResponse in proxy.go.
+		// Dev-server previews run arbitrary HTML/JS on our origin: sandbox them
+		// into an opaque origin so they can't read the IDE's tokens (localStorage)
+		// or call its API as the user. No allow-same-origin, ever.
+		switch {
+		case strings.HasPrefix(c.Request.URL.Path, "/code/"):
+		case strings.HasPrefix(c.Request.URL.Path, "/preview/"):
+			c.Header("Content-Security-Policy", previewCSP)
+		default:
 			c.Header("Content-Security-Policy",
 				"default-src 'self'; "+
 					"script-src 'self' 'unsafe-eval' 'unsafe-inline' blob:; "+
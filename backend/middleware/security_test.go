@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders_CSP(t *testing.T) {
+	r := gin.New()
+	r.Use(SecurityHeaders())
+	r.GET("/*path", func(c *gin.Context) {
+		// A dev server trying to lift the sandbox only adds a second policy.
+		c.Writer.Header().Add("Content-Security-Policy", "default-src *")
+		c.Status(http.StatusOK)
+	})
+	csp := func(path string) []string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		return w.Header().Values("Content-Security-Policy")
+	}
+
+	preview := csp("/preview/5173/index.html")
+	assert.Equal(t, previewCSP, preview[0])
+	assert.Contains(t, preview[0], "sandbox allow-scripts")
+	assert.NotContains(t, preview[0], "allow-same-origin")
+
+	assert.Contains(t, csp("/api/health")[0], "default-src 'self'")
+	assert.Equal(t, []string{"default-src *"}, csp("/code/"))
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ClaudeApproval statuses.
+const (
+	ApprovalPending  = "pending"
+	ApprovalAllowed  = "allowed"
+	ApprovalDenied   = "denied"
+	ApprovalExpired  = "expired"  // nobody decided in time; the server default applied
+	ApprovalCanceled = "canceled" // claude stopped waiting (answered in the terminal, interrupted)
+)
+
+// ClaudeApproval is a claude permission prompt waiting for the user's
+// decision from any device (see services.ApprovalService).
+type ClaudeApproval struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	InstanceID string         `gorm:"size:100" json:"instance_id"`
+	SessionID  string         `gorm:"size:100" json:"session_id"` // Claude session
+	Cwd        string         `gorm:"size:1024" json:"cwd"`
+	Tool       string         `gorm:"size:100" json:"tool"`
+	ToolInput  datatypes.JSON `gorm:"type:jsonb" json:"tool_input"`
+	Status     string         `gorm:"size:20;not null;index" json:"status"`
+	DecidedVia string         `gorm:"size:20" json:"decided_via,omitempty"` // "web", "telegram" or "timeout"
+	Message    string         `gorm:"size:1000" json:"message,omitempty"`   // the reason given to claude on deny
+
+	TelegramChatID    int64 `json:"-"` // the Telegram prompt with the buttons, to close it once decided
+	TelegramMessageID int   `json:"-"`
+
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	DecidedAt *time.Time `json:"decided_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (a *ClaudeApproval) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ClaudeEvent is one Claude Code hook event of a user's claude, kept as the
+// activity timeline of its sessions (see services.ClaudeEventService).
+// Rows are only appended, and removed by the retention.
+type ClaudeEvent struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	InstanceID string         `gorm:"size:100;index" json:"instance_id"` // the terminal claude runs in
+	SessionID  string         `gorm:"size:100;index" json:"session_id"`  // Claude session
+	Event      string         `gorm:"size:50;not null" json:"event"`     // hook event name, e.g. PreToolUse
+	Tool       string         `gorm:"size:100;index" json:"tool,omitempty"`
+	ToolInput  datatypes.JSON `gorm:"type:jsonb" json:"tool_input,omitempty"` // long strings and lists trimmed
+	Cwd        string         `gorm:"size:1024" json:"cwd,omitempty"`
+	Status     string         `gorm:"size:50" json:"status,omitempty"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at"` // UTC, compared as such in range queries
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (e *ClaudeEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ClaudeJob statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// ClaudeJob is a `claude -p` run in the background, independent of any open
+// connection (see services.ClaudeJobService).
+type ClaudeJob struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Prompt          string     `gorm:"type:text;not null" json:"prompt"`
+	WorkDir         string     `gorm:"size:1024" json:"work_dir"`
+	Model           string     `gorm:"size:100" json:"model"`
+	AllowedTools    string     `gorm:"size:1000" json:"allowed_tools"`
+	ResumeSessionID string     `gorm:"size:100" json:"resume_session_id"`
+	Provider        string     `gorm:"size:20" json:"provider"` // as ?provider= of terminals, e.g. "glm"
+	Source          string     `gorm:"size:50" json:"source"`   // who queued it: "api", "schedule", ...
+	RetryOf         *uuid.UUID `gorm:"type:uuid" json:"retry_of"`
+	ScheduleID      *uuid.UUID `gorm:"type:uuid;index" json:"schedule_id"` // the ClaudeSchedule it is a run of
+	Status          string     `gorm:"size:20;not null;index" json:"status"`
+
+	SessionID    string  `gorm:"size:100" json:"session_id"` // Claude session, for a follow-up job's resume
+	Result       string  `gorm:"type:text" json:"result"`
+	Error        string  `gorm:"type:text" json:"error,omitempty"`
+	CostUSD      float64 `json:"cost_usd"`
+	NumTurns     int     `json:"num_turns"`
+	ExitCode     *int    `json:"exit_code"`
+	Log          string  `gorm:"type:text;not null;default:''" json:"-"` // stream-json output, one event per line
+	LogBytes     int64   `json:"log_bytes"`
+	LogTruncated bool    `json:"log_truncated"`
+
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (j *ClaudeJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == uuid.Nil {
+		j.ID = uuid.New()
+	}
+	return nil
+}
+
+// Finished reports whether the job is done, one way or another.
+func (j *ClaudeJob) Finished() bool {
+	return j.Status != JobQueued && j.Status != JobRunning
+}
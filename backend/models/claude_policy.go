@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ClaudePolicyRule actions; when several rules match a call the strictest wins.
+const (
+	PolicyAllow = "allow" // run without the permission prompt
+	PolicyAsk   = "ask"   // always ask the user, even if claude's settings allow it
+	PolicyDeny  = "deny"  // block the call; the reason is told to claude
+)
+
+// ClaudePolicyRule is a server-side guardrail checked before every claude
+// tool call (PreToolUse hook, see services.PolicyService). Empty conditions
+// match anything, but a rule has at least one.
+type ClaudePolicyRule struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID           *uuid.UUID `gorm:"type:uuid;index" json:"user_id"` // nil: every user
+	Name             string     `gorm:"size:100" json:"name"`
+	Tool             string     `gorm:"size:200" json:"tool"`                            // Go regexp for the whole tool name, e.g. "Write|Edit"
+	CommandPattern   string     `gorm:"size:512" json:"command_pattern"`                 // Go regexp searched in tool_input.command (Bash)
+	PathGlob         string     `gorm:"size:512" json:"path_glob"`                       // glob for the file the tool touches; unless it starts with "/" it matches at any depth
+	OutsideWorkspace bool       `gorm:"not null;default:false" json:"outside_workspace"` // only calls that reach outside the user's workspace
+	Action           string     `gorm:"size:10;not null" json:"action"`
+	Reason           string     `gorm:"size:500" json:"reason"` // told to claude on deny and ask
+	Enabled          bool       `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (r *ClaudePolicyRule) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// ClaudePolicyDenial records a tool call a policy rule blocked.
+type ClaudePolicyDenial struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primaryKey" json:"id"`
+	RuleID     uuid.UUID      `gorm:"type:uuid;index" json:"rule_id"`
+	UserID     uuid.UUID      `gorm:"type:uuid;not null;index" json:"user_id"`
+	InstanceID string         `gorm:"size:100" json:"instance_id"`
+	SessionID  string         `gorm:"size:100" json:"session_id"` // Claude session
+	Cwd        string         `gorm:"size:1024" json:"cwd"`
+	Tool       string         `gorm:"size:100" json:"tool"`
+	ToolInput  datatypes.JSON `gorm:"type:jsonb" json:"tool_input"`
+	Reason     string         `gorm:"size:500" json:"reason"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at"`
+}
+
+func (d *ClaudePolicyDenial) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
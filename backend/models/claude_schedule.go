@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ClaudeSchedule notification targets for finished runs.
+const (
+	ScheduleNotifyWS       = "ws"       // claude_schedule event on the sync WebSocket only
+	ScheduleNotifyTelegram = "telegram" // Telegram message (plus the sync event)
+)
+
+// ClaudeSchedule is a recurring headless claude run: on every match of Cron a
+// ClaudeJob with the schedule's prompt is queued (see
+// services.ClaudeScheduleService).
+type ClaudeSchedule struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	WorkspaceID  string    `gorm:"size:100;index" json:"workspace_id"` // the app workspace it belongs to; empty: none
+	Name         string    `gorm:"size:100" json:"name"`
+	Cron         string    `gorm:"size:100;not null" json:"cron"` // five fields or @daily etc.
+	Timezone     string    `gorm:"size:64" json:"timezone"`       // IANA name; empty: the server's
+	Prompt       string    `gorm:"type:text;not null" json:"prompt"`
+	WorkDir      string    `gorm:"size:1024" json:"work_dir"`
+	Model        string    `gorm:"size:100" json:"model"`
+	AllowedTools string    `gorm:"size:1000" json:"allowed_tools"`
+	Provider     string    `gorm:"size:20" json:"provider"`
+	Notify       string    `gorm:"size:20;not null" json:"notify"`
+	Enabled      bool      `gorm:"not null;default:true" json:"enabled"`
+
+	NextRunAt  *time.Time `gorm:"index" json:"next_run_at"` // nil while disabled
+	LastRunAt  *time.Time `json:"last_run_at"`
+	LastJobID  *uuid.UUID `gorm:"type:uuid" json:"last_job_id"`
+	LastStatus string     `gorm:"size:20" json:"last_status"` // of the last run's job
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (s *ClaudeSchedule) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
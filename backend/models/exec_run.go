@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExecRun statuses.
+const (
+	ExecRunning     = "running"
+	ExecExited      = "exited"
+	ExecTimeout     = "timeout"
+	ExecOutputLimit = "output_limit"
+	ExecCanceled    = "canceled"
+	ExecFailed      = "failed"
+)
+
+// ExecRun is one non-interactive command run through POST /api/exec.
+type ExecRun struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Command     string     `gorm:"type:text;not null" json:"command"`
+	WorkDir     string     `gorm:"size:1024" json:"work_dir"`
+	Source      string     `gorm:"size:50" json:"source"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	ExitCode    *int       `json:"exit_code"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	OutputBytes int64      `json:"output_bytes"`
+	Output      string     `gorm:"type:text" json:"output,omitempty"` // combined stdout+stderr, last ExecService.HistoryOutputBytes
+	DurationMs  int64      `json:"duration_ms"`
+	StartedAt   time.Time  `gorm:"index" json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (r *ExecRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
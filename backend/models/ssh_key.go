@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SSHKey is a public key that logs its owner into the SSH gateway.
+type SSHKey struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name        string     `gorm:"size:100" json:"name"`
+	PublicKey   string     `gorm:"type:text;not null" json:"public_key"`             // authorized_keys format
+	Fingerprint string     `gorm:"size:100;not null;uniqueIndex" json:"fingerprint"` // SHA256:...
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (k *SSHKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
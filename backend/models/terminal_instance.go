@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TerminalInstance is what is known about one of a user's terminals (an
+// instanceId of /ws/terminal) beyond the in-memory session, so the terminal
+// list survives restarts and is the same on every device.
+type TerminalInstance struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID             uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_terminal_instances_user_instance" json:"user_id"`
+	InstanceID         string     `gorm:"size:100;not null;uniqueIndex:idx_terminal_instances_user_instance" json:"instance_id"`
+	Name               string     `gorm:"size:100" json:"name"`
+	WorkspaceSessionID string     `gorm:"size:64;index" json:"workspace_session_id"` // the @ws: suffix of the last attach
+	WorkDir            string     `gorm:"size:1024" json:"workdir"`                  // where the current shell started
+	Profile            string     `gorm:"size:100" json:"profile"`                   // TerminalProfile name the shell started with
+	LastAttachedAt     *time.Time `json:"last_attached_at"`
+	LastExitCode       *int       `json:"last_exit_code"` // of the previous shell; -1 when killed
+	LastExitAt         *time.Time `json:"last_exit_at"`
+	HibernatedAt       *time.Time `json:"hibernated_at"`                   // set while the shell is hibernated (idle, hung up)
+	HibernatedCwd      string     `gorm:"size:1024" json:"hibernated_cwd"` // where the next shell starts
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (t *TerminalInstance) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
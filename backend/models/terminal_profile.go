@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// TerminalProfile is a per-user preset applied when a terminal is opened with
+// ?profile=<name>: which shell to start, where, with what environment and
+// what to run first.
+type TerminalProfile struct {
+	ID             uuid.UUID                             `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID         uuid.UUID                             `gorm:"type:uuid;not null;uniqueIndex:idx_terminal_profiles_user_name" json:"user_id"`
+	Name           string                                `gorm:"size:100;not null;uniqueIndex:idx_terminal_profiles_user_name" json:"name"`
+	Shell          string                                `gorm:"size:255" json:"shell"`   // empty: the default shell
+	WorkDir        string                                `gorm:"size:512" json:"workdir"` // relative to the workspace root
+	Env            datatypes.JSONType[map[string]string] `json:"env"`
+	StartupCommand string                                `gorm:"size:2000" json:"startup_command"` // typed into a new shell
+	Provider       string                                `gorm:"size:20" json:"provider"`          // as ?provider=, e.g. "glm"
+	CreatedAt      time.Time                             `json:"created_at"`
+	UpdatedAt      time.Time                             `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (p *TerminalProfile) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TerminalTrigger actions.
+const (
+	TriggerNotify   = "notify"   // desktop/mobile notification in the app
+	TriggerSync     = "sync"     // silent event for the UI (badges, auto-focus)
+	TriggerTelegram = "telegram" // Telegram message (plus the sync event)
+)
+
+// TerminalTrigger is a per-user rule matched against terminal output.
+type TerminalTrigger struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name        string    `gorm:"size:100" json:"name"`
+	Pattern     string    `gorm:"size:512;not null" json:"pattern"` // Go regexp, matched per line with escape sequences stripped
+	InstanceID  string    `gorm:"size:100" json:"instance_id"`      // empty: every terminal of the user
+	Action      string    `gorm:"size:20;not null" json:"action"`
+	DebounceSec int       `json:"debounce_sec"` // per terminal; 0 means the default
+	Enabled     bool      `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (t *TerminalTrigger) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
@@ -16,11 +16,19 @@ type User struct {
 	IsAdmin      bool      `gorm:"default:false" json:"is_admin"`
 	TelegramID   int64     `gorm:"default:0" json:"telegram_id"`
 	// Opt-in: notify this user in Telegram when claude finishes / waits for input. Off by default.
-	NotifyTelegram bool    `gorm:"default:false" json:"notify_telegram"`
-	ThemeJSON       string    `gorm:"type:text;default:'{}'" json:"-"`
-	PreferencesJSON string    `gorm:"type:text;default:'{}'" json:"-"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	NotifyTelegram bool `gorm:"default:false" json:"notify_telegram"`
+	// Terminal cgroup overrides: 0 = server default, -1 = unlimited.
+	TerminalCPUPercent int `gorm:"default:0" json:"terminal_cpu_percent"`
+	TerminalMemoryMB   int `gorm:"default:0" json:"terminal_memory_mb"`
+	TerminalPidsMax    int `gorm:"default:0" json:"terminal_pids_max"`
+	// Terminal policy overrides, same convention: attached sessions at once
+	// and hours an idle, unattached shell lives before hibernation.
+	TerminalMaxSessions    int       `gorm:"default:0" json:"terminal_max_sessions"`
+	TerminalHibernateHours int       `gorm:"default:0" json:"terminal_hibernate_hours"`
+	ThemeJSON              string    `gorm:"type:text;default:'{}'" json:"-"`
+	PreferencesJSON        string    `gorm:"type:text;default:'{}'" json:"-"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) error {
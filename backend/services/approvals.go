@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Remote approval of claude permission prompts ──
+//
+// Claude Code's PermissionRequest hook blocks in Request until the user
+// decides from any device (web or Telegram), the timeout passes or the hook
+// goes away. The request is a ClaudeApproval row, so every device can list
+// and answer it; the waiting hook is only in memory, and requests a restart
+// left pending are expired by Start.
+
+// maxApprovalWait keeps the wait under the timeout claude gives the hook.
+const maxApprovalWait = permissionHookTimeoutSec*time.Second - time.Minute
+
+var (
+	ErrApprovalNotFound = errors.New("approval not found")
+	ErrApprovalDecided  = errors.New("approval has already been decided")
+)
+
+// ApprovalEvent is a permission prompt being raised ("requested") or
+// resolved one way or another ("decided").
+type ApprovalEvent struct {
+	Event    string
+	Approval *models.ClaudeApproval
+}
+
+type ApprovalService struct {
+	// OnEvent is called in its own goroutine for every request and decision.
+	OnEvent func(ApprovalEvent)
+
+	mu      sync.Mutex
+	waiting map[uuid.UUID]chan struct{} // closed once decided
+}
+
+func NewApprovalService() *ApprovalService {
+	return &ApprovalService{waiting: make(map[uuid.UUID]chan struct{})}
+}
+
+// Start expires the requests a previous backend process left pending.
+func (s *ApprovalService) Start() {
+	now := time.Now()
+	res := database.DB.Model(&models.ClaudeApproval{}).Where("status = ?", models.ApprovalPending).
+		Updates(map[string]interface{}{"status": models.ApprovalExpired, "decided_at": now})
+	if res.RowsAffected > 0 {
+		log.Printf("[Approvals] %d approval(s) left by the restart expired", res.RowsAffected)
+	}
+}
+
+// Request stores a pending approval and waits up to timeout for a decision.
+// Returns the approval as resolved: allowed, denied, expired (timeout) or
+// canceled (ctx done: the hook is gone).
+func (s *ApprovalService) Request(ctx context.Context, a *models.ClaudeApproval, timeout time.Duration) (*models.ClaudeApproval, error) {
+	timeout = min(timeout, maxApprovalWait)
+	a.ID = uuid.Nil
+	a.Status = models.ApprovalPending
+	a.ExpiresAt = time.Now().Add(timeout)
+	if err := database.DB.Create(a).Error; err != nil {
+		return nil, err
+	}
+	decided := make(chan struct{})
+	s.mu.Lock()
+	s.waiting[a.ID] = decided
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiting, a.ID)
+		s.mu.Unlock()
+	}()
+	log.Printf("[Approvals] requested id=%s user=%s tool=%s instance=%s", a.ID, a.UserID, a.Tool, a.InstanceID)
+	s.emit(ApprovalEvent{Event: "requested", Approval: a})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-decided:
+	case <-timer.C:
+		s.resolve(a.ID, models.ApprovalExpired, "timeout", "")
+	case <-ctx.Done():
+		s.resolve(a.ID, models.ApprovalCanceled, "", "")
+	}
+
+	var out models.ClaudeApproval
+	if err := database.DB.First(&out, "id = ?", a.ID).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Decide allows or denies one of the user's pending approvals. via is where
+// the answer came from ("web", "telegram"); message is told to claude on deny.
+func (s *ApprovalService) Decide(userID, id uuid.UUID, allow bool, via, message string) error {
+	var count int64
+	database.DB.Model(&models.ClaudeApproval{}).Where("id = ? AND user_id = ?", id, userID).Count(&count)
+	if count == 0 {
+		return ErrApprovalNotFound
+	}
+	status := models.ApprovalDenied
+	if allow {
+		status = models.ApprovalAllowed
+	}
+	if !s.resolve(id, status, via, message) {
+		return ErrApprovalDecided
+	}
+	return nil
+}
+
+// resolve moves a pending approval to its final status, wakes its hook and
+// fires "decided". False if it was no longer pending.
+func (s *ApprovalService) resolve(id uuid.UUID, status, via, message string) bool {
+	now := time.Now()
+	res := database.DB.Model(&models.ClaudeApproval{}).Where("id = ? AND status = ?", id, models.ApprovalPending).
+		Updates(map[string]interface{}{"status": status, "decided_via": via, "message": message, "decided_at": now})
+	if res.RowsAffected == 0 {
+		return false
+	}
+	s.mu.Lock()
+	if ch, ok := s.waiting[id]; ok {
+		close(ch)
+	}
+	s.mu.Unlock()
+
+	var a models.ClaudeApproval
+	if err := database.DB.First(&a, "id = ?", id).Error; err == nil {
+		log.Printf("[Approvals] %s id=%s via=%s", status, id, via)
+		s.emit(ApprovalEvent{Event: "decided", Approval: &a})
+	}
+	return true
+}
+
+// SetTelegramMessage records the Telegram prompt sent for an approval. The
+// send races the decision: if the approval was decided meanwhile, "decided"
+// found no message to close, so the decided approval is returned for the
+// caller to close.
+func (s *ApprovalService) SetTelegramMessage(id uuid.UUID, chatID int64, messageID int) (*models.ClaudeApproval, error) {
+	sent := map[string]interface{}{"telegram_chat_id": chatID, "telegram_message_id": messageID}
+	res := database.DB.Model(&models.ClaudeApproval{}).Where("id = ? AND status = ?", id, models.ApprovalPending).Updates(sent)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return nil, res.Error
+	}
+	if err := database.DB.Model(&models.ClaudeApproval{}).Where("id = ?", id).Updates(sent).Error; err != nil {
+		return nil, err
+	}
+	var a models.ClaudeApproval
+	if err := database.DB.First(&a, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *ApprovalService) emit(ev ApprovalEvent) {
+	if s.OnEvent != nil {
+		go s.OnEvent(ev)
+	}
+}
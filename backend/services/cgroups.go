@@ -0,0 +1,247 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ── Per-user cgroup v2 limits for terminal shells ──
+//
+// Every sandboxed shell starts inside <Root>/user-<userID>, a cgroup carrying
+// the user's cpu.max, memory.max and pids.max. The child is cloned straight
+// into it (CLONE_INTO_CGROUP, see withCgroup), so nothing it forks can slip
+// out before the limits hold. All shells (and everything they spawn) of one
+// user share the budget, so a fork bomb or a runaway build only starves its
+// owner. Limits are re-applied for every new shell, so a changed override
+// takes effect with the next one (or immediately via Apply).
+
+const cgroupMount = "/sys/fs/cgroup"
+
+// cgroupControllers are the controllers delegated to the terminal cgroups.
+var cgroupControllers = []string{"cpu", "memory", "pids"}
+
+// CgroupLimits is a resource budget. Zero means unlimited.
+type CgroupLimits struct {
+	CPUPercent  int   `json:"cpu_percent"` // 100 = one full core
+	MemoryBytes int64 `json:"memory_bytes"`
+	PidsMax     int   `json:"pids_max"`
+}
+
+// Override returns l with the per-user values of o applied: 0 keeps the
+// default, a negative value lifts the limit.
+func (l CgroupLimits) Override(o CgroupLimits) CgroupLimits {
+	pick := func(def, v int64) int64 {
+		switch {
+		case v > 0:
+			return v
+		case v < 0:
+			return 0
+		}
+		return def
+	}
+	return CgroupLimits{
+		CPUPercent:  int(pick(int64(l.CPUPercent), int64(o.CPUPercent))),
+		MemoryBytes: pick(l.MemoryBytes, o.MemoryBytes),
+		PidsMax:     int(pick(int64(l.PidsMax), int64(o.PidsMax))),
+	}
+}
+
+// CgroupUsage is the current consumption of one user's cgroup.
+type CgroupUsage struct {
+	UserID        string       `json:"user_id"`
+	Limits        CgroupLimits `json:"limits"`
+	MemoryBytes   int64        `json:"memory_bytes"`
+	PeakMemory    int64        `json:"memory_peak_bytes"`
+	Pids          int          `json:"pids"`
+	CPUUsageUsec  int64        `json:"cpu_usage_usec"`
+	ThrottledUsec int64        `json:"cpu_throttled_usec"`
+	OOMKills      int64        `json:"oom_kills"`
+}
+
+type CgroupManager struct {
+	// Root is the cgroup directory holding the per-user cgroups.
+	Root string
+	// Defaults apply to users without overrides.
+	Defaults CgroupLimits
+	// LimitsFor returns a user's overrides (see CgroupLimits.Override). Optional.
+	LimitsFor func(userID string) CgroupLimits
+
+	mu      sync.Mutex
+	enabled bool
+}
+
+func NewCgroupManager(root string, defaults CgroupLimits) *CgroupManager {
+	return &CgroupManager{Root: root, Defaults: defaults}
+}
+
+// Init checks for cgroup v2 and delegates the controllers down to Root.
+// On failure the manager stays disabled and Prepare is a no-op.
+func (m *CgroupManager) Init() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("cgroups require linux")
+	}
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return errors.New("cgroup v2 is not mounted at " + cgroupMount)
+	}
+	parent := filepath.Dir(m.Root)
+	if err := enableControllers(parent); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Root, 0o755); err != nil {
+		return err
+	}
+	if err := enableControllers(m.Root); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.enabled = true
+	m.mu.Unlock()
+	log.Printf("[Cgroups] terminal cgroups at %s defaults=%+v", m.Root, m.Defaults)
+	return nil
+}
+
+// enableControllers turns on cpu/memory/pids for the children of dir. cgroup v2
+// forbids that while dir itself has processes ("no internal processes"), which
+// is the case for a container's root cgroup: the processes there are moved to
+// a "backend" child first.
+func enableControllers(dir string) error {
+	ctl := filepath.Join(dir, "cgroup.subtree_control")
+	val := "+" + strings.Join(cgroupControllers, " +")
+	err := os.WriteFile(ctl, []byte(val), 0o644)
+	if err == nil || !errors.Is(err, syscall.EBUSY) {
+		return err
+	}
+	leaf := filepath.Join(dir, "backend")
+	if err := os.MkdirAll(leaf, 0o755); err != nil {
+		return err
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	for _, pid := range strings.Fields(string(data)) {
+		// Kernel threads and exiting processes refuse to move; that's fine.
+		os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(pid), 0o644)
+	}
+	return os.WriteFile(ctl, []byte(val), 0o644)
+}
+
+// Enabled reports whether Init succeeded.
+func (m *CgroupManager) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled
+}
+
+func (m *CgroupManager) userDir(userID string) string {
+	return filepath.Join(m.Root, "user-"+userID)
+}
+
+func (m *CgroupManager) limitsFor(userID string) CgroupLimits {
+	if m.LimitsFor == nil {
+		return m.Defaults
+	}
+	return m.Defaults.Override(m.LimitsFor(userID))
+}
+
+// Apply (re)writes the limits of a user's cgroup, creating it if needed.
+func (m *CgroupManager) Apply(userID string) error {
+	if !m.Enabled() || userID == "" {
+		return nil
+	}
+	return m.apply(userID)
+}
+
+func (m *CgroupManager) apply(userID string) error {
+	dir := m.userDir(userID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	l := m.limitsFor(userID)
+	cpu := "max 100000"
+	if l.CPUPercent > 0 {
+		cpu = strconv.Itoa(l.CPUPercent*1000) + " 100000"
+	}
+	mem := "max"
+	if l.MemoryBytes > 0 {
+		mem = strconv.FormatInt(l.MemoryBytes, 10)
+	}
+	pids := "max"
+	if l.PidsMax > 0 {
+		pids = strconv.Itoa(l.PidsMax)
+	}
+	for file, val := range map[string]string{"cpu.max": cpu, "memory.max": mem, "pids.max": pids} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(val), 0o644); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// Prepare applies a user's limits and returns the cgroup directory their
+// shells must start in; "" when the manager is disabled.
+func (m *CgroupManager) Prepare(userID string) (string, error) {
+	if !m.Enabled() || userID == "" {
+		return "", nil
+	}
+	if err := m.apply(userID); err != nil {
+		return "", err
+	}
+	return m.userDir(userID), nil
+}
+
+// Usage reports every per-user cgroup, sorted by memory use (largest first).
+func (m *CgroupManager) Usage() []CgroupUsage {
+	result := []CgroupUsage{}
+	if !m.Enabled() {
+		return result
+	}
+	entries, _ := os.ReadDir(m.Root)
+	for _, e := range entries {
+		uid, ok := strings.CutPrefix(e.Name(), "user-")
+		if !e.IsDir() || !ok {
+			continue
+		}
+		dir := filepath.Join(m.Root, e.Name())
+		u := CgroupUsage{UserID: uid, Limits: m.limitsFor(uid)}
+		u.MemoryBytes = readCgroupInt(dir, "memory.current")
+		u.PeakMemory = readCgroupInt(dir, "memory.peak")
+		u.Pids = int(readCgroupInt(dir, "pids.current"))
+		cpu := readCgroupKV(dir, "cpu.stat")
+		u.CPUUsageUsec, u.ThrottledUsec = cpu["usage_usec"], cpu["throttled_usec"]
+		u.OOMKills = readCgroupKV(dir, "memory.events")["oom_kill"]
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].MemoryBytes > result[j].MemoryBytes })
+	return result
+}
+
+func readCgroupInt(dir, file string) int64 {
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return n
+}
+
+// readCgroupKV parses flat-keyed files like cpu.stat ("usage_usec 123\n...").
+func readCgroupKV(dir, file string) map[string]int64 {
+	result := make(map[string]int64)
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return result
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, " "); ok {
+			result[k], _ = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		}
+	}
+	return result
+}
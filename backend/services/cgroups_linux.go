@@ -0,0 +1,23 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"syscall"
+)
+
+// withCgroup makes a child start directly inside the cgroup at dir
+// (clone3 with CLONE_INTO_CGROUP). The returned file must stay open until the
+// child has started.
+func withCgroup(attr *syscall.SysProcAttr, dir string) (*syscall.SysProcAttr, *os.File, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return attr, nil, err
+	}
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	attr.UseCgroupFD, attr.CgroupFD = true, int(f.Fd())
+	return attr, f, nil
+}
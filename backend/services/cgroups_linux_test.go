@@ -0,0 +1,87 @@
+//go:build linux
+
+package services
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cgroup2Mount finds a writable cgroup v2 hierarchy, or skips.
+func cgroup2Mount(t *testing.T) string {
+	t.Helper()
+	f, err := os.Open("/proc/self/mountinfo")
+	require.NoError(t, err)
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// ... mount-point options - fstype source super-options
+		fields := strings.Fields(sc.Text())
+		for i, f := range fields {
+			if f == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				dir, err := os.MkdirTemp(fields[4], "nebulide-test-")
+				if err != nil {
+					t.Skipf("cgroup2 at %s not writable: %v", fields[4], err)
+				}
+				t.Cleanup(func() { os.Remove(dir) })
+				return dir
+			}
+		}
+	}
+	t.Skip("no cgroup2 mount")
+	return ""
+}
+
+func TestWithCgroup_ChildStartsInside(t *testing.T) {
+	dir := cgroup2Mount(t)
+
+	cmd := exec.Command("/bin/sh", "-c", "cat /proc/self/cgroup")
+	attr, cg, err := withCgroup(cmd.SysProcAttr, dir)
+	require.NoError(t, err)
+	cmd.SysProcAttr = attr
+	out, err := cmd.Output()
+	cg.Close()
+	require.NoError(t, err)
+	// The shell and what it forks (cat) were never outside the cgroup.
+	assert.Contains(t, string(out), "0::/"+filepath.Base(dir)+"\n")
+
+	_, _, err = withCgroup(nil, filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestPtyHolder_ShellStartsInCgroup(t *testing.T) {
+	dir := cgroup2Mount(t)
+	sock, err := os.MkdirTemp("", "pty-")
+	require.NoError(t, err)
+	defer os.RemoveAll(sock)
+
+	h := &ptyHolder{spec: holderSpec{
+		SessionKey: "term:user-1:main",
+		Socket:     filepath.Join(sock, "h.sock"),
+		Path:       "/bin/sh",
+		Dir:        sock,
+		Env:        []string{"PATH=/usr/bin:/bin"},
+		Cgroup:     dir,
+	}, cols: 80, rows: 24, quit: make(chan struct{})}
+	ln, err := h.start()
+	require.NoError(t, err)
+	defer func() {
+		// Reaped before the cgroup is removed, or rmdir fails with EBUSY.
+		killProcessGroup(h.cmd.Process.Pid)
+		h.cmd.Wait()
+		h.pty.Close()
+		ln.Close()
+	}()
+
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(h.cmd.Process.Pid), "cgroup"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "0::/"+filepath.Base(dir)+"\n")
+}
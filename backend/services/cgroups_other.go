@@ -0,0 +1,13 @@
+//go:build !linux
+
+package services
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func withCgroup(attr *syscall.SysProcAttr, _ string) (*syscall.SysProcAttr, *os.File, error) {
+	return attr, nil, errors.New("cgroups require linux")
+}
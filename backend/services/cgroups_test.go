@@ -0,0 +1,72 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupLimits_Override(t *testing.T) {
+	def := CgroupLimits{CPUPercent: 200, MemoryBytes: 2 << 30, PidsMax: 512}
+	got := def.Override(CgroupLimits{CPUPercent: 400, MemoryBytes: -1})
+	assert.Equal(t, CgroupLimits{CPUPercent: 400, MemoryBytes: 0, PidsMax: 512}, got)
+	assert.Equal(t, def, def.Override(CgroupLimits{}))
+}
+
+// The manager only writes files, so a plain directory stands in for cgroupfs.
+func TestCgroupManager_PrepareAndUsage(t *testing.T) {
+	root := t.TempDir()
+	m := NewCgroupManager(root, CgroupLimits{CPUPercent: 150, MemoryBytes: 1 << 30, PidsMax: 256})
+	m.LimitsFor = func(userID string) CgroupLimits {
+		if userID == "u2" {
+			return CgroupLimits{PidsMax: -1}
+		}
+		return CgroupLimits{}
+	}
+	m.enabled = true
+
+	dir, err := m.Prepare("u1")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "user-u1"), dir)
+	_, err = m.Prepare("u2")
+	require.NoError(t, err)
+
+	read := func(user, file string) string {
+		data, err := os.ReadFile(filepath.Join(root, "user-"+user, file))
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "150000 100000", read("u1", "cpu.max"))
+	assert.Equal(t, "1073741824", read("u1", "memory.max"))
+	assert.Equal(t, "256", read("u1", "pids.max"))
+	assert.Equal(t, "max", read("u2", "pids.max"))
+
+	os.WriteFile(filepath.Join(dir, "memory.current"), []byte("52428800\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "pids.current"), []byte("7\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte("usage_usec 1200\nuser_usec 1000\nthrottled_usec 300\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "memory.events"), []byte("low 0\noom 1\noom_kill 1\n"), 0o644)
+
+	usage := m.Usage()
+	require.Len(t, usage, 2)
+	assert.Equal(t, "u1", usage[0].UserID)
+	assert.Equal(t, int64(52428800), usage[0].MemoryBytes)
+	assert.Equal(t, 7, usage[0].Pids)
+	assert.Equal(t, int64(1200), usage[0].CPUUsageUsec)
+	assert.Equal(t, int64(300), usage[0].ThrottledUsec)
+	assert.Equal(t, int64(1), usage[0].OOMKills)
+	assert.Equal(t, 0, usage[1].Limits.PidsMax)
+}
+
+func TestCgroupManager_DisabledIsNoop(t *testing.T) {
+	root := t.TempDir()
+	m := NewCgroupManager(root, CgroupLimits{PidsMax: 10})
+	dir, err := m.Prepare("u1")
+	require.NoError(t, err)
+	assert.Empty(t, dir)
+	_, err = os.Stat(filepath.Join(root, "user-u1"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, m.Usage())
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Claude hook event timeline ──
+//
+// Every hook event but StatusLine is appended to claude_events, so a
+// session's activity (prompts, tool calls, permission prompts, stops) can be
+// read back later even if no browser was open to receive it live. Tool input
+// is trimmed before it is stored: file contents and long commands only need
+// to be recognizable. Events are written by one goroutine from a queue, in
+// order and off the hook's path (PreToolUse waits for the policy verdict).
+// Events older than the retention are pruned hourly.
+
+const (
+	claudeEventQueue = 1024 // events waiting for the writer; past this they are dropped
+
+	claudeEventMaxString = 512       // bytes kept of each string in the tool input
+	claudeEventMaxList   = 20        // items kept of each list in the tool input
+	claudeEventMaxInput  = 16 * 1024 // past this, only the top-level scalars are kept
+)
+
+type ClaudeEventService struct {
+	retention time.Duration // 0 = keep forever
+	queue     chan *models.ClaudeEvent
+}
+
+func NewClaudeEventService(retention time.Duration) *ClaudeEventService {
+	s := &ClaudeEventService{retention: retention, queue: make(chan *models.ClaudeEvent, claudeEventQueue)}
+	go s.writeLoop()
+	return s
+}
+
+// Start runs the retention in the background.
+func (s *ClaudeEventService) Start() {
+	if s.retention <= 0 {
+		return
+	}
+	go func() {
+		s.prune()
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.prune()
+		}
+	}()
+}
+
+func (s *ClaudeEventService) prune() {
+	res := database.DB.Where("created_at < ?", time.Now().UTC().Add(-s.retention)).Delete(&models.ClaudeEvent{})
+	if res.Error != nil {
+		log.Printf("[ClaudeEvents] retention: %v", res.Error)
+	} else if res.RowsAffected > 0 {
+		log.Printf("[ClaudeEvents] retention removed %d events", res.RowsAffected)
+	}
+}
+
+// Record queues an event, with its tool input trimmed, for the writer. It
+// never blocks: if the writer is that far behind, the event is dropped.
+func (s *ClaudeEventService) Record(e *models.ClaudeEvent, toolInput map[string]interface{}) {
+	if len(toolInput) > 0 {
+		e.ToolInput = trimToolInput(toolInput)
+	}
+	e.CreatedAt = time.Now().UTC()
+	select {
+	case s.queue <- e:
+	default:
+		log.Printf("[ClaudeEvents] queue full, dropped event=%s instance=%s", e.Event, e.InstanceID)
+	}
+}
+
+func (s *ClaudeEventService) writeLoop() {
+	for e := range s.queue {
+		if err := database.DB.Create(e).Error; err != nil {
+			log.Printf("[ClaudeEvents] record event=%s instance=%s: %v", e.Event, e.InstanceID, err)
+		}
+	}
+}
+
+// trimToolInput shortens long strings and lists; if the input is still too
+// large, it keeps only the top-level strings, numbers and bools (file_path,
+// command, pattern…), which say what was touched.
+func trimToolInput(in map[string]interface{}) []byte {
+	trimmed := trimJSONValue(in).(map[string]interface{})
+	out, _ := json.Marshal(trimmed)
+	if len(out) <= claudeEventMaxInput {
+		return out
+	}
+	scalars := map[string]interface{}{"truncated": true}
+	for k, v := range trimmed {
+		switch v.(type) {
+		case string, float64, bool:
+			scalars[k] = v
+		}
+	}
+	out, _ = json.Marshal(scalars)
+	return out
+}
+
+func trimJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if len(v) > claudeEventMaxString {
+			return strings.ToValidUTF8(v[:claudeEventMaxString], "") + "…"
+		}
+		return v
+	case []interface{}:
+		v = v[:min(len(v), claudeEventMaxList)]
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = trimJSONValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = trimJSONValue(item)
+		}
+		return out
+	}
+	return v
+}
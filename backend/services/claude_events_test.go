@@ -0,0 +1,42 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaudeEvents_TrimToolInput(t *testing.T) {
+	edits := make([]interface{}, 30)
+	for i := range edits {
+		edits[i] = map[string]interface{}{"old_string": "a", "new_string": "b"}
+	}
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(trimToolInput(map[string]interface{}{
+		"file_path": "/ws/app/main.go",
+		"content":   strings.Repeat("ж", 400), // 800 bytes, cut inside no rune
+		"edits":     edits,
+		"timeout":   120.0,
+	}), &got))
+	assert.Equal(t, "/ws/app/main.go", got["file_path"])
+	content := got["content"].(string)
+	assert.True(t, utf8.ValidString(content))
+	assert.True(t, strings.HasSuffix(content, "…"))
+	assert.LessOrEqual(t, len(content), claudeEventMaxString+len("…"))
+	assert.Len(t, got["edits"], claudeEventMaxList)
+	assert.Equal(t, 120.0, got["timeout"])
+
+	// Still too large after trimming: only the top-level scalars stay.
+	huge := make([]interface{}, claudeEventMaxList)
+	for i := range huge {
+		huge[i] = strings.Repeat("x", 2*claudeEventMaxString)
+	}
+	deep := map[string]interface{}{"a": huge, "b": huge, "c": huge}
+	got = nil
+	require.NoError(t, json.Unmarshal(trimToolInput(map[string]interface{}{"command": "make", "nested": deep}), &got))
+	assert.Equal(t, map[string]interface{}{"command": "make", "truncated": true}, got)
+}
@@ -0,0 +1,494 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Claude jobs: `claude -p` in the background ──
+//
+// A job is queued in the DB and run when its owner has a free slot
+// (MaxPerUser), with the same working directory, environment and sandbox as
+// the user's terminals. The stream-json output is appended to the job's log
+// as it arrives and every line is also passed to OnEvent, so progress can be
+// watched live and the result read later from any device. A job that runs
+// past Timeout is killed and fails, as does one interrupted by a backend
+// restart; retry queues a copy.
+
+// claudeJobFlushInterval is how often a running job's new log lines are saved.
+const claudeJobFlushInterval = 2 * time.Second
+
+// claudeJobStderrBytes is how much of claude's stderr is kept for the error.
+const claudeJobStderrBytes = 4 << 10
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job has already finished")
+	ErrJobActive   = errors.New("job is still queued or running")
+)
+
+// JobShell is how a user's jobs are started, like their terminals.
+type JobShell struct {
+	Username  string
+	Sandboxed bool
+	Env       map[string]string
+}
+
+// ClaudeJobEvent is a job changing status ("status") or printing a
+// stream-json line ("output").
+type ClaudeJobEvent struct {
+	Event string
+	Job   *models.ClaudeJob // without the log
+	Line  json.RawMessage   // "output" only
+}
+
+type ClaudeJobService struct {
+	terminal *TerminalService
+
+	// UserShell resolves the user a job runs as, with the provider's env.
+	// Required.
+	UserShell func(userID uuid.UUID, provider string) (JobShell, error)
+	// OnEvent is called for every status change and output line, from the
+	// job's goroutine so a job's events arrive in order (optional).
+	OnEvent func(ClaudeJobEvent)
+
+	Binary       string        // the claude executable, looked up in the user's shell
+	AllowedTools string        // default for jobs that don't set their own
+	MaxPerUser   int           // concurrently running jobs per user
+	MaxLogBytes  int64         // stream-json kept per job; the rest is dropped
+	Timeout      time.Duration // a running job is killed after this (0 = never)
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*runningJob // by job ID
+	perUser map[uuid.UUID]int
+}
+
+type runningJob struct {
+	userID   uuid.UUID
+	pid      int
+	canceled bool
+	timedOut bool
+}
+
+func NewClaudeJobService(terminal *TerminalService, allowedTools string) *ClaudeJobService {
+	return &ClaudeJobService{
+		terminal:     terminal,
+		Binary:       "claude",
+		AllowedTools: allowedTools,
+		MaxPerUser:   2,
+		MaxLogBytes:  8 << 20,
+		running:      make(map[uuid.UUID]*runningJob),
+		perUser:      make(map[uuid.UUID]int),
+	}
+}
+
+// Start fails the jobs a previous backend process left running and starts
+// the queued ones.
+func (s *ClaudeJobService) Start() {
+	now := time.Now()
+	res := database.DB.Model(&models.ClaudeJob{}).Where("status = ?", models.JobRunning).
+		Updates(map[string]interface{}{"status": models.JobFailed, "error": "interrupted by a backend restart", "finished_at": now})
+	if res.RowsAffected > 0 {
+		log.Printf("[ClaudeJobs] %d job(s) interrupted by the restart marked failed", res.RowsAffected)
+	}
+	s.dispatch()
+}
+
+// Submit validates and queues a job.
+func (s *ClaudeJobService) Submit(job *models.ClaudeJob) error {
+	if strings.TrimSpace(job.Prompt) == "" {
+		return errors.New("prompt is required")
+	}
+	if job.AllowedTools == "" {
+		job.AllowedTools = s.AllowedTools
+	}
+	job.ID = uuid.Nil
+	job.Status = models.JobQueued
+	if err := database.DB.Create(job).Error; err != nil {
+		return err
+	}
+	log.Printf("[ClaudeJobs] queued job=%s user=%s source=%s", job.ID, job.UserID, job.Source)
+	s.emit(ClaudeJobEvent{Event: "status", Job: job})
+	s.dispatch()
+	return nil
+}
+
+// Cancel drops a queued job or kills a running one.
+func (s *ClaudeJobService) Cancel(userID, jobID uuid.UUID) error {
+	s.mu.Lock()
+	if rj, ok := s.running[jobID]; ok && rj.userID == userID {
+		rj.canceled = true
+		pid := rj.pid
+		s.mu.Unlock()
+		if pid > 0 {
+			killExecGroup(pid)
+		}
+		return nil
+	}
+	s.mu.Unlock()
+
+	var job models.ClaudeJob
+	if err := database.DB.Omit("log").Where("id = ? AND user_id = ?", jobID, userID).First(&job).Error; err != nil {
+		return ErrJobNotFound
+	}
+	now := time.Now()
+	res := database.DB.Model(&models.ClaudeJob{}).Where("id = ? AND status = ?", jobID, models.JobQueued).
+		Updates(map[string]interface{}{"status": models.JobCanceled, "finished_at": now})
+	if res.RowsAffected == 0 {
+		return ErrJobFinished // or it just started: cancel again
+	}
+	job.Status, job.FinishedAt = models.JobCanceled, &now
+	s.emit(ClaudeJobEvent{Event: "status", Job: &job})
+	return nil
+}
+
+// Retry queues a copy of a finished job.
+func (s *ClaudeJobService) Retry(userID, jobID uuid.UUID, source string) (*models.ClaudeJob, error) {
+	var old models.ClaudeJob
+	if err := database.DB.Omit("log").Where("id = ? AND user_id = ?", jobID, userID).First(&old).Error; err != nil {
+		return nil, ErrJobNotFound
+	}
+	if !old.Finished() {
+		return nil, ErrJobActive
+	}
+	job := &models.ClaudeJob{
+		UserID:          old.UserID,
+		Prompt:          old.Prompt,
+		WorkDir:         old.WorkDir,
+		Model:           old.Model,
+		AllowedTools:    old.AllowedTools,
+		ResumeSessionID: old.ResumeSessionID,
+		Provider:        old.Provider,
+		Source:          source,
+		RetryOf:         &old.ID,
+	}
+	return job, s.Submit(job)
+}
+
+// dispatch starts queued jobs, oldest first, while their owners have free slots.
+func (s *ClaudeJobService) dispatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var queued []models.ClaudeJob
+	if err := database.DB.Omit("log").Where("status = ?", models.JobQueued).Order("created_at ASC").Limit(200).Find(&queued).Error; err != nil {
+		log.Printf("[ClaudeJobs] listing queued jobs: %v", err)
+		return
+	}
+	for i := range queued {
+		job := &queued[i]
+		if s.perUser[job.UserID] >= s.MaxPerUser {
+			continue
+		}
+		now := time.Now()
+		res := database.DB.Model(&models.ClaudeJob{}).Where("id = ? AND status = ?", job.ID, models.JobQueued).
+			Updates(map[string]interface{}{"status": models.JobRunning, "started_at": now})
+		if res.RowsAffected == 0 {
+			continue // canceled meanwhile
+		}
+		job.Status, job.StartedAt = models.JobRunning, &now
+		s.perUser[job.UserID]++
+		s.running[job.ID] = &runningJob{userID: job.UserID}
+		go s.run(job)
+	}
+}
+
+// run executes a job that dispatch marked running, then frees its slot.
+func (s *ClaudeJobService) run(job *models.ClaudeJob) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.ID)
+		if s.perUser[job.UserID]--; s.perUser[job.UserID] <= 0 {
+			delete(s.perUser, job.UserID)
+		}
+		s.mu.Unlock()
+		s.dispatch()
+	}()
+	s.emit(ClaudeJobEvent{Event: "status", Job: job})
+	sessionKey := "job:" + job.UserID.String() + ":" + job.ID.String()
+
+	cmd, stdout, stderr, err := s.start(sessionKey, job)
+	if err != nil {
+		log.Printf("[ClaudeJobs] start failed: %v key=%s", err, sessionKey)
+		s.finish(job, models.JobFailed, nil, err.Error())
+		return
+	}
+	s.mu.Lock()
+	rj := s.running[job.ID]
+	rj.pid = cmd.Process.Pid
+	canceled := rj.canceled
+	s.mu.Unlock()
+	if canceled {
+		killExecGroup(cmd.Process.Pid)
+	}
+	log.Printf("[ClaudeJobs] started job=%s pid=%d key=%s", job.ID, cmd.Process.Pid, sessionKey)
+	if s.Timeout > 0 {
+		deadline := time.AfterFunc(s.Timeout, func() {
+			s.mu.Lock()
+			rj.timedOut = true
+			s.mu.Unlock()
+			log.Printf("[ClaudeJobs] job=%s timed out after %s", job.ID, s.Timeout)
+			killExecGroup(cmd.Process.Pid)
+		})
+		defer deadline.Stop()
+	}
+
+	var errTail []byte
+	errDone := make(chan struct{})
+	go func() {
+		defer close(errDone)
+		buf := make([]byte, 4096)
+		for {
+			n, err := stderr.Read(buf)
+			errTail = appendTail(errTail, buf[:n], claudeJobStderrBytes)
+			if err != nil {
+				return
+			}
+		}
+	}()
+	// Background processes claude left behind would hold the pipes open:
+	// kill them, and stop reading after a grace period in case one escaped.
+	readDone, waitDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		cmd.Wait()
+		killExecGroup(cmd.Process.Pid)
+		close(waitDone)
+		select {
+		case <-readDone:
+		case <-time.After(execDrainGrace):
+		}
+		stdout.Close()
+		stderr.Close()
+	}()
+
+	result := s.readOutput(job, stdout)
+	close(readDone)
+	<-errDone
+	<-waitDone
+
+	var exitCode *int
+	if cmd.ProcessState != nil {
+		code := cmd.ProcessState.ExitCode()
+		exitCode = &code
+	}
+	s.mu.Lock()
+	canceled, timedOut := rj.canceled, rj.timedOut
+	s.mu.Unlock()
+
+	status, errMsg := models.JobSucceeded, ""
+	switch {
+	case canceled:
+		status = models.JobCanceled
+	case timedOut:
+		status, errMsg = models.JobFailed, fmt.Sprintf("timed out after %s", s.Timeout)
+	case result == nil:
+		status, errMsg = models.JobFailed, strings.TrimSpace(strings.ToValidUTF8(string(errTail), "�"))
+		if errMsg == "" {
+			errMsg = fmt.Sprintf("claude exited (%s) without a result", fmtExitCode(exitCode))
+		}
+	case result.IsError:
+		status, errMsg = models.JobFailed, result.Subtype
+	}
+	s.finish(job, status, exitCode, errMsg)
+}
+
+// claudeResult is the final "result" event of stream-json.
+type claudeResult struct {
+	Type         string  `json:"type"`
+	Subtype      string  `json:"subtype"`
+	IsError      bool    `json:"is_error"`
+	Result       string  `json:"result"`
+	SessionID    string  `json:"session_id"`
+	NumTurns     int     `json:"num_turns"`
+	TotalCostUSD float64 `json:"total_cost_usd"`
+}
+
+// readOutput reads stream-json lines until claude closes stdout, appending
+// them to the log in batches. Returns the result event, if any.
+func (s *ClaudeJobService) readOutput(job *models.ClaudeJob, stdout *os.File) *claudeResult {
+	var result *claudeResult
+	var pending strings.Builder
+	lastFlush := time.Now()
+	flush := func() {
+		if pending.Len() == 0 {
+			return
+		}
+		err := database.DB.Model(&models.ClaudeJob{}).Where("id = ?", job.ID).
+			Updates(map[string]interface{}{
+				"log":           gorm.Expr("log || ?", pending.String()),
+				"log_bytes":     job.LogBytes,
+				"log_truncated": job.LogTruncated,
+				"session_id":    job.SessionID,
+			}).Error
+		if err != nil {
+			log.Printf("[ClaudeJobs] saving log of job=%s: %v", job.ID, err)
+		}
+		pending.Reset()
+		lastFlush = time.Now()
+	}
+
+	sc := bufio.NewScanner(stdout)
+	sc.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 || !json.Valid(line) {
+			continue
+		}
+		var ev claudeResult
+		json.Unmarshal(line, &ev)
+		if ev.SessionID != "" {
+			job.SessionID = ev.SessionID
+		}
+		if ev.Type == "result" {
+			result = &ev
+		}
+		if job.LogBytes+int64(len(line))+1 <= s.MaxLogBytes {
+			pending.Write(line)
+			pending.WriteByte('\n')
+			job.LogBytes += int64(len(line)) + 1
+		} else {
+			job.LogTruncated = true
+		}
+		s.emit(ClaudeJobEvent{Event: "output", Job: job, Line: append(json.RawMessage(nil), line...)})
+		if time.Since(lastFlush) >= claudeJobFlushInterval {
+			flush()
+		}
+	}
+	flush()
+	if result != nil {
+		job.Result = result.Result
+		job.CostUSD = result.TotalCostUSD
+		job.NumTurns = result.NumTurns
+	}
+	return result
+}
+
+// start launches claude with stdout/stderr on pipes the caller reads.
+func (s *ClaudeJobService) start(sessionKey string, job *models.ClaudeJob) (*exec.Cmd, *os.File, *os.File, error) {
+	if s.UserShell == nil {
+		return nil, nil, nil, errors.New("job runner is not configured")
+	}
+	user, err := s.UserShell(job.UserID, job.Provider)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// The prompt goes in on stdin: as an argument, one starting with "-"
+	// would be parsed as a flag.
+	args := []string{"-p", "--output-format", "stream-json", "--verbose"}
+	if job.Model != "" {
+		args = append(args, "--model", job.Model)
+	}
+	if job.AllowedTools != "" {
+		args = append(args, "--allowedTools", job.AllowedTools)
+	}
+	if job.ResumeSessionID != "" {
+		args = append(args, "--resume", job.ResumeSessionID)
+	}
+	// Through the user's shell, so claude is found like in their terminals;
+	// the arguments are passed as "$@", never parsed by the shell.
+	shell, shellArgs := defaultShell(), append([]string{"-c", `exec "$0" "$@"`, s.Binary}, args...)
+	if runtime.GOOS == "windows" {
+		shell, shellArgs = s.Binary, args
+	}
+	spec, err := s.terminal.shellSpec(sessionKey, shell, job.WorkDir, user.Sandboxed, user.Username, user.Env, shellArgs...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = spec.Env
+	setExecProcAttr(cmd, spec.Cloneflags)
+	if spec.Cgroup != "" {
+		attr, cg, err := withCgroup(cmd.SysProcAttr, spec.Cgroup)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("terminal limits unavailable: %w", err)
+		}
+		defer cg.Close()
+		cmd.SysProcAttr = attr
+	}
+
+	// Plain pipes, so Wait never waits on copying: a process claude left in
+	// the background may keep any of them open.
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, nil, nil, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		outR.Close()
+		outW.Close()
+		return nil, nil, nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = inR, outW, errW
+	err = cmd.Start()
+	inR.Close()
+	outW.Close()
+	errW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		errR.Close()
+		return nil, nil, nil, err
+	}
+	go func() {
+		io.WriteString(inW, job.Prompt)
+		inW.Close()
+	}()
+	return cmd, outR, errR, nil
+}
+
+func (s *ClaudeJobService) finish(job *models.ClaudeJob, status string, exitCode *int, errMsg string) {
+	now := time.Now()
+	job.Status = status
+	job.ExitCode = exitCode
+	job.Error = errMsg
+	job.FinishedAt = &now
+	err := database.DB.Model(&models.ClaudeJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status":      status,
+		"exit_code":   exitCode,
+		"error":       errMsg,
+		"result":      job.Result,
+		"cost_usd":    job.CostUSD,
+		"num_turns":   job.NumTurns,
+		"session_id":  job.SessionID,
+		"finished_at": now,
+	}).Error
+	if err != nil {
+		log.Printf("[ClaudeJobs] failed to save job %s: %v", job.ID, err)
+	}
+	log.Printf("[ClaudeJobs] finished job=%s status=%s exit=%s cost=%.4f", job.ID, status, fmtExitCode(exitCode), job.CostUSD)
+	s.emit(ClaudeJobEvent{Event: "status", Job: job})
+}
+
+func (s *ClaudeJobService) emit(ev ClaudeJobEvent) {
+	if s.OnEvent == nil {
+		return
+	}
+	j := *ev.Job
+	j.Log = ""
+	ev.Job = &j
+	s.OnEvent(ev)
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Policy rules for claude tool calls ──
+//
+// Server-side guardrails (models.ClaudePolicyRule) checked by the PreToolUse
+// hook before claude runs a tool. A rule matches on the tool name, the Bash
+// command, the file the tool touches and whether the call reaches outside
+// the user's workspace. When several rules match, the strictest action wins
+// (deny, then ask, then allow); on a tie the user's own rule beats a global
+// one. Enabled rules are cached until Invalidate; denials are logged and
+// stored as ClaudePolicyDenial. The check fails closed without bricking
+// claude: if the rules can't be loaded, every call is turned into a prompt for
+// the user until they can — the same answer the hook script gives when the
+// backend is unreachable.
+
+const policyMaxPattern = 512
+
+// policyRank orders actions by strictness.
+var policyRank = map[string]int{models.PolicyAllow: 1, models.PolicyAsk: 2, models.PolicyDeny: 3}
+
+// PolicyCall is a tool call claude is about to make.
+type PolicyCall struct {
+	UserID     uuid.UUID
+	InstanceID string
+	SessionID  string
+	Cwd        string
+	Workspace  string // the user's workspace; empty: nothing is outside
+	Tool       string
+	ToolInput  map[string]interface{}
+}
+
+// PolicyDecision is the verdict of the strictest matching rule.
+type PolicyDecision struct {
+	Action string
+	Reason string
+	RuleID uuid.UUID
+}
+
+type compiledPolicyRule struct {
+	models.ClaudePolicyRule
+	tool    *regexp.Regexp
+	command *regexp.Regexp
+	path    *regexp.Regexp
+}
+
+type PolicyService struct {
+	mu     sync.Mutex
+	rules  []*compiledPolicyRule // user rules first, then global ones
+	loaded bool
+	gen    int // bumped by Invalidate, guards a load racing with it
+}
+
+func NewPolicyService() *PolicyService {
+	return &PolicyService{}
+}
+
+// ValidatePolicyRule checks a rule's action and compiles its conditions.
+func ValidatePolicyRule(r *models.ClaudePolicyRule) error {
+	if _, ok := policyRank[r.Action]; !ok {
+		return fmt.Errorf("action must be allow, deny or ask")
+	}
+	_, err := compilePolicyRule(*r)
+	return err
+}
+
+func compilePolicyRule(r models.ClaudePolicyRule) (*compiledPolicyRule, error) {
+	if r.Tool == "" && r.CommandPattern == "" && r.PathGlob == "" && !r.OutsideWorkspace {
+		return nil, fmt.Errorf("a rule needs a tool, command_pattern, path_glob or outside_workspace")
+	}
+	c := &compiledPolicyRule{ClaudePolicyRule: r}
+	for _, p := range []string{r.Tool, r.CommandPattern, r.PathGlob} {
+		if len(p) > policyMaxPattern {
+			return nil, fmt.Errorf("patterns must be at most %d bytes", policyMaxPattern)
+		}
+	}
+	var err error
+	if r.Tool != "" {
+		if c.tool, err = regexp.Compile("^(?:" + r.Tool + ")$"); err != nil {
+			return nil, fmt.Errorf("invalid tool: %w", err)
+		}
+	}
+	if r.CommandPattern != "" {
+		if c.command, err = regexp.Compile(r.CommandPattern); err != nil {
+			return nil, fmt.Errorf("invalid command_pattern: %w", err)
+		}
+	}
+	if r.PathGlob != "" {
+		if c.path, err = compilePolicyGlob(r.PathGlob); err != nil {
+			return nil, fmt.Errorf("invalid path_glob: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// compilePolicyGlob turns a glob into a regexp over slash-separated paths:
+// "*" and "?" stay within a path element, "**" crosses them. A glob not
+// starting with "/" matches at any depth, so ".env" is any .env file.
+func compilePolicyGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.HasPrefix(glob, "/") {
+		b.WriteString("(?:.*/)?")
+	}
+	for rest := glob; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, "**/"):
+			b.WriteString("(?:.*/)?")
+			rest = rest[3:]
+		case strings.HasPrefix(rest, "**"):
+			b.WriteString(".*")
+			rest = rest[2:]
+		case rest[0] == '*':
+			b.WriteString("[^/]*")
+			rest = rest[1:]
+		case rest[0] == '?':
+			b.WriteString("[^/]")
+			rest = rest[1:]
+		default:
+			_, n := utf8.DecodeRuneInString(rest)
+			b.WriteString(regexp.QuoteMeta(rest[:n]))
+			rest = rest[n:]
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Invalidate drops the cached rules after they changed.
+func (s *PolicyService) Invalidate() {
+	s.mu.Lock()
+	s.rules, s.loaded = nil, false
+	s.gen++
+	s.mu.Unlock()
+}
+
+func (s *PolicyService) load() ([]*compiledPolicyRule, error) {
+	s.mu.Lock()
+	rules, loaded, gen := s.rules, s.loaded, s.gen
+	s.mu.Unlock()
+	if loaded {
+		return rules, nil
+	}
+
+	var rows []models.ClaudePolicyRule
+	if err := database.DB.Where("enabled = ?", true).Order("user_id IS NULL, created_at").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	rules = make([]*compiledPolicyRule, 0, len(rows))
+	for _, r := range rows {
+		c, err := compilePolicyRule(r)
+		if err != nil {
+			log.Printf("[Policy] skipping rule=%s: %v", r.ID, err)
+			continue
+		}
+		rules = append(rules, c)
+	}
+	s.mu.Lock()
+	if s.gen == gen {
+		s.rules, s.loaded = rules, true
+	}
+	s.mu.Unlock()
+	return rules, nil
+}
+
+// Evaluate returns the decision for a tool call, or nil when no rule
+// matches and claude's own permission settings apply.
+func (s *PolicyService) Evaluate(call PolicyCall) *PolicyDecision {
+	rules, err := s.load()
+	if err != nil {
+		log.Printf("[Policy] load rules: %v; asking user=%s tool=%s instance=%s", err, call.UserID, call.Tool, call.InstanceID)
+		return &PolicyDecision{Action: models.PolicyAsk, Reason: "Nebulide could not check its policy rules"}
+	}
+	var best *compiledPolicyRule
+	for _, r := range rules {
+		if r.UserID != nil && *r.UserID != call.UserID {
+			continue
+		}
+		if best != nil && policyRank[r.Action] <= policyRank[best.Action] {
+			continue
+		}
+		if r.matches(call) {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	d := &PolicyDecision{Action: best.Action, Reason: best.Reason, RuleID: best.ID}
+	if d.Reason == "" && d.Action != models.PolicyAllow {
+		d.Reason = fmt.Sprintf("Nebulide policy rule %q", best.Name)
+		if d.Action == models.PolicyDeny {
+			d.Reason = "Blocked by " + d.Reason
+		}
+	}
+	if d.Action == models.PolicyDeny {
+		s.recordDenial(call, d)
+	}
+	return d
+}
+
+func (s *PolicyService) recordDenial(call PolicyCall, d *PolicyDecision) {
+	log.Printf("[Policy] denied user=%s tool=%s rule=%s instance=%s session=%s",
+		call.UserID, call.Tool, d.RuleID, call.InstanceID, call.SessionID)
+	denial := models.ClaudePolicyDenial{
+		RuleID:     d.RuleID,
+		UserID:     call.UserID,
+		InstanceID: call.InstanceID,
+		SessionID:  call.SessionID,
+		Cwd:        call.Cwd,
+		Tool:       call.Tool,
+		Reason:     d.Reason,
+	}
+	if len(call.ToolInput) > 0 {
+		denial.ToolInput, _ = json.Marshal(call.ToolInput)
+	}
+	if err := database.DB.Create(&denial).Error; err != nil {
+		log.Printf("[Policy] record denial: %v", err)
+	}
+}
+
+func (r *compiledPolicyRule) matches(call PolicyCall) bool {
+	if r.tool != nil && !r.tool.MatchString(call.Tool) {
+		return false
+	}
+	command, _ := call.ToolInput["command"].(string)
+	if r.command != nil && (command == "" || !r.command.MatchString(command)) {
+		return false
+	}
+	paths := toolPaths(call)
+	if r.path != nil && !anyPathMatches(r.path, paths) {
+		return false
+	}
+	if r.OutsideWorkspace && !reachesOutside(call, paths, command) {
+		return false
+	}
+	return true
+}
+
+// toolPaths returns the files and directories named in the tool input
+// (Read/Write/Edit, NotebookEdit, Glob/Grep), made absolute against cwd.
+func toolPaths(call PolicyCall) []string {
+	var paths []string
+	for _, key := range []string{"file_path", "notebook_path", "path"} {
+		if p, _ := call.ToolInput[key].(string); p != "" {
+			paths = append(paths, absPolicyPath(p, call.Cwd))
+		}
+	}
+	return paths
+}
+
+func absPolicyPath(p, cwd string) string {
+	if !filepath.IsAbs(p) && cwd != "" {
+		p = filepath.Join(cwd, p)
+	}
+	return filepath.Clean(p)
+}
+
+func anyPathMatches(re *regexp.Regexp, paths []string) bool {
+	for _, p := range paths {
+		if re.MatchString(filepath.ToSlash(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// reachesOutside reports whether the call touches anything outside the
+// workspace: a tool path, the cwd of a command, or an absolute, home or
+// parent path among the command's words. A heuristic, not a shell parser.
+func reachesOutside(call PolicyCall, paths []string, command string) bool {
+	if call.Workspace == "" {
+		return false
+	}
+	for _, p := range paths {
+		if !withinDir(p, call.Workspace) {
+			return true
+		}
+	}
+	if command == "" {
+		return false
+	}
+	cwd := call.Cwd
+	if cwd == "" {
+		cwd = call.Workspace
+	}
+	if !withinDir(cwd, call.Workspace) {
+		return true
+	}
+	for _, word := range strings.Fields(command) {
+		if i := strings.LastIndexByte(word, '='); i >= 0 {
+			word = word[i+1:] // --out=/etc/x
+		}
+		word = strings.Trim(word, `"'<>;&|()`)
+		switch {
+		case strings.HasPrefix(word, "~"):
+			return true
+		case filepath.IsAbs(word) || strings.HasPrefix(word, "/") || strings.Contains(word, ".."):
+			if !withinDir(absPolicyPath(word, cwd), call.Workspace) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func withinDir(p, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/models"
+)
+
+func newTestPolicy(t *testing.T, rules ...models.ClaudePolicyRule) *PolicyService {
+	t.Helper()
+	s := NewPolicyService()
+	for _, r := range rules {
+		r.ID = uuid.New()
+		c, err := compilePolicyRule(r)
+		require.NoError(t, err)
+		s.rules = append(s.rules, c)
+	}
+	s.loaded = true
+	return s
+}
+
+func TestPolicy_Matching(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix paths")
+	}
+	call := func(tool string, input map[string]interface{}) PolicyCall {
+		return PolicyCall{Cwd: "/ws/alice/app", Workspace: "/ws/alice", Tool: tool, ToolInput: input}
+	}
+	cases := []struct {
+		name string
+		rule models.ClaudePolicyRule
+		call PolicyCall
+		want bool
+	}{
+		{"tool alternation", models.ClaudePolicyRule{Tool: "Write|Edit"}, call("Edit", nil), true},
+		{"tool is anchored", models.ClaudePolicyRule{Tool: "Edit"}, call("MultiEdit", nil), false},
+		{"command regexp", models.ClaudePolicyRule{CommandPattern: `\bgit\s+push\b.*--force`}, call("Bash", map[string]interface{}{"command": "git push origin main --force"}), true},
+		{"command needs a command", models.ClaudePolicyRule{CommandPattern: `.`}, call("Read", map[string]interface{}{"file_path": "a.go"}), false},
+		{"glob by base name at any depth", models.ClaudePolicyRule{PathGlob: ".env*"}, call("Write", map[string]interface{}{"file_path": "config/.env.local"}), true},
+		{"glob with directories", models.ClaudePolicyRule{PathGlob: "secrets/**"}, call("Read", map[string]interface{}{"file_path": "/ws/alice/app/secrets/prod/key.pem"}), true},
+		{"single star stays in one directory", models.ClaudePolicyRule{PathGlob: "/ws/*/key.pem"}, call("Read", map[string]interface{}{"file_path": "/ws/alice/app/key.pem"}), false},
+		{"path inside the workspace", models.ClaudePolicyRule{Tool: "Write", OutsideWorkspace: true}, call("Write", map[string]interface{}{"file_path": "../notes.md"}), false},
+		{"path outside the workspace", models.ClaudePolicyRule{Tool: "Write", OutsideWorkspace: true}, call("Write", map[string]interface{}{"file_path": "../../bob/notes.md"}), true},
+		{"rm -rf inside the workspace", models.ClaudePolicyRule{CommandPattern: `\brm\s+-\w*r`, OutsideWorkspace: true}, call("Bash", map[string]interface{}{"command": "rm -rf build /ws/alice/tmp"}), false},
+		{"rm -rf of an absolute path", models.ClaudePolicyRule{CommandPattern: `\brm\s+-\w*r`, OutsideWorkspace: true}, call("Bash", map[string]interface{}{"command": "rm -rf /etc"}), true},
+		{"rm -rf of the home", models.ClaudePolicyRule{CommandPattern: `\brm\s+-\w*r`, OutsideWorkspace: true}, call("Bash", map[string]interface{}{"command": `rm -fr "~/projects"`}), true},
+		{"rm -rf climbing out", models.ClaudePolicyRule{CommandPattern: `\brm\s+-\w*r`, OutsideWorkspace: true}, call("Bash", map[string]interface{}{"command": "cd x && rm -rf ../../.."}), true},
+	}
+	for _, tc := range cases {
+		c, err := compilePolicyRule(tc.rule)
+		require.NoError(t, err, tc.name)
+		assert.Equal(t, tc.want, c.matches(tc.call), tc.name)
+	}
+}
+
+func TestPolicy_StrictestRuleWins(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	s := newTestPolicy(t,
+		models.ClaudePolicyRule{UserID: &alice, Name: "alice reads", Tool: "Read", Action: models.PolicyAllow},
+		models.ClaudePolicyRule{Name: "env", PathGlob: ".env", Action: models.PolicyAsk, Reason: "secrets"},
+		models.ClaudePolicyRule{Name: "reads", Tool: "Read|Grep", Action: models.PolicyAllow},
+	)
+
+	d := s.Evaluate(PolicyCall{UserID: alice, Tool: "Read", ToolInput: map[string]interface{}{"file_path": "/app/.env"}})
+	require.NotNil(t, d)
+	assert.Equal(t, models.PolicyAsk, d.Action)
+	assert.Equal(t, "secrets", d.Reason)
+
+	// A tie goes to the user's own rule, listed first.
+	d = s.Evaluate(PolicyCall{UserID: alice, Tool: "Read", ToolInput: map[string]interface{}{"file_path": "/app/main.go"}})
+	require.NotNil(t, d)
+	assert.Equal(t, s.rules[0].ID, d.RuleID)
+	d = s.Evaluate(PolicyCall{UserID: bob, Tool: "Read", ToolInput: map[string]interface{}{"file_path": "/app/main.go"}})
+	require.NotNil(t, d)
+	assert.Equal(t, s.rules[2].ID, d.RuleID)
+
+	assert.Nil(t, s.Evaluate(PolicyCall{UserID: bob, Tool: "Bash", ToolInput: map[string]interface{}{"command": "ls"}}))
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	for _, r := range []models.ClaudePolicyRule{
+		{Tool: "Bash", Action: "block"},
+		{Action: models.PolicyDeny},
+		{Tool: "Bash(", Action: models.PolicyDeny},
+		{CommandPattern: `rm (`, Action: models.PolicyDeny},
+	} {
+		assert.Error(t, ValidatePolicyRule(&r), "%+v", r)
+	}
+	assert.NoError(t, ValidatePolicyRule(&models.ClaudePolicyRule{OutsideWorkspace: true, Action: models.PolicyAsk}))
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Scheduled claude runs ──
+//
+// Every scheduleTick the enabled schedules whose next_run_at has passed
+// queue a ClaudeJob, so a scheduled run is a job like any other (sandbox,
+// log, result, cost) and a schedule's history is the jobs with its
+// schedule_id. A run is skipped while the schedule's previous job is still
+// queued or running. Runs missed while the backend was down for longer than
+// scheduleMissedGrace are not caught up: the schedule moves on to its next
+// time.
+
+const (
+	scheduleTick        = 15 * time.Second
+	scheduleMissedGrace = time.Hour
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrScheduleBusy     = errors.New("the previous run is still queued or running")
+)
+
+// ClaudeScheduleEvent is a scheduled run being queued ("started"), skipped
+// because the previous one is still active ("skipped", Job is that one) or
+// finishing ("finished").
+type ClaudeScheduleEvent struct {
+	Event    string
+	Schedule *models.ClaudeSchedule
+	Job      *models.ClaudeJob // without the log
+}
+
+// Summary is a short text about a finished run, for notifications.
+func (ev ClaudeScheduleEvent) Summary() string {
+	title := ev.Schedule.Name
+	if title == "" {
+		title = "Scheduled task"
+	}
+	icon, body := "✅", ev.Job.Result
+	if ev.Job.Status != models.JobSucceeded {
+		icon, body = "❌", ev.Job.Status
+		if ev.Job.Error != "" {
+			body += ": " + ev.Job.Error
+		}
+	}
+	body = strings.TrimSpace(body)
+	if r := []rune(body); len(r) > 3000 {
+		body = string(r[:3000]) + "…"
+	}
+	return fmt.Sprintf("%s %s ($%.2f)\n%s", icon, title, ev.Job.CostUSD, body)
+}
+
+type ClaudeScheduleService struct {
+	jobs *ClaudeJobService
+
+	// OnEvent is called in its own goroutine for every started, skipped and
+	// finished run.
+	OnEvent func(ClaudeScheduleEvent)
+
+	mu sync.Mutex // one run decision at a time, so a schedule never overlaps itself
+}
+
+func NewClaudeScheduleService(jobs *ClaudeJobService) *ClaudeScheduleService {
+	return &ClaudeScheduleService{jobs: jobs}
+}
+
+// Start runs the due schedules every scheduleTick.
+func (s *ClaudeScheduleService) Start() {
+	go func() {
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			s.RunDue(now)
+		}
+	}()
+}
+
+// RunDue queues a run of every enabled schedule due at now and moves it to
+// its next time.
+func (s *ClaudeScheduleService) RunDue(now time.Time) {
+	now = now.UTC() // as next_run_at is stored
+	var due []models.ClaudeSchedule
+	if err := database.DB.Where("enabled = ? AND next_run_at <= ?", true, now).Find(&due).Error; err != nil {
+		log.Printf("[ClaudeSchedules] listing due schedules: %v", err)
+		return
+	}
+	for _, sched := range due {
+		var next *time.Time
+		if t, err := NextCronRun(sched.Cron, sched.Timezone, now); err == nil {
+			t = t.UTC()
+			next = &t
+		} else {
+			log.Printf("[ClaudeSchedules] schedule=%s has no next run: %v", sched.ID, err)
+		}
+		// Conditional, so a concurrent edit of the schedule wins.
+		res := database.DB.Model(&models.ClaudeSchedule{}).
+			Where("id = ? AND next_run_at = ?", sched.ID, sched.NextRunAt).
+			Update("next_run_at", next)
+		if res.RowsAffected == 0 {
+			continue
+		}
+		if late := now.Sub(*sched.NextRunAt); late > scheduleMissedGrace {
+			log.Printf("[ClaudeSchedules] schedule=%s missed its run at %s, skipping", sched.ID, sched.NextRunAt.Format(time.RFC3339))
+			continue
+		}
+		if _, err := s.run(sched.ID, "schedule"); err != nil && !errors.Is(err, ErrScheduleBusy) {
+			log.Printf("[ClaudeSchedules] run of schedule=%s failed: %v", sched.ID, err)
+		}
+	}
+}
+
+// RunNow queues a run of one of the user's schedules right away, whether or
+// not it is enabled.
+func (s *ClaudeScheduleService) RunNow(userID, scheduleID uuid.UUID) (*models.ClaudeJob, error) {
+	var count int64
+	database.DB.Model(&models.ClaudeSchedule{}).Where("id = ? AND user_id = ?", scheduleID, userID).Count(&count)
+	if count == 0 {
+		return nil, ErrScheduleNotFound
+	}
+	return s.run(scheduleID, "manual")
+}
+
+// run queues a job for the schedule unless its last one is still active.
+func (s *ClaudeScheduleService) run(scheduleID uuid.UUID, trigger string) (*models.ClaudeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sched models.ClaudeSchedule
+	if err := database.DB.First(&sched, "id = ?", scheduleID).Error; err != nil {
+		return nil, ErrScheduleNotFound
+	}
+	if sched.LastJobID != nil {
+		var last models.ClaudeJob
+		if err := database.DB.Omit("log").First(&last, "id = ?", *sched.LastJobID).Error; err == nil && !last.Finished() {
+			log.Printf("[ClaudeSchedules] schedule=%s skipped (%s): job=%s still %s", sched.ID, trigger, last.ID, last.Status)
+			s.emit(ClaudeScheduleEvent{Event: "skipped", Schedule: &sched, Job: &last})
+			return nil, ErrScheduleBusy
+		}
+	}
+
+	job := &models.ClaudeJob{
+		UserID:       sched.UserID,
+		Prompt:       sched.Prompt,
+		WorkDir:      sched.WorkDir,
+		Model:        sched.Model,
+		AllowedTools: sched.AllowedTools,
+		Provider:     sched.Provider,
+		Source:       "schedule",
+		ScheduleID:   &sched.ID,
+	}
+	if err := s.jobs.Submit(job); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sched.LastRunAt, sched.LastJobID, sched.LastStatus = &now, &job.ID, job.Status
+	database.DB.Model(&models.ClaudeSchedule{}).Where("id = ?", sched.ID).Updates(map[string]interface{}{
+		"last_run_at": now,
+		"last_job_id": job.ID,
+		"last_status": job.Status,
+	})
+	log.Printf("[ClaudeSchedules] schedule=%s queued job=%s (%s)", sched.ID, job.ID, trigger)
+	j := *job
+	j.Log = ""
+	s.emit(ClaudeScheduleEvent{Event: "started", Schedule: &sched, Job: &j})
+	return job, nil
+}
+
+// JobFinished records the outcome of a scheduled run and fires "finished".
+// Fed with the ClaudeJobService events; other jobs are ignored.
+func (s *ClaudeScheduleService) JobFinished(job *models.ClaudeJob) {
+	if job.ScheduleID == nil || !job.Finished() {
+		return
+	}
+	s.mu.Lock() // a quick job can finish before run has recorded it
+	database.DB.Model(&models.ClaudeSchedule{}).
+		Where("id = ? AND last_job_id = ?", *job.ScheduleID, job.ID).
+		Update("last_status", job.Status)
+	s.mu.Unlock()
+	var sched models.ClaudeSchedule
+	if err := database.DB.First(&sched, "id = ?", *job.ScheduleID).Error; err != nil {
+		return // deleted meanwhile
+	}
+	s.emit(ClaudeScheduleEvent{Event: "finished", Schedule: &sched, Job: job})
+}
+
+func (s *ClaudeScheduleService) emit(ev ClaudeScheduleEvent) {
+	if s.OnEvent != nil {
+		go s.OnEvent(ev)
+	}
+}
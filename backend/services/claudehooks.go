@@ -14,6 +14,10 @@ var hookEvents = []string{
 	"Stop", "SessionStart", "SessionEnd", "Notification", "PermissionRequest",
 }
 
+// Таймаут (сек) нашего хука на PermissionRequest: хук ждёт решения с веба/Telegram (см.
+// ApprovalService), а дефолтные 60с claude убили бы его раньше. Реальное ожидание задаёт бэкенд.
+const permissionHookTimeoutSec = 3600
+
 // RegisterClaudeHooks мерджит наши hooks + statusLine в ~/.claude/settings.json КРОСС-ПЛАТФОРМЕННО
 // (замена jq-мерджа из entrypoint.sh — теперь работает и в Docker на Linux, и локально на Windows,
 // чтобы claude в терминале Nebulide одинаково дёргал хуки). Скрипты — Node .mjs (один код на обе ОС).
@@ -75,9 +79,13 @@ func applyNebulideHooks(settings map[string]any, hookCmd, statusCmd string) {
 	for _, ev := range hookEvents {
 		arr, _ := hooks[ev].([]any)
 		arr = stripNebulideHookGroups(arr, hookCmd) // убрать прежние наши (в т.ч. устаревшие .sh)
+		hook := map[string]any{"type": "command", "command": hookCmd}
+		if ev == "PermissionRequest" {
+			hook["timeout"] = permissionHookTimeoutSec
+		}
 		arr = append(arr, map[string]any{
 			"matcher": "",
-			"hooks":   []any{map[string]any{"type": "command", "command": hookCmd}},
+			"hooks":   []any{hook},
 		})
 		hooks[ev] = arr
 	}
@@ -86,3 +86,21 @@ func TestApplyNebulideHooks_PreservesForeignStatusLine(t *testing.T) {
 		t.Fatalf("чужой statusLine перетёрт: %v", sl["command"])
 	}
 }
+
+// Хук на PermissionRequest ждёт удалённого решения — ему нужен таймаут больше дефолтных 60с.
+func TestApplyNebulideHooks_PermissionRequestTimeout(t *testing.T) {
+	s := map[string]any{}
+	applyNebulideHooks(s, `node "h.mjs"`, `node "s.mjs"`)
+	hookOf := func(ev string) map[string]any {
+		arr, _ := s["hooks"].(map[string]any)[ev].([]any)
+		hs, _ := arr[0].(map[string]any)["hooks"].([]any)
+		h, _ := hs[0].(map[string]any)
+		return h
+	}
+	if hookOf("PermissionRequest")["timeout"] != permissionHookTimeoutSec {
+		t.Fatalf("PermissionRequest: нет таймаута: %v", hookOf("PermissionRequest"))
+	}
+	if _, ok := hookOf("Stop")["timeout"]; ok {
+		t.Fatal("Stop: таймаут не нужен")
+	}
+}
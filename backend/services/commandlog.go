@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── Shell integration: per-terminal command log ──
+//
+// Unix shells get a PROMPT_COMMAND and PS0 (see shellSpec) that emit
+//   OSC 133;C;cmdline=<text>   before a command runs (output starts here)
+//   OSC 133;D;<exit code>      when it finished (output ends where this starts)
+//   OSC 7;file://<host><cwd>   the shell's cwd, at every prompt
+//   OSC 133;A                  prompt start
+// The screen model hands every OSC to commandLog together with its scrollback
+// offsets, so each command's output can be read back from the scrollback log.
+// Finished commands are appended to commands.jsonl next to the scrollback
+// segments and survive restarts together with them.
+
+const (
+	commandLogMax  = 1000 // commands kept per terminal
+	commandLogFile = "commands.jsonl"
+	commandMaxText = 4096
+)
+
+// Shell integration for bash, injected through the environment. Other shells
+// ignore PS0, so they simply produce no command log. The command line is the
+// newest history entry; the prompt remembers the one before, and when
+// history didn't take the command (HISTCONTROL=ignorespace/ignoredups,
+// history off) the cmdline is left empty rather than naming the previous one.
+const (
+	shellIntegrationPromptCommand = `__nb_ec=$?; history -a; history -r; __nb_hl=$(HISTTIMEFORMAT= history 1); ` +
+		`printf '\033]133;D;%s\007\033]7;file://%s%s\007\033]133;A\007' "$__nb_ec" "${HOSTNAME:-localhost}" "$PWD"`
+	shellIntegrationPS0 = `\e]133;C;cmdline=$(__nb_h=$(HISTTIMEFORMAT= history 1); [ "$__nb_h" != "$__nb_hl" ] && printf %s "${__nb_h#*[0-9]  }")\a`
+)
+
+// TerminalCommand is one command run at a terminal's prompt. Output offsets
+// refer to the terminal's scrollback log.
+type TerminalCommand struct {
+	Seq         int        `json:"seq"`
+	Command     string     `json:"command"`
+	Cwd         string     `json:"cwd,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	ExitCode    *int       `json:"exit_code,omitempty"`
+	OutputStart int64      `json:"output_start"`
+	OutputEnd   int64      `json:"output_end"` // 0 while the command runs
+}
+
+// CommandOutput is the output of a logged command as kept in the scrollback.
+type CommandOutput struct {
+	Raw       []byte `json:"-"`
+	Text      string `json:"text"`  // escape sequences stripped, per line
+	Start     int64  `json:"start"` // offsets of Raw in the scrollback log
+	End       int64  `json:"end"`
+	Truncated bool   `json:"truncated"` // part of the output was rotated out or cut at the size limit
+}
+
+type commandLog struct {
+	mu      sync.Mutex
+	path    string
+	cmds    []TerminalCommand // oldest first, finished ones
+	running *TerminalCommand
+	cwd     string
+	nextSeq int
+}
+
+func openCommandLog(dir string) *commandLog {
+	cl := &commandLog{path: filepath.Join(dir, commandLogFile), nextSeq: 1}
+	f, err := os.Open(cl.path)
+	if err != nil {
+		return cl
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	lines := 0
+	for sc.Scan() {
+		var c TerminalCommand
+		if json.Unmarshal(sc.Bytes(), &c) != nil {
+			continue
+		}
+		lines++
+		cl.cmds = append(cl.cmds, c)
+		if len(cl.cmds) > commandLogMax {
+			cl.cmds = cl.cmds[1:]
+		}
+		cl.nextSeq = c.Seq + 1
+	}
+	if n := len(cl.cmds); n > 0 {
+		cl.cwd = cl.cmds[n-1].Cwd
+	}
+	if lines > 2*commandLogMax {
+		cl.rewrite()
+	}
+	return cl
+}
+
+// handleOSC consumes shell-integration sequences; called by the screen model.
+func (cl *commandLog) handleOSC(cmd int, payload string, start, end int64) {
+	switch cmd {
+	case 7:
+		if cwd := parseOSC7(payload); cwd != "" {
+			cl.mu.Lock()
+			cl.cwd = cwd
+			cl.mu.Unlock()
+		}
+	case 133:
+		kind, arg, _ := strings.Cut(payload, ";")
+		switch kind {
+		case "C":
+			text, _ := strings.CutPrefix(arg, "cmdline=")
+			if len(text) > commandMaxText {
+				text = text[:commandMaxText]
+			}
+			cl.mu.Lock()
+			cl.running = &TerminalCommand{
+				Seq:         cl.nextSeq,
+				Command:     strings.ToValidUTF8(text, "�"),
+				Cwd:         cl.cwd,
+				StartedAt:   time.Now(),
+				OutputStart: end,
+			}
+			cl.nextSeq++
+			cl.mu.Unlock()
+		case "D":
+			cl.finish(arg, start)
+		}
+	}
+}
+
+func (cl *commandLog) finish(exitArg string, outputEnd int64) {
+	cl.mu.Lock()
+	c := cl.running
+	if c == nil {
+		// Prompt without a command (first prompt, Ctrl+C on an empty line)
+		cl.mu.Unlock()
+		return
+	}
+	cl.running = nil
+	now := time.Now()
+	c.FinishedAt = &now
+	c.OutputEnd = max(outputEnd, c.OutputStart)
+	if code, err := strconv.Atoi(strings.TrimSpace(exitArg)); err == nil {
+		c.ExitCode = &code
+	}
+	cl.cmds = append(cl.cmds, *c)
+	if len(cl.cmds) > commandLogMax {
+		cl.cmds = cl.cmds[len(cl.cmds)-commandLogMax:]
+	}
+	cl.appendFile(*c)
+	cl.mu.Unlock()
+}
+
+// List returns the logged commands, oldest first, including a running one.
+func (cl *commandLog) List() []TerminalCommand {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	out := make([]TerminalCommand, 0, len(cl.cmds)+1)
+	out = append(out, cl.cmds...)
+	if cl.running != nil {
+		out = append(out, *cl.running)
+	}
+	return out
+}
+
+// Get returns a command by sequence number.
+func (cl *commandLog) Get(seq int) (TerminalCommand, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.running != nil && cl.running.Seq == seq {
+		return *cl.running, true
+	}
+	for i := len(cl.cmds) - 1; i >= 0; i-- {
+		if cl.cmds[i].Seq == seq {
+			return cl.cmds[i], true
+		}
+	}
+	return TerminalCommand{}, false
+}
+
+// Cwd returns the last directory reported by the shell ("" if none).
+func (cl *commandLog) Cwd() string {
+	if cl == nil {
+		return ""
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.cwd
+}
+
+// runningSeq returns the sequence number of the running command, 0 if none.
+func (cl *commandLog) runningSeq() int {
+	if cl == nil {
+		return 0
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.running == nil {
+		return 0
+	}
+	return cl.running.Seq
+}
+
+func (cl *commandLog) appendFile(c TerminalCommand) {
+	f, err := os.OpenFile(cl.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		log.Printf("[TerminalService] command log: %v", err)
+		return
+	}
+	defer f.Close()
+	data, _ := json.Marshal(c)
+	f.Write(append(data, '\n'))
+}
+
+// rewrite replaces the file with the retained commands.
+func (cl *commandLog) rewrite() {
+	tmp := cl.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	for _, c := range cl.cmds {
+		data, _ := json.Marshal(c)
+		w.Write(append(data, '\n'))
+	}
+	if w.Flush() != nil || f.Close() != nil {
+		os.Remove(tmp)
+		return
+	}
+	os.Rename(tmp, cl.path)
+}
+
+// readCommandOutput reads a command's output range from the scrollback log.
+// A running command's output is everything logged so far.
+func readCommandOutput(sl *scrollbackLog, c TerminalCommand, maxBytes int64) CommandOutput {
+	end := c.OutputEnd
+	if c.FinishedAt == nil {
+		sl.mu.Lock()
+		end = sl.end
+		sl.mu.Unlock()
+	}
+	limit := min(end, c.OutputStart+maxBytes)
+	raw, from := sl.ReadRange(c.OutputStart, limit)
+	out := CommandOutput{
+		Raw:       raw,
+		Start:     from,
+		End:       from + int64(len(raw)),
+		Truncated: from > c.OutputStart || limit < end,
+	}
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = stripANSI([]byte(l))
+	}
+	out.Text = strings.Join(lines, "\n")
+	return out
+}
+
+// parseOSC7 extracts the path from "file://host/path" (percent-decoded when valid).
+func parseOSC7(payload string) string {
+	rest, ok := strings.CutPrefix(payload, "file://")
+	if !ok {
+		return ""
+	}
+	i := strings.IndexByte(rest, '/')
+	if i < 0 {
+		return ""
+	}
+	p := rest[i:]
+	if dec, err := url.PathUnescape(p); err == nil {
+		p = dec
+	}
+	return p
+}
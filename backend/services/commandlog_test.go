@@ -0,0 +1,134 @@
+package services
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCommandWriter(t *testing.T, dir string) *multiWriter {
+	t.Helper()
+	mw := &multiWriter{
+		writers: make(map[io.Writer]*writerEntry),
+		screen:  newVTScreen(80, 24),
+		log:     openScrollbackLog(dir, 0),
+		cmds:    openCommandLog(dir),
+	}
+	mw.screen.onOSC = mw.cmds.handleOSC
+	t.Cleanup(mw.Stop)
+	return mw
+}
+
+// prompt is what the injected PROMPT_COMMAND prints, followed by a PS1.
+func prompt(exit, cwd string) string {
+	return "\x1b]133;D;" + exit + "\x07\x1b]7;file://box" + cwd + "\x07\x1b]133;A\x07$ "
+}
+
+func TestCommandLog_RecordsCommandsAndOutputRanges(t *testing.T) {
+	dir := t.TempDir()
+	mw := newTestCommandWriter(t, dir)
+
+	// First prompt has no command before it
+	mw.Write([]byte("motd\r\n" + prompt("0", "/home/u")))
+	mw.Write([]byte("ls\r\n\x1b]133;C;cmdline=ls\x07"))
+	mw.Write([]byte("a.txt  \x1b[34mdir\x1b[0m\r\n"))
+	// Marker split across reads
+	mw.Write([]byte(prompt("0", "/home/u/my%20dir")[:5]))
+	mw.Write([]byte(prompt("0", "/home/u/my%20dir")[5:]))
+	mw.Write([]byte("\x1b]133;C;cmdline=make test\x07boom\r\n" + prompt("2", "/home/u/my%20dir")))
+
+	cmds := mw.cmds.List()
+	require.Len(t, cmds, 2)
+	assert.Equal(t, 1, cmds[0].Seq)
+	assert.Equal(t, "ls", cmds[0].Command)
+	assert.Equal(t, "/home/u", cmds[0].Cwd)
+	require.NotNil(t, cmds[0].ExitCode)
+	assert.Equal(t, 0, *cmds[0].ExitCode)
+	assert.NotNil(t, cmds[0].FinishedAt)
+
+	assert.Equal(t, "make test", cmds[1].Command)
+	assert.Equal(t, "/home/u/my dir", cmds[1].Cwd)
+	require.NotNil(t, cmds[1].ExitCode)
+	assert.Equal(t, 2, *cmds[1].ExitCode)
+
+	out := readCommandOutput(mw.log, cmds[0], 1<<20)
+	assert.Equal(t, "a.txt  \x1b[34mdir\x1b[0m\r\n", string(out.Raw))
+	assert.Equal(t, "a.txt  dir", out.Text)
+	assert.False(t, out.Truncated)
+
+	out = readCommandOutput(mw.log, cmds[1], 1<<20)
+	assert.Equal(t, "boom\r\n", string(out.Raw))
+
+	out = readCommandOutput(mw.log, cmds[0], 3)
+	assert.Equal(t, "a.t", string(out.Raw))
+	assert.True(t, out.Truncated)
+}
+
+func TestCommandLog_RunningCommandAndReload(t *testing.T) {
+	dir := t.TempDir()
+	mw := newTestCommandWriter(t, dir)
+	mw.Write([]byte(prompt("0", "/w") + "\x1b]133;C;cmdline=false\x07" + prompt("1", "/w")))
+	mw.Write([]byte("\x1b]133;C;cmdline=tail -f log\x07line 1\r\n"))
+
+	running, ok := mw.cmds.Get(2)
+	require.True(t, ok)
+	assert.Nil(t, running.FinishedAt)
+	assert.Nil(t, running.ExitCode)
+	assert.Equal(t, "line 1\r\n", string(readCommandOutput(mw.log, running, 1<<20).Raw))
+	mw.Stop()
+
+	// Only finished commands are persisted; numbering continues after them.
+	data, err := os.ReadFile(filepath.Join(dir, commandLogFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"command":"false"`)
+
+	cl := openCommandLog(dir)
+	cmds := cl.List()
+	require.Len(t, cmds, 1)
+	assert.Equal(t, "false", cmds[0].Command)
+	assert.Equal(t, 1, *cmds[0].ExitCode)
+	assert.Equal(t, 2, cl.nextSeq)
+	assert.Equal(t, "/w", cl.cwd)
+}
+
+func TestCommandLog_BashIntegration(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("no bash")
+	}
+	dir := t.TempDir()
+	mw := newTestCommandWriter(t, dir)
+
+	// An interactive bash reading stdin prints prompts and PS0 to stderr.
+	cmd := exec.Command("bash", "--norc", "--noprofile", "-i")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PROMPT_COMMAND="+shellIntegrationPromptCommand, "PS0="+shellIntegrationPS0,
+		"HISTFILE="+filepath.Join(dir, ".bash_history"), "HISTCONTROL=ignorespace:ignoredups")
+	cmd.Stdin = strings.NewReader("echo one\n echo secret\necho one\nfalse\nexit 0\n")
+	cmd.Stdout, cmd.Stderr = mw, mw
+	require.NoError(t, cmd.Run())
+
+	cmds := mw.cmds.List()
+	require.Len(t, cmds, 5)
+	got := make([]string, len(cmds))
+	for i, c := range cmds {
+		got[i] = c.Command
+	}
+	// Commands history skipped are logged without a command line, never as
+	// the previous one.
+	assert.Equal(t, []string{"echo one", "", "", "false", "exit 0"}, got)
+	require.NotNil(t, cmds[3].ExitCode)
+	assert.Equal(t, 1, *cmds[3].ExitCode)
+}
+
+func TestParseOSC7(t *testing.T) {
+	assert.Equal(t, "/home/u", parseOSC7("file://host/home/u"))
+	assert.Equal(t, "/a b", parseOSC7("file:///a%20b"))
+	assert.Equal(t, "", parseOSC7("file://host"))
+	assert.Equal(t, "", parseOSC7("/plain"))
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Cron expressions ──
+//
+// The five standard fields, minute hour day-of-month month day-of-week, each
+// "*", a number, a range "a-b" or a list "a,b", with an optional step ("*/15",
+// "9-17/2"); months and weekdays also by name ("jan", "mon-fri"), Sunday is 0
+// or 7. As in Vixie cron, when both day fields are restricted a day matching
+// either of them counts. The macros @hourly, @daily (@midnight), @weekly,
+// @monthly and @yearly (@annually) are accepted too.
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+var (
+	cronMonths   = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronSearchYears bounds Next for expressions that match rarely or never
+// ("0 0 30 2 *").
+const cronSearchYears = 5
+
+// CronSpec is a parsed cron expression.
+type CronSpec struct {
+	minute, hour, dom, month, dow uint64 // bit i set: value i matches
+	domStar, dowStar              bool   // the day field starts with "*"
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (*CronSpec, error) {
+	expr = strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, errors.New("expected 5 fields: minute hour day-of-month month day-of-week")
+	}
+	c := &CronSpec{domStar: strings.HasPrefix(f[2], "*"), dowStar: strings.HasPrefix(f[4], "*")}
+	var err error
+	if c.minute, err = parseCronField(f[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(f[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(f[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(f[3], 1, 12, cronMonths); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseCronField(f[4], 0, 7, cronWeekdays); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1 // 7 is Sunday too
+	}
+	return c, nil
+}
+
+// parseCronField parses one field into a bit set of the values in [min, max].
+// names[i] is the name of value i.
+func parseCronField(field string, min, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(loStr, min, max, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(hiStr, min, max, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max // "a/n": from a to the end
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func cronValue(s string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return n, nil
+}
+
+// Next returns the first matching minute after t, in t's location, or the
+// zero time if there is none within a few years. Times skipped by a DST
+// change don't occur, so a run at 02:30 is skipped on spring-forward day.
+func (c *CronSpec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		case !c.dayMatches(t):
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// forward returns next, or the next hour if next is not after t: time.Date
+// may resolve a midnight skipped by a DST change to the evening before.
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+func (c *CronSpec) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	}
+	return dom || dow
+}
+
+// NextCronRun returns the first run of a cron expression after t, evaluated
+// in the named time zone ("" is the server's).
+func NextCronRun(expr, timezone string, t time.Time) (time.Time, error) {
+	spec, err := ParseCron(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc := time.Local
+	if timezone != "" {
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone %q", timezone)
+		}
+	}
+	next := spec.Next(t.In(loc))
+	if next.IsZero() {
+		return time.Time{}, errors.New("the expression never matches")
+	}
+	return next, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron_Next(t *testing.T) {
+	// Wednesday
+	from := time.Date(2026, 3, 4, 10, 17, 30, 0, time.UTC)
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2026-03-04 10:18"},
+		{"*/15 * * * *", "2026-03-04 10:30"},
+		{"0 9 * * *", "2026-03-05 09:00"},
+		{"30 8 * * mon-fri", "2026-03-05 08:30"},
+		{"0 8 * * SAT,7", "2026-03-07 08:00"},
+		{"0 0 1 * *", "2026-04-01 00:00"},
+		{"0 0 1,15 * mon", "2026-03-09 00:00"}, // either day field matches
+		{"5 10-14/2 * * *", "2026-03-04 12:05"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		{"@daily", "2026-03-05 00:00"},
+		{"@weekly", "2026-03-08 00:00"},
+		{"17 10 4 mar *", "2027-03-04 10:17"},
+	}
+	for _, tc := range cases {
+		spec, err := ParseCron(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.want, spec.Next(from).Format("2006-01-02 15:04"), tc.expr)
+	}
+}
+
+func TestCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "* * * foo *", "@reboot"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+	_, err := NextCronRun("0 0 31 2 *", "", time.Now())
+	assert.Error(t, err)
+	_, err = NextCronRun("0 9 * * *", "Mars/Olympus", time.Now())
+	assert.Error(t, err)
+}
+
+func TestCron_TimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	// 2026-03-08 is the spring-forward day: 09:00 local is 13:00 UTC, the day before 14:00.
+	next, err := NextCronRun("0 9 * * *", "America/New_York", time.Date(2026, 3, 7, 15, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC), next.UTC())
+	assert.Equal(t, loc.String(), next.Location().String())
+
+	// 02:30 does not exist that day, so that day's run is skipped.
+	next, err = NextCronRun("30 2 * * *", "America/New_York", time.Date(2026, 3, 8, 5, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-09 02:30", next.Format("2006-01-02 15:04"))
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Exec: non-interactive commands ──
+//
+// Runs `<shell> -c <command>` without a PTY, with the same working directory,
+// environment and sandbox as the user's terminals (TerminalService.shellSpec).
+// Output is streamed as it arrives; the run is bounded by a timeout and an
+// output cap and recorded as a models.ExecRun.
+
+// maxExecsPerUser limits concurrent exec runs of one user.
+const maxExecsPerUser = 4
+
+// execDrainGrace is how long output may trail the command's exit before the
+// pipes are closed.
+const execDrainGrace = 2 * time.Second
+
+var ErrExecLimit = fmt.Errorf("too many running commands (max %d per user)", maxExecsPerUser)
+
+// ExecRequest describes a command to run.
+type ExecRequest struct {
+	UserID    uuid.UUID
+	Username  string
+	Command   string
+	WorkDir   string
+	Sandboxed bool
+	Env       map[string]string
+	Stdin     string
+	Source    string // who asked: "api", "telegram", ...
+
+	// Zero means ExecService defaults; values above the service maximums are capped.
+	Timeout        time.Duration
+	MaxOutputBytes int64
+}
+
+// ExecEvent is one streamed message: "start", then "stdout"/"stderr" chunks,
+// then a final "exit".
+type ExecEvent struct {
+	Type        string `json:"type"`
+	ID          string `json:"id,omitempty"`
+	Data        string `json:"data,omitempty"`
+	Status      string `json:"status,omitempty"`
+	ExitCode    *int   `json:"exit_code,omitempty"`
+	DurationMs  int64  `json:"duration_ms,omitempty"`
+	OutputBytes int64  `json:"output_bytes,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type ExecService struct {
+	terminal *TerminalService
+
+	DefaultTimeout     time.Duration
+	MaxTimeout         time.Duration
+	MaxOutputBytes     int64
+	HistoryOutputBytes int // tail of the output kept in ExecRun.Output
+
+	mu      sync.Mutex
+	running map[uuid.UUID]int
+}
+
+func NewExecService(terminal *TerminalService) *ExecService {
+	return &ExecService{
+		terminal:           terminal,
+		DefaultTimeout:     time.Minute,
+		MaxTimeout:         30 * time.Minute,
+		MaxOutputBytes:     10 << 20,
+		HistoryOutputBytes: 64 << 10,
+		running:            make(map[uuid.UUID]int),
+	}
+}
+
+type execChunk struct {
+	stream string
+	data   []byte
+}
+
+// Run executes req and calls emit for every event, from the calling
+// goroutine. Cancelling ctx kills the command. An error is returned (and
+// nothing emitted) only if the command could not be started.
+func (s *ExecService) Run(ctx context.Context, req ExecRequest, emit func(ExecEvent)) (*models.ExecRun, error) {
+	if !s.acquire(req.UserID) {
+		return nil, ErrExecLimit
+	}
+	defer s.release(req.UserID)
+
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = s.DefaultTimeout
+	}
+	timeout = min(timeout, s.MaxTimeout)
+	maxOutput := req.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = s.MaxOutputBytes
+	}
+	maxOutput = min(maxOutput, s.MaxOutputBytes)
+
+	run := &models.ExecRun{
+		UserID:    req.UserID,
+		Command:   req.Command,
+		WorkDir:   req.WorkDir,
+		Source:    req.Source,
+		Status:    models.ExecRunning,
+		StartedAt: time.Now(),
+	}
+	if err := database.DB.Create(run).Error; err != nil {
+		return nil, err
+	}
+	sessionKey := "exec:" + req.UserID.String() + ":" + run.ID.String()
+
+	cmd, outR, errR, err := s.start(sessionKey, req)
+	if err != nil {
+		log.Printf("[Exec] start failed: %v key=%s", err, sessionKey)
+		s.finish(run, models.ExecFailed, nil, err.Error(), 0, nil)
+		return run, err
+	}
+	pid := cmd.Process.Pid
+	log.Printf("[Exec] started pid=%d user=%s key=%s", pid, req.Username, sessionKey)
+	emit(ExecEvent{Type: "start", ID: run.ID.String()})
+
+	chunks := make(chan execChunk, 16)
+	var wg sync.WaitGroup
+	for stream, r := range map[string]*os.File{"stdout": outR, "stderr": errR} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.Close()
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := r.Read(buf)
+				if n > 0 {
+					chunks <- execChunk{stream, append([]byte(nil), buf[:n]...)}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(chunks)
+	}()
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var drain <-chan time.Time
+	done := ctx.Done()
+	status := models.ExecExited
+	killed := false
+	kill := func(why string) {
+		if !killed {
+			killed = true
+			status = why
+			killExecGroup(pid)
+		}
+	}
+
+	var total int64
+	var tail []byte
+	partial := map[string][]byte{} // incomplete UTF-8 sequence at the end of the last chunk
+	for chunks != nil || exited != nil {
+		select {
+		case ch, ok := <-chunks:
+			if !ok {
+				chunks = nil
+				// The output ended inside a character: pass on what there is.
+				for _, stream := range []string{"stdout", "stderr"} {
+					if len(partial[stream]) > 0 {
+						emit(ExecEvent{Type: stream, Data: string(partial[stream])})
+					}
+				}
+				continue
+			}
+			if killed {
+				continue // discard what trails a kill
+			}
+			if left := maxOutput - total; int64(len(ch.data)) > left {
+				ch.data = ch.data[:left]
+				kill(models.ExecOutputLimit)
+			}
+			total += int64(len(ch.data))
+			tail = appendTail(tail, ch.data, s.HistoryOutputBytes)
+			data := append(partial[ch.stream], ch.data...)
+			cut := utf8CompleteLen(data)
+			partial[ch.stream] = append([]byte(nil), data[cut:]...)
+			if cut > 0 {
+				emit(ExecEvent{Type: ch.stream, Data: string(data[:cut])})
+			}
+		case <-exited:
+			exited = nil
+			// Background jobs would hold the pipes open: kill them, and stop
+			// reading after a grace period in case one escaped the group.
+			killExecGroup(pid)
+			drain = time.After(execDrainGrace)
+		case <-drain:
+			drain = nil
+			outR.Close()
+			errR.Close()
+		case <-timer.C:
+			kill(models.ExecTimeout)
+		case <-done:
+			done = nil
+			kill(models.ExecCanceled)
+		}
+	}
+
+	var exitCode *int
+	if cmd.ProcessState != nil {
+		code := cmd.ProcessState.ExitCode()
+		exitCode = &code
+	}
+	errMsg := ""
+	switch status {
+	case models.ExecTimeout:
+		errMsg = fmt.Sprintf("timed out after %s", timeout)
+	case models.ExecOutputLimit:
+		errMsg = fmt.Sprintf("output exceeded %d bytes", maxOutput)
+	}
+	s.finish(run, status, exitCode, errMsg, total, tail)
+	log.Printf("[Exec] finished status=%s exit=%v bytes=%d key=%s", status, fmtExitCode(exitCode), total, sessionKey)
+	emit(ExecEvent{
+		Type:        "exit",
+		ID:          run.ID.String(),
+		Status:      run.Status,
+		ExitCode:    run.ExitCode,
+		DurationMs:  run.DurationMs,
+		OutputBytes: run.OutputBytes,
+		Error:       run.Error,
+	})
+	return run, nil
+}
+
+// start launches the command with stdout/stderr on pipes the caller reads.
+func (s *ExecService) start(sessionKey string, req ExecRequest) (*exec.Cmd, *os.File, *os.File, error) {
+	if strings.TrimSpace(req.Command) == "" {
+		return nil, nil, nil, errors.New("empty command")
+	}
+	spec, err := s.terminal.shellSpec(sessionKey, defaultShell(), req.WorkDir, req.Sandboxed, req.Username, req.Env, "-c", req.Command)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = spec.Env
+	if req.Stdin != "" {
+		cmd.Stdin = strings.NewReader(req.Stdin)
+	}
+	setExecProcAttr(cmd, spec.Cloneflags)
+	if spec.Cgroup != "" {
+		attr, cg, err := withCgroup(cmd.SysProcAttr, spec.Cgroup)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("terminal limits unavailable: %w", err)
+		}
+		defer cg.Close()
+		cmd.SysProcAttr = attr
+	}
+
+	// Plain pipes rather than StdoutPipe: Wait must not wait for (or close)
+	// output that background jobs keep open.
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		outR.Close()
+		outW.Close()
+		return nil, nil, nil, err
+	}
+	cmd.Stdout, cmd.Stderr = outW, errW
+	err = cmd.Start()
+	outW.Close()
+	errW.Close()
+	if err != nil {
+		outR.Close()
+		errR.Close()
+		return nil, nil, nil, err
+	}
+	return cmd, outR, errR, nil
+}
+
+func (s *ExecService) finish(run *models.ExecRun, status string, exitCode *int, errMsg string, total int64, tail []byte) {
+	now := time.Now()
+	run.Status = status
+	run.ExitCode = exitCode
+	run.Error = errMsg
+	run.OutputBytes = total
+	run.Output = strings.ToValidUTF8(string(tail), "�")
+	run.DurationMs = now.Sub(run.StartedAt).Milliseconds()
+	run.FinishedAt = &now
+	if err := database.DB.Save(run).Error; err != nil {
+		log.Printf("[Exec] failed to save run %s: %v", run.ID, err)
+	}
+}
+
+func (s *ExecService) acquire(userID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[userID] >= maxExecsPerUser {
+		return false
+	}
+	s.running[userID]++
+	return true
+}
+
+func (s *ExecService) release(userID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[userID]--; s.running[userID] <= 0 {
+		delete(s.running, userID)
+	}
+}
+
+// appendTail appends data to tail keeping at most max trailing bytes.
+func appendTail(tail, data []byte, max int) []byte {
+	tail = append(tail, data...)
+	if len(tail) > max {
+		tail = append(tail[:0], tail[len(tail)-max:]...)
+	}
+	return tail
+}
+
+func fmtExitCode(code *int) string {
+	if code == nil {
+		return "-"
+	}
+	return fmt.Sprint(*code)
+}
@@ -0,0 +1,14 @@
+//go:build linux
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setExecProcAttr puts an exec command in its own process group (so
+// killExecGroup gets its background jobs too) and new namespaces.
+func setExecProcAttr(cmd *exec.Cmd, cloneflags uintptr) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Cloneflags: cloneflags}
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !windows
+
+package services
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setExecProcAttr(cmd *exec.Cmd, _ uintptr) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package services
+
+import "syscall"
+
+// killExecGroup kills the process group of an exec command.
+func killExecGroup(pid int) {
+	syscall.Kill(-pid, syscall.SIGKILL)
+}
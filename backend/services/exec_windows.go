@@ -0,0 +1,12 @@
+//go:build windows
+
+package services
+
+import "os/exec"
+
+func setExecProcAttr(_ *exec.Cmd, _ uintptr) {}
+
+// killExecGroup on Windows kills just the process (no process groups).
+func killExecGroup(pid int) {
+	killProcessGroup(pid)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"log"
+	"time"
+)
+
+// ── Idle terminal hibernation ──
+//
+// A shell nobody is attached to, with nothing worth keeping running (no
+// watched process, no claude), is hibernated once it has been idle for its
+// owner's HibernateAfter: OnHibernate warns HibernateWarning ahead, then the
+// shell gets SIGHUP and leaves the session map. The scrollback stays on disk,
+// so the next attach starts a new shell with the old output on screen; the
+// handlers start it in the cwd reported with the "hibernated" event.
+
+// hibernateGrace is how long a hung-up shell may take to exit before it is killed.
+const hibernateGrace = 10 * time.Second
+
+// SessionPolicy limits a user's terminals.
+type SessionPolicy struct {
+	MaxSessions    int           `json:"max_sessions"`    // attached sessions at once, 0 = unlimited
+	HibernateAfter time.Duration `json:"hibernate_after"` // idle time before hibernation, 0 = never
+}
+
+// Override returns p with the per-user values of o applied: 0 keeps the
+// default, a negative value lifts the limit (see CgroupLimits.Override).
+func (p SessionPolicy) Override(o SessionPolicy) SessionPolicy {
+	if o.MaxSessions > 0 {
+		p.MaxSessions = o.MaxSessions
+	} else if o.MaxSessions < 0 {
+		p.MaxSessions = 0
+	}
+	if o.HibernateAfter > 0 {
+		p.HibernateAfter = o.HibernateAfter
+	} else if o.HibernateAfter < 0 {
+		p.HibernateAfter = 0
+	}
+	return p
+}
+
+// HibernateEvent announces or reports the hibernation of an idle terminal.
+type HibernateEvent struct {
+	Event       string // "warning" or "hibernated"
+	UserID      string
+	InstanceID  string
+	WorkspaceID string
+	At          time.Time // when the shell will be / was hung up
+	Cwd         string    // the shell's cwd ("hibernated" only)
+}
+
+func (s *TerminalService) policyFor(userID string) SessionPolicy {
+	if s.PolicyFor == nil {
+		return s.Policy
+	}
+	return s.Policy.Override(s.PolicyFor(userID))
+}
+
+// hibernateIdle warns about and hibernates idle sessions. Called by reapLoop.
+func (s *TerminalService) hibernateIdle(now time.Time) {
+	type candidate struct {
+		key  string
+		sess *TerminalSession
+	}
+	var idle []candidate
+	s.mu.RLock()
+	for key, sess := range s.sessions {
+		if sess.IsAlive() && sess.WriterCount() == 0 {
+			idle = append(idle, candidate{key, sess})
+		}
+	}
+	s.mu.RUnlock()
+
+	policies := make(map[string]SessionPolicy)
+	for _, c := range idle {
+		uid, iid := parseSessionKey(c.key)
+		p, ok := policies[uid]
+		if !ok {
+			p = s.policyFor(uid)
+			policies[uid] = p
+		}
+		if p.HibernateAfter <= 0 {
+			continue
+		}
+		busy := c.sess.HasClaudeChild() || len(s.watchedIn(c.key)) > 0
+
+		ts := c.sess
+		ts.mu.Lock()
+		if busy {
+			ts.busyAt = now
+		}
+		idleFrom := ts.OrphanSince
+		if ts.busyAt.After(idleFrom) {
+			idleFrom = ts.busyAt
+		}
+		at := idleFrom.Add(p.HibernateAfter)
+		warn := false
+		if !busy && !idleFrom.IsZero() && s.HibernateWarning > 0 {
+			if ts.idleWarned.Equal(idleFrom) {
+				at = ts.hibernateAt
+			} else if !now.Before(at.Add(-s.HibernateWarning)) {
+				// Always warn a full HibernateWarning ahead, even if late
+				if at.Before(now.Add(s.HibernateWarning)) {
+					at = now.Add(s.HibernateWarning)
+				}
+				ts.idleWarned, ts.hibernateAt = idleFrom, at
+				warn = true
+			} else {
+				at = time.Time{} // not due yet
+			}
+		}
+		wsID := ts.WorkspaceID
+		ts.mu.Unlock()
+
+		switch {
+		case busy || idleFrom.IsZero() || at.IsZero():
+		case warn:
+			log.Printf("[TerminalService] idle session will hibernate at %s key=%s", at.Format(time.RFC3339), c.key)
+			s.fireHibernate(HibernateEvent{Event: "warning", UserID: uid, InstanceID: iid, WorkspaceID: wsID, At: at})
+		case !now.Before(at):
+			s.hibernate(c.key, c.sess)
+		}
+	}
+}
+
+// hibernate hangs up an idle session's shell, keeping its scrollback.
+func (s *TerminalService) hibernate(sessionKey string, ts *TerminalSession) {
+	cwd := ts.Cwd()
+	s.mu.Lock()
+	if s.sessions[sessionKey] != ts || ts.WriterCount() > 0 {
+		s.mu.Unlock()
+		return // replaced or reattached meanwhile
+	}
+	delete(s.sessions, sessionKey)
+	ts.mw.Stop()
+	s.mu.Unlock()
+
+	log.Printf("[TerminalService] hibernating idle session pid=%d cwd=%s key=%s", ts.pid, cwd, sessionKey)
+	hangupShell(ts.pid)
+	go func() {
+		select {
+		case <-ts.Done:
+		case <-time.After(hibernateGrace):
+			log.Printf("[TerminalService] shell ignored SIGHUP, killing key=%s", sessionKey)
+		}
+		ts.killProcessTree()
+	}()
+
+	uid, iid := parseSessionKey(sessionKey)
+	ts.mu.Lock()
+	wsID := ts.WorkspaceID
+	ts.mu.Unlock()
+	s.fireHibernate(HibernateEvent{Event: "hibernated", UserID: uid, InstanceID: iid, WorkspaceID: wsID, At: time.Now(), Cwd: cwd})
+}
+
+func (s *TerminalService) fireHibernate(ev HibernateEvent) {
+	if s.OnHibernate != nil {
+		go s.OnHibernate(ev)
+	}
+}
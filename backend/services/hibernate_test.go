@@ -0,0 +1,127 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionPolicy_Override(t *testing.T) {
+	def := SessionPolicy{MaxSessions: 15, HibernateAfter: 24 * time.Hour}
+	assert.Equal(t, def, def.Override(SessionPolicy{}))
+	assert.Equal(t, SessionPolicy{MaxSessions: 0, HibernateAfter: 2 * time.Hour},
+		def.Override(SessionPolicy{MaxSessions: -1, HibernateAfter: 2 * time.Hour}))
+	assert.Equal(t, SessionPolicy{MaxSessions: 3}, def.Override(SessionPolicy{MaxSessions: 3, HibernateAfter: -1}))
+}
+
+func newHibernateTestService(t *testing.T, orphanSince time.Time) (*TerminalService, *TerminalSession, chan HibernateEvent) {
+	t.Helper()
+	events := make(chan HibernateEvent, 4)
+	sess := &TerminalSession{
+		Done:        make(chan struct{}),
+		mw:          newTestMultiWriter(t),
+		OrphanSince: orphanSince,
+		WorkDir:     "/work/project",
+	}
+	s := &TerminalService{
+		sessions:         map[string]*TerminalSession{"term:u1:t1": sess},
+		Policy:           SessionPolicy{HibernateAfter: time.Hour},
+		HibernateWarning: 10 * time.Minute,
+		OnHibernate:      func(ev HibernateEvent) { events <- ev },
+	}
+	return s, sess, events
+}
+
+func nextHibernateEvent(t *testing.T, events chan HibernateEvent) HibernateEvent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no hibernate event")
+		return HibernateEvent{}
+	}
+}
+
+func TestHibernateIdle_WarnsThenHibernates(t *testing.T) {
+	now := time.Now()
+	orphan := now.Add(-50 * time.Minute)
+	s, _, events := newHibernateTestService(t, orphan)
+
+	s.hibernateIdle(now)
+	ev := nextHibernateEvent(t, events)
+	assert.Equal(t, "warning", ev.Event)
+	assert.Equal(t, "t1", ev.InstanceID)
+	assert.True(t, ev.At.Equal(orphan.Add(time.Hour)))
+
+	s.hibernateIdle(now.Add(time.Minute)) // warned once per idle period
+	assert.Empty(t, events)
+	_, ok := s.Get("term:u1:t1")
+	require.True(t, ok)
+
+	s.hibernateIdle(now.Add(10 * time.Minute))
+	ev = nextHibernateEvent(t, events)
+	assert.Equal(t, "hibernated", ev.Event)
+	assert.Equal(t, "/work/project", ev.Cwd)
+	_, ok = s.Get("term:u1:t1")
+	assert.False(t, ok)
+}
+
+func TestHibernateIdle_LateWarningPostponesHibernation(t *testing.T) {
+	now := time.Now()
+	s, _, events := newHibernateTestService(t, now.Add(-3*time.Hour))
+
+	s.hibernateIdle(now)
+	ev := nextHibernateEvent(t, events)
+	assert.Equal(t, "warning", ev.Event)
+	assert.True(t, ev.At.Equal(now.Add(10*time.Minute)))
+
+	s.hibernateIdle(now.Add(9 * time.Minute))
+	assert.Empty(t, events)
+	s.hibernateIdle(now.Add(10 * time.Minute))
+	assert.Equal(t, "hibernated", nextHibernateEvent(t, events).Event)
+}
+
+func TestHibernateIdle_SkipsAttachedAndExempt(t *testing.T) {
+	now := time.Now()
+	s, sess, events := newHibernateTestService(t, time.Time{})
+	sess.mw.Add(&bufWriter{}, nil, "")
+	s.hibernateIdle(now.Add(48 * time.Hour))
+	assert.Empty(t, events)
+
+	s, _, events = newHibernateTestService(t, now.Add(-48*time.Hour))
+	s.PolicyFor = func(string) SessionPolicy { return SessionPolicy{HibernateAfter: -1} }
+	s.hibernateIdle(now)
+	assert.Empty(t, events)
+	_, ok := s.Get("term:u1:t1")
+	assert.True(t, ok)
+}
+
+type spectatorBuf struct{ bufWriter }
+
+func (*spectatorBuf) Spectating() {}
+
+func TestHibernateIdle_SpectatorsDontKeepSessionAttached(t *testing.T) {
+	now := time.Now()
+	s, sess, events := newHibernateTestService(t, time.Time{})
+	owner, spectator := &bufWriter{}, &spectatorBuf{}
+	sess.AddWriter(owner, nil, "")
+	sess.AddWriter(spectator, nil, "")
+	assert.Equal(t, 1, sess.WriterCount())
+	assert.True(t, sess.OrphanSince.IsZero())
+
+	// The owner leaves; the spectator still gets output but the session is
+	// orphaned like any other.
+	sess.RemoveWriter(owner)
+	assert.Equal(t, 0, sess.WriterCount())
+	require.False(t, sess.OrphanSince.IsZero())
+	orphan := sess.OrphanSince
+	sess.AddWriter(&spectatorBuf{}, nil, "")
+	assert.Equal(t, orphan, sess.OrphanSince)
+	assert.Len(t, sess.WriterStats(), 2)
+
+	s.hibernateIdle(now.Add(2 * time.Hour))
+	assert.Equal(t, "warning", nextHibernateEvent(t, events).Event)
+}
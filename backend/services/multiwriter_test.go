@@ -0,0 +1,109 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bufWriter collects everything written to it.
+type bufWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *bufWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *bufWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func (w *bufWriter) Close() error { return nil }
+
+// stuckWriter blocks every Write until released, like a phone on a dead network.
+type stuckWriter struct {
+	release chan struct{}
+	resync  chan struct{}
+}
+
+func (w *stuckWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func (w *stuckWriter) Close() error { return nil }
+
+func (w *stuckWriter) CloseResync() { close(w.resync) }
+
+func newTestMultiWriter(t *testing.T) *multiWriter {
+	mw := &multiWriter{
+		writers: make(map[io.Writer]*writerEntry),
+		screen:  newVTScreen(80, 24),
+		log:     openScrollbackLog(t.TempDir(), 0),
+	}
+	t.Cleanup(mw.Stop)
+	return mw
+}
+
+func TestMultiWriter_SlowWriterDoesNotBlockOthers(t *testing.T) {
+	mw := newTestMultiWriter(t)
+	fast := &bufWriter{}
+	slow := &stuckWriter{release: make(chan struct{}), resync: make(chan struct{})}
+	defer close(slow.release)
+
+	mw.Add(slow, slow, "phone")
+	mw.Add(fast, fast, "desktop")
+
+	done := make(chan struct{})
+	go func() {
+		mw.Write([]byte("hello\r\n"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Write blocked on a stuck writer")
+	}
+
+	require.Eventually(t, func() bool { return strings.Contains(fast.String(), "hello") }, time.Second, 5*time.Millisecond)
+	// The snapshot goes out before live output
+	assert.True(t, strings.HasPrefix(fast.String(), "\x1bc"))
+}
+
+func TestMultiWriter_LaggingWriterIsResynced(t *testing.T) {
+	mw := newTestMultiWriter(t)
+	slow := &stuckWriter{release: make(chan struct{}), resync: make(chan struct{})}
+	defer close(slow.release)
+	mw.Add(slow, slow, "phone")
+
+	chunk := []byte(strings.Repeat("x", 64<<10))
+	for i := 0; i < 8; i++ {
+		mw.Write(chunk)
+	}
+	stats := mw.Stats()
+	require.Len(t, stats, 1)
+	assert.True(t, stats[0].Lagging)
+	assert.Greater(t, stats[0].QueuedBytes, writerLagBytes)
+
+	for i := 0; i < writerResyncBytes/len(chunk); i++ {
+		mw.Write(chunk)
+	}
+	select {
+	case <-slow.resync:
+	case <-time.After(time.Second):
+		t.Fatal("writer past the hard cap was not resynced")
+	}
+	assert.Equal(t, 0, mw.Count())
+}
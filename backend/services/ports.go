@@ -0,0 +1,243 @@
+package services
+
+import (
+	"encoding/hex"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── Listening ports of terminals ──
+//
+// On every childWatchLoop tick the listening TCP sockets (/proc/net/tcp{,6})
+// are matched against the sockets held by each terminal's process tree, so a
+// dev server started in a terminal is known together with its owner. The
+// /preview/:port proxy only lets a user through to ports owned this way.
+
+// ListeningPort is a TCP port a terminal's process listens on.
+type ListeningPort struct {
+	Port       int       `json:"port"`
+	Addr       string    `json:"addr"` // listen address, e.g. "0.0.0.0" or "::1"
+	PID        int       `json:"pid"`
+	Cmdline    string    `json:"cmdline"`
+	InstanceID string    `json:"instance_id"`
+	Since      time.Time `json:"since"`
+}
+
+// DialAddr is the address to reach the port from the backend.
+func (p ListeningPort) DialAddr() string {
+	host := p.Addr
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(p.Port))
+}
+
+// PortEvent is a port opening or closing in a terminal.
+type PortEvent struct {
+	Event       string // "opened" or "closed"
+	UserID      string
+	WorkspaceID string
+	Port        ListeningPort
+}
+
+// listenSocket is a LISTEN entry of /proc/net/tcp.
+type listenSocket struct {
+	ip   net.IP
+	port int
+}
+
+// portRescanInterval limits on-demand rescans for ports not seen by the last poll.
+const portRescanInterval = 500 * time.Millisecond
+
+type PortService struct {
+	// OnEvent is called in its own goroutine for every opened/closed port.
+	OnEvent func(PortEvent)
+
+	mu      sync.Mutex
+	byKey   map[string]map[int]ListeningPort // session key → port → listener
+	targets map[string]watchTarget           // live terminals at the last poll
+	rescan  map[string]time.Time             // user ID → last on-demand rescan
+}
+
+func NewPortService() *PortService {
+	return &PortService{
+		byKey:   make(map[string]map[int]ListeningPort),
+		targets: make(map[string]watchTarget),
+		rescan:  make(map[string]time.Time),
+	}
+}
+
+// UserPorts returns the ports open in a user's terminals, by port number.
+func (s *PortService) UserPorts(userID string) []ListeningPort {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []ListeningPort
+	for key, ports := range s.byKey {
+		if s.targets[key].userID != userID {
+			continue
+		}
+		for _, p := range ports {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Port < out[j].Port })
+	return out
+}
+
+// Lookup returns the listener if port is open in one of the user's terminals.
+// A port not seen by the last poll (a server started a moment ago) triggers a
+// rescan of the user's terminals.
+func (s *PortService) Lookup(userID string, port int) (ListeningPort, bool) {
+	s.mu.Lock()
+	var mine []watchTarget
+	for key, t := range s.targets {
+		if t.userID != userID {
+			continue
+		}
+		if p, ok := s.byKey[key][port]; ok {
+			s.mu.Unlock()
+			return p, true
+		}
+		mine = append(mine, t)
+	}
+	if len(mine) == 0 || time.Since(s.rescan[userID]) < portRescanInterval {
+		s.mu.Unlock()
+		return ListeningPort{}, false
+	}
+	s.rescan[userID] = time.Now()
+	s.mu.Unlock()
+
+	listen := listeningSockets()
+	for _, t := range mine {
+		if p, ok := ownedPorts(t, listen, time.Now())[port]; ok {
+			return p, true
+		}
+	}
+	return ListeningPort{}, false
+}
+
+// poll rescans the terminals' listening ports and fires the changes. Called
+// by childWatchLoop.
+func (s *PortService) poll(targets []watchTarget) {
+	now := time.Now()
+	listen := listeningSockets()
+	var events []PortEvent
+
+	cur := make(map[string]map[int]ListeningPort, len(targets))
+	curTargets := make(map[string]watchTarget, len(targets))
+	for _, t := range targets {
+		curTargets[t.key] = t
+		if len(listen) > 0 {
+			if ports := ownedPorts(t, listen, now); len(ports) > 0 {
+				cur[t.key] = ports
+			}
+		}
+	}
+
+	s.mu.Lock()
+	for key, ports := range cur {
+		prev := s.byKey[key]
+		for n, p := range ports {
+			if old, ok := prev[n]; ok && old.PID == p.PID {
+				ports[n] = old // keep Since
+				continue
+			}
+			events = append(events, PortEvent{Event: "opened", UserID: curTargets[key].userID, WorkspaceID: curTargets[key].workspaceID, Port: p})
+		}
+	}
+	for key, prev := range s.byKey {
+		for n, p := range prev {
+			if c, ok := cur[key][n]; ok && c.PID == p.PID {
+				continue
+			}
+			t := s.targets[key]
+			events = append(events, PortEvent{Event: "closed", UserID: t.userID, WorkspaceID: t.workspaceID, Port: p})
+		}
+	}
+	s.byKey = cur
+	s.targets = curTargets
+	s.mu.Unlock()
+
+	for _, ev := range events {
+		log.Printf("[Ports] %s port=%d pid=%d user=%s instance=%s", ev.Event, ev.Port.Port, ev.Port.PID, ev.UserID, ev.Port.InstanceID)
+		if s.OnEvent != nil {
+			go s.OnEvent(ev)
+		}
+	}
+}
+
+// ownedPorts returns the listening ports held by a terminal's shell or its
+// descendants.
+func ownedPorts(t watchTarget, listen map[uint64]listenSocket, now time.Time) map[int]ListeningPort {
+	procs := append([]ProcessInfo{{PID: t.pid}}, descendantProcs(t.pid)...)
+	ports := make(map[int]ListeningPort)
+	for _, p := range procs {
+		for _, inode := range socketInodes(p.PID) {
+			l, ok := listen[inode]
+			if !ok {
+				continue
+			}
+			if _, dup := ports[l.port]; dup {
+				continue
+			}
+			ports[l.port] = ListeningPort{
+				Port:       l.port,
+				Addr:       l.ip.String(),
+				PID:        p.PID,
+				Cmdline:    p.Cmdline,
+				InstanceID: t.instanceID,
+				Since:      now,
+			}
+		}
+	}
+	return ports
+}
+
+// parseProcNetTCP extracts the LISTEN sockets from /proc/net/tcp or tcp6
+// content, by socket inode.
+func parseProcNetTCP(data string, out map[uint64]listenSocket) {
+	for _, line := range strings.Split(data, "\n") {
+		f := strings.Fields(line)
+		if len(f) < 10 || f[3] != "0A" { // 0A = TCP_LISTEN
+			continue
+		}
+		ip, port, ok := parseProcNetAddr(f[1])
+		if !ok {
+			continue
+		}
+		inode, err := strconv.ParseUint(f[9], 10, 64)
+		if err != nil || inode == 0 {
+			continue
+		}
+		out[inode] = listenSocket{ip: ip, port: port}
+	}
+}
+
+// parseProcNetAddr decodes "0100007F:1F90": the address is printed as 32-bit
+// words in host byte order (little-endian on our hosts), the port as plain hex.
+func parseProcNetAddr(s string) (net.IP, int, bool) {
+	host, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, false
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, false
+	}
+	b, err := hex.DecodeString(host)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, 0, false
+	}
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return net.IP(b), int(port), true
+}
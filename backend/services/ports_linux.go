@@ -0,0 +1,42 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listeningSockets reads the LISTEN TCP sockets of the backend's network
+// namespace (shared with terminals: the sandbox has no network namespace).
+func listeningSockets() map[uint64]listenSocket {
+	out := make(map[uint64]listenSocket)
+	for _, f := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		if data, err := os.ReadFile(f); err == nil {
+			parseProcNetTCP(string(data), out)
+		}
+	}
+	return out
+}
+
+// socketInodes lists the inodes of the sockets a process has open.
+func socketInodes(pid int) []uint64 {
+	dir := filepath.Join("/proc", strconv.Itoa(pid), "fd")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []uint64
+	for _, e := range entries {
+		link, err := os.Readlink(filepath.Join(dir, e.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		if inode, err := strconv.ParseUint(strings.TrimSuffix(link[len("socket:["):], "]"), 10, 64); err == nil {
+			out = append(out, inode)
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package services
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPorts_OwnedByProcessTree(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// The test process plays the shell that holds the listener.
+	target := watchTarget{key: "term:u1:t1", userID: "u1", instanceID: "t1", pid: os.Getpid()}
+	s := NewPortService()
+	events := make(chan PortEvent, 16)
+	s.OnEvent = func(ev PortEvent) { events <- ev }
+
+	s.poll([]watchTarget{target})
+	ev := waitPortEvent(t, events, port)
+	assert.Equal(t, "opened", ev.Event)
+	assert.Equal(t, "t1", ev.Port.InstanceID)
+	assert.Equal(t, "127.0.0.1", ev.Port.Addr)
+
+	p, ok := s.Lookup("u1", port)
+	require.True(t, ok)
+	assert.Equal(t, os.Getpid(), p.PID)
+	_, ok = s.Lookup("u2", port)
+	assert.False(t, ok, "another user's port")
+
+	ln.Close()
+	s.poll([]watchTarget{target})
+	ev = waitPortEvent(t, events, port)
+	assert.Equal(t, "closed", ev.Event)
+	_, ok = s.Lookup("u1", port)
+	assert.False(t, ok)
+}
+
+func waitPortEvent(t *testing.T, events chan PortEvent, port int) PortEvent {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Port.Port == port {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("no event for port %d", port)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package services
+
+// Port detection needs /proc; elsewhere terminals have no known ports.
+
+func listeningSockets() map[uint64]listenSocket { return nil }
+
+func socketInodes(_ int) []uint64 { return nil }
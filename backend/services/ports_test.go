@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcNetTCP(t *testing.T) {
+	const tcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4711 1 0000000000000000 100 0 0 10 0
+   1: 00000000:1435 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4712 1 0000000000000000 100 0 0 10 0
+   2: 0100007F:1F90 0100007F:D2C4 01 00000000:00000000 00:00000000 00000000     0        0 4713 1 0000000000000000 20 4 30 10 -1
+`
+	const tcp6 = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0BB8 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 4720 1 0000000000000000 100 0 0 10 0
+`
+	out := make(map[uint64]listenSocket)
+	parseProcNetTCP(tcp, out)
+	parseProcNetTCP(tcp6, out)
+
+	require.Len(t, out, 3, "established sockets are skipped")
+	assert.Equal(t, "127.0.0.1", out[4711].ip.String())
+	assert.Equal(t, 8080, out[4711].port)
+	assert.Equal(t, "0.0.0.0", out[4712].ip.String())
+	assert.Equal(t, 5173, out[4712].port)
+	assert.Equal(t, "::1", out[4720].ip.String())
+	assert.Equal(t, 3000, out[4720].port)
+}
+
+func TestListeningPort_DialAddr(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:5173", ListeningPort{Port: 5173, Addr: "0.0.0.0"}.DialAddr())
+	assert.Equal(t, "[::1]:3000", ListeningPort{Port: 3000, Addr: "::"}.DialAddr())
+	assert.Equal(t, "[::1]:3000", ListeningPort{Port: 3000, Addr: "::1"}.DialAddr())
+	assert.Equal(t, "10.0.0.5:80", ListeningPort{Port: 80, Addr: "10.0.0.5"}.DialAddr())
+}
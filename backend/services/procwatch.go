@@ -0,0 +1,295 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Process watchers ──
+//
+// Per-user cmdline patterns (models.ProcessWatcher) matched against the
+// process tree of each terminal on every childWatchLoop tick. A matching
+// process fires "started" when it first shows up and "exited" once it is gone.
+// The exit status is that of the shell command it ran under, taken from the
+// command log (shell integration); it is unknown for processes that outlived
+// their command or when the shell has no integration. Children of a watched
+// process matching the same watcher are not reported separately.
+
+// WatchedProcess is a running process matched by a watcher.
+type WatchedProcess struct {
+	WatcherID string    `json:"watcher_id"`
+	Name      string    `json:"name"`
+	PID       int       `json:"pid"`
+	Cmdline   string    `json:"cmdline"`
+	StartedAt time.Time `json:"started_at"` // when it was first seen (poll interval accuracy)
+}
+
+// ProcessEvent is a watched process starting or exiting in a terminal.
+type ProcessEvent struct {
+	Event       string // "started" or "exited"
+	UserID      string
+	InstanceID  string
+	WorkspaceID string
+	Process     WatchedProcess
+	DurationMs  int64 // exited only
+	ExitCode    *int  // exited only, nil if unknown
+}
+
+type compiledWatcher struct {
+	models.ProcessWatcher
+	re *regexp.Regexp
+}
+
+type watchedProc struct {
+	WatchedProcess
+	cmdSeq   int // command-log entry that was running when the process appeared
+	lastSeen time.Time
+}
+
+type pendingExit struct {
+	proc   *watchedProc
+	target watchTarget
+	polls  int
+}
+
+// watchTarget is a live terminal as seen by childWatchLoop.
+type watchTarget struct {
+	key         string
+	userID      string
+	instanceID  string
+	workspaceID string
+	pid         int
+	cmds        *commandLog
+}
+
+type ProcessWatchService struct {
+	// OnEvent is called in its own goroutine for every started/exited process.
+	OnEvent func(ProcessEvent)
+
+	mu      sync.Mutex
+	rules   map[string][]*compiledWatcher // by user ID; absent: not loaded yet
+	gen     map[string]int
+	running map[string]map[string]*watchedProc // session key → "pid/watcher" → process
+	targets map[string]watchTarget             // last known identity of sessions in running
+	exits   []*pendingExit
+}
+
+func NewProcessWatchService() *ProcessWatchService {
+	return &ProcessWatchService{
+		rules:   make(map[string][]*compiledWatcher),
+		gen:     make(map[string]int),
+		running: make(map[string]map[string]*watchedProc),
+		targets: make(map[string]watchTarget),
+	}
+}
+
+// CompileWatcherPattern validates and compiles a watcher's cmdline pattern.
+func CompileWatcherPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern is empty")
+	}
+	if len(pattern) > triggerMaxPattern {
+		return nil, fmt.Errorf("pattern is longer than %d bytes", triggerMaxPattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// Invalidate drops a user's cached watchers after they changed.
+func (s *ProcessWatchService) Invalidate(userID string) {
+	s.mu.Lock()
+	delete(s.rules, userID)
+	s.gen[userID]++
+	s.mu.Unlock()
+}
+
+// Running returns the watched processes running in a terminal, oldest first.
+func (s *ProcessWatchService) Running(sessionKey string) []WatchedProcess {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	procs := s.running[sessionKey]
+	if len(procs) == 0 {
+		return nil
+	}
+	out := make([]WatchedProcess, 0, len(procs))
+	for _, p := range procs {
+		out = append(out, p.WatchedProcess)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+func (s *ProcessWatchService) rulesFor(userID string) []*compiledWatcher {
+	s.mu.Lock()
+	rules, ok := s.rules[userID]
+	gen := s.gen[userID]
+	s.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	rules = loadWatchers(userID)
+	s.mu.Lock()
+	if s.gen[userID] == gen {
+		s.rules[userID] = rules
+	}
+	s.mu.Unlock()
+	return rules
+}
+
+func loadWatchers(userID string) []*compiledWatcher {
+	if database.DB == nil {
+		return nil
+	}
+	var rows []models.ProcessWatcher
+	if err := database.DB.Where("user_id = ? AND enabled = ?", userID, true).Find(&rows).Error; err != nil {
+		log.Printf("[ProcessWatch] load user=%s: %v", userID, err)
+		return nil
+	}
+	rules := make([]*compiledWatcher, 0, len(rows))
+	for _, r := range rows {
+		re, err := CompileWatcherPattern(r.Pattern)
+		if err != nil {
+			log.Printf("[ProcessWatch] skipping watcher=%s: %v", r.ID, err)
+			continue
+		}
+		rules = append(rules, &compiledWatcher{ProcessWatcher: r, re: re})
+	}
+	return rules
+}
+
+// poll compares the process trees of the live terminals with the previous
+// poll and fires the transitions. Called by childWatchLoop.
+func (s *ProcessWatchService) poll(targets []watchTarget) {
+	now := time.Now()
+	var events []ProcessEvent
+	live := make(map[string]bool, len(targets))
+
+	for _, t := range targets {
+		live[t.key] = true
+		rules := s.rulesFor(t.userID)
+		s.mu.Lock()
+		prev := s.running[t.key]
+		s.mu.Unlock()
+		if len(rules) == 0 && len(prev) == 0 {
+			continue
+		}
+
+		cur := make(map[string]*watchedProc)
+		matched := make(map[int]map[string]bool) // pid → watchers matched by it or an ancestor
+		for _, p := range descendantProcs(t.pid) {
+			inherited := matched[p.PPID]
+			mine := inherited
+			for _, r := range rules {
+				wid := r.ID.String()
+				if inherited[wid] || !r.re.MatchString(p.Cmdline) {
+					continue
+				}
+				if len(mine) == len(inherited) {
+					mine = make(map[string]bool, len(inherited)+1)
+					for k := range inherited {
+						mine[k] = true
+					}
+				}
+				mine[wid] = true
+
+				id := strconv.Itoa(p.PID) + "/" + wid
+				if w, ok := prev[id]; ok {
+					w.lastSeen = now
+					cur[id] = w
+					continue
+				}
+				w := &watchedProc{
+					WatchedProcess: WatchedProcess{WatcherID: wid, Name: r.Name, PID: p.PID, Cmdline: p.Cmdline, StartedAt: now},
+					cmdSeq:         t.cmds.runningSeq(),
+					lastSeen:       now,
+				}
+				cur[id] = w
+				events = append(events, ProcessEvent{
+					Event: "started", UserID: t.userID, InstanceID: t.instanceID, WorkspaceID: t.workspaceID,
+					Process: w.WatchedProcess,
+				})
+			}
+			matched[p.PID] = mine
+		}
+
+		s.mu.Lock()
+		for id, w := range prev {
+			if _, ok := cur[id]; !ok {
+				s.exits = append(s.exits, &pendingExit{proc: w, target: t})
+			}
+		}
+		if len(cur) > 0 {
+			s.running[t.key] = cur
+			s.targets[t.key] = t
+		} else {
+			delete(s.running, t.key)
+			delete(s.targets, t.key)
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	// Terminals that are gone take their processes with them.
+	for key, procs := range s.running {
+		if live[key] {
+			continue
+		}
+		for _, w := range procs {
+			s.exits = append(s.exits, &pendingExit{proc: w, target: s.targets[key], polls: 1})
+		}
+		delete(s.running, key)
+		delete(s.targets, key)
+	}
+	// An exit is reported once its command finished, or a poll later without
+	// a status (the command goes on, or there is no shell integration).
+	pending := s.exits[:0]
+	for _, e := range s.exits {
+		ev, done := e.resolve(now)
+		if !done {
+			e.polls++
+			pending = append(pending, e)
+			continue
+		}
+		events = append(events, ev)
+	}
+	s.exits = pending
+	s.mu.Unlock()
+
+	for _, ev := range events {
+		log.Printf("[ProcessWatch] %s pid=%d watcher=%s user=%s instance=%s", ev.Event, ev.Process.PID, ev.Process.WatcherID, ev.UserID, ev.InstanceID)
+		if s.OnEvent != nil {
+			go s.OnEvent(ev)
+		}
+	}
+}
+
+func (e *pendingExit) resolve(now time.Time) (ProcessEvent, bool) {
+	ev := ProcessEvent{
+		Event: "exited", UserID: e.target.userID, InstanceID: e.target.instanceID, WorkspaceID: e.target.workspaceID,
+		Process: e.proc.WatchedProcess,
+	}
+	end := now
+	var c TerminalCommand
+	var ok bool
+	if e.target.cmds != nil && e.proc.cmdSeq > 0 {
+		c, ok = e.target.cmds.Get(e.proc.cmdSeq)
+	}
+	if ok && c.FinishedAt != nil && !c.FinishedAt.Before(e.proc.lastSeen) {
+		// The command ended after the process was last seen: the process was
+		// part of it up to the end, so its status is the command's.
+		ev.ExitCode = c.ExitCode
+		end = *c.FinishedAt
+	} else if e.polls == 0 {
+		return ev, false
+	}
+	ev.DurationMs = max(end.Sub(e.proc.StartedAt), 0).Milliseconds()
+	return ev, true
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package services
+
+import (
+	"os/exec"
+	"regexp"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/models"
+)
+
+func newTestWatchService(t *testing.T, userID, pattern string) (*ProcessWatchService, func() []ProcessEvent) {
+	t.Helper()
+	s := NewProcessWatchService()
+	s.rules[userID] = []*compiledWatcher{{
+		ProcessWatcher: models.ProcessWatcher{ID: uuid.New(), Name: "sleepy", Pattern: pattern},
+		re:             regexp.MustCompile(pattern),
+	}}
+	var mu sync.Mutex
+	var got []ProcessEvent
+	s.OnEvent = func(ev ProcessEvent) {
+		mu.Lock()
+		got = append(got, ev)
+		mu.Unlock()
+	}
+	return s, func() []ProcessEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ProcessEvent(nil), got...)
+	}
+}
+
+// startShell runs a shell whose child is `sleep 30` and returns the shell and the sleep's pid.
+func startShell(t *testing.T) (*exec.Cmd, int) {
+	t.Helper()
+	sh := exec.Command("sh", "-c", "sleep 30; true")
+	require.NoError(t, sh.Start())
+	t.Cleanup(func() { sh.Process.Kill(); sh.Wait() })
+	var child int
+	require.Eventually(t, func() bool {
+		procs := descendantProcs(sh.Process.Pid)
+		if len(procs) == 1 && procs[0].Cmdline == "sleep 30" {
+			child = procs[0].PID
+			return true
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+	return sh, child
+}
+
+func TestProcessWatch_ExitStatusFromCommandLog(t *testing.T) {
+	s, events := newTestWatchService(t, "u1", `^sleep \d+$`)
+	sh, child := startShell(t)
+
+	cl := &commandLog{path: t.TempDir() + "/commands.jsonl", nextSeq: 1}
+	cl.handleOSC(133, "C;cmdline=sleep 30; true", 0, 0)
+	target := watchTarget{key: "term:u1:t1", userID: "u1", instanceID: "t1", pid: sh.Process.Pid, cmds: cl}
+
+	s.poll([]watchTarget{target})
+	require.Eventually(t, func() bool { return len(events()) == 1 }, time.Second, 5*time.Millisecond)
+	started := events()[0]
+	assert.Equal(t, "started", started.Event)
+	assert.Equal(t, child, started.Process.PID)
+	assert.Equal(t, "sleepy", started.Process.Name)
+	require.Len(t, s.Running("term:u1:t1"), 1)
+
+	require.NoError(t, syscall.Kill(child, syscall.SIGTERM))
+	sh.Wait()
+	cl.handleOSC(133, "D;143", 10, 20)
+
+	s.poll([]watchTarget{target})
+	require.Eventually(t, func() bool { return len(events()) == 2 }, time.Second, 5*time.Millisecond)
+	exited := events()[1]
+	assert.Equal(t, "exited", exited.Event)
+	require.NotNil(t, exited.ExitCode)
+	assert.Equal(t, 143, *exited.ExitCode)
+	assert.Empty(t, s.Running("term:u1:t1"))
+}
+
+func TestProcessWatch_UnknownStatusAfterGrace(t *testing.T) {
+	s, events := newTestWatchService(t, "u1", `sleep`)
+	sh, _ := startShell(t)
+	target := watchTarget{key: "term:u1:t1", userID: "u1", instanceID: "t1", pid: sh.Process.Pid}
+
+	s.poll([]watchTarget{target})
+	require.Eventually(t, func() bool { return len(events()) == 1 }, time.Second, 5*time.Millisecond)
+
+	// The terminal goes away with the process still running.
+	s.poll(nil)
+	require.Eventually(t, func() bool { return len(events()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "exited", events()[1].Event)
+	assert.Nil(t, events()[1].ExitCode)
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ── PTY holders: shells that outlive the backend process ──
+//
+// With holders enabled every shell is started by a small `nebulide pty-holder`
+// process in its own session. The holder owns the PTY and serves it on a unix
+// socket under ptyHolderDir; the backend is just a client. When the backend
+// restarts, AdoptHolders dials the sockets and the shells come back as live
+// sessions (GetOrCreate reattaches instead of spawning). Output produced while
+// no backend is attached is buffered in the holder (bounded) and flushed on
+// reattach.
+//
+// Holders survive restarts of the Go process, not of the machine or container.
+// In Docker that means the backend must restart inside a running container:
+// entrypoint.sh supervises the binary and the deploy workflow swaps it in place,
+// recreating the container (and losing the shells) only when the image or
+// compose setup changed.
+//
+// Wire protocol: frames of [type byte][uint32 big-endian length][payload].
+//   holder → backend: 'H' hello (JSON holderHello, always first), 'O' output,
+//                     'X' exit (int32 exit code, then the holder closes)
+//   backend → holder: 'I' input, 'R' resize (uint16 cols, uint16 rows),
+//                     'K' kill the shell and exit without waiting for a reattach
+
+var ptyHolderDir = "/tmp/nebulide-pty"
+
+const (
+	holderFrameHello  = 'H'
+	holderFrameOutput = 'O'
+	holderFrameExit   = 'X'
+	holderFrameInput  = 'I'
+	holderFrameResize = 'R'
+	holderFrameKill   = 'K'
+
+	holderMaxFrame = 1 << 20
+)
+
+// holderSpec is what the backend hands a freshly spawned holder on stdin.
+type holderSpec struct {
+	SessionKey string   `json:"session_key"`
+	Socket     string   `json:"socket"`
+	Path       string   `json:"path"`
+	Args       []string `json:"args"`
+	Dir        string   `json:"dir"`
+	Env        []string `json:"env"`
+	Cloneflags uintptr  `json:"cloneflags,omitempty"` // namespaces for the shell (sandbox)
+	Cgroup     string   `json:"cgroup,omitempty"`     // cgroup the shell starts in (see cgroups.go)
+}
+
+// holderHello describes the shell a holder owns; sent on every connect.
+type holderHello struct {
+	SessionKey string    `json:"session_key"`
+	PID        int       `json:"pid"`
+	WorkDir    string    `json:"work_dir"`
+	Cols       int       `json:"cols"`
+	Rows       int       `json:"rows"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// holderSocketPath hashes the session key so the path stays well under the
+// unix socket length limit whatever the instance id looks like.
+func holderSocketPath(sessionKey string) string {
+	sum := sha1.Sum([]byte(sessionKey))
+	return filepath.Join(ptyHolderDir, hex.EncodeToString(sum[:])+".sock")
+}
+
+func writeHolderFrame(w io.Writer, typ byte, payload []byte) error {
+	buf := make([]byte, 5+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(payload)))
+	copy(buf[5:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readHolderFrame(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:5])
+	if n > holderMaxFrame {
+		return 0, nil, fmt.Errorf("holder frame too large: %d bytes", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
+
+// holderPty is the backend side of a holder connection. It stands in for the
+// local PTY in TerminalSession: Read yields shell output and returns io.EOF
+// once the shell has exited.
+type holderPty struct {
+	conn  net.Conn
+	hello holderHello
+
+	wmu  sync.Mutex
+	rest []byte // undelivered part of the current output frame
+
+	// exitCode is the shell's exit status once Read has returned io.EOF
+	// (-1 if the holder went away without reporting it).
+	exitCode int
+}
+
+// dialHolder connects to a holder socket and reads its hello.
+func dialHolder(path string) (*holderPty, error) {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	typ, payload, err := readHolderFrame(conn)
+	if err == nil && typ != holderFrameHello {
+		err = fmt.Errorf("unexpected holder frame %q", typ)
+	}
+	var hello holderHello
+	if err == nil {
+		err = json.Unmarshal(payload, &hello)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	return &holderPty{conn: conn, hello: hello, exitCode: -1}, nil
+}
+
+func (h *holderPty) Read(p []byte) (int, error) {
+	for len(h.rest) == 0 {
+		typ, payload, err := readHolderFrame(h.conn)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrUnexpectedEOF) {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		switch typ {
+		case holderFrameOutput:
+			h.rest = payload
+		case holderFrameExit:
+			code := -1
+			if len(payload) == 4 {
+				code = int(int32(binary.BigEndian.Uint32(payload)))
+			}
+			log.Printf("[TerminalService] holder shell exited code=%d key=%s", code, h.hello.SessionKey)
+			h.exitCode = code
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, h.rest)
+	h.rest = h.rest[n:]
+	return n, nil
+}
+
+func (h *holderPty) Write(p []byte) (int, error) {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+	if err := writeHolderFrame(h.conn, holderFrameInput, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *holderPty) Resize(width, height int) error {
+	var payload [4]byte
+	binary.BigEndian.PutUint16(payload[0:2], uint16(width))
+	binary.BigEndian.PutUint16(payload[2:4], uint16(height))
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+	return writeHolderFrame(h.conn, holderFrameResize, payload[:])
+}
+
+// Close tells the holder to kill the shell and quit, then disconnects. Only
+// called when the session is being torn down; a backend that merely exits
+// never closes, so its holders keep running.
+func (h *holderPty) Close() error {
+	h.wmu.Lock()
+	h.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	writeHolderFrame(h.conn, holderFrameKill, nil)
+	h.wmu.Unlock()
+	return h.conn.Close()
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPtyHolder_SurvivesBackendExit runs the real restart path: a backend
+// process spawns a holder and dies without detaching; the next backend adopts
+// the same shell from ptyHolderDir.
+func TestPtyHolder_SurvivesBackendExit(t *testing.T) {
+	if dir := os.Getenv("NEBULIDE_TEST_BACKEND_DIR"); dir != "" {
+		// The "old backend": start a shell, report its pid, exit abruptly.
+		ptyHolderDir = dir
+		hp, err := startPtyHolder(holderSpec{
+			SessionKey: "term:user-1:main",
+			Path:       "/bin/sh",
+			Dir:        dir,
+			Env:        []string{"PATH=/usr/bin:/bin", "PS1=$ "},
+		})
+		if err != nil {
+			fmt.Println("error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(hp.hello.PID)
+		os.Exit(0)
+	}
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("no /bin/sh")
+	}
+
+	// Not t.TempDir(): its path can push the socket past the unix path limit.
+	dir, err := os.MkdirTemp("", "pty-")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	backend := exec.Command(os.Args[0], "-test.run=^TestPtyHolder_SurvivesBackendExit$")
+	backend.Env = append(os.Environ(), "NEBULIDE_TEST_BACKEND_DIR="+dir, "JWT_SECRET=backend-only-secret")
+	out, err := backend.Output()
+	require.NoError(t, err, string(out))
+	pid, err := strconv.Atoi(strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0]))
+	require.NoError(t, err, string(out))
+
+	saved := ptyHolderDir
+	ptyHolderDir = dir
+	t.Cleanup(func() { ptyHolderDir = saved })
+
+	holders := findHolders()
+	require.Len(t, holders, 1)
+	hp := holders[0]
+	defer hp.Close()
+	assert.Equal(t, pid, hp.hello.PID)
+	assert.Equal(t, "term:user-1:main", hp.hello.SessionKey)
+
+	hp.Write([]byte("echo adopted-$((40+2))\n"))
+	readUntil(t, hp, "adopted-42")
+
+	// The holder (the shell's parent) got none of the backend's environment.
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	require.NoError(t, err)
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	environ, err := os.ReadFile("/proc/" + fields[1] + "/environ")
+	require.NoError(t, err)
+	assert.NotContains(t, string(environ), "JWT_SECRET")
+	assert.Equal(t, []string{"PATH=" + os.Getenv("PATH")}, strings.Split(strings.TrimRight(string(environ), "\x00"), "\x00"))
+
+	hp.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(holderSocketPath("term:user-1:main")); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("holder did not exit after Close")
+}
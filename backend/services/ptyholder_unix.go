@@ -0,0 +1,366 @@
+//go:build !windows
+
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	gopty "github.com/aymanbagabas/go-pty"
+)
+
+const (
+	// holderPendingMax bounds the output a holder keeps while detached; the
+	// oldest bytes go first.
+	holderPendingMax = 4 << 20
+	// holderExitLinger is how long a holder whose shell exited waits for a
+	// backend to collect the remaining output and exit code.
+	holderExitLinger   = 30 * time.Second
+	holderWriteTimeout = 5 * time.Second
+)
+
+// startPtyHolder spawns a holder for spec and connects to it.
+func startPtyHolder(spec holderSpec) (*holderPty, error) {
+	if err := os.MkdirAll(ptyHolderDir, 0o700); err != nil {
+		return nil, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	spec.Socket = holderSocketPath(spec.SessionKey)
+
+	cmd := exec.Command(exe, "pty-holder")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	// The holder outlives us by design; it must not carry the backend's
+	// secrets (JWT, DB, Telegram) around for the life of a shell. The shell's
+	// own environment travels in spec.Env.
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go cmd.Wait() // reap; the holder outlives us only if we exit first
+
+	json.NewEncoder(stdin).Encode(spec)
+	stdin.Close()
+
+	ready := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		ready <- strings.TrimSpace(line)
+	}()
+	select {
+	case line := <-ready:
+		if line != "ready" {
+			cmd.Process.Kill()
+			return nil, fmt.Errorf("pty-holder failed: %s", line)
+		}
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		return nil, errors.New("pty-holder did not start in time")
+	}
+	return dialHolder(spec.Socket)
+}
+
+// findHolders connects to every holder left in ptyHolderDir. Sockets nobody
+// listens on any more (holder killed with the machine) are removed.
+func findHolders() []*holderPty {
+	paths, _ := filepath.Glob(filepath.Join(ptyHolderDir, "*.sock"))
+	var result []*holderPty
+	for _, p := range paths {
+		hp, err := dialHolder(p)
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+				os.Remove(p)
+				os.Remove(strings.TrimSuffix(p, ".sock") + ".log")
+			}
+			log.Printf("[TerminalService] holder %s not adoptable: %v", filepath.Base(p), err)
+			continue
+		}
+		result = append(result, hp)
+	}
+	return result
+}
+
+// ── Holder process ──
+
+type ptyHolder struct {
+	spec      holderSpec
+	pty       gopty.Pty
+	cmd       *gopty.Cmd
+	startedAt time.Time
+
+	mu       sync.Mutex
+	client   net.Conn
+	pending  []byte // output produced while no backend is attached
+	cols     int
+	rows     int
+	exited   bool
+	exitCode int
+
+	quitOnce sync.Once
+	quit     chan struct{} // exit frame delivered, or kill requested
+}
+
+// RunPTYHolder is the entry point of `nebulide pty-holder`. It reads a
+// holderSpec from stdin, starts the shell, answers "ready" on stdout and then
+// serves the PTY on spec.Socket until the shell exits. Returns the exit status.
+func RunPTYHolder() int {
+	var spec holderSpec
+	if err := json.NewDecoder(os.Stdin).Decode(&spec); err != nil {
+		fmt.Println("bad spec:", err)
+		return 2
+	}
+	if f, err := os.OpenFile(strings.TrimSuffix(spec.Socket, ".sock")+".log", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600); err == nil {
+		log.SetOutput(f)
+	}
+	signal.Ignore(syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+
+	h := &ptyHolder{spec: spec, startedAt: time.Now(), cols: 80, rows: 24, quit: make(chan struct{})}
+	ln, err := h.start()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println("ready")
+	os.Stdout.Close()
+	os.Stdin.Close()
+
+	h.serve(ln)
+	return 0
+}
+
+func (h *ptyHolder) start() (net.Listener, error) {
+	p, err := gopty.New()
+	if err != nil {
+		return nil, err
+	}
+	p.Resize(h.cols, h.rows)
+	cmd := p.Command(h.spec.Path, h.spec.Args...)
+	cmd.Dir = h.spec.Dir
+	cmd.Env = h.spec.Env
+	setCloneflags(cmd, h.spec.Cloneflags)
+	if h.spec.Cgroup != "" {
+		attr, cg, err := withCgroup(cmd.SysProcAttr, h.spec.Cgroup)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("cgroup: %w", err)
+		}
+		defer cg.Close()
+		cmd.SysProcAttr = attr
+	}
+
+	os.Remove(h.spec.Socket)
+	ln, err := net.Listen("unix", h.spec.Socket)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	os.Chmod(h.spec.Socket, 0o600)
+
+	if err := cmd.Start(); err != nil {
+		ln.Close()
+		p.Close()
+		return nil, err
+	}
+	h.pty, h.cmd = p, cmd
+	log.Printf("[PtyHolder] shell started pid=%d key=%s", cmd.Process.Pid, h.spec.SessionKey)
+	return ln, nil
+}
+
+func (h *ptyHolder) serve(ln net.Listener) {
+	go h.acceptLoop(ln)
+
+	readDone := make(chan struct{})
+	go func() {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := h.pty.Read(buf)
+			if n > 0 {
+				h.deliver(buf[:n])
+			}
+			if err != nil {
+				break
+			}
+		}
+		close(readDone)
+	}()
+
+	code := 0
+	if err := h.cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else {
+			code = -1
+		}
+	}
+	// Let the reader drain what the shell wrote last, then unblock it.
+	select {
+	case <-readDone:
+	case <-time.After(time.Second):
+	}
+	h.pty.Close()
+	<-readDone
+	log.Printf("[PtyHolder] shell exited code=%d key=%s", code, h.spec.SessionKey)
+
+	h.mu.Lock()
+	h.exited, h.exitCode = true, code
+	if h.client != nil {
+		h.sendExitLocked(h.client)
+		h.client = nil
+	}
+	h.mu.Unlock()
+
+	select {
+	case <-h.quit:
+	case <-time.After(holderExitLinger):
+		log.Printf("[PtyHolder] no backend collected the exit, giving up key=%s", h.spec.SessionKey)
+	}
+	ln.Close()
+	os.Remove(h.spec.Socket)
+	os.Remove(strings.TrimSuffix(h.spec.Socket, ".sock") + ".log")
+}
+
+func (h *ptyHolder) stop() {
+	h.quitOnce.Do(func() { close(h.quit) })
+}
+
+func (h *ptyHolder) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		h.attach(conn)
+	}
+}
+
+// attach makes conn the one connected backend, replacing any previous one,
+// and flushes output buffered while detached.
+func (h *ptyHolder) attach(conn net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client != nil {
+		h.client.Close()
+		h.client = nil
+	}
+	hello, _ := json.Marshal(holderHello{
+		SessionKey: h.spec.SessionKey,
+		PID:        h.cmd.Process.Pid,
+		WorkDir:    h.spec.Dir,
+		Cols:       h.cols,
+		Rows:       h.rows,
+		StartedAt:  h.startedAt,
+	})
+	conn.SetWriteDeadline(time.Now().Add(holderWriteTimeout))
+	if err := writeHolderFrame(conn, holderFrameHello, hello); err != nil {
+		conn.Close()
+		return
+	}
+	for len(h.pending) > 0 {
+		n := min(len(h.pending), 64<<10)
+		if err := writeHolderFrame(conn, holderFrameOutput, h.pending[:n]); err != nil {
+			conn.Close()
+			return
+		}
+		h.pending = h.pending[n:]
+	}
+	h.pending = nil
+	if h.exited {
+		h.sendExitLocked(conn)
+		return
+	}
+	conn.SetWriteDeadline(time.Time{})
+	h.client = conn
+	log.Printf("[PtyHolder] backend attached key=%s", h.spec.SessionKey)
+	go h.readClient(conn)
+}
+
+func (h *ptyHolder) sendExitLocked(conn net.Conn) {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], uint32(int32(h.exitCode)))
+	conn.SetWriteDeadline(time.Now().Add(holderWriteTimeout))
+	writeHolderFrame(conn, holderFrameExit, payload[:])
+	conn.Close()
+	h.stop()
+}
+
+// deliver forwards output to the backend, or buffers it while detached.
+func (h *ptyHolder) deliver(p []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.client != nil {
+		h.client.SetWriteDeadline(time.Now().Add(holderWriteTimeout))
+		if err := writeHolderFrame(h.client, holderFrameOutput, p); err == nil {
+			return
+		}
+		log.Printf("[PtyHolder] backend gone, buffering output key=%s", h.spec.SessionKey)
+		h.client.Close()
+		h.client = nil
+	}
+	h.pending = append(h.pending, p...)
+	if over := len(h.pending) - holderPendingMax; over > 0 {
+		n := copy(h.pending, h.pending[over:])
+		h.pending = h.pending[:n]
+	}
+}
+
+func (h *ptyHolder) readClient(conn net.Conn) {
+	defer func() {
+		h.mu.Lock()
+		if h.client == conn {
+			h.client = nil
+			conn.Close()
+			log.Printf("[PtyHolder] backend detached key=%s", h.spec.SessionKey)
+		}
+		h.mu.Unlock()
+	}()
+	for {
+		typ, payload, err := readHolderFrame(conn)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case holderFrameInput:
+			h.pty.Write(payload)
+		case holderFrameResize:
+			if len(payload) != 4 {
+				continue
+			}
+			cols := int(binary.BigEndian.Uint16(payload[0:2]))
+			rows := int(binary.BigEndian.Uint16(payload[2:4]))
+			if err := h.pty.Resize(cols, rows); err == nil {
+				h.mu.Lock()
+				h.cols, h.rows = cols, rows
+				h.mu.Unlock()
+			}
+		case holderFrameKill:
+			log.Printf("[PtyHolder] kill requested key=%s", h.spec.SessionKey)
+			killProcessGroup(h.cmd.Process.Pid)
+			h.stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+//go:build !windows
+
+package services
+
+import (
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readUntil reads holder output until it contains want.
+func readUntil(t *testing.T, hp *holderPty, want string) string {
+	t.Helper()
+	var out strings.Builder
+	buf := make([]byte, 4096)
+	hp.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	defer hp.conn.SetReadDeadline(time.Time{})
+	for !strings.Contains(out.String(), want) {
+		n, err := hp.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			t.Fatalf("reading holder output: %v (got %q)", err, out.String())
+		}
+	}
+	return out.String()
+}
+
+func TestPtyHolder_ReattachKeepsShellAndBufferedOutput(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+	spec := holderSpec{
+		SessionKey: "term:user-1:main",
+		Socket:     filepath.Join(t.TempDir(), "h.sock"),
+		Path:       sh,
+		Dir:        t.TempDir(),
+		Env:        []string{"PATH=/usr/bin:/bin", "PS1=$ "},
+	}
+	h := &ptyHolder{spec: spec, startedAt: time.Now(), cols: 80, rows: 24, quit: make(chan struct{})}
+	ln, err := h.start()
+	require.NoError(t, err)
+	served := make(chan struct{})
+	go func() {
+		h.serve(ln)
+		close(served)
+	}()
+
+	hp, err := dialHolder(spec.Socket)
+	require.NoError(t, err)
+	assert.Equal(t, spec.SessionKey, hp.hello.SessionKey)
+	assert.Positive(t, hp.hello.PID)
+	require.NoError(t, hp.Resize(100, 30))
+
+	hp.Write([]byte("echo one-$((40+2))\n"))
+	readUntil(t, hp, "one-42")
+
+	// The backend goes away; the shell keeps producing output.
+	hp.conn.Close()
+	time.Sleep(50 * time.Millisecond)
+	h.pty.Write([]byte("echo two-$((40+3))\n"))
+	time.Sleep(200 * time.Millisecond)
+
+	hp, err = dialHolder(spec.Socket)
+	require.NoError(t, err)
+	assert.Equal(t, 100, hp.hello.Cols)
+	assert.Equal(t, 30, hp.hello.Rows)
+	readUntil(t, hp, "two-43")
+
+	hp.Write([]byte("exit 3\n"))
+	buf := make([]byte, 4096)
+	hp.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := hp.Read(buf); err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("holder did not exit after delivering the exit frame")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PTY holders rely on setsid and unix sockets; on Windows shells always run
+// directly under the backend (dev only).
+
+var errHoldersUnsupported = errors.New("pty holders are not supported on windows")
+
+func startPtyHolder(_ holderSpec) (*holderPty, error) { return nil, errHoldersUnsupported }
+
+func findHolders() []*holderPty { return nil }
+
+// RunPTYHolder is the entry point of `nebulide pty-holder`.
+func RunPTYHolder() int {
+	fmt.Println(errHoldersUnsupported)
+	return 1
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ── asciicast v2 recorder ──
+//
+// Format: https://docs.asciinema.org/manual/asciicast/v2/
+// First line is a JSON header, every following line is an event
+// [seconds-since-start, "o"|"r", data]. Files are plain NDJSON so an
+// in-progress recording can be downloaded and replayed at any time.
+
+const recordingExt = ".cast"
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+type asciicastRecorder struct {
+	mu    sync.Mutex
+	f     *os.File
+	start time.Time
+	path  string
+	// pending holds a trailing incomplete UTF-8 sequence from the previous
+	// chunk — PTY reads split multibyte runes, and asciicast data must be valid UTF-8.
+	pending []byte
+	closed  bool
+}
+
+func newAsciicastRecorder(path string, cols, rows int, title string) (*asciicastRecorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if cols <= 0 || rows <= 0 {
+		cols, rows = 80, 24
+	}
+	now := time.Now()
+	hdr, _ := json.Marshal(asciicastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: now.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm-256color", "SHELL": defaultShell()},
+	})
+	if _, err := f.Write(append(hdr, '\n')); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return &asciicastRecorder{f: f, start: now, path: path}, nil
+}
+
+func (r *asciicastRecorder) writeEvent(kind, data string) {
+	line, _ := json.Marshal([]interface{}{
+		float64(time.Since(r.start).Microseconds()) / 1e6,
+		kind,
+		data,
+	})
+	if _, err := r.f.Write(append(line, '\n')); err != nil {
+		log.Printf("[Recording] write error %s: %v", r.path, err)
+	}
+}
+
+// Output records a chunk of PTY output.
+func (r *asciicastRecorder) Output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	data := append(r.pending, p...)
+	cut := utf8CompleteLen(data)
+	r.pending = append([]byte(nil), data[cut:]...)
+	if cut > 0 {
+		r.writeEvent("o", string(data[:cut]))
+	}
+}
+
+// Resize records a terminal size change.
+func (r *asciicastRecorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.writeEvent("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close flushes any pending bytes and closes the file. Idempotent.
+func (r *asciicastRecorder) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if len(r.pending) > 0 {
+		r.writeEvent("o", string(r.pending))
+		r.pending = nil
+	}
+	r.f.Close()
+}
+
+// utf8CompleteLen returns the length of the longest prefix of p that does not
+// end in the middle of a multibyte UTF-8 sequence.
+func utf8CompleteLen(p []byte) int {
+	// A rune is at most 4 bytes — only the last 3 can be an incomplete start.
+	for i := len(p) - 1; i >= 0 && i >= len(p)-3; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// ── RecordingService: storage, listing and retention ──
+
+// RecordingService owns the on-disk recordings directory:
+// {dir}/{userID}/{instanceID}_{timestamp}.cast
+type RecordingService struct {
+	dir       string
+	retention time.Duration // 0 = keep forever
+	maxBytes  int64         // total size cap across all users, 0 = unlimited
+
+	// RecordByDefault starts a recording for every newly created terminal.
+	RecordByDefault bool
+
+	mu     sync.Mutex
+	active map[string]bool // absolute paths of recordings still being written
+}
+
+// RecordingInfo describes a recording file for listing.
+type RecordingInfo struct {
+	ID         string    `json:"id"`
+	InstanceID string    `json:"instance_id"`
+	StartedAt  time.Time `json:"started_at"`
+	SizeBytes  int64     `json:"size_bytes"`
+	Active     bool      `json:"active"`
+}
+
+func NewRecordingService(dir string, retention time.Duration, maxBytes int64) *RecordingService {
+	os.MkdirAll(dir, 0755)
+	rs := &RecordingService{
+		dir:       dir,
+		retention: retention,
+		maxBytes:  maxBytes,
+		active:    make(map[string]bool),
+	}
+	go rs.retentionLoop()
+	return rs
+}
+
+// Recording IDs end in the start time to the millisecond; parsing with
+// recordingTimeLayout also accepts older IDs with whole seconds.
+const (
+	recordingTimeLayout = "20060102T150405"
+	recordingIDLayout   = recordingTimeLayout + ".000"
+)
+
+// start opens a new recording for a session key "term:{userID}:{instanceId}".
+func (rs *RecordingService) start(sessionKey string, cols, rows int) (*asciicastRecorder, string, error) {
+	uid, iid := parseSessionKey(sessionKey)
+	if uid == "" {
+		return nil, "", fmt.Errorf("invalid session key")
+	}
+	// A recording started in the same millisecond (a quick reattach) takes
+	// the next free one.
+	var id, path string
+	var rec *asciicastRecorder
+	var err error
+	t := time.Now().UTC()
+	for try := 0; try < 100; try++ {
+		id = sanitizeKey(iid) + "_" + t.Format(recordingIDLayout)
+		path = filepath.Join(rs.dir, sanitizeKey(uid), id+recordingExt)
+		if rec, err = newAsciicastRecorder(path, cols, rows, iid); !os.IsExist(err) {
+			break
+		}
+		t = t.Add(time.Millisecond)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	rs.mu.Lock()
+	rs.active[path] = true
+	rs.mu.Unlock()
+	log.Printf("[Recording] started %s", path)
+	return rec, id, nil
+}
+
+// finish marks a recording as complete (eligible for retention).
+func (rs *RecordingService) finish(rec *asciicastRecorder) {
+	rec.Close()
+	rs.mu.Lock()
+	delete(rs.active, rec.path)
+	rs.mu.Unlock()
+	log.Printf("[Recording] finished %s", rec.path)
+}
+
+// validRecordingID rejects anything that could escape the user's directory.
+func validRecordingID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && !strings.Contains(id, "..")
+}
+
+// Path returns the file path of a user's recording, or "" if it doesn't exist.
+func (rs *RecordingService) Path(userID, id string) string {
+	if !validRecordingID(id) {
+		return ""
+	}
+	p := filepath.Join(rs.dir, sanitizeKey(userID), id+recordingExt)
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
+
+// List returns a user's recordings, newest first.
+func (rs *RecordingService) List(userID string) []RecordingInfo {
+	userDir := filepath.Join(rs.dir, sanitizeKey(userID))
+	entries, err := os.ReadDir(userDir)
+	if err != nil {
+		return []RecordingInfo{}
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	result := make([]RecordingInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), recordingExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		id := strings.TrimSuffix(e.Name(), recordingExt)
+		ri := RecordingInfo{
+			ID:        id,
+			SizeBytes: info.Size(),
+			StartedAt: info.ModTime(),
+			Active:    rs.active[filepath.Join(userDir, e.Name())],
+		}
+		if i := strings.LastIndexByte(id, '_'); i > 0 {
+			ri.InstanceID = id[:i]
+			if t, err := time.Parse(recordingTimeLayout, id[i+1:]); err == nil {
+				ri.StartedAt = t
+			}
+		}
+		result = append(result, ri)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].StartedAt.After(result[j].StartedAt) })
+	return result
+}
+
+// Delete removes a finished recording. Active recordings can't be deleted.
+func (rs *RecordingService) Delete(userID, id string) error {
+	p := rs.Path(userID, id)
+	if p == "" {
+		return os.ErrNotExist
+	}
+	rs.mu.Lock()
+	active := rs.active[p]
+	rs.mu.Unlock()
+	if active {
+		return fmt.Errorf("recording is still in progress")
+	}
+	return os.Remove(p)
+}
+
+// Replay streams a recording's events to w with their original timing,
+// scaled by speed and with idle gaps capped at maxIdle. Stops when done is closed.
+func (rs *RecordingService) Replay(path string, w io.Writer, flush func(), speed float64, maxIdle time.Duration, done <-chan struct{}) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if speed <= 0 {
+		speed = 1
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	first := true
+	var prev float64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if first {
+			// Header goes out immediately
+			first = false
+			w.Write(append(line, '\n'))
+			flush()
+			continue
+		}
+		var ev []json.RawMessage
+		if err := json.Unmarshal(line, &ev); err != nil || len(ev) < 3 {
+			continue
+		}
+		var ts float64
+		json.Unmarshal(ev[0], &ts)
+		delay := time.Duration((ts - prev) / speed * float64(time.Second))
+		prev = ts
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-done:
+				return nil
+			}
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		flush()
+	}
+	return scanner.Err()
+}
+
+// retentionLoop prunes old recordings hourly.
+func (rs *RecordingService) retentionLoop() {
+	rs.prune()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for range ticker.C {
+		rs.prune()
+	}
+}
+
+// prune deletes finished recordings older than retention, then the oldest
+// finished recordings until the total size fits into maxBytes.
+func (rs *RecordingService) prune() {
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	filepath.Walk(rs.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(p, recordingExt) {
+			return nil
+		}
+		files = append(files, file{path: p, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	removed := 0
+	for _, f := range files {
+		if rs.active[f.path] {
+			continue
+		}
+		expired := rs.retention > 0 && time.Since(f.modTime) > rs.retention
+		overCap := rs.maxBytes > 0 && total > rs.maxBytes
+		if !expired && !overCap {
+			continue
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("[Recording] retention removed %d recordings (total now %d bytes)", removed, total)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readCastLines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
+
+func TestAsciicastRecorder_HeaderOutputAndResize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.cast")
+	rec, err := newAsciicastRecorder(path, 120, 40, "main")
+	require.NoError(t, err)
+
+	rec.Output([]byte("hello\r\n"))
+	rec.Resize(100, 30)
+	rec.Close()
+
+	lines := readCastLines(t, path)
+	require.Len(t, lines, 3)
+
+	var hdr asciicastHeader
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &hdr))
+	assert.Equal(t, 2, hdr.Version)
+	assert.Equal(t, 120, hdr.Width)
+	assert.Equal(t, 40, hdr.Height)
+	assert.Equal(t, "main", hdr.Title)
+
+	var ev []interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &ev))
+	assert.Equal(t, "o", ev[1])
+	assert.Equal(t, "hello\r\n", ev[2])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &ev))
+	assert.Equal(t, "r", ev[1])
+	assert.Equal(t, "100x30", ev[2])
+}
+
+func TestAsciicastRecorder_SplitMultibyteRune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rec.cast")
+	rec, err := newAsciicastRecorder(path, 80, 24, "")
+	require.NoError(t, err)
+
+	word := []byte("привет")
+	rec.Output(word[:3]) // ends in the middle of "р"
+	rec.Output(word[3:])
+	rec.Close()
+
+	var sb strings.Builder
+	for _, line := range readCastLines(t, path)[1:] {
+		var ev []interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &ev))
+		sb.WriteString(ev[2].(string))
+	}
+	assert.Equal(t, "привет", sb.String(), "split rune must be carried to the next event, not replaced")
+}
+
+func TestRecordingService_ListAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	rs := &RecordingService{dir: dir, retention: time.Hour, active: map[string]bool{}}
+
+	rec, id, err := rs.start("term:user-1:main", 80, 24)
+	require.NoError(t, err)
+	rec.Output([]byte("ls\r\n"))
+
+	list := rs.List("user-1")
+	require.Len(t, list, 1)
+	assert.Equal(t, id, list[0].ID)
+	assert.Equal(t, "main", list[0].InstanceID)
+	assert.True(t, list[0].Active)
+	assert.Empty(t, rs.List("user-2"), "recordings are scoped per user")
+
+	// Active recordings survive retention even when old
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(rec.path, old, old))
+	rs.prune()
+	assert.NotEmpty(t, rs.Path("user-1", id))
+
+	rs.finish(rec)
+	require.NoError(t, os.Chtimes(rec.path, old, old))
+	rs.prune()
+	assert.Empty(t, rs.Path("user-1", id), "finished recording past retention is removed")
+}
+
+func TestRecordingService_StartSameMoment(t *testing.T) {
+	rs := &RecordingService{dir: t.TempDir(), active: map[string]bool{}}
+	var ids []string
+	for i := 0; i < 3; i++ {
+		rec, id, err := rs.start("term:user-1:main", 80, 24)
+		require.NoError(t, err, "restart %d", i)
+		defer rs.finish(rec)
+		ids = append(ids, id)
+	}
+	assert.Len(t, rs.List("user-1"), 3)
+	assert.NotEqual(t, ids[0], ids[1])
+
+	// IDs from before millisecond resolution still list with their start time.
+	require.NoError(t, os.WriteFile(filepath.Join(rs.dir, "user-1", "old_20240102T030405.cast"), nil, 0o644))
+	list := rs.List("user-1")
+	require.Len(t, list, 4)
+	assert.Equal(t, "old", list[3].InstanceID)
+	assert.Equal(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), list[3].StartedAt)
+}
+
+func TestRecordingService_PathRejectsTraversal(t *testing.T) {
+	rs := &RecordingService{dir: t.TempDir(), active: map[string]bool{}}
+	assert.Empty(t, rs.Path("user-1", "../user-2/x"))
+	assert.Empty(t, rs.Path("user-1", ".."))
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+// ── Terminal sandbox ──
+//
+// Non-admin shells run under `nebulide sandbox-init`, the backend binary
+// re-executed in fresh mount and PID namespaces (Linux only). As PID 1 of the
+// sandbox it:
+//   - makes all mounts private and lays an empty tmpfs over every Hide path
+//     (other users' workspaces, the admin workspace, /root), binding the
+//     user's own workspace back in;
+//   - mounts a private /tmp and a /proc that only shows the sandbox;
+//   - sets no_new_privs (sudo and setuid binaries stop working) and,
+//     optionally, a seccomp filter against kernel-facing syscalls, mounts
+//     and new namespaces (installed just before the shell is exec'd);
+//   - starts the shell in a new user namespace as the unprivileged sandbox
+//     user, with no capabilities and no supplementary groups, then reaps
+//     orphans until the shell exits.
+//
+// The workspace's .ssh directory is bound over the sandbox user's ~/.ssh, so
+// keys and known_hosts stay per user rather than shared by every sandboxed
+// shell.
+//
+// There is no fallback: if the sandbox can't be set up, the terminal fails.
+
+// sandboxSecretEnv are backend settings that must not leak into user shells.
+var sandboxSecretEnv = map[string]bool{
+	"JWT_SECRET":         true,
+	"DB_PASSWORD":        true,
+	"ADMIN_PASSWORD":     true,
+	"TELEGRAM_BOT_TOKEN": true,
+	"TELEGRAM_API_HASH":  true,
+	"NVIDIA_API_KEY":     true,
+	"ZAI_API_KEY":        true,
+}
+
+// sandboxSpec is the argument of `nebulide sandbox-init`.
+type sandboxSpec struct {
+	WorkDir string   `json:"work_dir"`
+	Hide    []string `json:"hide"`
+	TmpSize string   `json:"tmp_size"`
+	UID     int      `json:"uid"`
+	GID     int      `json:"gid"`
+	Home    string   `json:"home"`
+	Seccomp bool     `json:"seccomp"`
+	Path    string   `json:"path"`
+	Args    []string `json:"args"`
+}
+
+type Sandbox struct {
+	// User is the account sandboxed shells run as.
+	User string
+	// Hide lists directories replaced by an empty tmpfs inside the sandbox.
+	Hide []string
+	// TmpSize caps the private /tmp (tmpfs size option, e.g. "1g").
+	TmpSize string
+	// Seccomp enables the syscall filter.
+	Seccomp bool
+	// Home is the sandbox user's home directory (from passwd, set by Init),
+	// where ssh looks for ~/.ssh whatever HOME says.
+	Home string
+
+	uid, gid int
+
+	mu      sync.Mutex
+	initErr error
+}
+
+func NewSandbox(username string, hide []string) *Sandbox {
+	return &Sandbox{User: username, Hide: hide, TmpSize: "1g", Seccomp: true}
+}
+
+// Init resolves the sandbox user and runs a trial sandbox, so a broken setup
+// shows up at startup. Until Init succeeds, Wrap fails.
+func (sb *Sandbox) Init() error {
+	err := sb.init()
+	sb.mu.Lock()
+	sb.initErr = err
+	sb.mu.Unlock()
+	return err
+}
+
+func (sb *Sandbox) init() error {
+	u, err := user.Lookup(sb.User)
+	if err != nil {
+		return fmt.Errorf("sandbox user: %w", err)
+	}
+	sb.uid, _ = strconv.Atoi(u.Uid)
+	sb.gid, _ = strconv.Atoi(u.Gid)
+	sb.Home = u.HomeDir
+	if sb.uid == 0 {
+		return errors.New("sandbox user must not be root")
+	}
+	return sb.check()
+}
+
+// Wrap rewrites a shell spec so it runs inside the sandbox. The workspace
+// spec.Dir belongs to (its top directory under a Hide path) is the only one
+// left visible.
+func (sb *Sandbox) Wrap(spec holderSpec) (holderSpec, error) {
+	sb.mu.Lock()
+	err := sb.initErr
+	sb.mu.Unlock()
+	if err != nil {
+		return spec, err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return spec, err
+	}
+	arg, _ := json.Marshal(sb.spec(spec.Dir, spec.Path, spec.Args))
+	spec.Path = exe
+	spec.Args = []string{"sandbox-init", string(arg)}
+	spec.Cloneflags = sandboxCloneflags
+	return spec, nil
+}
+
+func (sb *Sandbox) spec(workDir, path string, args []string) sandboxSpec {
+	return sandboxSpec{
+		WorkDir: workDir,
+		Hide:    sb.Hide,
+		TmpSize: sb.TmpSize,
+		UID:     sb.uid,
+		GID:     sb.gid,
+		Home:    sb.Home,
+		Seccomp: sb.Seccomp,
+		Path:    path,
+		Args:    args,
+	}
+}
+
+// Own hands directories the backend created for a sandboxed shell (workspace,
+// .claude/skills, ...) to the sandbox user. Best-effort.
+func (sb *Sandbox) Own(paths ...string) {
+	if sb.uid == 0 {
+		return
+	}
+	for _, p := range paths {
+		os.Lchown(p, sb.uid, sb.gid)
+	}
+}
@@ -0,0 +1,272 @@
+//go:build linux
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	gopty "github.com/aymanbagabas/go-pty"
+	"golang.org/x/sys/unix"
+)
+
+// sandboxCloneflags are the namespaces sandbox-init is started in. The user
+// namespace is created one step later, for the shell only: procfs can't be
+// mounted from inside a user namespace while the container masks /proc paths.
+const sandboxCloneflags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+
+// setCloneflags starts cmd in new namespaces (no-op for 0).
+func setCloneflags(cmd *gopty.Cmd, flags uintptr) {
+	if flags != 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: flags}
+	}
+}
+
+// check runs `sh -c 'exit 0'` in a throwaway sandbox.
+func (sb *Sandbox) check() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "sandbox-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, 0o755)
+
+	arg, _ := json.Marshal(sb.spec(dir, "/bin/sh", []string{"-c", "exit 0"}))
+	cmd := exec.Command(exe, "sandbox-init", string(arg))
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: sandboxCloneflags}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sandbox self-test failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// sandboxExecArg marks the second stage of sandbox-init: the backend binary
+// again, already in the user namespace, which installs the seccomp filter
+// and execs the shell in its place. The filter refuses new namespaces, so it
+// can only go on after the clone that created the user one. The binary is
+// passed as fd 3: the private /tmp or a Hide path may cover it by then.
+const sandboxExecArg = "exec"
+
+// RunSandboxInit is the entry point of `nebulide sandbox-init <spec>`: it
+// sets up the sandbox, runs the shell and returns the shell's exit status.
+func RunSandboxInit() int {
+	// prctl and seccomp settings are per thread; the shell is forked from this one.
+	runtime.LockOSThread()
+
+	args := os.Args[2:]
+	stage2 := len(args) == 2 && args[0] == sandboxExecArg
+	if stage2 {
+		args = args[1:]
+	}
+	var spec sandboxSpec
+	if len(args) != 1 || json.Unmarshal([]byte(args[0]), &spec) != nil {
+		fmt.Fprintln(os.Stderr, "sandbox: bad spec")
+		return 2
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "\r\nsandbox: %v\r\n", err)
+		return 1
+	}
+	if stage2 {
+		return fail(execSandboxed(spec))
+	}
+	if os.Getpid() != 1 {
+		return fail(fmt.Errorf("must be started in a new PID namespace"))
+	}
+	self, err := os.Open("/proc/self/exe")
+	if err != nil {
+		return fail(err)
+	}
+	if err := setupSandboxMounts(spec); err != nil {
+		return fail(err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fail(fmt.Errorf("no_new_privs: %w", err))
+	}
+
+	cmd := exec.Command(spec.Path, spec.Args...)
+	if spec.Seccomp {
+		cmd = exec.Command("/proc/self/fd/3", "sandbox-init", sandboxExecArg, os.Args[2])
+		cmd.ExtraFiles = []*os.File{self}
+	}
+	cmd.Dir = spec.WorkDir
+	cmd.Env = os.Environ()
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		// Inside the user namespace only the sandbox user exists; root and
+		// every capability are gone for good once the shell is exec'd.
+		Cloneflags:                 syscall.CLONE_NEWUSER,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: spec.UID, HostID: spec.UID, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: spec.GID, HostID: spec.GID, Size: 1}},
+		GidMappingsEnableSetgroups: true,
+		Credential:                 &syscall.Credential{Uid: uint32(spec.UID), Gid: uint32(spec.GID), Groups: []uint32{}},
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	err = cmd.Start()
+	self.Close()
+	if err != nil {
+		return fail(err)
+	}
+
+	// The PTY hangup and the backend's TERM reach us as session leader.
+	sigs := make(chan os.Signal, 4)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for s := range sigs {
+			cmd.Process.Signal(s)
+		}
+	}()
+
+	// As PID 1 we inherit every orphan; reap them until the shell exits.
+	for {
+		var ws syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return 1
+		}
+		if pid == cmd.Process.Pid {
+			if ws.Signaled() {
+				return 128 + int(ws.Signal())
+			}
+			return ws.ExitStatus()
+		}
+	}
+}
+
+// execSandboxed is the second stage (see sandboxExecArg). It only returns
+// on failure.
+func execSandboxed(spec sandboxSpec) error {
+	unix.CloseOnExec(3)
+	if err := installSeccomp(); err != nil {
+		return fmt.Errorf("seccomp: %w", err)
+	}
+	path, err := exec.LookPath(spec.Path)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{spec.Path}, spec.Args...), os.Environ())
+}
+
+func setupSandboxMounts(spec sandboxSpec) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("private mounts: %w", err)
+	}
+	// The workspace stays visible: the top directory of WorkDir under the
+	// hidden path it lives in (workspaces/bob for workspaces/bob/src).
+	visible := ""
+	for _, dir := range append(spec.Hide, "/tmp") {
+		if isUnderDir(spec.WorkDir, dir) {
+			visible = topDirUnder(spec.WorkDir, dir)
+			break
+		}
+	}
+	// Keep a handle on it: it is about to disappear under a tmpfs.
+	wd := -1
+	if visible != "" {
+		fd, err := unix.Open(visible, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("workspace: %w", err)
+		}
+		defer unix.Close(fd)
+		wd = fd
+	}
+
+	for _, dir := range spec.Hide {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=1m,mode=755"); err != nil {
+			return fmt.Errorf("hide %s: %w", dir, err)
+		}
+	}
+
+	tmpOpts := "mode=1777"
+	if spec.TmpSize != "" {
+		tmpOpts += ",size=" + spec.TmpSize
+	}
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, tmpOpts); err != nil {
+		return fmt.Errorf("private /tmp: %w", err)
+	}
+
+	if wd >= 0 {
+		if err := os.MkdirAll(visible, 0o755); err != nil {
+			return fmt.Errorf("workspace mount point: %w", err)
+		}
+		src := fmt.Sprintf("/proc/self/fd/%d", wd)
+		if err := unix.Mount(src, visible, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("workspace bind: %w", err)
+		}
+		if err := bindSandboxSSH(visible, spec); err != nil {
+			return fmt.Errorf("~/.ssh: %w", err)
+		}
+	}
+
+	// A /proc of our own PID namespace: other users' processes (and their
+	// /proc/<pid>/root) are simply not there.
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+	return nil
+}
+
+// bindSandboxSSH creates the workspace's .ssh (0700, owned by the sandbox
+// user) and binds it over <home>/.ssh. No-op when the user has no home.
+func bindSandboxSSH(workspace string, spec sandboxSpec) error {
+	if spec.Home == "" || spec.Home == "/" {
+		return nil
+	}
+	if _, err := os.Stat(spec.Home); err != nil {
+		return nil
+	}
+	src := filepath.Join(workspace, ".ssh")
+	if err := os.Mkdir(src, 0o700); err == nil {
+		os.Chown(src, spec.UID, spec.GID)
+	} else if !os.IsExist(err) {
+		return err
+	}
+	// The user controls the workspace: never follow a symlinked .ssh.
+	fd, err := unix.Open(src, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	// Every sandboxed user may write the home: refuse a planted symlink
+	// rather than mount over wherever it points.
+	dst := filepath.Join(spec.Home, ".ssh")
+	if err := os.Mkdir(dst, 0o700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	dfd, err := unix.Open(dst, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dfd)
+	return unix.Mount(fmt.Sprintf("/proc/self/fd/%d", fd), fmt.Sprintf("/proc/self/fd/%d", dfd), "", unix.MS_BIND, "")
+}
+
+// topDirUnder returns dir joined with the first element of path below it
+// (dir itself if path == dir).
+func topDirUnder(path, dir string) string {
+	rel, _ := filepath.Rel(dir, path)
+	return filepath.Join(dir, strings.SplitN(rel, "/", 2)[0])
+}
+
+// isUnderDir reports whether path is dir or inside it.
+func isUnderDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,179 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The sandbox and pty-holders re-execute os.Executable(), which under
+// `go test` is the test binary; dispatch the subcommands the same way main does.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == "sandbox-init" {
+		os.Exit(RunSandboxInit())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "pty-holder" {
+		os.Exit(RunPTYHolder())
+	}
+	os.Exit(m.Run())
+}
+
+func newTestSandbox(t *testing.T, hide []string) *Sandbox {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("sandbox needs root")
+	}
+	probe := exec.Command("/bin/true")
+	probe.SysProcAttr = &syscall.SysProcAttr{Cloneflags: sandboxCloneflags | syscall.CLONE_NEWUSER}
+	if err := probe.Run(); err != nil {
+		t.Skipf("namespaces unavailable: %v", err)
+	}
+	sb := NewSandbox("nobody", hide)
+	sb.TmpSize = "16m"
+	require.NoError(t, sb.Init())
+	return sb
+}
+
+// mkTree creates dirs and files readable by everyone, so only the sandbox
+// (not permissions) can keep them from the shell.
+func mkTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			os.Chmod(p, 0o755)
+		}
+		return nil
+	})
+}
+
+func runSandboxed(t *testing.T, sb *Sandbox, workDir, script string) string {
+	t.Helper()
+	spec, err := sb.Wrap(holderSpec{Path: "/bin/sh", Args: []string{"-c", script}, Dir: workDir})
+	require.NoError(t, err)
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: spec.Cloneflags}
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return string(out)
+}
+
+func TestSandbox_OtherWorkspacesUnreachable(t *testing.T) {
+	// Outside /tmp: the sandbox's private /tmp would hide the tree regardless.
+	base, err := os.MkdirTemp("/var/tmp", "sandbox-test-")
+	if err != nil {
+		t.Skipf("no /var/tmp: %v", err)
+	}
+	defer os.RemoveAll(base)
+	workspaces := filepath.Join(base, "workspaces")
+	admin := filepath.Join(base, "workspace")
+	mkTree(t, base, map[string]string{
+		"workspaces/alice/secret.txt": "alice-secret",
+		"workspaces/bob/notes.txt":    "bob-notes",
+		"workspace/admin.txt":         "admin-only",
+	})
+
+	hostTmp := t.TempDir()
+	os.Chmod(hostTmp, 0o755)
+	marker := filepath.Join(hostTmp, "marker")
+	require.NoError(t, os.WriteFile(marker, []byte("host"), 0o644))
+
+	sb := newTestSandbox(t, []string{workspaces, admin})
+	bob := filepath.Join(workspaces, "bob")
+	out := runSandboxed(t, sb, bob, strings.Join([]string{
+		"cat notes.txt; echo",
+		"pwd",
+		"id -u",
+		"cat " + filepath.Join(workspaces, "alice", "secret.txt") + " 2>/dev/null || echo alice-hidden",
+		"ls " + filepath.Join(workspaces) + " | tr '\\n' ' '; echo",
+		"cat " + filepath.Join(admin, "admin.txt") + " 2>/dev/null || echo admin-hidden",
+		"cat " + marker + " 2>/dev/null || echo tmp-private",
+		"grep CapEff /proc/self/status",
+		"sudo -n true 2>/dev/null && echo sudo-works || echo no-sudo",
+	}, "\n"))
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 9, out)
+	assert.Equal(t, "bob-notes", lines[0])
+	assert.Equal(t, bob, lines[1])
+	assert.Equal(t, "65534", lines[2])
+	assert.Equal(t, "alice-hidden", lines[3])
+	assert.Equal(t, "bob", strings.TrimSpace(lines[4]))
+	assert.Equal(t, "admin-hidden", lines[5])
+	assert.Equal(t, "tmp-private", lines[6])
+	assert.Regexp(t, `CapEff:\s+0+$`, lines[7])
+	assert.Equal(t, "no-sudo", lines[8])
+
+	// Starting in a subdirectory keeps the whole workspace, and only it, visible.
+	require.NoError(t, os.Mkdir(filepath.Join(bob, "src"), 0o755))
+	out = runSandboxed(t, sb, filepath.Join(bob, "src"), "pwd; cat ../notes.txt; echo; ls "+workspaces)
+	assert.Equal(t, filepath.Join(bob, "src")+"\nbob-notes\nbob\n", out)
+}
+
+func TestSandbox_SeccompDeniesNamespaces(t *testing.T) {
+	if _, err := exec.LookPath("unshare"); err != nil {
+		t.Skip("no unshare")
+	}
+	sb := newTestSandbox(t, nil)
+	dir := t.TempDir()
+	os.Chmod(filepath.Dir(dir), 0o755)
+	os.Chmod(dir, 0o755)
+	// A nested user namespace would hand the shell the capabilities to mount.
+	script := "unshare -Ur true 2>/dev/null && echo userns || echo no-userns"
+	assert.Equal(t, "no-userns\n", runSandboxed(t, sb, dir, script))
+
+	sb.Seccomp = false
+	assert.Equal(t, "userns\n", runSandboxed(t, sb, dir, script))
+}
+
+func TestSandbox_PerUserSSH(t *testing.T) {
+	base, err := os.MkdirTemp("/var/tmp", "sandbox-test-")
+	if err != nil {
+		t.Skipf("no /var/tmp: %v", err)
+	}
+	defer os.RemoveAll(base)
+	workspaces := filepath.Join(base, "workspaces")
+	home := filepath.Join(base, "home")
+	mkTree(t, base, map[string]string{"workspaces/bob/notes.txt": "", "home/.profile": ""})
+
+	sb := newTestSandbox(t, []string{workspaces})
+	sb.Home = home
+	bob := filepath.Join(workspaces, "bob")
+	out := runSandboxed(t, sb, bob, "stat -c '%u %a' "+home+"/.ssh; echo bob-host > "+home+"/.ssh/known_hosts")
+	assert.Equal(t, "65534 700\n", out)
+
+	// The keys live in the workspace; the shared home keeps none.
+	data, err := os.ReadFile(filepath.Join(bob, ".ssh", "known_hosts"))
+	require.NoError(t, err)
+	assert.Equal(t, "bob-host\n", string(data))
+	entries, _ := os.ReadDir(filepath.Join(home, ".ssh"))
+	assert.Empty(t, entries)
+
+	// A symlink planted in the home is not mounted over.
+	require.NoError(t, os.Remove(filepath.Join(home, ".ssh")))
+	require.NoError(t, os.Symlink(base, filepath.Join(home, ".ssh")))
+	spec, err := sb.Wrap(holderSpec{Path: "/bin/sh", Args: []string{"-c", "true"}, Dir: bob})
+	require.NoError(t, err)
+	cmd := exec.Command(spec.Path, spec.Args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: spec.Cloneflags}
+	assert.Error(t, cmd.Run())
+}
+
+func TestSandbox_WrapFailsWithoutInit(t *testing.T) {
+	sb := NewSandbox("no-such-user-nebulide", nil)
+	assert.Error(t, sb.Init())
+	_, err := sb.Wrap(holderSpec{Path: "/bin/sh", Dir: "/"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	gopty "github.com/aymanbagabas/go-pty"
+)
+
+// The terminal sandbox needs Linux namespaces; elsewhere (dev machines)
+// sandboxed terminals are not started.
+
+const sandboxCloneflags = 0
+
+var errSandboxUnsupported = errors.New("terminal sandbox requires linux")
+
+func setCloneflags(_ *gopty.Cmd, _ uintptr) {}
+
+func (sb *Sandbox) check() error { return errSandboxUnsupported }
+
+// RunSandboxInit is the entry point of `nebulide sandbox-init`.
+func RunSandboxInit() int {
+	fmt.Println(errSandboxUnsupported)
+	return 1
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package services
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccompNamespaceFlags are the clone flags that create namespaces: with
+// unshare and setns denied, clone must not create them either.
+const seccompNamespaceFlags = unix.CLONE_NEWNS | unix.CLONE_NEWUSER | unix.CLONE_NEWPID |
+	unix.CLONE_NEWNET | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC | unix.CLONE_NEWCGROUP | unix.CLONE_NEWTIME
+
+// installSeccomp makes the syscalls in seccompDenied fail with EPERM for this
+// thread and everything it forks, as well as clone with namespace flags.
+// clone3 passes its flags in memory the filter can't read, so it fails with
+// ENOSYS and libc falls back to clone. Syscalls of a foreign ABI (32-bit,
+// x32) are refused wholesale so the list can't be bypassed.
+func installSeccomp() error {
+	if seccompArch == 0 {
+		return errors.New("no syscall table for this architecture")
+	}
+	prog := seccompProgram(seccompArch, seccompDenied)
+	fprog := unix.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&fprog)), 0, 0)
+}
+
+func seccompProgram(arch uint32, denied []uint32) []unix.SockFilter {
+	const (
+		offNr   = 0 // struct seccomp_data: int nr; u32 arch; u64 ip; u64 args[6]
+		offArch = 4
+		offArg0 = 16 // low word of args[0] (little-endian)
+		x32Bit  = 0x40000000
+	)
+	stmt := func(code uint16, k uint32) unix.SockFilter { return unix.SockFilter{Code: code, K: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k, Jt: jt, Jf: jf}
+	}
+	deny := unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+
+	prog := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, deny),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offNr),
+	}
+	// The checks below jump forward to one of the tail instructions: allow,
+	// deny, ENOSYS, then the clone flag test.
+	checks := 3 + len(denied)
+	allowAt := len(prog) + checks
+	denyAt, enosysAt, cloneAt := allowAt+1, allowAt+2, allowAt+3
+	to := func(target int) uint8 { return uint8(target - len(prog) - 1) }
+	prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32Bit, to(denyAt), 0))
+	prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SYS_CLONE3, to(enosysAt), 0))
+	prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, unix.SYS_CLONE, to(cloneAt), 0))
+	for _, nr := range denied {
+		prog = append(prog, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, nr, to(denyAt), 0))
+	}
+	return append(prog,
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		stmt(unix.BPF_RET|unix.BPF_K, deny),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offArg0),
+		jump(unix.BPF_JMP|unix.BPF_JSET|unix.BPF_K, seccompNamespaceFlags, 0, 1),
+		stmt(unix.BPF_RET|unix.BPF_K, deny),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+	)
+}
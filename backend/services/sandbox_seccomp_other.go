@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package services
+
+// No syscall table for this architecture: enabling seccomp fails the sandbox.
+const seccompArch = 0
+
+var seccompDenied []uint32
@@ -0,0 +1,456 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── scrollbackLog: append-only, segmented, compressed terminal output ──
+//
+// Layout: {scrollbackDir}/{sanitizedKey}/{startOffset:016d}.gz
+// Every byte of PTY output gets a global offset (counted from the first byte
+// ever logged for the session key). A segment holds up to
+// scrollbackSegmentBytes of raw output as a series of gzip members — each
+// flush appends one complete member, so a crash loses at most the last
+// unflushed chunk. Oldest segments are dropped when the session exceeds its size cap.
+
+const (
+	scrollbackSegmentBytes  = 1 << 20  // raw bytes per segment before rotation
+	scrollbackFlushBytes    = 64 << 10 // flush pending output once it reaches this size
+	scrollbackFlushInterval = 2 * time.Second
+	scrollbackRestoreBytes  = 512 << 10 // tail fed into the screen model on restore
+	scrollbackMaxLineBytes  = 64 << 10  // longer "lines" (no newline) are split for search
+	scrollbackSegmentExt    = ".gz"
+
+	// DefaultScrollbackMaxBytes caps compressed scrollback per session.
+	DefaultScrollbackMaxBytes int64 = 64 << 20
+)
+
+type scrollbackSegment struct {
+	start int64 // global offset of the segment's first byte
+	raw   int64 // uncompressed length
+	size  int64 // compressed length on disk
+	path  string
+}
+
+type scrollbackLog struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+
+	segments []*scrollbackSegment // oldest first; last one may be active
+	active   *os.File             // open handle of the last segment, nil between rotations
+	pending  []byte               // output not yet written to disk
+	end      int64                // global offset of the next byte
+
+	closed bool
+	stopCh chan struct{}
+}
+
+// openScrollbackLog opens (or creates) the log in dir for appending. Existing
+// segments are kept; new output always goes into a fresh segment so a torn
+// tail from a crash is never appended to.
+func openScrollbackLog(dir string, maxBytes int64) *scrollbackLog {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[Scrollback] mkdir %s: %v", dir, err)
+	}
+	l := loadScrollbackLog(dir, maxBytes)
+	go l.flushLoop()
+	return l
+}
+
+// loadScrollbackLog indexes the segments in dir without starting the flush
+// loop — enough for reading the log of a session that isn't running.
+func loadScrollbackLog(dir string, maxBytes int64) *scrollbackLog {
+	l := &scrollbackLog{dir: dir, maxBytes: maxBytes, stopCh: make(chan struct{})}
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, scrollbackSegmentExt) {
+			continue
+		}
+		start, err := strconv.ParseInt(strings.TrimSuffix(name, scrollbackSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seg := &scrollbackSegment{start: start, path: filepath.Join(dir, name)}
+		if info, err := e.Info(); err == nil {
+			seg.size = info.Size()
+		}
+		l.segments = append(l.segments, seg)
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i].start < l.segments[j].start })
+
+	// Only the raw length of the newest segment matters for the next offset;
+	// older ones are measured lazily when read.
+	if n := len(l.segments); n > 0 {
+		last := l.segments[n-1]
+		last.raw = int64(len(readSegment(last.path)))
+		l.end = last.start + last.raw
+		for i := 0; i < n-1; i++ {
+			l.segments[i].raw = -1
+		}
+	}
+	return l
+}
+
+// Append buffers output; it reaches disk on the next flush.
+func (l *scrollbackLog) Append(p []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.pending = append(l.pending, p...)
+	l.end += int64(len(p))
+	if len(l.pending) >= scrollbackFlushBytes {
+		l.flushLocked()
+	}
+}
+
+func (l *scrollbackLog) flushLoop() {
+	ticker := time.NewTicker(scrollbackFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			l.flushLocked()
+			l.mu.Unlock()
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// flushLocked writes pending output as one gzip member, rotating segments
+// and enforcing the size cap as needed.
+func (l *scrollbackLog) flushLocked() {
+	if len(l.pending) == 0 {
+		return
+	}
+	if l.active == nil {
+		start := l.end - int64(len(l.pending))
+		path := filepath.Join(l.dir, fmt.Sprintf("%016d%s", start, scrollbackSegmentExt))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Printf("[Scrollback] open segment %s: %v", path, err)
+			return
+		}
+		l.active = f
+		l.segments = append(l.segments, &scrollbackSegment{start: start, path: path})
+	}
+	seg := l.segments[len(l.segments)-1]
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(l.pending)
+	gz.Close()
+	if _, err := l.active.Write(buf.Bytes()); err != nil {
+		log.Printf("[Scrollback] write %s: %v", seg.path, err)
+	}
+	seg.raw += int64(len(l.pending))
+	seg.size += int64(buf.Len())
+	l.pending = l.pending[:0]
+
+	if seg.raw >= scrollbackSegmentBytes {
+		l.active.Close()
+		l.active = nil
+	}
+	l.enforceCapLocked()
+}
+
+// enforceCapLocked drops the oldest segments while the log exceeds maxBytes.
+// The newest segment is always kept.
+func (l *scrollbackLog) enforceCapLocked() {
+	if l.maxBytes <= 0 {
+		return
+	}
+	var total int64
+	for _, s := range l.segments {
+		total += s.size
+	}
+	for total > l.maxBytes && len(l.segments) > 1 {
+		oldest := l.segments[0]
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Scrollback] remove %s: %v", oldest.path, err)
+			return
+		}
+		total -= oldest.size
+		l.segments = l.segments[1:]
+	}
+}
+
+// Close flushes pending output and stops the flush loop. Idempotent.
+func (l *scrollbackLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.flushLocked()
+	l.closed = true
+	close(l.stopCh)
+	if l.active != nil {
+		l.active.Close()
+		l.active = nil
+	}
+}
+
+// Delete closes the log and removes it from disk.
+func (l *scrollbackLog) Delete() {
+	l.Close()
+	os.RemoveAll(l.dir)
+}
+
+// readSegment decompresses a segment. A torn trailing member (crash mid-write)
+// is tolerated: everything decoded before it is returned.
+func readSegment(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil
+	}
+	data, _ := io.ReadAll(gz)
+	return data
+}
+
+// scrollbackChunk is a contiguous run of output: a segment on disk or the
+// in-memory pending tail.
+type scrollbackChunk struct {
+	start int64
+	raw   int64 // -1 = unknown, read the whole segment
+	path  string
+	data  []byte
+}
+
+func (c scrollbackChunk) load() []byte {
+	if c.path == "" {
+		return c.data
+	}
+	data := readSegment(c.path)
+	if c.raw >= 0 && int64(len(data)) > c.raw {
+		// Concurrent flush appended past the point we snapshotted
+		data = data[:c.raw]
+	}
+	return data
+}
+
+// chunks snapshots the log contents, oldest first.
+func (l *scrollbackLog) chunks() (chunks []scrollbackChunk, end int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, s := range l.segments {
+		chunks = append(chunks, scrollbackChunk{start: s.start, raw: s.raw, path: s.path})
+	}
+	if len(l.pending) > 0 {
+		chunks = append(chunks, scrollbackChunk{
+			start: l.end - int64(len(l.pending)),
+			raw:   int64(len(l.pending)),
+			data:  append([]byte(nil), l.pending...),
+		})
+	}
+	return chunks, l.end
+}
+
+// Tail returns up to n of the most recent bytes.
+func (l *scrollbackLog) Tail(n int) []byte {
+	chunks, _ := l.chunks()
+	var parts [][]byte
+	total := 0
+	for i := len(chunks) - 1; i >= 0 && total < n; i-- {
+		data := chunks[i].load()
+		parts = append(parts, data)
+		total += len(data)
+	}
+	var out []byte
+	for i := len(parts) - 1; i >= 0; i-- {
+		out = append(out, parts[i]...)
+	}
+	if len(out) > n {
+		out = out[len(out)-n:]
+	}
+	return out
+}
+
+// ReadRange returns the output in [start, end) that is still retained, and
+// the offset it actually starts at (later than start if the beginning has been
+// rotated out).
+func (l *scrollbackLog) ReadRange(start, end int64) ([]byte, int64) {
+	chunks, logEnd := l.chunks()
+	end = min(end, logEnd)
+	var out []byte
+	from := int64(-1)
+	for i, c := range chunks {
+		cEnd := logEnd
+		if i+1 < len(chunks) {
+			cEnd = chunks[i+1].start
+		}
+		if cEnd <= start || c.start >= end {
+			continue
+		}
+		data := c.load()
+		lo, hi := max(start-c.start, 0), min(end-c.start, int64(len(data)))
+		if lo >= hi {
+			continue
+		}
+		if from < 0 {
+			from = c.start + lo
+		}
+		out = append(out, data[lo:hi]...)
+	}
+	if from < 0 {
+		from = max(start, 0)
+	}
+	return out, from
+}
+
+// ScrollbackLine is one line of terminal output with escape sequences removed.
+type ScrollbackLine struct {
+	Offset int64  `json:"offset"` // global byte offset of the line start
+	Text   string `json:"text"`
+}
+
+// ScrollbackPage is a window of lines, oldest first. Pass NextBefore as
+// ?before= to fetch the preceding page.
+type ScrollbackPage struct {
+	Lines      []ScrollbackLine `json:"lines"`
+	Start      int64            `json:"start"` // oldest offset still retained
+	End        int64            `json:"end"`   // offset of the next byte to be written
+	NextBefore int64            `json:"next_before"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// Search walks the log backwards from before (exclusive; <=0 = end) and
+// returns up to limit lines, optionally only those containing q
+// (case-insensitive, matched against the text without escape sequences).
+func (l *scrollbackLog) Search(q string, before int64, limit int) ScrollbackPage {
+	chunks, end := l.chunks()
+	page := ScrollbackPage{Lines: []ScrollbackLine{}, End: end}
+	if len(chunks) > 0 {
+		page.Start = chunks[0].start
+	}
+	if before <= 0 || before > end {
+		before = end
+	}
+	q = strings.ToLower(q)
+
+	var found []ScrollbackLine
+	// carry is the start of a newer chunk up to its first newline: the end of
+	// a line that began in an older chunk.
+	var carry []byte
+	for i := len(chunks) - 1; i >= 0 && len(found) < limit; i-- {
+		c := chunks[i]
+		if c.start >= before {
+			// before is always a line start, so nothing here belongs to the page
+			continue
+		}
+		data := append(c.load(), carry...)
+		carry = nil
+
+		// The first line may continue in the previous chunk unless this is the oldest one
+		stop := 0
+		if i > 0 {
+			nl := bytes.IndexByte(data, '\n')
+			switch {
+			case nl < 0 && len(data) < scrollbackMaxLineBytes:
+				carry = data
+				continue
+			case nl >= 0 && nl < scrollbackMaxLineBytes:
+				carry = append([]byte(nil), data[:nl]...)
+				stop = nl + 1
+			}
+		}
+
+		seg := data[stop:]
+		e := len(seg)
+		if e > 0 && seg[e-1] == '\n' {
+			e--
+		}
+		for e >= 0 && len(found) < limit {
+			st := bytes.LastIndexByte(seg[:e], '\n') + 1
+			line := seg[st:e]
+			if len(line) > scrollbackMaxLineBytes {
+				line = line[len(line)-scrollbackMaxLineBytes:]
+			}
+			if off := c.start + int64(stop+st); off < before {
+				text := stripANSI(line)
+				if q == "" || strings.Contains(strings.ToLower(text), q) {
+					found = append(found, ScrollbackLine{Offset: off, Text: text})
+				}
+			}
+			if st == 0 {
+				break
+			}
+			e = st - 1
+		}
+	}
+
+	for i := len(found) - 1; i >= 0; i-- {
+		page.Lines = append(page.Lines, found[i])
+	}
+	if len(found) > 0 {
+		page.NextBefore = found[len(found)-1].Offset
+		page.HasMore = len(found) >= limit && page.NextBefore > page.Start
+	}
+	return page
+}
+
+// stripANSI removes escape sequences and control characters from a line of
+// terminal output. Carriage-return overwrites (progress bars) keep only the
+// last non-empty rewrite.
+func stripANSI(p []byte) string {
+	var out []byte
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+		switch {
+		case b == 0x1b && i+1 < len(p):
+			i++
+			switch p[i] {
+			case '[': // CSI: params/intermediates until a final byte
+				for i+1 < len(p) && (p[i+1] < 0x40 || p[i+1] > 0x7e) {
+					i++
+				}
+				i++
+			case ']', 'P', '_', '^', 'X': // string until BEL or ST
+				for i+1 < len(p) {
+					i++
+					if p[i] == 0x07 {
+						break
+					}
+					if p[i] == 0x1b && i+1 < len(p) && p[i+1] == '\\' {
+						i++
+						break
+					}
+				}
+			case '(', ')', '#', '%':
+				i++ // designator byte
+			}
+		case b == '\r':
+			if rest := bytes.TrimRight(p[i+1:], "\r\n"); len(rest) > 0 {
+				out = out[:0]
+			}
+		case b == '\t':
+			out = append(out, b)
+		case b < 0x20 || b == 0x7f:
+		default:
+			out = append(out, b)
+		}
+	}
+	return strings.ToValidUTF8(string(out), "")
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrollbackLog_SearchAndPaging(t *testing.T) {
+	l := openScrollbackLog(t.TempDir(), 0)
+	defer l.Close()
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&logWriter{l}, "\x1b[32mline %d\x1b[0m\r\n", i)
+	}
+	l.Append([]byte("$ ls"))
+
+	page := l.Search("", 0, 4)
+	require.Len(t, page.Lines, 4)
+	assert.Equal(t, []string{"line 7", "line 8", "line 9", "$ ls"}, lineTexts(page))
+	assert.True(t, page.HasMore)
+
+	prev := l.Search("", page.NextBefore, 3)
+	assert.Equal(t, []string{"line 4", "line 5", "line 6"}, lineTexts(prev))
+
+	hits := l.Search("LINE 3", 0, 10)
+	require.Len(t, hits.Lines, 1)
+	assert.Equal(t, "line 3", hits.Lines[0].Text)
+	assert.False(t, hits.HasMore)
+}
+
+func TestScrollbackLog_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	l := openScrollbackLog(dir, 0)
+	l.Append([]byte("first\r\nsec"))
+	l.Close()
+
+	l = openScrollbackLog(dir, 0)
+	l.Append([]byte("ond\r\nthird\r\n"))
+	l.Close()
+
+	l = loadScrollbackLog(dir, 0)
+	assert.Equal(t, int64(len("first\r\nsecond\r\nthird\r\n")), l.end)
+	assert.Equal(t, "first\r\nsecond\r\nthird\r\n", string(l.Tail(1000)))
+	// "second" spans two segments
+	assert.Equal(t, []string{"first", "second", "third"}, lineTexts(l.Search("", 0, 10)))
+}
+
+func TestScrollbackLog_TornTailTolerated(t *testing.T) {
+	dir := t.TempDir()
+	l := openScrollbackLog(dir, 0)
+	l.Append([]byte("kept\r\n"))
+	l.Close()
+
+	// Simulate a crash in the middle of writing the next gzip member
+	f, err := os.OpenFile(l.segments[0].path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	f.Write([]byte{0x1f, 0x8b, 0x08, 0x00})
+	f.Close()
+
+	l = openScrollbackLog(dir, 0)
+	defer l.Close()
+	assert.Equal(t, int64(len("kept\r\n")), l.end)
+	assert.Equal(t, []string{"kept"}, lineTexts(l.Search("", 0, 10)))
+}
+
+func TestScrollbackLog_SizeCapDropsOldestSegments(t *testing.T) {
+	l := openScrollbackLog(t.TempDir(), 1)
+	defer l.Close()
+
+	// Enough output to rotate through three segments
+	chunk := []byte(strings.Repeat("0123456789abcdef", scrollbackFlushBytes/16))
+	for i := 0; i < 3*scrollbackSegmentBytes/len(chunk); i++ {
+		l.Append(chunk)
+	}
+	l.mu.Lock()
+	l.flushLocked()
+	segs := len(l.segments)
+	start := l.segments[0].start
+	l.mu.Unlock()
+
+	assert.Equal(t, 1, segs, "only the newest segment survives a tiny cap")
+	assert.Greater(t, start, int64(0))
+	assert.Equal(t, start, l.Search("", 0, 1).Start)
+}
+
+func TestStripANSI(t *testing.T) {
+	assert.Equal(t, "ok done", stripANSI([]byte("\x1b[1;32mok\x1b[0m done")))
+	assert.Equal(t, "title gone", stripANSI([]byte("\x1b]0;x\x07title gone")))
+	assert.Equal(t, "100%", stripANSI([]byte("10%\r50%\r100%\r")))
+}
+
+type logWriter struct{ l *scrollbackLog }
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.l.Append(p)
+	return len(p), nil
+}
+
+func lineTexts(p ScrollbackPage) []string {
+	var out []string
+	for _, l := range p.Lines {
+		out = append(out, l.Text)
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── Terminal spectators: read-only watch links ──
+//
+// A spectator link is a scoped JWT (purpose "terminal-watch") whose jti is
+// registered here together with the one session key it may watch. The registry
+// is the source of truth: revoking removes the entry and drops live watchers,
+// and a link stops working once its entry is gone even if the JWT hasn't expired.
+// At ExpiresAt a timer drops the entry the same way, so a time-limited link
+// can't be watched past its deadline. Links are in-memory and do not survive
+// a backend restart.
+
+// SpectatorPurpose is the scoped-token purpose of spectator links.
+const SpectatorPurpose = "terminal-watch"
+
+// Spectator is one issued watch link.
+type Spectator struct {
+	ID         string    `json:"id"` // token jti
+	InstanceID string    `json:"instance_id"`
+	Label      string    `json:"label,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Watching   int       `json:"watching"` // currently connected viewers
+
+	sessionKey string
+	conns      map[io.Closer]struct{}
+	expiry     *time.Timer // drops the link at ExpiresAt
+}
+
+type SpectatorRegistry struct {
+	mu    sync.Mutex
+	links map[string]*Spectator
+}
+
+func NewSpectatorRegistry() *SpectatorRegistry {
+	return &SpectatorRegistry{links: make(map[string]*Spectator)}
+}
+
+// Register records a freshly minted link for sessionKey.
+func (r *SpectatorRegistry) Register(id, sessionKey, label string, expiresAt time.Time) *Spectator {
+	_, iid := parseSessionKey(sessionKey)
+	sp := &Spectator{
+		ID:         id,
+		InstanceID: iid,
+		Label:      label,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  expiresAt,
+		sessionKey: sessionKey,
+		conns:      make(map[io.Closer]struct{}),
+	}
+	r.mu.Lock()
+	r.links[id] = sp
+	sp.expiry = time.AfterFunc(time.Until(expiresAt), func() { r.drop(sp) })
+	r.mu.Unlock()
+	return sp
+}
+
+// Attach resolves a link to its session key and registers a live viewer.
+// Returns "" if the link is unknown, revoked or expired.
+func (r *SpectatorRegistry) Attach(id string, conn io.Closer) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sp, ok := r.links[id]
+	if !ok || time.Now().After(sp.ExpiresAt) {
+		return ""
+	}
+	sp.conns[conn] = struct{}{}
+	return sp.sessionKey
+}
+
+// Detach unregisters a viewer connection.
+func (r *SpectatorRegistry) Detach(id string, conn io.Closer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sp, ok := r.links[id]; ok {
+		delete(sp.conns, conn)
+	}
+}
+
+// List returns the unexpired links for sessions under prefix
+// (e.g. "term:{userID}:" or a full session key), oldest first.
+func (r *SpectatorRegistry) List(prefix string) []Spectator {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	result := []Spectator{}
+	for _, sp := range r.links {
+		if strings.HasPrefix(sp.sessionKey, prefix) && !now.After(sp.ExpiresAt) {
+			cp := *sp
+			cp.Watching = len(sp.conns)
+			result = append(result, cp)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	return result
+}
+
+// Revoke deletes a link under prefix and disconnects its viewers.
+func (r *SpectatorRegistry) Revoke(prefix, id string) bool {
+	r.mu.Lock()
+	sp, ok := r.links[id]
+	r.mu.Unlock()
+	if !ok || !strings.HasPrefix(sp.sessionKey, prefix) {
+		return false
+	}
+	return r.drop(sp)
+}
+
+// drop deletes sp, if still registered, and disconnects its viewers.
+func (r *SpectatorRegistry) drop(sp *Spectator) bool {
+	r.mu.Lock()
+	if r.links[sp.ID] != sp {
+		r.mu.Unlock()
+		return false
+	}
+	delete(r.links, sp.ID)
+	conns := sp.conns
+	r.mu.Unlock()
+
+	sp.expiry.Stop()
+	for c := range conns {
+		c.Close()
+	}
+	return true
+}
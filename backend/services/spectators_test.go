@@ -0,0 +1,55 @@
+package services
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type closeRecorder struct{ closed atomic.Bool }
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestSpectatorRegistry_AttachListRevoke(t *testing.T) {
+	r := NewSpectatorRegistry()
+	r.Register("jti-1", "term:user-1:main", "pairing", time.Now().Add(time.Hour))
+
+	conn := &closeRecorder{}
+	assert.Equal(t, "term:user-1:main", r.Attach("jti-1", conn))
+	assert.Empty(t, r.Attach("unknown", conn))
+
+	list := r.List("term:user-1:")
+	require.Len(t, list, 1)
+	assert.Equal(t, "main", list[0].InstanceID)
+	assert.Equal(t, 1, list[0].Watching)
+	assert.Empty(t, r.List("term:user-2:"))
+
+	assert.False(t, r.Revoke("term:user-2:", "jti-1"), "other users can't revoke")
+	assert.True(t, r.Revoke("term:user-1:", "jti-1"))
+	assert.True(t, conn.closed.Load(), "revoking disconnects live viewers")
+	assert.Empty(t, r.Attach("jti-1", &closeRecorder{}))
+}
+
+func TestSpectatorRegistry_ExpiredLinkRejected(t *testing.T) {
+	r := NewSpectatorRegistry()
+	r.Register("jti-1", "term:user-1:main", "", time.Now().Add(-time.Second))
+	assert.Empty(t, r.Attach("jti-1", &closeRecorder{}))
+	assert.Empty(t, r.List("term:user-1:"))
+}
+
+func TestSpectatorRegistry_ExpiryDisconnectsViewers(t *testing.T) {
+	r := NewSpectatorRegistry()
+	r.Register("jti-1", "term:user-1:main", "", time.Now().Add(100*time.Millisecond))
+	conn := &closeRecorder{}
+	require.Equal(t, "term:user-1:main", r.Attach("jti-1", conn))
+
+	require.Eventually(t, conn.closed.Load, 2*time.Second, 10*time.Millisecond)
+	assert.Empty(t, r.List("term:user-1:"))
+	assert.False(t, r.Revoke("term:user-1:", "jti-1"))
+}
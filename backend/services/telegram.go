@@ -1,15 +1,21 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"nebulide/config"
@@ -20,6 +26,11 @@ type TelegramBot struct {
 	bot *tgbotapi.BotAPI
 	cfg *config.Config
 	db  *gorm.DB
+
+	// Terminal serves the /screen command (optional).
+	Terminal *TerminalService
+	// Approvals takes the Allow/Deny buttons of permission prompts (optional).
+	Approvals *ApprovalService
 }
 
 func NewTelegramBot(cfg *config.Config, db *gorm.DB) (*TelegramBot, error) {
@@ -55,6 +66,10 @@ func (t *TelegramBot) Start() {
 	updates := t.bot.GetUpdatesChan(u)
 
 	for update := range updates {
+		if update.CallbackQuery != nil {
+			t.handleCallback(update.CallbackQuery)
+			continue
+		}
 		if update.Message == nil {
 			continue
 		}
@@ -81,6 +96,12 @@ func (t *TelegramBot) handleMessage(msg *tgbotapi.Message) {
 		return
 	}
 
+	// /screen [instanceId] — what a terminal shows right now
+	if msg.IsCommand() && msg.Command() == "screen" {
+		t.sendScreen(chatID, user.ID.String(), strings.TrimSpace(msg.CommandArguments()))
+		return
+	}
+
 	// Handle file/photo/document
 	var fileID, fileName string
 
@@ -204,6 +225,167 @@ func (t *TelegramBot) copyLocalFile(fileID, destPath string) error {
 	return nil
 }
 
+// maxScreenRunes keeps a /screen reply under Telegram's 4096-character limit.
+const maxScreenRunes = 4000
+
+// sendScreen replies with a terminal's visible screen. Without an instanceId
+// it picks the user's only running terminal or lists them.
+func (t *TelegramBot) sendScreen(chatID int64, userID, instanceID string) {
+	reply := func(text string) { t.bot.Send(tgbotapi.NewMessage(chatID, text)) }
+	if t.Terminal == nil {
+		reply("Терминалы недоступны.")
+		return
+	}
+	if instanceID == "" {
+		var running []string
+		for _, s := range t.Terminal.ListUserSessions(userID) {
+			if s.Alive {
+				running = append(running, s.InstanceID)
+			}
+		}
+		sort.Strings(running)
+		switch len(running) {
+		case 0:
+			reply("Нет запущенных терминалов.")
+			return
+		case 1:
+			instanceID = running[0]
+		default:
+			reply("Выбери терминал: /screen <id>\n\n" + strings.Join(running, "\n"))
+			return
+		}
+	}
+
+	snap, ok := t.Terminal.Screen("term:"+userID+":"+instanceID, false)
+	if !ok {
+		reply("Терминал не найден: " + instanceID)
+		return
+	}
+	text := screenTail(snap.Text, maxScreenRunes)
+	if text == "" {
+		reply("Экран пуст.")
+		return
+	}
+	m := tgbotapi.NewMessage(chatID, "<pre>"+html.EscapeString(text)+"</pre>")
+	m.ParseMode = tgbotapi.ModeHTML
+	if _, err := t.bot.Send(m); err != nil {
+		log.Printf("[TelegramBot] /screen send error: %v", err)
+	}
+}
+
+// screenTail drops blank lines at the ends of a screen and keeps the last
+// whole lines that fit in max runes.
+func screenTail(text string, max int) string {
+	lines := strings.Split(strings.Trim(text, "\n"), "\n")
+	n := 0
+	start := len(lines)
+	for start > 0 {
+		l := utf8.RuneCountInString(lines[start-1]) + 1
+		if n+l > max {
+			break
+		}
+		n += l
+		start--
+	}
+	return strings.Join(lines[start:], "\n")
+}
+
+// approvalCallbackPrefix starts the callback data of the approval buttons:
+// "approval:allow:<id>" or "approval:deny:<id>".
+const approvalCallbackPrefix = "approval:"
+
+// SendApproval asks in the chat to allow or deny a claude permission prompt.
+// Returns the message ID, for CloseApproval.
+func (t *TelegramBot) SendApproval(chatID int64, a *models.ClaudeApproval) (int, error) {
+	m := tgbotapi.NewMessage(chatID, approvalText(a))
+	m.ParseMode = tgbotapi.ModeHTML
+	m.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Разрешить", approvalCallbackPrefix+"allow:"+a.ID.String()),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Запретить", approvalCallbackPrefix+"deny:"+a.ID.String()),
+	))
+	sent, err := t.bot.Send(m)
+	return sent.MessageID, err
+}
+
+// CloseApproval replaces the buttons of a decided prompt with the outcome.
+func (t *TelegramBot) CloseApproval(a *models.ClaudeApproval) {
+	if a.TelegramMessageID == 0 {
+		return
+	}
+	outcome := map[string]string{
+		models.ApprovalAllowed:  "✅ Разрешено",
+		models.ApprovalDenied:   "❌ Запрещено",
+		models.ApprovalExpired:  "⌛ Время вышло",
+		models.ApprovalCanceled: "↩️ Больше не нужно",
+	}[a.Status]
+	edit := tgbotapi.NewEditMessageText(a.TelegramChatID, a.TelegramMessageID, approvalText(a)+"\n\n"+outcome)
+	edit.ParseMode = tgbotapi.ModeHTML
+	if _, err := t.bot.Send(edit); err != nil {
+		log.Printf("[TelegramBot] closing approval %s: %v", a.ID, err)
+	}
+}
+
+// handleCallback takes a press of an Allow/Deny button.
+func (t *TelegramBot) handleCallback(cb *tgbotapi.CallbackQuery) {
+	answer := func(text string) { t.bot.Request(tgbotapi.NewCallback(cb.ID, text)) }
+	rest, ok := strings.CutPrefix(cb.Data, approvalCallbackPrefix)
+	if !ok || t.Approvals == nil {
+		answer("")
+		return
+	}
+	action, idStr, _ := strings.Cut(rest, ":")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		answer("")
+		return
+	}
+	var user models.User
+	if err := t.db.Where("telegram_id = ?", cb.From.ID).First(&user).Error; err != nil {
+		answer("Аккаунт не привязан.")
+		return
+	}
+	switch err := t.Approvals.Decide(user.ID, id, action == "allow", "telegram", ""); {
+	case errors.Is(err, ErrApprovalDecided):
+		answer("Уже решено.")
+	case err != nil:
+		answer("Запрос не найден.")
+	case action == "allow":
+		answer("Разрешено")
+	default:
+		answer("Запрещено")
+	}
+}
+
+// approvalText describes a permission prompt: the tool and what it is about
+// to do (a Bash command, a file path, or the raw input).
+func approvalText(a *models.ClaudeApproval) string {
+	text := "🔐 Claude просит разрешение: <b>" + html.EscapeString(a.Tool) + "</b>"
+	if a.Cwd != "" {
+		text += "\n📁 " + html.EscapeString(filepath.Base(a.Cwd))
+	}
+	var input map[string]interface{}
+	json.Unmarshal(a.ToolInput, &input)
+	detail := ""
+	for _, key := range []string{"command", "file_path", "url", "pattern", "path"} {
+		if v, ok := input[key].(string); ok && v != "" {
+			detail = v
+			break
+		}
+	}
+	if detail == "" && len(input) > 0 {
+		detail = string(a.ToolInput)
+	}
+	if detail != "" {
+		if r := []rune(detail); len(r) > maxApprovalDetailRunes {
+			detail = string(r[:maxApprovalDetailRunes]) + "…"
+		}
+		text += "\n\n<pre>" + html.EscapeString(detail) + "</pre>"
+	}
+	return text
+}
+
+const maxApprovalDetailRunes = 2000
+
 // SendFile sends a file from the filesystem to a Telegram chat.
 func (t *TelegramBot) SendFile(chatID int64, filePath string) error {
 	file := tgbotapi.FilePath(filePath)
@@ -214,6 +396,12 @@ func (t *TelegramBot) SendFile(chatID int64, filePath string) error {
 	return err
 }
 
+// SendText sends a plain text message to a Telegram chat.
+func (t *TelegramBot) SendText(chatID int64, text string) error {
+	_, err := t.bot.Send(tgbotapi.NewMessage(chatID, text))
+	return err
+}
+
 const maxDownloadSize = 800 * 1024 * 1024 // 800MB
 
 func downloadFile(url, dest string) error {
@@ -1,14 +1,13 @@
 package services
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -25,116 +24,240 @@ func sanitizeKey(key string) string {
 	return r.Replace(key)
 }
 
-func scrollbackPath(sessionKey string) string {
+// scrollbackLogDir is the directory of a session's segmented scrollback log.
+func scrollbackLogDir(sessionKey string) string {
+	return filepath.Join(scrollbackDir, sanitizeKey(sessionKey))
+}
+
+// legacyScrollbackPath is the single-file scrollback used before the segmented
+// log; imported once on open so output survives the upgrade.
+func legacyScrollbackPath(sessionKey string) string {
 	return filepath.Join(scrollbackDir, sanitizeKey(sessionKey)+".buf")
 }
 
 // ── multiWriter: broadcasts PTY output to all connected WebSocket clients ──
 
-const replayBufCap = 65536 // 64KB ring buffer for late joiners
+// Per-writer backpressure. Each writer has its own output queue and sender
+// goroutine, so a slow client never blocks pumpOutput (and with it the PTY and
+// every other device).
+const (
+	writerLagBytes    = 256 << 10        // queued output above this flags the writer as lagging
+	writerResyncBytes = 2 << 20          // above this the writer is dropped and told to resync
+	writerResyncLag   = 15 * time.Second // same when the oldest undelivered output is this old
+)
+
+// ResyncCloser is implemented by writers that can ask their client to
+// reconnect (the terminal WS closes with code 4002). On reconnect the client
+// gets a fresh screen snapshot instead of the output it fell behind on.
+type ResyncCloser interface {
+	CloseResync()
+}
+
+// SpectatorWriter is implemented by output-only writers of a spectator link
+// (see SpectatorRegistry). They get output like any writer but don't count as
+// a connected client: a session only spectators watch still goes orphaned,
+// hibernates, leaves room under MaxSessions and is killable by admins.
+type SpectatorWriter interface {
+	Spectating()
+}
 
 type writerEntry struct {
-	closer io.Closer
-	wsId   string
+	closer    io.Closer
+	wsId      string
+	spectator bool
+
+	// Output queue, guarded by multiWriter.mu. Chunks that arrive while the
+	// sender is busy are coalesced and go out as a single message.
+	queue      []byte
+	queuedAt   time.Time // when the oldest byte in queue was enqueued
+	inflight   int       // bytes handed to Write and not yet returned
+	inflightAt time.Time
+	lagging    bool
+	sentBytes  int64
+	dropped    bool
+
+	wake chan struct{} // cap 1: queue became non-empty
+	stop chan struct{} // closed when the writer is removed
+}
+
+// lag is the age of the oldest output not yet delivered to the writer.
+func (e *writerEntry) lag(now time.Time) time.Duration {
+	switch {
+	case e.inflight > 0:
+		return now.Sub(e.inflightAt)
+	case len(e.queue) > 0:
+		return now.Sub(e.queuedAt)
+	}
+	return 0
+}
+
+// WriterStats describes one attached writer's output queue.
+type WriterStats struct {
+	WsID        string `json:"ws_id,omitempty"`
+	Spectator   bool   `json:"spectator,omitempty"`
+	QueuedBytes int    `json:"queued_bytes"`
+	LagMs       int64  `json:"lag_ms"`
+	Lagging     bool   `json:"lagging"`
+	SentBytes   int64  `json:"sent_bytes"`
 }
 
 type multiWriter struct {
 	mu      sync.Mutex
 	writers map[io.Writer]*writerEntry
 
-	// replayBuf stores the last N bytes of PTY output so that new
-	// connections see the current prompt / recent output.
-	replayBuf []byte
+	// screen is a headless terminal emulator fed with all PTY output. New
+	// connections get a synthesized snapshot of it instead of a byte tail,
+	// which keeps full-screen apps intact and never replays queries.
+	screen *vtScreen
 
-	// Persistent scrollback: file path and dirty flag for periodic flush.
-	filePath string
-	dirty    bool
-	stopCh   chan struct{}
-}
+	// log is the persistent, searchable scrollback (survives container restart).
+	log *scrollbackLog
 
-func newMultiWriter(filePath string) *multiWriter {
-	os.MkdirAll(scrollbackDir, 0755)
+	// cmds is the shell-integration command log (fed by screen's OSC hook).
+	cmds *commandLog
+}
 
+func newMultiWriter(sessionKey string, maxScrollbackBytes int64, cols, rows int) *multiWriter {
 	mw := &multiWriter{
-		writers:  make(map[io.Writer]*writerEntry),
-		filePath: filePath,
-		stopCh:   make(chan struct{}),
+		writers: make(map[io.Writer]*writerEntry),
+		screen:  newVTScreen(cols, rows),
+		log:     openScrollbackLog(scrollbackLogDir(sessionKey), maxScrollbackBytes),
 	}
 
-	// Load existing scrollback from disk (survives container restart)
-	if data, err := os.ReadFile(filePath); err == nil && len(data) > 0 {
-		if len(data) > replayBufCap {
-			data = data[len(data)-replayBufCap:]
+	legacy := legacyScrollbackPath(sessionKey)
+	if data, err := os.ReadFile(legacy); err == nil {
+		if mw.log.end == 0 && len(data) > 0 {
+			mw.log.Append(data)
 		}
-		mw.replayBuf = data
-		log.Printf("[TerminalService] loaded scrollback %d bytes from %s", len(data), filePath)
+		os.Remove(legacy)
 	}
 
-	// Periodic flush to disk every 5 seconds
-	go mw.flushLoop()
+	// Rebuild the screen from the tail of the log. The emulator copes with a
+	// tail that starts mid-sequence; later output repaints anything garbled.
+	tail := mw.log.Tail(scrollbackRestoreBytes)
+	mw.screen.fed = mw.log.end - int64(len(tail))
+	if len(tail) > 0 {
+		mw.screen.Write(tail)
+		log.Printf("[TerminalService] restored screen from %d bytes of scrollback key=%s", len(tail), sessionKey)
+	}
+
+	// Hooked up after the restore: the tail's markers are already in the log.
+	mw.cmds = openCommandLog(scrollbackLogDir(sessionKey))
+	mw.screen.onOSC = mw.cmds.handleOSC
 
 	return mw
 }
 
-func (mw *multiWriter) flushLoop() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// Write feeds the screen model and scrollback log and queues data for every
+// connected writer. Never blocks on a writer.
+func (mw *multiWriter) Write(p []byte) (int, error) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	mw.screen.Write(p)
+	mw.log.Append(p)
+
+	for w, entry := range mw.writers {
+		mw.enqueueLocked(w, entry, p)
+	}
+	return len(p), nil
+}
+
+func (mw *multiWriter) enqueueLocked(w io.Writer, e *writerEntry, p []byte) {
+	now := time.Now()
+	if len(e.queue) == 0 {
+		e.queuedAt = now
+	}
+	e.queue = append(e.queue, p...)
+
+	backlog := len(e.queue) + e.inflight
+	if backlog > writerResyncBytes || e.lag(now) > writerResyncLag {
+		log.Printf("[TerminalService] writer wsId=%s fell behind (%d bytes, lag %s), resyncing",
+			e.wsId, backlog, e.lag(now).Round(time.Millisecond))
+		mw.dropLocked(w, e)
+		go func() {
+			if rc, ok := w.(ResyncCloser); ok {
+				rc.CloseResync()
+			} else {
+				e.closer.Close()
+			}
+		}()
+		return
+	}
+	if backlog > writerLagBytes && !e.lagging {
+		e.lagging = true
+		log.Printf("[TerminalService] writer wsId=%s lagging (%d bytes queued)", e.wsId, backlog)
+	}
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sendLoop delivers a writer's queue. Exits when the writer is removed or a
+// write fails (the writer is then closed and removed).
+func (mw *multiWriter) sendLoop(w io.Writer, e *writerEntry) {
 	for {
 		select {
-		case <-ticker.C:
-			mw.flushToDisk()
-		case <-mw.stopCh:
-			mw.flushToDisk() // final flush
+		case <-e.wake:
+		case <-e.stop:
 			return
 		}
+		for {
+			mw.mu.Lock()
+			if e.dropped || len(e.queue) == 0 {
+				mw.mu.Unlock()
+				break
+			}
+			buf := e.queue
+			e.queue = nil
+			e.inflight, e.inflightAt = len(buf), e.queuedAt
+			mw.mu.Unlock()
+
+			_, err := w.Write(buf)
+
+			mw.mu.Lock()
+			e.inflight = 0
+			e.sentBytes += int64(len(buf))
+			if e.lagging && len(e.queue) < writerLagBytes/2 {
+				e.lagging = false
+			}
+			if err != nil {
+				mw.dropLocked(w, e)
+			}
+			mw.mu.Unlock()
+			if err != nil {
+				e.closer.Close()
+				return
+			}
+		}
 	}
 }
 
-func (mw *multiWriter) flushToDisk() {
-	mw.mu.Lock()
-	if !mw.dirty || len(mw.replayBuf) == 0 {
-		mw.mu.Unlock()
+// dropLocked removes a writer and stops its sender. Idempotent.
+func (mw *multiWriter) dropLocked(w io.Writer, e *writerEntry) {
+	if e.dropped {
 		return
 	}
-	buf := make([]byte, len(mw.replayBuf))
-	copy(buf, mw.replayBuf)
-	mw.dirty = false
-	mw.mu.Unlock()
-
-	if err := os.WriteFile(mw.filePath, buf, 0644); err != nil {
-		log.Printf("[TerminalService] scrollback flush error: %v", err)
+	e.dropped = true
+	e.queue = nil
+	close(e.stop)
+	if mw.writers[w] == e {
+		delete(mw.writers, w)
 	}
 }
 
-// Write sends data to all connected writers and appends to the replay buffer.
-// Dead writers are removed automatically.
-func (mw *multiWriter) Write(p []byte) (int, error) {
+// Resize keeps the screen model in sync with the PTY size.
+func (mw *multiWriter) Resize(cols, rows int) {
 	mw.mu.Lock()
 	defer mw.mu.Unlock()
-
-	// Append to replay buffer (ring: keep last replayBufCap bytes)
-	mw.replayBuf = append(mw.replayBuf, p...)
-	if len(mw.replayBuf) > replayBufCap {
-		mw.replayBuf = mw.replayBuf[len(mw.replayBuf)-replayBufCap:]
-	}
-	mw.dirty = true
-
-	for w, entry := range mw.writers {
-		if _, err := w.Write(p); err != nil {
-			entry.closer.Close()
-			delete(mw.writers, w)
-		}
-	}
-	return len(p), nil
+	mw.screen.Resize(cols, rows)
 }
 
-// daQueryRe matches Device Attributes queries (\e[c, \e[0c, \e[>c, etc.)
-// that bash/readline sends on startup. If replayed to xterm on reconnect,
-// xterm responds with \e[?1;2c which goes to PTY stdin → bash displays "1;2c".
-var daQueryRe = regexp.MustCompile(`\x1b\[[\d>]*c`)
-
-// Add registers a new writer. Flushes the replay buffer to it so the client
-// sees the current terminal state (prompt, recent output).
+// Add registers a new writer. Sends it a snapshot of the screen model so the
+// client sees the exact current terminal state (scrollback, alternate screen,
+// cursor, modes).
 // If wsId is provided, supersedes any existing writer with the same wsId
 // (handles reconnect race where stale TCP connection still in writers map).
 func (mw *multiWriter) Add(w io.Writer, closer io.Closer, wsId string) {
@@ -146,53 +269,95 @@ func (mw *multiWriter) Add(w io.Writer, closer io.Closer, wsId string) {
 		for existing, entry := range mw.writers {
 			if entry.wsId == wsId {
 				log.Printf("[TerminalService] superseding stale writer wsId=%s", wsId)
+				mw.dropLocked(existing, entry)
 				entry.closer.Close()
-				delete(mw.writers, existing)
 			}
 		}
 	}
 
-	// Replay recent output to the new connection, stripping DA queries
-	// to prevent xterm from auto-responding with \e[?1;2c → "1;2c" in terminal
-	if len(mw.replayBuf) > 0 {
-		cleaned := daQueryRe.ReplaceAll(mw.replayBuf, nil)
-		// Also strip any literal "1;2c" remnants from previous DA responses
-		cleaned = bytes.ReplaceAll(cleaned, []byte("1;2c"), nil)
-		if len(cleaned) > 0 {
-			w.Write(cleaned)
-		}
-		log.Printf("[TerminalService] replay %d bytes (cleaned %d DA/remnant bytes)", len(mw.replayBuf), len(mw.replayBuf)-len(cleaned))
+	// The snapshot is the first thing in the new writer's queue, so it is
+	// delivered before any live output and never blocks the PTY reader.
+	snapshot := mw.screen.Snapshot()
+	log.Printf("[TerminalService] replay snapshot %d bytes (%dx%d alt=%v)", len(snapshot), mw.screen.cols, mw.screen.rows, mw.screen.altActive)
+
+	_, spectator := w.(SpectatorWriter)
+	entry := &writerEntry{
+		closer:    closer,
+		wsId:      wsId,
+		spectator: spectator,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
 	}
-
-	mw.writers[w] = &writerEntry{closer: closer, wsId: wsId}
+	mw.writers[w] = entry
+	go mw.sendLoop(w, entry)
+	mw.enqueueLocked(w, entry, snapshot)
 }
 
 // Remove unregisters a writer (called when WS disconnects).
 func (mw *multiWriter) Remove(w io.Writer) {
 	mw.mu.Lock()
 	defer mw.mu.Unlock()
-	delete(mw.writers, w)
+	if e, ok := mw.writers[w]; ok {
+		mw.dropLocked(w, e)
+	}
+}
+
+// Drain waits up to timeout for a writer's queue to be delivered, so the last
+// output of an exiting shell reaches the client before its connection closes.
+func (mw *multiWriter) Drain(w io.Writer, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		mw.mu.Lock()
+		e, ok := mw.writers[w]
+		idle := !ok || (len(e.queue) == 0 && e.inflight == 0)
+		mw.mu.Unlock()
+		if idle {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 }
 
-// Count returns the number of currently connected writers.
+// Stats returns queue statistics for every attached writer.
+func (mw *multiWriter) Stats() []WriterStats {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	now := time.Now()
+	stats := make([]WriterStats, 0, len(mw.writers))
+	for _, e := range mw.writers {
+		stats = append(stats, WriterStats{
+			WsID:        e.wsId,
+			Spectator:   e.spectator,
+			QueuedBytes: len(e.queue) + e.inflight,
+			LagMs:       e.lag(now).Milliseconds(),
+			Lagging:     e.lagging,
+			SentBytes:   e.sentBytes,
+		})
+	}
+	return stats
+}
+
+// Count returns the number of currently connected writers, spectators aside.
 func (mw *multiWriter) Count() int {
 	mw.mu.Lock()
 	defer mw.mu.Unlock()
-	return len(mw.writers)
+	n := 0
+	for _, e := range mw.writers {
+		if !e.spectator {
+			n++
+		}
+	}
+	return n
 }
 
-// Stop stops the flush loop and performs a final flush.
+// Stop flushes the scrollback log and closes it.
 func (mw *multiWriter) Stop() {
-	select {
-	case <-mw.stopCh:
-	default:
-		close(mw.stopCh)
-	}
+	mw.log.Close()
 }
 
-// DeleteFile removes the scrollback file from disk.
+// DeleteFile removes the scrollback log from disk.
 func (mw *multiWriter) DeleteFile() {
-	os.Remove(mw.filePath)
+	mw.log.Delete()
 }
 
 // ── TerminalService ──
@@ -208,13 +373,65 @@ type TerminalService struct {
 	// OnChildStarted is called when a terminal gains a live `claude` descendant
 	// (user ran `claude` command). Parameters: userID, instanceID, workspaceID.
 	OnChildStarted func(userID, instanceID, workspaceID string)
+
+	// OnShellExited is called when a terminal's shell ends, with its exit
+	// status (-1 if it was killed by a signal or the status is unknown).
+	OnShellExited func(userID, instanceID string, exitCode int)
+
+	// Recordings stores asciicast recordings of terminal sessions (optional).
+	Recordings *RecordingService
+
+	// ScrollbackMaxBytes caps the compressed scrollback log of each session (0 = unlimited).
+	ScrollbackMaxBytes int64
+
+	// UsePtyHolders starts shells in pty-holder processes so they survive a
+	// backend restart (see ptyholder.go). Falls back to a local PTY on error.
+	UsePtyHolders bool
+
+	// Triggers matches terminal output against users' trigger rules (optional).
+	Triggers *TriggerService
+
+	// Watchers reports user-defined processes (dev servers, test runs) starting
+	// and exiting in terminals (optional; polled by childWatchLoop).
+	Watchers *ProcessWatchService
+
+	// Ports tracks TCP ports listened on by terminals' processes (optional;
+	// polled by childWatchLoop, gates the /preview proxy).
+	Ports *PortService
+
+	// Cgroups caps CPU/memory/PIDs of sandboxed shells per user (optional).
+	Cgroups *CgroupManager
+
+	// Sandbox isolates non-admin shells on Linux. Required there: without it
+	// sandboxed terminals refuse to start.
+	Sandbox *Sandbox
+
+	// Policy limits every user's terminals; PolicyFor returns a user's
+	// overrides (see SessionPolicy.Override, optional).
+	Policy    SessionPolicy
+	PolicyFor func(userID string) SessionPolicy
+
+	// HibernateWarning is how long before hibernating an idle session
+	// OnHibernate gets a "warning" (0 = no warning). See hibernate.go.
+	HibernateWarning time.Duration
+	OnHibernate      func(HibernateEvent)
+}
+
+// sessionPty is the shell's terminal: a local go-pty, or the connection to
+// the pty-holder that owns it.
+type sessionPty interface {
+	io.ReadWriteCloser
+	Resize(width, height int) error
 }
 
 type TerminalSession struct {
-	Pty  gopty.Pty
-	Cmd  *gopty.Cmd
+	Pty  sessionPty
+	Cmd  *gopty.Cmd // nil when the shell lives in a pty-holder
 	Done chan struct{}
 
+	// pid is the shell's process id (0 if unknown).
+	pid int
+
 	// ptyCloseOnce гарантирует закрытие нативного ConPTY-хэндла РОВНО один раз. Несколько путей
 	// могут звать закрытие (горутина cmd.Wait при выходе шелла + CloseKeepScrollback/Close при
 	// пересоздании мёртвой сессии) — двойной Close() ConPTY на Windows = double-free → heap
@@ -251,11 +468,27 @@ type TerminalSession struct {
 	// terminal → its Claude project dir (~/.claude/projects/<slug>) when
 	// resolving the live JSONL for the chat-view wrapper.
 	WorkDir string
+
+	// rec is the active asciicast recording (nil when not recording), guarded by mu.
+	rec        *asciicastRecorder
+	recID      string
+	recordings *RecordingService
+
+	// triggers matches output against the owner's trigger rules (nil if disabled).
+	triggers *triggerScanner
+
+	// Hibernation bookkeeping (guarded by mu): when a watched process or
+	// claude was last seen, and the idle period already warned about.
+	busyAt      time.Time
+	idleWarned  time.Time
+	hibernateAt time.Time
 }
 
 func NewTerminalService() *TerminalService {
 	ts := &TerminalService{
-		sessions: make(map[string]*TerminalSession),
+		sessions:           make(map[string]*TerminalSession),
+		ScrollbackMaxBytes: DefaultScrollbackMaxBytes,
+		Policy:             SessionPolicy{MaxSessions: DefaultMaxSessionsPerUser},
 	}
 	go ts.reapLoop()
 	go ts.childWatchLoop()
@@ -274,7 +507,8 @@ func (s *TerminalService) GetWorkDir(sessionKey string) string {
 }
 
 // reapLoop periodically removes dead terminal sessions and logs status.
-// Live sessions are NEVER killed — they persist until the shell process exits.
+// Live sessions persist until the shell process exits, unless the owner's
+// policy hibernates them when idle (see hibernateIdle).
 func (s *TerminalService) reapLoop() {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
@@ -309,6 +543,7 @@ func (s *TerminalService) reapLoop() {
 		if len(status) > 0 {
 			log.Printf("[TerminalService] status: %d sessions\n%s", len(status), strings.Join(status, "\n"))
 		}
+		s.hibernateIdle(now)
 	}
 }
 
@@ -332,16 +567,22 @@ func (s *TerminalService) childWatchLoop() {
 	defer ticker.Stop()
 	for range ticker.C {
 		current := make(map[string]watchedClaude)
+		var targets []watchTarget
 		s.mu.RLock()
 		for key, sess := range s.sessions {
-			if !sess.IsAlive() || !sess.HasClaudeChild() {
+			if !sess.IsAlive() {
 				continue
 			}
 			uid, iid := parseSessionKey(key)
 			sess.mu.Lock()
 			wsID := sess.WorkspaceID
 			sess.mu.Unlock()
-			current[key] = watchedClaude{userID: uid, instanceID: iid, workspaceID: wsID}
+			if s.Watchers != nil || s.Ports != nil {
+				targets = append(targets, watchTarget{key: key, userID: uid, instanceID: iid, workspaceID: wsID, pid: sess.pid, cmds: sess.mw.cmds})
+			}
+			if sess.HasClaudeChild() {
+				current[key] = watchedClaude{userID: uid, instanceID: iid, workspaceID: wsID}
+			}
 		}
 		s.mu.RUnlock()
 
@@ -359,6 +600,13 @@ func (s *TerminalService) childWatchLoop() {
 			}
 		}
 		prevState = current
+
+		if s.Watchers != nil {
+			s.Watchers.poll(targets)
+		}
+		if s.Ports != nil {
+			s.Ports.poll(targets)
+		}
 	}
 }
 
@@ -387,14 +635,38 @@ func defaultShell() string {
 	return "/bin/sh"
 }
 
-// maxSessionsPerUser limits the number of concurrent ACTIVE (with writers) terminal sessions per user.
-// Orphaned sessions (writers=0) don't count — they don't block new terminals.
-const maxSessionsPerUser = 15
+// ShellOptions customize a new shell (see models.TerminalProfile). They are
+// ignored when GetOrCreate reuses a running shell.
+type ShellOptions struct {
+	Shell          string // name or path; empty or not found: defaultShell()
+	StartupCommand string // typed into the shell once it has started
+}
+
+// shell resolves the shell to start.
+func (o ShellOptions) shell() string {
+	if o.Shell == "" {
+		return defaultShell()
+	}
+	p, err := exec.LookPath(o.Shell)
+	if err != nil {
+		log.Printf("[TerminalService] shell %q not found, using the default: %v", o.Shell, err)
+		return defaultShell()
+	}
+	return p
+}
+
+// DefaultMaxSessionsPerUser is the default Policy.MaxSessions: concurrent
+// ACTIVE (with writers) terminal sessions per user. Orphaned sessions
+// (writers=0) don't count — they don't block new terminals.
+const DefaultMaxSessionsPerUser = 15
 
 // GetOrCreate returns an existing alive session or creates a new one.
-// If sandboxed is true (Linux only), the shell runs in an isolated mount namespace
-// where other users' workspaces are hidden behind tmpfs.
-func (s *TerminalService) GetOrCreate(sessionKey string, workingDir string, sandboxed bool, username string, extraEnv map[string]string) (*TerminalSession, error) {
+// If sandboxed is true (Linux only), the shell runs in the native sandbox
+// where other users' workspaces are hidden behind tmpfs (see sandbox.go).
+func (s *TerminalService) GetOrCreate(sessionKey string, workingDir string, sandboxed bool, username string, extraEnv map[string]string, opts ShellOptions) (*TerminalSession, error) {
+	uid, _ := parseSessionKey(sessionKey)
+	maxSessions := s.policyFor(uid).MaxSessions
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -414,7 +686,7 @@ func (s *TerminalService) GetOrCreate(sessionKey string, workingDir string, sand
 	} else {
 		// No in-memory session — scrollback file may exist from a previous
 		// container. Keep it so terminal output survives deploys/restarts.
-		// DA queries stripped in multiWriter.Add() prevent 1;2c on replay.
+		// Replay is a screen snapshot, so no DA queries reach xterm (no 1;2c).
 		log.Printf("[TerminalService] no existing session, creating new key=%s", sessionKey)
 	}
 
@@ -428,17 +700,17 @@ func (s *TerminalService) GetOrCreate(sessionKey string, workingDir string, sand
 				activeCount++
 			}
 		}
-		if activeCount >= maxSessionsPerUser {
-			log.Printf("[TerminalService] active session limit reached for user prefix=%s active=%d max=%d", userPrefix, activeCount, maxSessionsPerUser)
-			return nil, fmt.Errorf("active terminal session limit reached (max %d per user)", maxSessionsPerUser)
+		if maxSessions > 0 && activeCount >= maxSessions {
+			log.Printf("[TerminalService] active session limit reached for user prefix=%s active=%d max=%d", userPrefix, activeCount, maxSessions)
+			return nil, fmt.Errorf("active terminal session limit reached (max %d per user)", maxSessions)
 		}
 	}
 
-	return s.createLocked(sessionKey, workingDir, sandboxed, username, extraEnv)
+	return s.createLocked(sessionKey, workingDir, sandboxed, username, extraEnv, opts)
 }
 
 // Create always creates a new session, closing any existing one.
-func (s *TerminalService) Create(sessionKey string, workingDir string, sandboxed bool, username string, extraEnv map[string]string) (*TerminalSession, error) {
+func (s *TerminalService) Create(sessionKey string, workingDir string, sandboxed bool, username string, extraEnv map[string]string, opts ShellOptions) (*TerminalSession, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -447,17 +719,109 @@ func (s *TerminalService) Create(sessionKey string, workingDir string, sandboxed
 		delete(s.sessions, sessionKey)
 	}
 
-	return s.createLocked(sessionKey, workingDir, sandboxed, username, extraEnv)
+	return s.createLocked(sessionKey, workingDir, sandboxed, username, extraEnv, opts)
 }
 
-func (s *TerminalService) createLocked(sessionKey string, workingDir string, sandboxed bool, username string, extraEnv map[string]string) (*TerminalSession, error) {
-	shell := defaultShell()
+func (s *TerminalService) createLocked(sessionKey string, workingDir string, sandboxed bool, username string, extraEnv map[string]string, opts ShellOptions) (*TerminalSession, error) {
+	shell := opts.shell()
 	log.Printf("[TerminalService] createLocked shell=%s dir=%s sandboxed=%v user=%s key=%s", shell, workingDir, sandboxed, username, sessionKey)
 
+	spec, err := s.shellSpec(sessionKey, shell, workingDir, sandboxed, username, extraEnv)
+	if err != nil {
+		return nil, err
+	}
+	workingDir = spec.Dir
+
+	if s.UsePtyHolders {
+		hp, err := startPtyHolder(spec)
+		if err == nil {
+			session := s.addSessionLocked(sessionKey, hp, hp.hello.PID, workingDir, 80, 24)
+			session.typeStartupCommand(opts.StartupCommand)
+			return session, nil
+		}
+		log.Printf("[TerminalService] pty-holder failed, starting shell directly: %v key=%s", err, sessionKey)
+	}
+
+	p, err := gopty.New()
+	if err != nil {
+		return nil, err
+	}
+	cmd := p.Command(spec.Path, spec.Args...)
+	cmd.Dir = spec.Dir
+	cmd.Env = spec.Env
+	setCloneflags(cmd, spec.Cloneflags)
+	if spec.Cgroup != "" {
+		attr, cg, err := withCgroup(cmd.SysProcAttr, spec.Cgroup)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("terminal limits unavailable: %w", err)
+		}
+		defer cg.Close()
+		cmd.SysProcAttr = attr
+	}
+
+	if err := cmd.Start(); err != nil {
+		p.Close()
+		log.Printf("[TerminalService] cmd.Start failed: %v key=%s", err, sessionKey)
+		return nil, err
+	}
+
+	session := s.addSessionLocked(sessionKey, p, cmd.Process.Pid, workingDir, 80, 24)
+	session.Cmd = cmd
+	session.typeStartupCommand(opts.StartupCommand)
+
+	// Monitor process exit
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("[TerminalService] shell exited with error: %v (key=%s)", err, sessionKey)
+		} else {
+			log.Printf("[TerminalService] shell exited normally (key=%s)", sessionKey)
+		}
+		code := -1
+		if cmd.ProcessState != nil {
+			code = cmd.ProcessState.ExitCode()
+		}
+		s.shellExited(sessionKey, code)
+		// Close PTY to unblock pumpOutput's Read() — идемпотентно (см. closePty), чтобы не
+		// конфликтовать с CloseKeepScrollback/Close при пересоздании сессии.
+		session.closePty()
+	}()
+
+	return session, nil
+}
+
+// typeStartupCommand types a profile's startup command into the new shell,
+// as if the user did: the tty buffers it until the shell reads its input, and
+// the shell stays when the command exits.
+func (ts *TerminalSession) typeStartupCommand(cmd string) {
+	if cmd == "" {
+		return
+	}
+	if _, err := ts.Pty.Write([]byte(cmd + "\r")); err != nil {
+		log.Printf("[TerminalService] startup command not sent: %v", err)
+	}
+}
+
+// shellSpec builds how a user's shell (or, with args, a command in it) is
+// started: working directory, environment and, for sandboxed users on Linux,
+// the sandbox wrapper. Shared by terminals and the exec API.
+func (s *TerminalService) shellSpec(sessionKey, shell, workingDir string, sandboxed bool, username string, extraEnv map[string]string, args ...string) (holderSpec, error) {
+	// A sandboxed user's shell must never land outside their workspace.
+	confined := sandboxed && runtime.GOOS == "linux"
+	if confined && s.Sandbox == nil {
+		return holderSpec{}, errors.New("terminal sandbox is not configured")
+	}
+
 	// Verify working directory exists, fall back to /tmp
 	if _, err := os.Stat(workingDir); err != nil {
-		log.Printf("Terminal: dir %s not found, fallback /tmp", workingDir)
-		workingDir = os.TempDir()
+		if confined {
+			if err := os.MkdirAll(workingDir, 0o755); err != nil {
+				return holderSpec{}, fmt.Errorf("workspace %s: %w", workingDir, err)
+			}
+		} else {
+			log.Printf("Terminal: dir %s not found, fallback /tmp", workingDir)
+			workingDir = os.TempDir()
+		}
 	}
 
 	// Ensure the project skills dir exists at session start so uploaded skills
@@ -466,30 +830,12 @@ func (s *TerminalService) createLocked(sessionKey string, workingDir string, san
 	// Ensure the "communication chats" dir exists so opening a new chat from the Chat
 	// window only needs `cd "<dir>" && claude` (no mkdir in the command). Best-effort.
 	os.MkdirAll(filepath.Join(workingDir, ".nebulide_chats"), 0o755)
-
-	p, err := gopty.New()
-	if err != nil {
-		return nil, err
+	if confined {
+		s.Sandbox.Own(workingDir, filepath.Join(workingDir, ".claude"),
+			filepath.Join(workingDir, ".claude", "skills"), filepath.Join(workingDir, ".nebulide_chats"))
 	}
 
-	// On Linux with sandboxing, use sandboxed-shell wrapper that creates an
-	// isolated mount namespace hiding other users' workspaces.
-	var cmd *gopty.Cmd
-	if sandboxed && runtime.GOOS == "linux" {
-		sandboxScript := "/usr/local/bin/sandboxed-shell"
-		if _, err := os.Stat(sandboxScript); err == nil {
-			log.Printf("[TerminalService] using sandboxed shell for user=%s key=%s", username, sessionKey)
-			cmd = p.Command(sandboxScript, workingDir, username)
-			cmd.Dir = workingDir
-		} else {
-			log.Printf("[TerminalService] sandboxed-shell not found, falling back to direct shell key=%s", sessionKey)
-			cmd = p.Command(shell)
-			cmd.Dir = workingDir
-		}
-	} else {
-		cmd = p.Command(shell)
-		cmd.Dir = workingDir
-	}
+	spec := holderSpec{SessionKey: sessionKey, Path: shell, Args: args, Dir: workingDir}
 
 	// Build environment: ensure critical vars exist for shell init.
 	// ВАЖНО: фильтруем маркеры запущенного Claude Code (CLAUDECODE / CLAUDE_CODE_* /
@@ -515,6 +861,9 @@ func (s *TerminalService) createLocked(sessionKey string, workingDir string, san
 		if glmMode && k == "ANTHROPIC_API_KEY" {
 			continue
 		}
+		if confined && (sandboxSecretEnv[k] || k == "HOME" || k == "USER") {
+			continue
+		}
 		env = append(env, e)
 		has[k] = true
 	}
@@ -527,7 +876,11 @@ func (s *TerminalService) createLocked(sessionKey string, workingDir string, san
 			env = append(env, "HOME="+workingDir)
 		}
 		if !has["USER"] {
-			env = append(env, "USER=root")
+			if confined {
+				env = append(env, "USER="+username)
+			} else {
+				env = append(env, "USER=root")
+			}
 		}
 		if !has["SHELL"] {
 			env = append(env, "SHELL="+shell)
@@ -538,7 +891,9 @@ func (s *TerminalService) createLocked(sessionKey string, workingDir string, san
 		// Per-user bash history: persists across deploys in workspace directory.
 		histFile := filepath.Join(workingDir, ".nebulide_history")
 		env = append(env, "HISTFILE="+histFile, "HISTSIZE=10000", "HISTFILESIZE=20000")
-		env = append(env, "PROMPT_COMMAND=history -a; history -r")
+		// PROMPT_COMMAND keeps `history -a; history -r` and, with PS0, emits the
+		// OSC 133 / OSC 7 markers of the command log (see commandlog.go).
+		env = append(env, "PROMPT_COMMAND="+shellIntegrationPromptCommand, "PS0="+shellIntegrationPS0)
 	}
 	env = append(env, "TERM=xterm-256color", "COLORTERM=truecolor")
 	// Claude в fullscreen/flicker-free включает ЗАХВАТ МЫШИ → в обёрнутом xterm движения мыши флудят
@@ -549,44 +904,108 @@ func (s *TerminalService) createLocked(sessionKey string, workingDir string, san
 	for k, v := range extraEnv {
 		env = append(env, k+"="+v)
 	}
-	cmd.Env = env
+	spec.Env = env
 
-	if err := cmd.Start(); err != nil {
-		p.Close()
-		log.Printf("[TerminalService] cmd.Start failed: %v key=%s", err, sessionKey)
-		return nil, err
+	// Non-admin shells run in the native sandbox (see sandbox.go); no fallback.
+	if confined {
+		wrapped, err := s.Sandbox.Wrap(spec)
+		if err != nil {
+			log.Printf("[TerminalService] sandbox unavailable: %v key=%s", err, sessionKey)
+			return holderSpec{}, fmt.Errorf("terminal sandbox unavailable: %w", err)
+		}
+		log.Printf("[TerminalService] using sandbox for user=%s key=%s", username, sessionKey)
+		spec = wrapped
+	}
+	// Sandboxed shells start inside their owner's cgroup; without it they
+	// don't start at all.
+	if sandboxed && s.Cgroups != nil {
+		uid, _ := parseSessionKey(sessionKey)
+		dir, err := s.Cgroups.Prepare(uid)
+		if err != nil {
+			log.Printf("[TerminalService] cgroup for user=%s: %v key=%s", username, err, sessionKey)
+			return holderSpec{}, fmt.Errorf("terminal limits unavailable: %w", err)
+		}
+		spec.Cgroup = dir
 	}
+	return spec, nil
+}
 
+// addSessionLocked registers a session for a started shell and starts its
+// output pump. A holder-backed shell ends when the holder reports its exit.
+func (s *TerminalService) addSessionLocked(sessionKey string, p sessionPty, pid int, workDir string, cols, rows int) *TerminalSession {
 	session := &TerminalSession{
 		Pty:         p,
-		Cmd:         cmd,
 		Done:        make(chan struct{}),
-		mw:          newMultiWriter(scrollbackPath(sessionKey)),
+		pid:         pid,
+		mw:          newMultiWriter(sessionKey, s.ScrollbackMaxBytes, cols, rows),
 		OrphanSince: time.Now(), // starts orphaned until a WebSocket connects
-		WorkDir:     workingDir,
+		WorkDir:     workDir,
+		recordings:  s.Recordings,
 	}
 
-	log.Printf("[TerminalService] shell started pid=%d key=%s", cmd.Process.Pid, sessionKey)
+	log.Printf("[TerminalService] shell started pid=%d key=%s", pid, sessionKey)
+
+	if s.Recordings != nil && s.Recordings.RecordByDefault {
+		if rec, id, err := s.Recordings.start(sessionKey, 0, 0); err == nil {
+			session.rec, session.recID = rec, id
+		} else {
+			log.Printf("[TerminalService] recording start failed: %v key=%s", err, sessionKey)
+		}
+	}
+
+	if s.Triggers != nil {
+		session.triggers = s.Triggers.scanner(sessionKey)
+	}
+
+	// A local shell's exit is reported by the cmd.Wait goroutine; a holder
+	// sends the status right before its output ends.
+	if hp, ok := p.(*holderPty); ok {
+		go func() {
+			<-session.Done
+			s.shellExited(sessionKey, hp.exitCode)
+		}()
+	}
 
 	// Single persistent PTY reader — survives WS reconnections.
 	// Writes to multiWriter which broadcasts to all attached clients.
 	go session.pumpOutput(sessionKey)
 
-	// Monitor process exit
-	go func() {
-		if err := cmd.Wait(); err != nil {
-			log.Printf("[TerminalService] shell exited with error: %v (key=%s)", err, sessionKey)
-		} else {
-			log.Printf("[TerminalService] shell exited normally (key=%s)", sessionKey)
-		}
-		// Close PTY to unblock pumpOutput's Read() — идемпотентно (см. closePty), чтобы не
-		// конфликтовать с CloseKeepScrollback/Close при пересоздании сессии.
-		session.closePty()
-	}()
-
 	s.sessions[sessionKey] = session
 	log.Printf("[TerminalService] session stored key=%s totalSessions=%d", sessionKey, len(s.sessions))
-	return session, nil
+	return session
+}
+
+func (s *TerminalService) shellExited(sessionKey string, code int) {
+	if s.OnShellExited == nil {
+		return
+	}
+	uid, iid := parseSessionKey(sessionKey)
+	if uid != "" {
+		go s.OnShellExited(uid, iid, code)
+	}
+}
+
+// AdoptHolders reattaches to the pty-holders left by a previous backend
+// process. Their shells become live sessions again, so the next GetOrCreate
+// for the key reattaches instead of spawning a fresh shell.
+func (s *TerminalService) AdoptHolders() int {
+	holders := findHolders()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	adopted := 0
+	for _, hp := range holders {
+		key := hp.hello.SessionKey
+		if _, exists := s.sessions[key]; exists || key == "" {
+			hp.conn.Close()
+			continue
+		}
+		session := s.addSessionLocked(key, hp, hp.hello.PID, hp.hello.WorkDir, hp.hello.Cols, hp.hello.Rows)
+		session.lastCols, session.lastRows = uint16(hp.hello.Cols), uint16(hp.hello.Rows)
+		log.Printf("[TerminalService] adopted pty-holder pid=%d started=%s key=%s",
+			hp.hello.PID, hp.hello.StartedAt.Format(time.RFC3339), key)
+		adopted++
+	}
+	return adopted
 }
 
 // pumpOutput is the single goroutine that reads PTY output and broadcasts it
@@ -603,10 +1022,19 @@ func (ts *TerminalSession) pumpOutput(sessionKey string) {
 			}
 			break
 		}
-		// Broadcast to all connected WebSocket clients (and buffer in replayBuf)
+		// Broadcast to all connected WebSocket clients (and feed the screen model)
 		ts.mw.Write(buf[:n])
+		if ts.triggers != nil {
+			ts.triggers.Feed(buf[:n])
+		}
+		ts.mu.Lock()
+		if ts.rec != nil {
+			ts.rec.Output(buf[:n])
+		}
+		ts.mu.Unlock()
 	}
 	log.Printf("[TerminalService] pumpOutput STOP key=%s", sessionKey)
+	ts.stopRecording()
 	close(ts.Done)
 }
 
@@ -650,28 +1078,207 @@ func (s *TerminalService) Resize(sessionKey string, rows, cols uint16) error {
 	}
 	session.lastCols = cols
 	session.lastRows = rows
+	if session.rec != nil {
+		session.rec.Resize(int(cols), int(rows))
+	}
 	session.mu.Unlock()
+	session.mw.Resize(int(cols), int(rows))
 
 	return session.Pty.Resize(int(cols), int(rows))
 }
 
+// SearchScrollback pages through a session's scrollback log (see
+// scrollbackLog.Search). Works for live sessions and for logs left on disk by
+// sessions that are not running (e.g. after a container restart).
+func (s *TerminalService) SearchScrollback(sessionKey, q string, before int64, limit int) (ScrollbackPage, bool) {
+	s.mu.RLock()
+	session, ok := s.sessions[sessionKey]
+	s.mu.RUnlock()
+	if ok {
+		return session.mw.log.Search(q, before, limit), true
+	}
+
+	dir := scrollbackLogDir(sessionKey)
+	if _, err := os.Stat(dir); err != nil {
+		return ScrollbackPage{}, false
+	}
+	return loadScrollbackLog(dir, 0).Search(q, before, limit), true
+}
+
+// ListCommands returns a terminal's shell-integration command log, oldest
+// first. Like SearchScrollback it also works for sessions that are not running.
+func (s *TerminalService) ListCommands(sessionKey string) ([]TerminalCommand, bool) {
+	s.mu.RLock()
+	session, ok := s.sessions[sessionKey]
+	s.mu.RUnlock()
+	if ok {
+		return session.mw.cmds.List(), true
+	}
+	dir := scrollbackLogDir(sessionKey)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, false
+	}
+	return openCommandLog(dir).List(), true
+}
+
+// CommandOutput returns a logged command and its output from the scrollback
+// log (at most maxBytes from the start of the output).
+func (s *TerminalService) CommandOutput(sessionKey string, seq int, maxBytes int64) (TerminalCommand, CommandOutput, bool) {
+	s.mu.RLock()
+	session, live := s.sessions[sessionKey]
+	s.mu.RUnlock()
+
+	var cl *commandLog
+	var sl *scrollbackLog
+	if live {
+		cl, sl = session.mw.cmds, session.mw.log
+	} else {
+		dir := scrollbackLogDir(sessionKey)
+		if _, err := os.Stat(dir); err != nil {
+			return TerminalCommand{}, CommandOutput{}, false
+		}
+		cl, sl = openCommandLog(dir), loadScrollbackLog(dir, 0)
+	}
+	cmd, ok := cl.Get(seq)
+	if !ok {
+		return cmd, CommandOutput{}, false
+	}
+	return cmd, readCommandOutput(sl, cmd, maxBytes), true
+}
+
+// StartRecording begins an asciicast recording of a live session.
+// Returns the recording ID; if the session is already being recorded, returns the existing ID.
+func (s *TerminalService) StartRecording(sessionKey string) (string, error) {
+	if s.Recordings == nil {
+		return "", fmt.Errorf("recordings are disabled")
+	}
+	s.mu.RLock()
+	session, ok := s.sessions[sessionKey]
+	s.mu.RUnlock()
+	if !ok || !session.IsAlive() {
+		return "", fmt.Errorf("terminal session not found")
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.rec != nil {
+		return session.recID, nil
+	}
+	rec, id, err := s.Recordings.start(sessionKey, int(session.lastCols), int(session.lastRows))
+	if err != nil {
+		return "", err
+	}
+	session.rec, session.recID = rec, id
+	return id, nil
+}
+
+// StopRecording finishes the active recording of a session.
+// Returns the recording ID, or "" if the session wasn't being recorded.
+func (s *TerminalService) StopRecording(sessionKey string) string {
+	s.mu.RLock()
+	session, ok := s.sessions[sessionKey]
+	s.mu.RUnlock()
+	if !ok {
+		return ""
+	}
+	return session.stopRecording()
+}
+
+// stopRecording closes the active recording (if any) and returns its ID.
+func (ts *TerminalSession) stopRecording() string {
+	ts.mu.Lock()
+	rec, id := ts.rec, ts.recID
+	ts.rec, ts.recID = nil, ""
+	ts.mu.Unlock()
+	if rec == nil {
+		return ""
+	}
+	if ts.recordings != nil {
+		ts.recordings.finish(rec)
+	} else {
+		rec.Close()
+	}
+	return id
+}
+
+// RecordingID returns the ID of the active recording, or "" if not recording.
+func (ts *TerminalSession) RecordingID() string {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.recID
+}
+
 // HasChildProcesses returns true if the shell has child processes running
 // (e.g. claude CLI). Uses platform-specific /proc check on Linux.
 func (ts *TerminalSession) HasChildProcesses() bool {
-	if ts.Cmd == nil || ts.Cmd.Process == nil {
+	if ts.pid <= 0 {
 		return false
 	}
-	return hasChildProcesses(ts.Cmd.Process.Pid)
+	return hasChildProcesses(ts.pid)
 }
 
 // HasClaudeChild walks the process tree from the shell and returns true
 // only if a descendant matches a "claude" binary by argv. Used to drive
 // pet reconciliation — vim/top/ssh inside the shell don't trigger pets.
 func (ts *TerminalSession) HasClaudeChild() bool {
-	if ts.Cmd == nil || ts.Cmd.Process == nil {
+	if ts.pid <= 0 {
 		return false
 	}
-	return hasClaudeProcess(ts.Cmd.Process.Pid)
+	return hasClaudeProcess(ts.pid)
+}
+
+// Errors of SignalProcess.
+var (
+	ErrBadSignal     = errors.New("signal must be one of SIGINT, SIGTERM, SIGSTOP, SIGCONT")
+	ErrNotDescendant = errors.New("process is not running in this terminal")
+)
+
+// ProcessTree returns a live terminal's shell followed by its descendants
+// (parents before children). In a sandboxed terminal these include the
+// orphans sandbox-init adopted; sandbox-init itself is not listed.
+func (s *TerminalService) ProcessTree(sessionKey string) ([]ProcessInfo, bool) {
+	session, ok := s.Get(sessionKey)
+	if !ok || !session.IsAlive() || session.pid <= 0 {
+		return nil, false
+	}
+	shell := terminalShellPid(session.pid)
+	cmdline, _ := readCmdline(shell)
+	tree := []ProcessInfo{{PID: shell, Cmdline: cmdline}}
+	for _, p := range descendantProcs(session.pid) {
+		if p.PID != shell {
+			tree = append(tree, p)
+		}
+	}
+	return tree, true
+}
+
+// SignalProcess sends a signal ("SIGINT", "term", ...) to a descendant of a
+// terminal's shell; the shell itself (and a sandboxed terminal's
+// sandbox-init) is off limits, so the terminal survives.
+func (s *TerminalService) SignalProcess(sessionKey string, pid int, signal string) error {
+	name := strings.ToUpper(signal)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	switch name {
+	case "SIGINT", "SIGTERM", "SIGSTOP", "SIGCONT":
+	default:
+		return ErrBadSignal
+	}
+	session, ok := s.Get(sessionKey)
+	if !ok || !session.IsAlive() {
+		return ErrNotDescendant
+	}
+	if pid == terminalShellPid(session.pid) {
+		return ErrNotDescendant
+	}
+	for _, p := range descendantProcs(session.pid) {
+		if p.PID == pid {
+			log.Printf("[TerminalService] %s → pid=%d (%s) key=%s", name, pid, p.Cmdline, sessionKey)
+			return sendSignal(pid, name)
+		}
+	}
+	return ErrNotDescendant
 }
 
 // IsAlive returns true if the shell process is still running.
@@ -685,11 +1292,14 @@ func (ts *TerminalSession) IsAlive() bool {
 }
 
 // AddWriter registers a new WS connection to receive PTY output.
-// The replay buffer is flushed to the new writer so it sees current terminal state.
+// A snapshot of the screen model is sent to the new writer so it sees current terminal state.
 // wsId (workspace session id from frontend) is used to dedupe stale writers on reconnect.
 func (ts *TerminalSession) AddWriter(w io.Writer, closer io.Closer, wsId string) {
 	log.Printf("[TerminalService] AddWriter: registering %p wsId=%s", w, wsId)
 	ts.mw.Add(w, closer, wsId)
+	if _, ok := w.(SpectatorWriter); ok {
+		return // watching doesn't make the session attached
+	}
 	// Clear orphan timer — a client is connected
 	ts.mu.Lock()
 	ts.OrphanSince = time.Time{}
@@ -707,13 +1317,38 @@ func (ts *TerminalSession) RemoveWriter(w io.Writer) {
 	// If no writers left, start orphan timer
 	if ts.mw.Count() == 0 {
 		ts.mu.Lock()
-		ts.OrphanSince = time.Now()
+		orphaned := ts.OrphanSince.IsZero()
+		if orphaned {
+			ts.OrphanSince = time.Now()
+		}
 		ts.mu.Unlock()
-		log.Printf("[TerminalService] session orphaned (0 writers)")
+		if orphaned {
+			log.Printf("[TerminalService] session orphaned (0 writers)")
+		}
 	}
 }
 
-// WriterCount returns the number of active WebSocket connections to this session.
+// Cwd returns the shell's current directory as last reported by the shell
+// integration (OSC 7), or the directory it started in.
+func (ts *TerminalSession) Cwd() string {
+	if cwd := ts.mw.cmds.Cwd(); cwd != "" {
+		return cwd
+	}
+	return ts.WorkDir
+}
+
+// DrainWriter waits up to timeout for queued output to reach w.
+func (ts *TerminalSession) DrainWriter(w io.Writer, timeout time.Duration) {
+	ts.mw.Drain(w, timeout)
+}
+
+// WriterStats returns per-writer queue and lag statistics.
+func (ts *TerminalSession) WriterStats() []WriterStats {
+	return ts.mw.Stats()
+}
+
+// WriterCount returns the number of active WebSocket connections to this
+// session, not counting spectators.
 func (ts *TerminalSession) WriterCount() int {
 	return ts.mw.Count()
 }
@@ -739,8 +1374,8 @@ func (ts *TerminalSession) closePty() {
 // killProcessTree kills the shell and all its child processes.
 // Platform-specific: see terminal_kill_unix.go / terminal_kill_windows.go.
 func (ts *TerminalSession) killProcessTree() {
-	if ts.Cmd != nil && ts.Cmd.Process != nil {
-		killProcessGroup(ts.Cmd.Process.Pid)
+	if ts.pid > 0 {
+		killProcessGroup(ts.pid)
 	}
 	ts.closePty()
 }
@@ -749,8 +1384,8 @@ func (ts *TerminalSession) killProcessTree() {
 // Used when shell dies or container restarts — scrollback survives for replay.
 func (ts *TerminalSession) CloseKeepScrollback() {
 	ts.mw.Stop()
-	if ts.Cmd != nil && ts.Cmd.Process != nil {
-		killProcessGroup(ts.Cmd.Process.Pid)
+	if ts.pid > 0 {
+		killProcessGroup(ts.pid)
 	}
 	ts.closePty()
 }
@@ -766,6 +1401,10 @@ type SessionInfo struct {
 	Alive          bool   `json:"alive"`
 	HasChildren    bool   `json:"has_children"`     // shell has any child process (vim, claude, etc.)
 	HasClaudeChild bool   `json:"has_claude_child"` // shell has a `claude` descendant specifically
+
+	Watched []WatchedProcess `json:"watched,omitempty"` // running processes matched by the user's watchers
+
+	Writers []WriterStats `json:"writers,omitempty"` // per-writer output lag (admin listing)
 }
 
 // parseSessionKey splits "term:{userID}:{instanceId}" into parts.
@@ -799,6 +1438,7 @@ func (s *TerminalService) ListSessions() []SessionInfo {
 			UserID:     uid,
 			InstanceID: iid,
 			Alive:      sess.IsAlive(),
+			Writers:    sess.WriterStats(),
 		})
 	}
 	return result
@@ -824,12 +1464,20 @@ func (s *TerminalService) ListUserSessions(userID string) []SessionInfo {
 				Alive:          sess.IsAlive(),
 				HasChildren:    sess.HasChildProcesses(),
 				HasClaudeChild: sess.HasClaudeChild(),
+				Watched:        s.watchedIn(key),
 			})
 		}
 	}
 	return result
 }
 
+func (s *TerminalService) watchedIn(sessionKey string) []WatchedProcess {
+	if s.Watchers == nil {
+		return nil
+	}
+	return s.Watchers.Running(sessionKey)
+}
+
 // KillSessionsByPrefix terminates all sessions whose key starts with prefix.
 // Returns the number of killed sessions.
 func (s *TerminalService) KillSessionsByPrefix(prefix string) int {
@@ -923,6 +1571,8 @@ type SessionProcessInfo struct {
 	HasChildren        bool      `json:"has_children"`
 	LastWriterAttachAt time.Time `json:"last_writer_attach_at"`
 	Suspicious         bool      `json:"suspicious"`
+
+	Writers []WriterStats `json:"writers"`
 }
 
 // ListSessionsWithPID returns all sessions with their process PIDs.
@@ -942,15 +1592,13 @@ func (s *TerminalService) ListSessionsWithPID() []SessionProcessInfo {
 		writers     int
 		hasChildren bool
 		lastAttach  time.Time
+		writerStats []WriterStats
 	}
 	raws := make([]rawInfo, 0, len(s.sessions))
 	maxAttachByUser := make(map[string]time.Time)
 	for key, sess := range s.sessions {
 		uid, iid := parseSessionKey(key)
-		pid := 0
-		if sess.Cmd != nil && sess.Cmd.Process != nil {
-			pid = sess.Cmd.Process.Pid
-		}
+		pid := sess.pid
 		sess.mu.Lock()
 		la := sess.LastWriterAttachAt
 		sess.mu.Unlock()
@@ -960,6 +1608,7 @@ func (s *TerminalService) ListSessionsWithPID() []SessionProcessInfo {
 			writers:     sess.WriterCount(),
 			hasChildren: sess.HasChildProcesses(),
 			lastAttach:  la,
+			writerStats: sess.WriterStats(),
 		})
 		if !la.IsZero() && la.After(maxAttachByUser[uid]) {
 			maxAttachByUser[uid] = la
@@ -989,6 +1638,7 @@ func (s *TerminalService) ListSessionsWithPID() []SessionProcessInfo {
 			HasChildren:        r.hasChildren,
 			LastWriterAttachAt: r.lastAttach,
 			Suspicious:         suspicious,
+			Writers:            r.writerStats,
 		})
 	}
 	return result
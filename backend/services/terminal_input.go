@@ -0,0 +1,119 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── Input broadcast ──
+//
+// SendInput types the same text into several terminals at once (`/compact`
+// to every Claude, `git pull` everywhere), the way xterm.js pastes it.
+
+const (
+	pasteStart = "\x1b[200~"
+	pasteEnd   = "\x1b[201~"
+
+	// enterDelay separates a paste from the Enter that submits it; a TUI
+	// reading both in one chunk may take the Enter as part of the paste.
+	enterDelay = 50 * time.Millisecond
+)
+
+// Values of InputResult.Error besides write errors.
+const (
+	InputNotFound   = "not_found"   // no such terminal
+	InputNotRunning = "not_running" // its shell has exited
+)
+
+// InputResult is the outcome of SendInput for one terminal.
+type InputResult struct {
+	InstanceID string `json:"instance_id"`
+	Delivered  bool   `json:"delivered"`
+	Bracketed  bool   `json:"bracketed"` // sent as a bracketed paste
+	Error      string `json:"error,omitempty"`
+}
+
+// SendInput writes text to each of a user's terminals as a paste: newlines
+// become CR, and the text is wrapped in bracketed-paste markers where the
+// foreground app enabled them (readline, Claude Code), so it is inserted
+// rather than run line by line. With enter, an Enter follows to submit it.
+func (s *TerminalService) SendInput(userID string, instanceIDs []string, text string, enter bool) []InputResult {
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\r"), "\n", "\r")
+
+	results := make([]InputResult, len(instanceIDs))
+	sessions := make([]*TerminalSession, len(instanceIDs))
+	delivered := 0
+	for i, iid := range instanceIDs {
+		r := &results[i]
+		r.InstanceID = iid
+		ts, ok := s.Get("term:" + userID + ":" + iid)
+		if !ok {
+			r.Error = InputNotFound
+			continue
+		}
+		if !ts.IsAlive() {
+			r.Error = InputNotRunning
+			continue
+		}
+		data := text
+		if r.Bracketed = ts.mw.bracketedPaste(); r.Bracketed {
+			data = pasteStart + strings.ReplaceAll(text, pasteEnd, "") + pasteEnd
+		}
+		if data != "" {
+			if _, err := ts.Pty.Write([]byte(data)); err != nil {
+				r.Error = err.Error()
+				continue
+			}
+		}
+		r.Delivered = true
+		sessions[i] = ts
+		delivered++
+	}
+
+	if enter && delivered > 0 {
+		if text != "" {
+			time.Sleep(enterDelay)
+		}
+		for i, ts := range sessions {
+			if ts == nil {
+				continue
+			}
+			if _, err := ts.Pty.Write([]byte("\r")); err != nil {
+				results[i].Delivered, results[i].Error = false, err.Error()
+			}
+		}
+	}
+	return results
+}
+
+// WorkspaceTerminals returns the instanceIds of a user's terminals last
+// attached from a workspace session.
+func (s *TerminalService) WorkspaceTerminals(userID, workspaceID string) []string {
+	prefix := "term:" + userID + ":"
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ids []string
+	for key, sess := range s.sessions {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		sess.mu.Lock()
+		match := sess.WorkspaceID == workspaceID
+		sess.mu.Unlock()
+		if match {
+			_, iid := parseSessionKey(key)
+			ids = append(ids, iid)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// bracketedPaste reports whether the app in the terminal enabled bracketed
+// paste (DECSET 2004).
+func (mw *multiWriter) bracketedPaste() bool {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	return mw.screen.bracketedPaste
+}
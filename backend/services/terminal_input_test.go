@@ -0,0 +1,45 @@
+package services
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// inputPty records what is typed into a terminal.
+type inputPty struct{ bufWriter }
+
+func (p *inputPty) Read([]byte) (int, error)       { return 0, io.EOF }
+func (p *inputPty) Resize(width, height int) error { return nil }
+
+func TestSendInput_BracketedWhereEnabled(t *testing.T) {
+	shell, claude, dead := &inputPty{}, &inputPty{}, &inputPty{}
+	s := &TerminalService{sessions: map[string]*TerminalSession{}}
+	add := func(iid string, p *inputPty, wsID string) *TerminalSession {
+		ts := &TerminalSession{Pty: p, Done: make(chan struct{}), mw: newTestMultiWriter(t), WorkspaceID: wsID}
+		s.sessions["term:u1:"+iid] = ts
+		return ts
+	}
+	add("t1", shell, "ws-a")
+	add("t2", claude, "ws-a").mw.Write([]byte("\x1b[?2004h> "))
+	close(add("t3", dead, "ws-b").Done)
+
+	assert.Equal(t, []string{"t1", "t2"}, s.WorkspaceTerminals("u1", "ws-a"))
+	assert.Empty(t, s.WorkspaceTerminals("u2", "ws-a"))
+
+	results := s.SendInput("u1", []string{"t1", "t2", "t3", "t4"}, "git pull\n/compact", true)
+	assert.Equal(t, []InputResult{
+		{InstanceID: "t1", Delivered: true},
+		{InstanceID: "t2", Delivered: true, Bracketed: true},
+		{InstanceID: "t3", Error: InputNotRunning},
+		{InstanceID: "t4", Error: InputNotFound},
+	}, results)
+	assert.Equal(t, "git pull\r/compact\r", shell.String())
+	assert.Equal(t, "\x1b[200~git pull\r/compact\x1b[201~\r", claude.String())
+	assert.Empty(t, dead.String())
+
+	// A paste cannot be ended early by the text itself.
+	s.SendInput("u1", []string{"t2"}, "a\x1b[201~b", false)
+	assert.Equal(t, "\x1b[200~ab\x1b[201~", claude.String()[len("\x1b[200~git pull\r/compact\x1b[201~\r"):])
+}
@@ -32,6 +32,14 @@ func killProcessGroup(pid int) {
 	syscall.Kill(pid, syscall.SIGKILL)
 }
 
+// hangupShell sends SIGHUP to a shell, as if its terminal went away: the
+// shell passes it on to its jobs and exits.
+func hangupShell(pid int) {
+	if pid > 0 {
+		syscall.Kill(pid, syscall.SIGHUP)
+	}
+}
+
 // collectDescendants walks /proc to find all child PIDs recursively.
 func collectDescendants(pid int) []int {
 	var result []int
@@ -115,3 +123,106 @@ func isClaudeCmdline(data []byte) bool {
 	}
 	return false
 }
+
+// ProcessInfo is one process in a terminal's process tree.
+type ProcessInfo struct {
+	PID     int
+	PPID    int
+	Cmdline string // argv joined with spaces
+}
+
+// maxTreeProcs caps how many descendants descendantProcs returns.
+const maxTreeProcs = 256
+
+// descendantProcs lists the descendants of rootPid (BFS, parents before
+// children). Processes that exit during the walk are skipped.
+func descendantProcs(rootPid int) []ProcessInfo {
+	if rootPid <= 0 {
+		return nil
+	}
+	var out []ProcessInfo
+	queue := []int{rootPid}
+	visited := map[int]bool{rootPid: true}
+	for len(queue) > 0 && len(out) < maxTreeProcs {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, pid := range getChildPids(parent) {
+			if visited[pid] || len(out) >= maxTreeProcs {
+				continue
+			}
+			visited[pid] = true
+			cmdline, ok := readCmdline(pid)
+			if !ok {
+				continue
+			}
+			out = append(out, ProcessInfo{PID: pid, PPID: parent, Cmdline: cmdline})
+			queue = append(queue, pid)
+		}
+	}
+	return out
+}
+
+// readCmdline returns a process's argv joined with spaces; false if it is gone.
+func readCmdline(pid int) (string, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " ")), true
+}
+
+// terminalShellPid returns the shell of a terminal whose process is pid. A
+// sandboxed terminal's process is sandbox-init, PID 1 of the sandbox's PID
+// namespace, and the shell is its oldest child: orphans the init adopted are
+// its children too, but they were forked after the shell, so they have higher
+// PIDs in that namespace.
+func terminalShellPid(pid int) int {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if argv := strings.Split(string(data), "\x00"); err != nil || len(argv) < 2 || argv[1] != "sandbox-init" {
+		return pid
+	}
+	shell, lowest := pid, 0
+	for _, child := range getChildPids(pid) {
+		if n := innermostPid(child); n > 0 && (lowest == 0 || n < lowest) {
+			shell, lowest = child, n
+		}
+	}
+	return shell
+}
+
+// innermostPid returns pid as seen in the process's own PID namespace (the
+// last NSpid of /proc/<pid>/status), or 0 if unknown.
+func innermostPid(pid int) int {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "NSpid:"); ok {
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				return 0
+			}
+			n, _ := strconv.Atoi(fields[len(fields)-1])
+			return n
+		}
+	}
+	return 0
+}
+
+// userSignals are the signals users may send to processes in their terminals.
+var userSignals = map[string]syscall.Signal{
+	"SIGINT":  syscall.SIGINT,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGSTOP": syscall.SIGSTOP,
+	"SIGCONT": syscall.SIGCONT,
+}
+
+// sendSignal delivers one of userSignals to pid.
+func sendSignal(pid int, name string) error {
+	sig, ok := userSignals[name]
+	if !ok {
+		return ErrBadSignal
+	}
+	return syscall.Kill(pid, sig)
+}
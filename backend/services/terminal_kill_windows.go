@@ -2,7 +2,10 @@
 
 package services
 
-import "os"
+import (
+	"fmt"
+	"os"
+)
 
 // hasChildProcesses on Windows always returns true (can't check /proc).
 func hasChildProcesses(_ int) bool { return true }
@@ -11,6 +14,34 @@ func hasChildProcesses(_ int) bool { return true }
 // extra dependencies). Production runs Linux/Alpine — this is a dev-only stub.
 func hasClaudeProcess(_ int) bool { return false }
 
+// ProcessInfo is one process in a terminal's process tree.
+type ProcessInfo struct {
+	PID     int
+	PPID    int
+	Cmdline string
+}
+
+// descendantProcs on Windows returns nothing (no /proc); dev-only stub.
+func descendantProcs(_ int) []ProcessInfo { return nil }
+
+// terminalShellPid on Windows: no sandbox, the process is the shell.
+func terminalShellPid(pid int) int { return pid }
+
+// readCmdline on Windows is unknown (dev-only stub).
+func readCmdline(_ int) (string, bool) { return "", true }
+
+// sendSignal on Windows: ConPTY children have no POSIX signals.
+func sendSignal(_ int, _ string) error {
+	return fmt.Errorf("signals are not supported on windows")
+}
+
+// hangupShell on Windows: no SIGHUP, the shell is killed.
+func hangupShell(pid int) {
+	if pid > 0 {
+		killProcessGroup(pid)
+	}
+}
+
 // killProcessGroup on Windows just kills the direct process.
 // ConPTY doesn't have Unix process groups.
 func killProcessGroup(pid int) {
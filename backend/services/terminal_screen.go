@@ -0,0 +1,30 @@
+package services
+
+// ScreenSnapshot is what a terminal shows right now, from the session's
+// screen model (see vtscreen.go).
+type ScreenSnapshot struct {
+	Cols      int    `json:"cols"`
+	Rows      int    `json:"rows"`
+	Title     string `json:"title,omitempty"`
+	AltScreen bool   `json:"alt_screen"` // a full-screen app (vim, Claude's TUI) is up
+	Text      string `json:"text"`
+	HTML      string `json:"html,omitempty"`
+}
+
+// Screen returns the visible screen of a terminal, rendered as HTML too if
+// withHTML is set.
+func (s *TerminalService) Screen(sessionKey string, withHTML bool) (ScreenSnapshot, bool) {
+	ts, ok := s.Get(sessionKey)
+	if !ok {
+		return ScreenSnapshot{}, false
+	}
+	mw := ts.mw
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+	scr := mw.screen
+	snap := ScreenSnapshot{Cols: scr.cols, Rows: scr.rows, Title: scr.title, AltScreen: scr.altActive, Text: scr.Text()}
+	if withHTML {
+		snap.HTML = scr.HTML()
+	}
+	return snap, true
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package services
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminal_ProcessTreeAndSignal(t *testing.T) {
+	sh, child := startShell(t)
+	s := &TerminalService{sessions: map[string]*TerminalSession{
+		"term:u1:t1": {pid: sh.Process.Pid, Done: make(chan struct{})},
+	}}
+
+	tree, ok := s.ProcessTree("term:u1:t1")
+	require.True(t, ok)
+	require.Len(t, tree, 2)
+	assert.Equal(t, sh.Process.Pid, tree[0].PID)
+	assert.Equal(t, 0, tree[0].PPID)
+	assert.Equal(t, child, tree[1].PID)
+	assert.Equal(t, sh.Process.Pid, tree[1].PPID)
+
+	_, ok = s.ProcessTree("term:u2:t1")
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, s.SignalProcess("term:u1:t1", child, "SIGKILL"), ErrBadSignal)
+	assert.ErrorIs(t, s.SignalProcess("term:u1:t1", sh.Process.Pid, "SIGTERM"), ErrNotDescendant, "the shell itself")
+	assert.ErrorIs(t, s.SignalProcess("term:u2:t1", child, "SIGTERM"), ErrNotDescendant, "another user's terminal")
+
+	// The shell survives its child being interrupted and runs the next command.
+	require.NoError(t, s.SignalProcess("term:u1:t1", child, "int"))
+	require.NoError(t, sh.Wait())
+}
+
+func TestTerminal_ProcessTreeSandboxed(t *testing.T) {
+	sb := newTestSandbox(t, nil)
+	dir, err := os.MkdirTemp("/var/tmp", "sandbox-test-")
+	if err != nil {
+		t.Skipf("no /var/tmp: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, 0o755)
+	spec, err := sb.Wrap(holderSpec{Path: "/bin/sh", Args: []string{"-c", "sleep 30; true"}, Dir: dir})
+	require.NoError(t, err)
+	init := exec.Command(spec.Path, spec.Args...)
+	init.SysProcAttr = &syscall.SysProcAttr{Cloneflags: spec.Cloneflags}
+	require.NoError(t, init.Start())
+	t.Cleanup(func() { init.Process.Kill(); init.Wait() })
+	s := &TerminalService{sessions: map[string]*TerminalSession{
+		"term:u1:t1": {pid: init.Process.Pid, Done: make(chan struct{})},
+	}}
+
+	// The shell, not sandbox-init, is the root.
+	var tree []ProcessInfo
+	require.Eventually(t, func() bool {
+		tree, _ = s.ProcessTree("term:u1:t1")
+		return len(tree) == 2 && tree[1].Cmdline == "sleep 30"
+	}, 5*time.Second, 10*time.Millisecond)
+	shell := tree[0].PID
+	assert.NotEqual(t, init.Process.Pid, shell)
+	assert.True(t, strings.HasPrefix(tree[0].Cmdline, "/bin/sh"), tree[0].Cmdline)
+	assert.Equal(t, shell, tree[1].PPID)
+
+	assert.ErrorIs(t, s.SignalProcess("term:u1:t1", shell, "SIGSTOP"), ErrNotDescendant, "the shell")
+	assert.ErrorIs(t, s.SignalProcess("term:u1:t1", init.Process.Pid, "SIGSTOP"), ErrNotDescendant, "sandbox-init")
+	require.NoError(t, s.SignalProcess("term:u1:t1", tree[1].PID, "SIGTERM"))
+	require.NoError(t, init.Wait())
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"nebulide/database"
+	"nebulide/models"
+)
+
+// ── Output triggers ──
+//
+// Per-user regex rules (models.TerminalTrigger) matched against the output of
+// the user's terminals as pumpOutput reads it. Output is split into lines and
+// stripped of escape sequences before matching. A match is debounced per rule
+// and terminal, then handed to OnMatch (main publishes it as terminal_trigger).
+
+const (
+	triggerDefaultDebounce = 30 * time.Second
+	triggerMinDebounce     = time.Second
+	triggerMaxLine         = 4096 // longer lines are matched by their beginning
+	triggerMaxPattern      = 512
+	triggerEventLine       = 500 // chars of the matched line sent with the event
+)
+
+// TriggerMatch is one debounced match of a rule.
+type TriggerMatch struct {
+	TriggerID  string
+	Name       string
+	Action     string
+	UserID     string
+	InstanceID string
+	Line       string
+	Time       time.Time
+}
+
+type compiledTrigger struct {
+	models.TerminalTrigger
+	re *regexp.Regexp
+}
+
+type TriggerService struct {
+	// OnMatch is called in its own goroutine for every match that passed the debounce.
+	OnMatch func(TriggerMatch)
+
+	mu    sync.Mutex
+	rules map[string][]*compiledTrigger // by user ID; absent: not loaded yet
+	gen   map[string]int                // bumped by Invalidate, guards a load racing with it
+	last  map[string]time.Time          // rule ID + session key → last match
+}
+
+func NewTriggerService() *TriggerService {
+	return &TriggerService{
+		rules: make(map[string][]*compiledTrigger),
+		gen:   make(map[string]int),
+		last:  make(map[string]time.Time),
+	}
+}
+
+// CompileTriggerPattern validates and compiles a rule's pattern.
+func CompileTriggerPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern is empty")
+	}
+	if len(pattern) > triggerMaxPattern {
+		return nil, fmt.Errorf("pattern is longer than %d bytes", triggerMaxPattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// Invalidate drops a user's cached rules after they changed; they are loaded
+// again with the next output of the user's terminals.
+func (s *TriggerService) Invalidate(userID string) {
+	s.mu.Lock()
+	delete(s.rules, userID)
+	s.gen[userID]++
+	s.mu.Unlock()
+}
+
+func (s *TriggerService) rulesFor(userID string) []*compiledTrigger {
+	s.mu.Lock()
+	rules, ok := s.rules[userID]
+	gen := s.gen[userID]
+	s.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	rules = loadTriggers(userID)
+	s.mu.Lock()
+	if s.gen[userID] == gen {
+		s.rules[userID] = rules
+	}
+	s.mu.Unlock()
+	return rules
+}
+
+func loadTriggers(userID string) []*compiledTrigger {
+	if database.DB == nil {
+		return nil
+	}
+	var rows []models.TerminalTrigger
+	if err := database.DB.Where("user_id = ? AND enabled = ?", userID, true).Find(&rows).Error; err != nil {
+		log.Printf("[Triggers] load user=%s: %v", userID, err)
+		return nil
+	}
+	rules := make([]*compiledTrigger, 0, len(rows))
+	for _, r := range rows {
+		re, err := CompileTriggerPattern(r.Pattern)
+		if err != nil {
+			log.Printf("[Triggers] skipping trigger=%s: %v", r.ID, err)
+			continue
+		}
+		rules = append(rules, &compiledTrigger{TerminalTrigger: r, re: re})
+	}
+	return rules
+}
+
+// fire applies the debounce and dispatches a match.
+func (s *TriggerService) fire(r *compiledTrigger, sessionKey, userID, instanceID, line string) {
+	period := time.Duration(r.DebounceSec) * time.Second
+	if r.DebounceSec == 0 {
+		period = triggerDefaultDebounce
+	}
+	period = max(period, triggerMinDebounce)
+
+	key := r.ID.String() + "|" + sessionKey
+	now := time.Now()
+	s.mu.Lock()
+	if now.Sub(s.last[key]) < period {
+		s.mu.Unlock()
+		return
+	}
+	s.last[key] = now
+	if len(s.last) > 10000 {
+		for k, t := range s.last {
+			if now.Sub(t) > time.Hour {
+				delete(s.last, k)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if len(line) > triggerEventLine {
+		line = strings.ToValidUTF8(line[:triggerEventLine], "")
+	}
+	log.Printf("[Triggers] trigger=%s action=%s matched key=%s", r.ID, r.Action, sessionKey)
+	if s.OnMatch != nil {
+		go s.OnMatch(TriggerMatch{
+			TriggerID:  r.ID.String(),
+			Name:       r.Name,
+			Action:     r.Action,
+			UserID:     userID,
+			InstanceID: instanceID,
+			Line:       line,
+			Time:       now,
+		})
+	}
+}
+
+// triggerScanner splits one terminal's output into lines for matching.
+// Used only by the session's pumpOutput goroutine.
+type triggerScanner struct {
+	s          *TriggerService
+	sessionKey string
+	userID     string
+	instanceID string
+	line       []byte
+}
+
+func (s *TriggerService) scanner(sessionKey string) *triggerScanner {
+	userID, instanceID := parseSessionKey(sessionKey)
+	return &triggerScanner{s: s, sessionKey: sessionKey, userID: userID, instanceID: instanceID}
+}
+
+// Feed matches every line completed by p against the user's rules.
+func (sc *triggerScanner) Feed(p []byte) {
+	rules := sc.s.rulesFor(sc.userID)
+	if len(rules) == 0 {
+		sc.line = sc.line[:0]
+		return
+	}
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			sc.appendLine(p)
+			return
+		}
+		sc.appendLine(p[:i])
+		sc.match(rules)
+		sc.line = sc.line[:0]
+		p = p[i+1:]
+	}
+}
+
+func (sc *triggerScanner) appendLine(p []byte) {
+	if room := triggerMaxLine - len(sc.line); room > 0 {
+		sc.line = append(sc.line, p[:min(len(p), room)]...)
+	}
+}
+
+func (sc *triggerScanner) match(rules []*compiledTrigger) {
+	text := stripANSI(sc.line)
+	if text == "" {
+		return
+	}
+	for _, r := range rules {
+		if r.InstanceID != "" && r.InstanceID != sc.instanceID {
+			continue
+		}
+		if r.re.MatchString(text) {
+			sc.s.fire(r, sc.sessionKey, sc.userID, sc.instanceID, text)
+		}
+	}
+}
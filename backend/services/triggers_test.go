@@ -0,0 +1,85 @@
+package services
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"nebulide/models"
+)
+
+func newTestTriggers(t *testing.T, userID string, rules ...models.TerminalTrigger) (*TriggerService, func() []TriggerMatch) {
+	t.Helper()
+	s := NewTriggerService()
+	var mu sync.Mutex
+	var got []TriggerMatch
+	s.OnMatch = func(m TriggerMatch) {
+		mu.Lock()
+		got = append(got, m)
+		mu.Unlock()
+	}
+	for _, r := range rules {
+		r.ID = uuid.New()
+		s.rules[userID] = append(s.rules[userID], &compiledTrigger{TerminalTrigger: r, re: regexp.MustCompile(r.Pattern)})
+	}
+	return s, func() []TriggerMatch {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]TriggerMatch(nil), got...)
+	}
+}
+
+func TestTriggers_MatchesLinesAcrossChunks(t *testing.T) {
+	s, matches := newTestTriggers(t, "u1",
+		models.TerminalTrigger{Name: "fail", Pattern: `FAIL(ED)?\b`, Action: models.TriggerNotify},
+		models.TerminalTrigger{Name: "other tab", Pattern: `FAIL`, InstanceID: "t2", Action: models.TriggerSync},
+	)
+	sc := s.scanner("term:u1:t1")
+
+	sc.Feed([]byte("ok 1\r\n\x1b[31mFA"))
+	assert.Empty(t, matches(), "unfinished line is not matched")
+	sc.Feed([]byte("IL\x1b[0m pkg/foo\r\n"))
+
+	require.Eventually(t, func() bool { return len(matches()) == 1 }, time.Second, 5*time.Millisecond)
+	m := matches()[0]
+	assert.Equal(t, "fail", m.Name)
+	assert.Equal(t, "u1", m.UserID)
+	assert.Equal(t, "t1", m.InstanceID)
+	assert.Equal(t, "FAIL pkg/foo", m.Line)
+}
+
+func TestTriggers_Debounce(t *testing.T) {
+	s, matches := newTestTriggers(t, "u1",
+		models.TerminalTrigger{Pattern: `error`, Action: models.TriggerNotify, DebounceSec: 60},
+	)
+	a, b := s.scanner("term:u1:a"), s.scanner("term:u1:b")
+	a.Feed([]byte("error 1\nerror 2\nerror 3\n"))
+	b.Feed([]byte("error in b\n"))
+
+	// Debounced per terminal: one match each
+	require.Eventually(t, func() bool { return len(matches()) == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, matches(), 2)
+}
+
+func TestTriggers_InvalidateReloads(t *testing.T) {
+	s, _ := newTestTriggers(t, "u1", models.TerminalTrigger{Pattern: `x`, Action: models.TriggerSync})
+	require.Len(t, s.rulesFor("u1"), 1)
+	s.Invalidate("u1")
+	_, cached := s.rules["u1"]
+	assert.False(t, cached)
+}
+
+func TestCompileTriggerPattern(t *testing.T) {
+	_, err := CompileTriggerPattern("")
+	assert.Error(t, err)
+	_, err = CompileTriggerPattern("(unclosed")
+	assert.Error(t, err)
+	_, err = CompileTriggerPattern(`(?i)build (failed|error)`)
+	assert.NoError(t, err)
+}
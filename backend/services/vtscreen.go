@@ -0,0 +1,1475 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ── vtScreen: headless VT100/xterm emulator ──
+//
+// Tracks what a real terminal would show for the PTY output stream: both
+// screen buffers, scrollback, cursor, SGR pen, scroll region and the modes a
+// client has to know about (application cursor keys, bracketed paste, mouse
+// reporting, ...). Snapshot() synthesizes an escape stream that reproduces the
+// state on a fresh xterm, so reconnecting clients see full-screen apps (vim,
+// Claude's TUI) exactly as they are instead of a replayed byte tail.
+//
+// Query sequences (DA, DSR, ...) are consumed but never re-emitted, so a
+// snapshot can't make xterm answer into the shell's stdin.
+
+const vtDefaultScrollback = 2000 // lines of primary-buffer history kept for replay
+
+// vtColor: 0 = default, colorIndexed|n = palette index, colorRGB|0xRRGGBB = truecolor.
+type vtColor uint32
+
+const (
+	colorIndexed vtColor = 1 << 24
+	colorRGB     vtColor = 2 << 24
+	colorKind    vtColor = 0xff << 24
+)
+
+const (
+	attrBold uint16 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrInverse
+	attrHidden
+	attrStrike
+)
+
+type vtAttr struct {
+	fg, bg vtColor
+	flags  uint16
+}
+
+type vtCell struct {
+	r    rune   // 0 = never written (renders as space)
+	comb []rune // combining marks attached to r
+	attr vtAttr
+	wide bool // first half of a double-width rune
+	cont bool // second half of a double-width rune (r unused)
+}
+
+type vtLine struct {
+	cells []vtCell
+	// wrapped is set when the text continues on the next line via autowrap
+	// (as opposed to an explicit CR/LF).
+	wrapped bool
+}
+
+type vtSavedCursor struct {
+	valid       bool
+	x, y        int
+	attr        vtAttr
+	originMode  bool
+	wrapPending bool
+	charsets    [2]byte
+	gl          int
+}
+
+type vtBuffer struct {
+	lines []*vtLine
+	saved vtSavedCursor
+}
+
+const (
+	vtGround = iota
+	vtEscape
+	vtEscInter
+	vtCSI
+	vtOSC
+	vtOSCEsc
+	vtString // DCS / SOS / PM / APC — ignored until ST
+	vtStringEsc
+)
+
+type vtScreen struct {
+	cols, rows int
+
+	primary, alt *vtBuffer
+	buf          *vtBuffer // active buffer
+	altActive    bool
+
+	scrollback    []*vtLine
+	maxScrollback int
+
+	cx, cy      int
+	wrapPending bool
+	attr        vtAttr
+	top, bottom int // scroll region, 0-based inclusive
+	tabs        []bool
+
+	// Modes
+	appCursor      bool // DECCKM ?1
+	reverseVideo   bool // DECSCNM ?5
+	originMode     bool // DECOM ?6
+	autowrap       bool // DECAWM ?7
+	cursorHidden   bool // DECTCEM ?25 reset
+	bracketedPaste bool // ?2004
+	appKeypad      bool // DECKPAM
+	insertMode     bool // IRM 4
+	newlineMode    bool // LNM 20
+	mouseModes     map[int]bool
+	cursorStyle    int // DECSCUSR, 0 = default
+
+	charsets [2]byte // G0/G1: 'B' = ASCII, '0' = DEC special graphics
+	gl       int     // 0 = G0 active, 1 = G1 (SO)
+
+	title string
+	last  rune // last printed rune, for REP
+
+	// fed counts bytes written so far; multiWriter aligns it with scrollback
+	// offsets. onOSC, if set, sees every complete OSC with the offsets of its
+	// first and one-past-last byte (used for shell integration, see commandlog.go).
+	fed      int64
+	oscStart int64
+	onOSC    func(cmd int, payload string, start, end int64)
+
+	// Parser state
+	state   int
+	utf8buf []byte
+	params  []byte
+	inter   []byte
+	oscBuf  []byte
+}
+
+// Mouse / focus reporting modes that are restored in a snapshot, in the order
+// they should be enabled (protocol first, encoding after).
+var vtMouseModes = []int{9, 1000, 1001, 1002, 1003, 1004, 1005, 1006, 1015, 1016}
+
+func newVTScreen(cols, rows int) *vtScreen {
+	if cols < 2 || rows < 2 {
+		cols, rows = 80, 24
+	}
+	s := &vtScreen{cols: cols, rows: rows, maxScrollback: vtDefaultScrollback}
+	s.reset()
+	return s
+}
+
+// reset performs RIS. Scrollback history is kept.
+func (s *vtScreen) reset() {
+	s.primary = s.newBuffer()
+	s.alt = s.newBuffer()
+	s.buf = s.primary
+	s.altActive = false
+	s.cx, s.cy = 0, 0
+	s.wrapPending = false
+	s.attr = vtAttr{}
+	s.top, s.bottom = 0, s.rows-1
+	s.resetTabs()
+	s.appCursor, s.reverseVideo, s.originMode = false, false, false
+	s.autowrap = true
+	s.cursorHidden, s.bracketedPaste, s.appKeypad = false, false, false
+	s.insertMode, s.newlineMode = false, false
+	s.mouseModes = make(map[int]bool)
+	s.cursorStyle = 0
+	s.charsets = [2]byte{'B', 'B'}
+	s.gl = 0
+	s.title = ""
+}
+
+func (s *vtScreen) newBuffer() *vtBuffer {
+	b := &vtBuffer{lines: make([]*vtLine, s.rows)}
+	for i := range b.lines {
+		b.lines[i] = s.blankLine(vtAttr{})
+	}
+	return b
+}
+
+func (s *vtScreen) blankLine(a vtAttr) *vtLine {
+	l := &vtLine{cells: make([]vtCell, s.cols)}
+	if a.bg != 0 {
+		for i := range l.cells {
+			l.cells[i].attr.bg = a.bg
+		}
+	}
+	return l
+}
+
+func (s *vtScreen) resetTabs() {
+	s.tabs = make([]bool, s.cols)
+	for i := 8; i < s.cols; i += 8 {
+		s.tabs[i] = true
+	}
+}
+
+// ── Input ──
+
+// Write feeds PTY output into the emulator. Never fails.
+func (s *vtScreen) Write(p []byte) (int, error) {
+	for _, b := range p {
+		s.fed++
+		s.feed(b)
+	}
+	return len(p), nil
+}
+
+func (s *vtScreen) feed(b byte) {
+	// A pending UTF-8 sequence only continues in ground state.
+	if len(s.utf8buf) > 0 {
+		if b&0xc0 == 0x80 {
+			s.utf8buf = append(s.utf8buf, b)
+			if utf8.FullRune(s.utf8buf) {
+				r, _ := utf8.DecodeRune(s.utf8buf)
+				s.utf8buf = s.utf8buf[:0]
+				s.print(r)
+			}
+			return
+		}
+		s.utf8buf = s.utf8buf[:0]
+		s.print(utf8.RuneError)
+	}
+
+	switch s.state {
+	case vtGround:
+		switch {
+		case b == 0x1b:
+			s.state = vtEscape
+		case b < 0x20 || b == 0x7f:
+			s.execute(b)
+		case b < 0x80:
+			s.print(rune(b))
+		default:
+			s.utf8buf = append(s.utf8buf, b)
+			if utf8.FullRune(s.utf8buf) {
+				r, _ := utf8.DecodeRune(s.utf8buf)
+				s.utf8buf = s.utf8buf[:0]
+				s.print(r)
+			}
+		}
+
+	case vtEscape:
+		s.params = s.params[:0]
+		s.inter = s.inter[:0]
+		switch {
+		case b == '[':
+			s.state = vtCSI
+		case b == ']':
+			s.oscBuf = s.oscBuf[:0]
+			s.oscStart = s.fed - 2
+			s.state = vtOSC
+		case b == 'P' || b == 'X' || b == '^' || b == '_':
+			s.state = vtString
+		case b >= 0x20 && b <= 0x2f:
+			s.inter = append(s.inter, b)
+			s.state = vtEscInter
+		case b == 0x1b:
+			// stay in escape
+		case b < 0x20:
+			s.execute(b)
+		default:
+			s.state = vtGround
+			s.escDispatch(b)
+		}
+
+	case vtEscInter:
+		switch {
+		case b >= 0x20 && b <= 0x2f:
+			s.inter = append(s.inter, b)
+		case b == 0x1b:
+			s.state = vtEscape
+		case b < 0x20:
+			s.execute(b)
+		default:
+			s.state = vtGround
+			s.escDispatch(b)
+		}
+
+	case vtCSI:
+		switch {
+		case b >= 0x30 && b <= 0x3f:
+			if len(s.params) < 256 {
+				s.params = append(s.params, b)
+			}
+		case b >= 0x20 && b <= 0x2f:
+			s.inter = append(s.inter, b)
+		case b >= 0x40 && b <= 0x7e:
+			s.state = vtGround
+			s.csiDispatch(b)
+		case b == 0x1b:
+			s.state = vtEscape
+		case b == 0x18 || b == 0x1a:
+			s.state = vtGround
+		case b < 0x20:
+			s.execute(b)
+		}
+
+	case vtOSC:
+		switch b {
+		case 0x07:
+			s.state = vtGround
+			s.oscDispatch()
+		case 0x1b:
+			s.state = vtOSCEsc
+		case 0x18, 0x1a:
+			s.state = vtGround
+		default:
+			if len(s.oscBuf) < 4096 {
+				s.oscBuf = append(s.oscBuf, b)
+			}
+		}
+
+	case vtOSCEsc:
+		s.oscDispatch()
+		if b == '\\' {
+			s.state = vtGround
+		} else {
+			s.state = vtEscape
+			s.feed(b)
+		}
+
+	case vtString:
+		switch b {
+		case 0x1b:
+			s.state = vtStringEsc
+		case 0x07, 0x18, 0x1a:
+			s.state = vtGround
+		}
+
+	case vtStringEsc:
+		if b == '\\' {
+			s.state = vtGround
+		} else if b != 0x1b {
+			s.state = vtString
+		}
+	}
+}
+
+// execute handles C0 control characters.
+func (s *vtScreen) execute(b byte) {
+	switch b {
+	case 0x08: // BS
+		if s.cx > 0 {
+			s.cx--
+		}
+		s.wrapPending = false
+	case 0x09: // HT
+		s.tabForward(1)
+	case 0x0a, 0x0b, 0x0c: // LF, VT, FF
+		s.index()
+		if s.newlineMode {
+			s.cx = 0
+		}
+	case 0x0d: // CR
+		s.cx = 0
+		s.wrapPending = false
+	case 0x0e: // SO
+		s.gl = 1
+	case 0x0f: // SI
+		s.gl = 0
+	}
+}
+
+// ── Printing ──
+
+// decSpecialGraphics maps DEC line-drawing characters (ESC ( 0) to Unicode.
+var decSpecialGraphics = map[rune]rune{
+	'`': '◆', 'a': '▒', 'b': '␉', 'c': '␌', 'd': '␍', 'e': '␊', 'f': '°', 'g': '±',
+	'h': '␤', 'i': '␋', 'j': '┘', 'k': '┐', 'l': '┌', 'm': '└', 'n': '┼', 'o': '⎺',
+	'p': '⎻', 'q': '─', 'r': '⎼', 's': '⎽', 't': '├', 'u': '┤', 'v': '┴', 'w': '┬',
+	'x': '│', 'y': '≤', 'z': '≥', '{': 'π', '|': '≠', '}': '£', '~': '·',
+}
+
+func (s *vtScreen) print(r rune) {
+	if s.charsets[s.gl] == '0' {
+		if m, ok := decSpecialGraphics[r]; ok {
+			r = m
+		}
+	}
+	w := runeWidth(r)
+	if w == 0 {
+		s.combine(r)
+		return
+	}
+
+	if s.wrapPending && s.autowrap {
+		s.buf.lines[s.cy].wrapped = true
+		s.cx = 0
+		s.index()
+	}
+	s.wrapPending = false
+
+	if w == 2 && s.cx == s.cols-1 {
+		if s.autowrap {
+			// Doesn't fit: pad the last column and wrap early, like xterm.
+			s.putCell(s.cx, vtCell{attr: s.attr})
+			s.buf.lines[s.cy].wrapped = true
+			s.cx = 0
+			s.index()
+		} else {
+			s.cx = s.cols - 2
+		}
+	}
+
+	if s.insertMode {
+		s.insertCells(w)
+	}
+	s.putCell(s.cx, vtCell{r: r, attr: s.attr, wide: w == 2})
+	if w == 2 {
+		s.putCell(s.cx+1, vtCell{attr: s.attr, cont: true})
+	}
+	s.last = r
+
+	if s.cx+w >= s.cols {
+		s.cx = s.cols - 1
+		s.wrapPending = s.autowrap
+	} else {
+		s.cx += w
+	}
+}
+
+// combine attaches a zero-width rune to the previously printed cell.
+func (s *vtScreen) combine(r rune) {
+	x := s.cx
+	if !s.wrapPending {
+		x--
+	}
+	line := s.buf.lines[s.cy].cells
+	if x < 0 || x >= len(line) {
+		return
+	}
+	if line[x].cont && x > 0 {
+		x--
+	}
+	if line[x].r != 0 && len(line[x].comb) < 8 {
+		line[x].comb = append(line[x].comb, r)
+	}
+}
+
+// putCell writes a cell, clearing the other half of any wide rune it overlaps.
+func (s *vtScreen) putCell(x int, c vtCell) {
+	cells := s.buf.lines[s.cy].cells
+	if x < 0 || x >= len(cells) {
+		return
+	}
+	if cells[x].cont && x > 0 {
+		cells[x-1] = vtCell{attr: cells[x-1].attr}
+	}
+	if cells[x].wide && x+1 < len(cells) && !c.wide {
+		cells[x+1] = vtCell{attr: cells[x+1].attr}
+	}
+	cells[x] = c
+}
+
+// ── Cursor and scrolling ──
+
+func (s *vtScreen) index() {
+	if s.cy == s.bottom {
+		s.scrollUp(1)
+	} else if s.cy < s.rows-1 {
+		s.cy++
+	}
+}
+
+func (s *vtScreen) reverseIndex() {
+	if s.cy == s.top {
+		s.scrollDown(1)
+	} else if s.cy > 0 {
+		s.cy--
+	}
+	s.wrapPending = false
+}
+
+// scrollUp scrolls the region up by n lines. Lines leaving the top of the
+// primary screen go to scrollback.
+func (s *vtScreen) scrollUp(n int) {
+	s.scrollUpLines(n, s.top == 0 && !s.altActive)
+}
+
+func (s *vtScreen) scrollUpLines(n int, toHistory bool) {
+	height := s.bottom - s.top + 1
+	if n > height {
+		n = height
+	}
+	lines := s.buf.lines
+	for i := 0; i < n; i++ {
+		gone := lines[s.top]
+		copy(lines[s.top:s.bottom], lines[s.top+1:s.bottom+1])
+		lines[s.bottom] = s.blankLine(s.attr)
+		if toHistory {
+			s.pushScrollback(gone)
+		}
+	}
+}
+
+func (s *vtScreen) scrollDown(n int) {
+	height := s.bottom - s.top + 1
+	if n > height {
+		n = height
+	}
+	lines := s.buf.lines
+	for i := 0; i < n; i++ {
+		copy(lines[s.top+1:s.bottom+1], lines[s.top:s.bottom])
+		lines[s.top] = s.blankLine(s.attr)
+	}
+}
+
+func (s *vtScreen) pushScrollback(l *vtLine) {
+	if s.maxScrollback <= 0 {
+		return
+	}
+	s.scrollback = append(s.scrollback, l)
+	if over := len(s.scrollback) - s.maxScrollback; over > 0 {
+		// Copy down instead of reslicing so the backing array doesn't grow forever.
+		n := copy(s.scrollback, s.scrollback[over:])
+		for i := n; i < len(s.scrollback); i++ {
+			s.scrollback[i] = nil
+		}
+		s.scrollback = s.scrollback[:n]
+	}
+}
+
+func (s *vtScreen) tabForward(n int) {
+	for ; n > 0 && s.cx < s.cols-1; n-- {
+		s.cx++
+		for s.cx < s.cols-1 && !s.tabs[s.cx] {
+			s.cx++
+		}
+	}
+	s.wrapPending = false
+}
+
+func (s *vtScreen) tabBackward(n int) {
+	for ; n > 0 && s.cx > 0; n-- {
+		s.cx--
+		for s.cx > 0 && !s.tabs[s.cx] {
+			s.cx--
+		}
+	}
+	s.wrapPending = false
+}
+
+// moveTo positions the cursor; y is relative to the scroll region in origin mode.
+func (s *vtScreen) moveTo(x, y int) {
+	minY, maxY := 0, s.rows-1
+	if s.originMode {
+		y += s.top
+		minY, maxY = s.top, s.bottom
+	}
+	s.cx = clampInt(x, 0, s.cols-1)
+	s.cy = clampInt(y, minY, maxY)
+	s.wrapPending = false
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// ── Editing ──
+
+func (s *vtScreen) blank() vtCell {
+	return vtCell{attr: vtAttr{bg: s.attr.bg}}
+}
+
+func (s *vtScreen) eraseCells(y, from, to int) {
+	cells := s.buf.lines[y].cells
+	from = clampInt(from, 0, len(cells))
+	to = clampInt(to, 0, len(cells))
+	// Don't leave half of a wide rune behind
+	if from > 0 && from < len(cells) && cells[from].cont {
+		cells[from-1] = s.blank()
+	}
+	if to < len(cells) && cells[to].cont {
+		cells[to] = s.blank()
+	}
+	for x := from; x < to; x++ {
+		cells[x] = s.blank()
+	}
+}
+
+func (s *vtScreen) eraseLine(y int) {
+	s.eraseCells(y, 0, s.cols)
+	s.buf.lines[y].wrapped = false
+}
+
+func (s *vtScreen) insertCells(n int) {
+	cells := s.buf.lines[s.cy].cells
+	if n > s.cols-s.cx {
+		n = s.cols - s.cx
+	}
+	copy(cells[s.cx+n:], cells[s.cx:s.cols-n])
+	for x := s.cx; x < s.cx+n; x++ {
+		cells[x] = s.blank()
+	}
+}
+
+func (s *vtScreen) deleteCells(n int) {
+	cells := s.buf.lines[s.cy].cells
+	if n > s.cols-s.cx {
+		n = s.cols - s.cx
+	}
+	copy(cells[s.cx:], cells[s.cx+n:])
+	for x := s.cols - n; x < s.cols; x++ {
+		cells[x] = s.blank()
+	}
+}
+
+func (s *vtScreen) insertLines(n int) {
+	if s.cy < s.top || s.cy > s.bottom {
+		return
+	}
+	saved := s.top
+	s.top = s.cy
+	s.scrollDown(n)
+	s.top = saved
+	s.cx = 0
+	s.wrapPending = false
+}
+
+func (s *vtScreen) deleteLines(n int) {
+	if s.cy < s.top || s.cy > s.bottom {
+		return
+	}
+	saved := s.top
+	s.top = s.cy
+	s.scrollUpLines(n, false) // deleted lines never go to scrollback
+	s.top = saved
+	s.cx = 0
+	s.wrapPending = false
+}
+
+// ── Escape dispatch ──
+
+func (s *vtScreen) escDispatch(final byte) {
+	if len(s.inter) > 0 {
+		switch s.inter[0] {
+		case '(', ')':
+			g := 0
+			if s.inter[0] == ')' {
+				g = 1
+			}
+			if final == '0' {
+				s.charsets[g] = '0'
+			} else {
+				s.charsets[g] = 'B'
+			}
+		case '#':
+			if final == '8' { // DECALN: fill screen with E
+				for y := 0; y < s.rows; y++ {
+					for x := range s.buf.lines[y].cells {
+						s.buf.lines[y].cells[x] = vtCell{r: 'E'}
+					}
+				}
+			}
+		}
+		return
+	}
+	switch final {
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.cx = 0
+		s.index()
+	case 'M':
+		s.reverseIndex()
+	case 'H':
+		s.tabs[s.cx] = true
+	case 'c':
+		s.reset()
+	case '=':
+		s.appKeypad = true
+	case '>':
+		s.appKeypad = false
+	}
+}
+
+func (s *vtScreen) saveCursor() {
+	s.buf.saved = vtSavedCursor{
+		valid: true, x: s.cx, y: s.cy, attr: s.attr,
+		originMode: s.originMode, wrapPending: s.wrapPending,
+		charsets: s.charsets, gl: s.gl,
+	}
+}
+
+func (s *vtScreen) restoreCursor() {
+	sc := s.buf.saved
+	if !sc.valid {
+		s.cx, s.cy = 0, 0
+		s.attr = vtAttr{}
+		s.originMode = false
+		s.wrapPending = false
+		return
+	}
+	s.cx = clampInt(sc.x, 0, s.cols-1)
+	s.cy = clampInt(sc.y, 0, s.rows-1)
+	s.attr = sc.attr
+	s.originMode = sc.originMode
+	s.wrapPending = sc.wrapPending
+	s.charsets = sc.charsets
+	s.gl = sc.gl
+}
+
+// csiParams splits "1;2:3;;4" into [[1] [2 3] [-1] [4]]; -1 = omitted.
+func (s *vtScreen) csiParams() (prefix byte, ps [][]int) {
+	raw := s.params
+	if len(raw) > 0 && raw[0] >= '<' && raw[0] <= '?' {
+		prefix, raw = raw[0], raw[1:]
+	}
+	if len(raw) == 0 {
+		return prefix, nil
+	}
+	for _, group := range strings.Split(string(raw), ";") {
+		var sub []int
+		for _, v := range strings.Split(group, ":") {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				n = -1
+			}
+			if n > 65535 {
+				n = 65535
+			}
+			sub = append(sub, n)
+		}
+		ps = append(ps, sub)
+	}
+	return prefix, ps
+}
+
+// param returns the i-th parameter, or def if omitted or zero.
+func param(ps [][]int, i, def int) int {
+	if i >= len(ps) || ps[i][0] <= 0 {
+		return def
+	}
+	return ps[i][0]
+}
+
+func (s *vtScreen) csiDispatch(final byte) {
+	prefix, ps := s.csiParams()
+	if len(s.inter) > 0 {
+		switch {
+		case s.inter[0] == ' ' && final == 'q': // DECSCUSR
+			s.cursorStyle = param(ps, 0, 0)
+		case s.inter[0] == '!' && final == 'p': // DECSTR
+			s.softReset()
+		}
+		return
+	}
+	if prefix == '?' {
+		switch final {
+		case 'h':
+			s.setPrivateModes(ps, true)
+		case 'l':
+			s.setPrivateModes(ps, false)
+		}
+		return
+	}
+	if prefix != 0 {
+		// CSI > / CSI = / CSI < sequences (keyboard protocols, DA2/DA3) — queries and
+		// client-side settings we don't model.
+		return
+	}
+
+	n := param(ps, 0, 1)
+	switch final {
+	case '@':
+		s.insertCells(n)
+	case 'A':
+		s.cy = clampInt(s.cy-n, s.cursorMinY(), s.rows-1)
+		s.wrapPending = false
+	case 'B', 'e':
+		s.cy = clampInt(s.cy+n, 0, s.cursorMaxY())
+		s.wrapPending = false
+	case 'C', 'a':
+		s.cx = clampInt(s.cx+n, 0, s.cols-1)
+		s.wrapPending = false
+	case 'D':
+		s.cx = clampInt(s.cx-n, 0, s.cols-1)
+		s.wrapPending = false
+	case 'E':
+		s.cy = clampInt(s.cy+n, 0, s.cursorMaxY())
+		s.cx = 0
+		s.wrapPending = false
+	case 'F':
+		s.cy = clampInt(s.cy-n, s.cursorMinY(), s.rows-1)
+		s.cx = 0
+		s.wrapPending = false
+	case 'G', '`':
+		s.cx = clampInt(n-1, 0, s.cols-1)
+		s.wrapPending = false
+	case 'H', 'f':
+		s.moveTo(param(ps, 1, 1)-1, n-1)
+	case 'I':
+		s.tabForward(n)
+	case 'Z':
+		s.tabBackward(n)
+	case 'J':
+		s.eraseDisplay(param(ps, 0, 0))
+	case 'K':
+		switch param(ps, 0, 0) {
+		case 0:
+			s.eraseCells(s.cy, s.cx, s.cols)
+		case 1:
+			s.eraseCells(s.cy, 0, s.cx+1)
+		case 2:
+			s.eraseCells(s.cy, 0, s.cols)
+		}
+		s.wrapPending = false
+	case 'L':
+		s.insertLines(n)
+	case 'M':
+		s.deleteLines(n)
+	case 'P':
+		s.deleteCells(n)
+	case 'S':
+		s.scrollUp(n)
+	case 'T':
+		if len(ps) <= 1 { // CSI Ps ; Ps ; ... T with 5 params is mouse tracking
+			s.scrollDown(n)
+		}
+	case 'X':
+		s.eraseCells(s.cy, s.cx, s.cx+n)
+		s.wrapPending = false
+	case 'b': // REP
+		if s.last != 0 {
+			if n > s.cols*s.rows {
+				n = s.cols * s.rows
+			}
+			for i := 0; i < n; i++ {
+				s.print(s.last)
+			}
+		}
+	case 'd':
+		s.moveTo(s.cx, n-1)
+	case 'g':
+		switch param(ps, 0, 0) {
+		case 0:
+			s.tabs[s.cx] = false
+		case 3:
+			for i := range s.tabs {
+				s.tabs[i] = false
+			}
+		}
+	case 'h', 'l':
+		on := final == 'h'
+		for _, p := range ps {
+			switch p[0] {
+			case 4:
+				s.insertMode = on
+			case 20:
+				s.newlineMode = on
+			}
+		}
+	case 'm':
+		s.sgr(ps)
+	case 'r':
+		top, bottom := param(ps, 0, 1)-1, param(ps, 1, s.rows)-1
+		if bottom > s.rows-1 {
+			bottom = s.rows - 1
+		}
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		if len(ps) == 0 {
+			s.saveCursor()
+		}
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+func (s *vtScreen) cursorMinY() int {
+	if s.cy >= s.top {
+		return s.top
+	}
+	return 0
+}
+
+func (s *vtScreen) cursorMaxY() int {
+	if s.cy <= s.bottom {
+		return s.bottom
+	}
+	return s.rows - 1
+}
+
+func (s *vtScreen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseCells(s.cy, s.cx, s.cols)
+		for y := s.cy + 1; y < s.rows; y++ {
+			s.eraseLine(y)
+		}
+	case 1:
+		for y := 0; y < s.cy; y++ {
+			s.eraseLine(y)
+		}
+		s.eraseCells(s.cy, 0, s.cx+1)
+	case 2:
+		for y := 0; y < s.rows; y++ {
+			s.eraseLine(y)
+		}
+	case 3:
+		s.scrollback = nil
+	}
+	s.wrapPending = false
+}
+
+func (s *vtScreen) softReset() {
+	s.cursorHidden = false
+	s.insertMode = false
+	s.originMode = false
+	s.autowrap = true
+	s.appCursor = false
+	s.appKeypad = false
+	s.top, s.bottom = 0, s.rows-1
+	s.attr = vtAttr{}
+	s.charsets = [2]byte{'B', 'B'}
+	s.gl = 0
+	s.buf.saved = vtSavedCursor{}
+	s.wrapPending = false
+}
+
+func (s *vtScreen) setPrivateModes(ps [][]int, on bool) {
+	for _, p := range ps {
+		switch m := p[0]; m {
+		case 1:
+			s.appCursor = on
+		case 5:
+			s.reverseVideo = on
+		case 6:
+			s.originMode = on
+			s.moveTo(0, 0)
+		case 7:
+			s.autowrap = on
+			if !on {
+				s.wrapPending = false
+			}
+		case 25:
+			s.cursorHidden = !on
+		case 47, 1047:
+			s.switchBuffer(on, m == 1047 && !on)
+		case 1048:
+			if on {
+				s.saveCursor()
+			} else {
+				s.restoreCursor()
+			}
+		case 1049:
+			if on {
+				if !s.altActive {
+					s.saveCursor()
+					s.switchBuffer(true, false)
+					s.clearBuffer(s.alt)
+				}
+			} else if s.altActive {
+				s.switchBuffer(false, false)
+				s.restoreCursor()
+			}
+		case 2004:
+			s.bracketedPaste = on
+		default:
+			for _, mm := range vtMouseModes {
+				if mm == m {
+					if on {
+						s.mouseModes[m] = true
+					} else {
+						delete(s.mouseModes, m)
+					}
+				}
+			}
+		}
+	}
+}
+
+// switchBuffer activates the alternate (on) or primary buffer. clearAlt wipes
+// the alternate buffer on the way out (mode 1047).
+func (s *vtScreen) switchBuffer(on, clearAlt bool) {
+	if on == s.altActive {
+		return
+	}
+	if !on && clearAlt {
+		s.clearBuffer(s.alt)
+	}
+	s.altActive = on
+	if on {
+		s.buf = s.alt
+	} else {
+		s.buf = s.primary
+	}
+	s.wrapPending = false
+}
+
+func (s *vtScreen) clearBuffer(b *vtBuffer) {
+	for i := range b.lines {
+		b.lines[i] = s.blankLine(vtAttr{})
+	}
+}
+
+// sgr applies Select Graphic Rendition parameters to the pen.
+func (s *vtScreen) sgr(ps [][]int) {
+	if len(ps) == 0 {
+		s.attr = vtAttr{}
+		return
+	}
+	for i := 0; i < len(ps); i++ {
+		p := ps[i]
+		switch v := p[0]; {
+		case v <= 0:
+			s.attr = vtAttr{}
+		case v == 1:
+			s.attr.flags |= attrBold
+		case v == 2:
+			s.attr.flags |= attrDim
+		case v == 3:
+			s.attr.flags |= attrItalic
+		case v == 4:
+			if len(p) > 1 && p[1] == 0 {
+				s.attr.flags &^= attrUnderline
+			} else {
+				s.attr.flags |= attrUnderline
+			}
+		case v == 5 || v == 6:
+			s.attr.flags |= attrBlink
+		case v == 7:
+			s.attr.flags |= attrInverse
+		case v == 8:
+			s.attr.flags |= attrHidden
+		case v == 9:
+			s.attr.flags |= attrStrike
+		case v == 21:
+			s.attr.flags |= attrUnderline
+		case v == 22:
+			s.attr.flags &^= attrBold | attrDim
+		case v == 23:
+			s.attr.flags &^= attrItalic
+		case v == 24:
+			s.attr.flags &^= attrUnderline
+		case v == 25:
+			s.attr.flags &^= attrBlink
+		case v == 27:
+			s.attr.flags &^= attrInverse
+		case v == 28:
+			s.attr.flags &^= attrHidden
+		case v == 29:
+			s.attr.flags &^= attrStrike
+		case v >= 30 && v <= 37:
+			s.attr.fg = colorIndexed | vtColor(v-30)
+		case v == 38 || v == 48:
+			var c vtColor
+			var ok bool
+			if len(p) > 1 {
+				c, ok = extColor(p[1:]) // colon form: 38:5:n / 38:2::r:g:b
+			} else {
+				var used int
+				c, ok, used = extColorSemicolon(ps[i+1:])
+				i += used
+			}
+			if ok {
+				if v == 38 {
+					s.attr.fg = c
+				} else {
+					s.attr.bg = c
+				}
+			}
+		case v == 39:
+			s.attr.fg = 0
+		case v >= 40 && v <= 47:
+			s.attr.bg = colorIndexed | vtColor(v-40)
+		case v == 49:
+			s.attr.bg = 0
+		case v >= 90 && v <= 97:
+			s.attr.fg = colorIndexed | vtColor(v-90+8)
+		case v >= 100 && v <= 107:
+			s.attr.bg = colorIndexed | vtColor(v-100+8)
+		}
+	}
+}
+
+// extColor parses colon sub-parameters after 38/48: [5 n] or [2 (cs) r g b].
+func extColor(sub []int) (vtColor, bool) {
+	switch sub[0] {
+	case 5:
+		if len(sub) >= 2 && sub[1] >= 0 {
+			return colorIndexed | vtColor(sub[1]&0xff), true
+		}
+	case 2:
+		rgb := sub[1:]
+		if len(rgb) >= 4 { // with colorspace id
+			rgb = rgb[1:]
+		}
+		if len(rgb) >= 3 {
+			return rgbColor(rgb[0], rgb[1], rgb[2]), true
+		}
+	}
+	return 0, false
+}
+
+// extColorSemicolon parses the legacy 38;5;n / 38;2;r;g;b form.
+func extColorSemicolon(rest [][]int) (vtColor, bool, int) {
+	if len(rest) == 0 {
+		return 0, false, 0
+	}
+	switch rest[0][0] {
+	case 5:
+		if len(rest) >= 2 && rest[1][0] >= 0 {
+			return colorIndexed | vtColor(rest[1][0]&0xff), true, 2
+		}
+		return 0, false, len(rest)
+	case 2:
+		if len(rest) >= 4 {
+			return rgbColor(rest[1][0], rest[2][0], rest[3][0]), true, 4
+		}
+		return 0, false, len(rest)
+	}
+	return 0, false, 1
+}
+
+func rgbColor(r, g, b int) vtColor {
+	clamp := func(v int) vtColor { return vtColor(clampInt(v, 0, 255)) }
+	return colorRGB | clamp(r)<<16 | clamp(g)<<8 | clamp(b)
+}
+
+func (s *vtScreen) oscDispatch() {
+	data := string(s.oscBuf)
+	cmdStr, payload := data, ""
+	if i := strings.IndexByte(data, ';'); i >= 0 {
+		cmdStr, payload = data[:i], data[i+1:]
+	}
+	cmd, err := strconv.Atoi(cmdStr)
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case 0, 2:
+		s.title = payload
+	}
+	if s.onOSC != nil {
+		s.onOSC(cmd, payload, s.oscStart, s.fed)
+	}
+}
+
+// ── Resize ──
+
+// Resize changes the screen size. Lines are truncated or padded (no reflow);
+// when the primary screen shrinks, lines above the cursor move to scrollback.
+func (s *vtScreen) Resize(cols, rows int) {
+	if cols < 2 || rows < 2 || (cols == s.cols && rows == s.rows) {
+		return
+	}
+	for _, b := range []*vtBuffer{s.primary, s.alt} {
+		for _, l := range b.lines {
+			l.cells = resizeCells(l.cells, cols)
+		}
+	}
+
+	if rows < s.rows {
+		// Keep the cursor on screen: drop lines from the top first
+		shift := s.cy - (rows - 1)
+		if shift < 0 {
+			shift = 0
+		}
+		for _, l := range s.primary.lines[:shift] {
+			s.pushScrollback(l)
+		}
+		s.primary.lines = append([]*vtLine(nil), s.primary.lines[shift:shift+rows]...)
+		if s.altActive {
+			s.alt.lines = append([]*vtLine(nil), s.alt.lines[shift:shift+rows]...)
+		} else {
+			s.alt.lines = s.alt.lines[:rows]
+		}
+		s.cy -= shift
+		s.primary.saved.y -= shift
+		s.alt.saved.y -= shift
+	}
+	s.cols, s.rows = cols, rows
+	for _, b := range []*vtBuffer{s.primary, s.alt} {
+		for len(b.lines) < rows {
+			b.lines = append(b.lines, s.blankLine(vtAttr{}))
+		}
+		b.saved.x = clampInt(b.saved.x, 0, cols-1)
+		b.saved.y = clampInt(b.saved.y, 0, rows-1)
+	}
+	s.cx = clampInt(s.cx, 0, cols-1)
+	s.cy = clampInt(s.cy, 0, rows-1)
+	s.top, s.bottom = 0, rows-1
+	s.wrapPending = false
+	s.resetTabs()
+}
+
+func resizeCells(cells []vtCell, cols int) []vtCell {
+	if len(cells) >= cols {
+		cells = cells[:cols]
+		if cols > 0 && cells[cols-1].wide {
+			cells[cols-1] = vtCell{}
+		}
+		return cells
+	}
+	return append(cells, make([]vtCell, cols-len(cells))...)
+}
+
+// ── Snapshot ──
+
+// Snapshot returns an escape stream that, written to a freshly reset xterm of
+// the same size, reproduces scrollback, both buffers, cursor, pen and modes.
+func (s *vtScreen) Snapshot() []byte {
+	var sb strings.Builder
+	sb.WriteString("\x1bc") // RIS: start from a clean terminal
+
+	// Primary buffer: history then screen, as flowing text so the client's
+	// own scrollback fills up naturally.
+	lines := make([]*vtLine, 0, len(s.scrollback)+s.rows)
+	lines = append(lines, s.scrollback...)
+	lines = append(lines, s.primary.lines...)
+	for i, l := range lines {
+		last := i == len(lines)-1
+		writeLine(&sb, l, !l.wrapped || last)
+		if !last && !l.wrapped {
+			sb.WriteString("\r\n")
+		}
+	}
+
+	if s.altActive {
+		// 1049 saves the primary cursor on the client too
+		sc := s.primary.saved
+		writeCUP(&sb, sc.x, sc.y)
+		sb.WriteString("\x1b[?1049h")
+		for y, l := range s.alt.lines {
+			writeCUP(&sb, 0, y)
+			writeLine(&sb, l, true)
+		}
+		writeSavedCursor(&sb, s.alt.saved)
+	} else {
+		writeSavedCursor(&sb, s.primary.saved)
+	}
+
+	if s.top != 0 || s.bottom != s.rows-1 {
+		sb.WriteString("\x1b[" + strconv.Itoa(s.top+1) + ";" + strconv.Itoa(s.bottom+1) + "r")
+	}
+	if s.appCursor {
+		sb.WriteString("\x1b[?1h")
+	}
+	if s.reverseVideo {
+		sb.WriteString("\x1b[?5h")
+	}
+	if !s.autowrap {
+		sb.WriteString("\x1b[?7l")
+	}
+	if s.cursorHidden {
+		sb.WriteString("\x1b[?25l")
+	}
+	if s.bracketedPaste {
+		sb.WriteString("\x1b[?2004h")
+	}
+	for _, m := range vtMouseModes {
+		if s.mouseModes[m] {
+			sb.WriteString("\x1b[?" + strconv.Itoa(m) + "h")
+		}
+	}
+	if s.insertMode {
+		sb.WriteString("\x1b[4h")
+	}
+	if s.newlineMode {
+		sb.WriteString("\x1b[20h")
+	}
+	if s.appKeypad {
+		sb.WriteString("\x1b=")
+	}
+	if s.cursorStyle != 0 {
+		sb.WriteString("\x1b[" + strconv.Itoa(s.cursorStyle) + " q")
+	}
+	if s.title != "" {
+		sb.WriteString("\x1b]2;" + s.title + "\x07")
+	}
+	if s.charsets[0] == '0' {
+		sb.WriteString("\x1b(0")
+	}
+	if s.charsets[1] == '0' {
+		sb.WriteString("\x1b)0")
+	}
+	if s.gl == 1 {
+		sb.WriteString("\x0e")
+	}
+
+	y := s.cy
+	if s.originMode {
+		sb.WriteString("\x1b[?6h")
+		y -= s.top
+	}
+	writeCUP(&sb, s.cx, y)
+	writeSGR(&sb, s.attr)
+	return []byte(sb.String())
+}
+
+func writeSavedCursor(sb *strings.Builder, sc vtSavedCursor) {
+	if !sc.valid {
+		return
+	}
+	writeCUP(sb, sc.x, sc.y)
+	writeSGR(sb, sc.attr)
+	sb.WriteString("\x1b7\x1b[0m")
+}
+
+func writeCUP(sb *strings.Builder, x, y int) {
+	sb.WriteString("\x1b[" + strconv.Itoa(y+1) + ";" + strconv.Itoa(x+1) + "H")
+}
+
+// writeLine renders a line's cells with minimal SGR changes. If trim is set,
+// trailing untouched cells are dropped; the pen is always reset at the end.
+func writeLine(sb *strings.Builder, l *vtLine, trim bool) {
+	end := len(l.cells)
+	if trim {
+		for end > 0 {
+			c := l.cells[end-1]
+			if (c.r != 0 && c.r != ' ') || c.cont || c.attr != (vtAttr{}) {
+				break
+			}
+			end--
+		}
+	}
+	pen := vtAttr{}
+	for _, c := range l.cells[:end] {
+		if c.cont {
+			continue
+		}
+		if c.attr != pen {
+			writeSGR(sb, c.attr)
+			pen = c.attr
+		}
+		if c.r == 0 {
+			sb.WriteByte(' ')
+		} else {
+			sb.WriteRune(c.r)
+			for _, m := range c.comb {
+				sb.WriteRune(m)
+			}
+		}
+	}
+	if pen != (vtAttr{}) {
+		sb.WriteString("\x1b[0m")
+	}
+}
+
+// writeSGR emits a full reset followed by the attributes of a.
+func writeSGR(sb *strings.Builder, a vtAttr) {
+	sb.WriteString("\x1b[0")
+	flags := []struct {
+		bit  uint16
+		code string
+	}{
+		{attrBold, "1"}, {attrDim, "2"}, {attrItalic, "3"}, {attrUnderline, "4"},
+		{attrBlink, "5"}, {attrInverse, "7"}, {attrHidden, "8"}, {attrStrike, "9"},
+	}
+	for _, f := range flags {
+		if a.flags&f.bit != 0 {
+			sb.WriteString(";" + f.code)
+		}
+	}
+	writeColor(sb, a.fg, 30, 90, "38")
+	writeColor(sb, a.bg, 40, 100, "48")
+	sb.WriteByte('m')
+}
+
+func writeColor(sb *strings.Builder, c vtColor, base, brightBase int, ext string) {
+	switch c & colorKind {
+	case colorIndexed:
+		n := int(c & 0xff)
+		switch {
+		case n < 8:
+			sb.WriteString(";" + strconv.Itoa(base+n))
+		case n < 16:
+			sb.WriteString(";" + strconv.Itoa(brightBase+n-8))
+		default:
+			sb.WriteString(";" + ext + ";5;" + strconv.Itoa(n))
+		}
+	case colorRGB:
+		sb.WriteString(";" + ext + ";2;" +
+			strconv.Itoa(int(c>>16&0xff)) + ";" + strconv.Itoa(int(c>>8&0xff)) + ";" + strconv.Itoa(int(c&0xff)))
+	}
+}
+
+// Text returns the visible screen as plain text, one line per row with
+// trailing blanks trimmed.
+func (s *vtScreen) Text() string {
+	var sb strings.Builder
+	for i, l := range s.buf.lines {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(strings.TrimRight(lineText(l), " "))
+	}
+	return sb.String()
+}
+
+func lineText(l *vtLine) string {
+	var sb strings.Builder
+	for _, c := range l.cells {
+		if c.cont {
+			continue
+		}
+		if c.r == 0 {
+			sb.WriteByte(' ')
+			continue
+		}
+		sb.WriteRune(c.r)
+		for _, m := range c.comb {
+			sb.WriteRune(m)
+		}
+	}
+	return sb.String()
+}
+
+// ── Character width ──
+
+// runeWidth returns the number of cells r occupies, following xterm.js's
+// default Unicode 6 width tables (0 = combining, 2 = East Asian wide).
+func runeWidth(r rune) int {
+	if r < 0x300 {
+		return 1
+	}
+	if inRanges(r, vtCombining) {
+		return 0
+	}
+	if inRanges(r, vtWide) {
+		return 2
+	}
+	return 1
+}
+
+type runeRange struct{ lo, hi rune }
+
+func inRanges(r rune, table []runeRange) bool {
+	lo, hi := 0, len(table)-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		switch {
+		case r < table[mid].lo:
+			hi = mid - 1
+		case r > table[mid].hi:
+			lo = mid + 1
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+var vtWide = []runeRange{
+	{0x1100, 0x115F}, {0x2329, 0x232A}, {0x2E80, 0x303E}, {0x3040, 0xA4CF},
+	{0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19}, {0xFE30, 0xFE6F},
+	{0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+var vtCombining = []runeRange{
+	{0x0300, 0x036F}, {0x0483, 0x0489}, {0x0591, 0x05BD}, {0x05BF, 0x05BF},
+	{0x05C1, 0x05C2}, {0x05C4, 0x05C5}, {0x05C7, 0x05C7}, {0x0610, 0x061A},
+	{0x064B, 0x065F}, {0x0670, 0x0670}, {0x06D6, 0x06DC}, {0x06DF, 0x06E4},
+	{0x06E7, 0x06E8}, {0x06EA, 0x06ED}, {0x0900, 0x0902}, {0x093C, 0x093C},
+	{0x0941, 0x0948}, {0x094D, 0x094D}, {0x0E31, 0x0E31}, {0x0E34, 0x0E3A},
+	{0x0E47, 0x0E4E}, {0x1AB0, 0x1AFF}, {0x1DC0, 0x1DFF}, {0x200B, 0x200F},
+	{0x2028, 0x202E}, {0x2060, 0x2063}, {0x20D0, 0x20FF}, {0xFE00, 0xFE0F},
+	{0xFE20, 0xFE2F}, {0xFEFF, 0xFEFF}, {0xE0100, 0xE01EF},
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// ── HTML rendering ──
+//
+// HTML renders the visible screen for places without xterm.js (admin
+// thumbnails, previews in notifications): a <pre> of inline-styled spans,
+// colored with xterm.js's default theme.
+
+const (
+	vtHTMLForeground = "#ffffff"
+	vtHTMLBackground = "#000000"
+)
+
+// vtHTMLPalette is xterm.js's default ANSI palette (colors 0-15).
+var vtHTMLPalette = [16]string{
+	"#2e3436", "#cc0000", "#4e9a06", "#c4a000", "#3465a4", "#75507b", "#06989a", "#d3d7cf",
+	"#555753", "#ef2929", "#8ae234", "#fce94f", "#729fcf", "#ad7fa8", "#34e2e2", "#eeeeec",
+}
+
+// HTML returns the visible screen as a <pre> element. The cursor, if shown,
+// is drawn as an inverted cell.
+func (s *vtScreen) HTML() string {
+	fg, bg := vtHTMLForeground, vtHTMLBackground
+	if s.reverseVideo {
+		fg, bg = bg, fg
+	}
+	var sb strings.Builder
+	sb.WriteString(`<pre class="terminal-screen" style="margin:0;color:` + fg + `;background:` + bg + `">`)
+	for y, l := range s.buf.lines {
+		if y > 0 {
+			sb.WriteByte('\n')
+		}
+		cursorX := -1
+		if !s.cursorHidden && y == s.cy {
+			cursorX = s.cx
+		}
+		writeLineHTML(&sb, l, cursorX, fg, bg)
+	}
+	sb.WriteString("</pre>")
+	return sb.String()
+}
+
+// writeLineHTML renders a line without its trailing blank cells, merging
+// cells of the same style into one span.
+func writeLineHTML(sb *strings.Builder, l *vtLine, cursorX int, fg, bg string) {
+	end := len(l.cells)
+	for end > 0 {
+		c := l.cells[end-1]
+		if (c.r != 0 && c.r != ' ') || c.cont || c.attr.bg != 0 || c.attr.flags&attrInverse != 0 {
+			break
+		}
+		end--
+	}
+	if cursorX >= end && cursorX < len(l.cells) {
+		end = cursorX + 1
+	}
+
+	var run strings.Builder
+	style := ""
+	flush := func() {
+		if run.Len() == 0 {
+			return
+		}
+		if style == "" {
+			sb.WriteString(html.EscapeString(run.String()))
+		} else {
+			sb.WriteString(`<span style="` + style + `">` + html.EscapeString(run.String()) + `</span>`)
+		}
+		run.Reset()
+	}
+	for x, c := range l.cells[:end] {
+		if c.cont {
+			continue
+		}
+		if st := cellStyleCSS(c.attr, x == cursorX, fg, bg); st != style {
+			flush()
+			style = st
+		}
+		if c.r == 0 {
+			run.WriteByte(' ')
+			continue
+		}
+		run.WriteRune(c.r)
+		for _, m := range c.comb {
+			run.WriteRune(m)
+		}
+	}
+	flush()
+}
+
+// cellStyleCSS returns the inline style of a cell; "" for the default look.
+func cellStyleCSS(a vtAttr, cursor bool, defFg, defBg string) string {
+	fg, bg := colorCSS(a.fg), colorCSS(a.bg)
+	if (a.flags&attrInverse != 0) != cursor {
+		if fg == "" {
+			fg = defFg
+		}
+		if bg == "" {
+			bg = defBg
+		}
+		fg, bg = bg, fg
+	}
+	var parts []string
+	switch {
+	case a.flags&attrHidden != 0:
+		parts = append(parts, "color:transparent")
+	case fg != "":
+		parts = append(parts, "color:"+fg)
+	}
+	if bg != "" {
+		parts = append(parts, "background:"+bg)
+	}
+	if a.flags&attrBold != 0 {
+		parts = append(parts, "font-weight:bold")
+	}
+	if a.flags&attrDim != 0 {
+		parts = append(parts, "opacity:.6")
+	}
+	if a.flags&attrItalic != 0 {
+		parts = append(parts, "font-style:italic")
+	}
+	var deco []string
+	if a.flags&attrUnderline != 0 {
+		deco = append(deco, "underline")
+	}
+	if a.flags&attrStrike != 0 {
+		deco = append(deco, "line-through")
+	}
+	if len(deco) > 0 {
+		parts = append(parts, "text-decoration:"+strings.Join(deco, " "))
+	}
+	return strings.Join(parts, ";")
+}
+
+// colorCSS maps a cell color to CSS; "" for the default color.
+func colorCSS(c vtColor) string {
+	switch c & colorKind {
+	case colorIndexed:
+		n := int(c & 0xff)
+		switch {
+		case n < 16:
+			return vtHTMLPalette[n]
+		case n < 232: // 6x6x6 cube
+			n -= 16
+			level := func(v int) int {
+				if v == 0 {
+					return 0
+				}
+				return 55 + v*40
+			}
+			return hexRGB(level(n/36), level(n/6%6), level(n%6))
+		default: // grayscale ramp
+			v := 8 + (n-232)*10
+			return hexRGB(v, v, v)
+		}
+	case colorRGB:
+		return hexRGB(int(c>>16&0xff), int(c>>8&0xff), int(c&0xff))
+	}
+	return ""
+}
+
+func hexRGB(r, g, b int) string {
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVTScreen_HTML(t *testing.T) {
+	s := newVTScreen(20, 3)
+	s.Write([]byte("\x1b[1;31merr\x1b[0m <a&b>\r\n\x1b[38;5;21;48;2;1;2;3mx\x1b[7my\x1b[0m\r\n$ \x1b[?25l"))
+
+	lines := strings.Split(strings.TrimSuffix(strings.TrimPrefix(s.HTML(),
+		`<pre class="terminal-screen" style="margin:0;color:#ffffff;background:#000000">`), "</pre>"), "\n")
+	assert.Equal(t, []string{
+		`<span style="color:#cc0000;font-weight:bold">err</span> &lt;a&amp;b&gt;`,
+		`<span style="color:#0000ff;background:#010203">x</span><span style="color:#010203;background:#0000ff">y</span>`,
+		`$`,
+	}, lines)
+}
+
+func TestVTScreen_HTMLCursor(t *testing.T) {
+	s := newVTScreen(10, 2)
+	s.Write([]byte("$ "))
+	h := s.HTML()
+	assert.Equal(t, `$ <span style="color:#000000;background:#ffffff"> </span>`, h[strings.Index(h, ">")+1:strings.Index(h, "\n")])
+}
+
+func TestScreenTail(t *testing.T) {
+	assert.Equal(t, "a\n\nbb", screenTail("\n\na\n\nbb\n\n", 100))
+	assert.Equal(t, "bb\nccc", screenTail("a\nbb\nccc", 7))
+	assert.Equal(t, "", screenTail("toolong", 3))
+}
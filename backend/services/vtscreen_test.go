@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replayed feeds a snapshot of s into a fresh screen of the same size,
+// like a newly attached xterm would see it.
+func replayed(s *vtScreen) *vtScreen {
+	c := newVTScreen(s.cols, s.rows)
+	c.Write(s.Snapshot())
+	return c
+}
+
+func TestVTScreen_TextAndCursor(t *testing.T) {
+	s := newVTScreen(20, 5)
+	s.Write([]byte("hello\r\nworld\x1b[1;3H"))
+
+	assert.Equal(t, "hello\nworld\n\n\n", s.Text())
+	assert.Equal(t, 2, s.cx)
+	assert.Equal(t, 0, s.cy)
+}
+
+func TestVTScreen_SplitSequencesAndRunes(t *testing.T) {
+	s := newVTScreen(20, 5)
+	stream := []byte("\x1b[31mпривет\x1b[0m\x1b]2;title\x07")
+	for i := range stream {
+		s.Write(stream[i : i+1])
+	}
+	assert.Equal(t, "привет", strings.Split(s.Text(), "\n")[0])
+	assert.Equal(t, colorIndexed|1, s.primary.lines[0].cells[0].attr.fg)
+	assert.Equal(t, "title", s.title)
+}
+
+func TestVTScreen_SnapshotRoundTrip(t *testing.T) {
+	s := newVTScreen(30, 6)
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(s, "\x1b[1;38;5;%dmline %d\x1b[0m\r\n", 100+i, i)
+	}
+	s.Write([]byte("$ \x1b[?2004h\x1b[?1h"))
+
+	c := replayed(s)
+	assert.Equal(t, s.Text(), c.Text())
+	require.Len(t, c.scrollback, len(s.scrollback))
+	assert.Equal(t, lineText(s.scrollback[0]), lineText(c.scrollback[0]))
+	assert.Equal(t, s.primary.lines[0].cells[0].attr, c.primary.lines[0].cells[0].attr)
+	assert.Equal(t, [2]int{s.cx, s.cy}, [2]int{c.cx, c.cy})
+	assert.True(t, c.bracketedPaste)
+	assert.True(t, c.appCursor)
+}
+
+func TestVTScreen_AlternateBuffer(t *testing.T) {
+	s := newVTScreen(20, 5)
+	s.Write([]byte("$ vim\r\n"))
+	s.Write([]byte("\x1b[?1049h\x1b[H\x1b[2J~ editor\x1b[5;1H-- INSERT --\x1b[1;3H"))
+
+	c := replayed(s)
+	require.True(t, c.altActive)
+	assert.Equal(t, s.Text(), c.Text())
+	assert.Equal(t, [2]int{2, 0}, [2]int{c.cx, c.cy})
+
+	// Leaving the full-screen app restores the shell screen and cursor on both
+	s.Write([]byte("\x1b[?1049l"))
+	c.Write([]byte("\x1b[?1049l"))
+	assert.Equal(t, "$ vim", strings.Split(c.Text(), "\n")[0])
+	assert.Equal(t, s.Text(), c.Text())
+	assert.Equal(t, [2]int{s.cx, s.cy}, [2]int{c.cx, c.cy})
+}
+
+func TestVTScreen_QueriesNotReplayed(t *testing.T) {
+	s := newVTScreen(20, 5)
+	s.Write([]byte("\x1b[c\x1b[>c\x1b[0c\x1b[6n$ "))
+
+	snap := string(s.Snapshot())
+	assert.NotContains(t, snap, "\x1b[c")
+	assert.NotContains(t, snap, "\x1b[>c")
+	assert.NotContains(t, snap, "\x1b[6n")
+	assert.Equal(t, "$", strings.Split(s.Text(), "\n")[0])
+}
+
+func TestVTScreen_WideRunesAndWrap(t *testing.T) {
+	s := newVTScreen(5, 3)
+	s.Write([]byte("ab中文x"))
+
+	// "中" fits at 2-3, "文" doesn't fit at col 4 and wraps early
+	assert.Equal(t, "ab中\n文x\n", s.Text())
+	assert.True(t, s.primary.lines[0].wrapped)
+	assert.Equal(t, s.Text(), replayed(s).Text())
+}
+
+func TestVTScreen_ScrollRegionAndEdits(t *testing.T) {
+	s := newVTScreen(10, 5)
+	s.Write([]byte("1\r\n2\r\n3\r\n4\r\n5"))
+	s.Write([]byte("\x1b[2;4r\x1b[4;1H\n")) // scroll rows 2-4 only
+	assert.Equal(t, "1\n3\n4\n\n5", s.Text())
+	assert.Empty(t, s.scrollback, "region scroll below top doesn't feed history")
+
+	s.Write([]byte("\x1b[r\x1b[1;1H\x1b[2P\x1b[2;1H\x1b[K"))
+	assert.Equal(t, "\n\n4\n\n5", s.Text())
+}
+
+func TestVTScreen_ResizeKeepsCursorLine(t *testing.T) {
+	s := newVTScreen(10, 5)
+	s.Write([]byte("a\r\nb\r\nc\r\nd\r\ne"))
+	s.Resize(8, 3)
+
+	assert.Equal(t, "c\nd\ne", s.Text())
+	assert.Equal(t, 2, s.cy)
+	require.Len(t, s.scrollback, 2)
+	assert.Equal(t, "a", strings.TrimRight(lineText(s.scrollback[0]), " "))
+}
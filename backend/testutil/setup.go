@@ -46,6 +46,18 @@ func SetupTestDB() *gorm.DB {
 		&models.ChatSession{},
 		&models.Message{},
 		&models.RefreshToken{},
+		&models.ExecRun{},
+		&models.TerminalTrigger{},
+		&models.ProcessWatcher{},
+		&models.TerminalProfile{},
+		&models.TerminalInstance{},
+		&models.SSHKey{},
+		&models.ClaudeJob{},
+		&models.ClaudeSchedule{},
+		&models.ClaudeApproval{},
+		&models.ClaudePolicyRule{},
+		&models.ClaudePolicyDenial{},
+		&models.ClaudeEvent{},
 	)
 	if err != nil {
 		panic("failed to run migrations: " + err.Error())
@@ -59,7 +59,8 @@ if [ "$(ls -A "$SSH_TARGET" 2>/dev/null)" ]; then
 fi
 
 # NOTE: No global SSH symlink — admin SSH keys stay at /root/.ssh (root-only).
-# Non-admin users get per-user .ssh in their workspace via sandboxed-shell.
+# Non-admin users get per-user .ssh: the terminal sandbox binds <workspace>/.ssh
+# over ~/.ssh (see backend/services/sandbox_linux.go, bindSandboxSSH).
 
 # Claude CLI config — symlink /root/.claude.json into the persistent volume
 # so it survives container rebuilds (volume mounts /root/.claude/)
@@ -102,7 +103,15 @@ fi
 if ! grep -qF "histappend" "$ROOT_BASHRC" 2>/dev/null; then
   echo "shopt -s histappend" >> "$ROOT_BASHRC"
 fi
-# Per-user venv is created by sandboxed-shell on first terminal open.
+# Non-admin users keep their own venv in their workspace (python3 -m venv .venv).
+
+# Per-user terminal cgroups (TERMINAL_CGROUPS): Docker mounts cgroup2 read-only;
+# CAP_SYS_ADMIN lets us remount our own (namespaced, `cgroup: private` in
+# docker-compose.yml) cgroup tree writable. If that fails the backend refuses to
+# start while TERMINAL_CGROUPS is on.
+if [ -f /sys/fs/cgroup/cgroup.controllers ]; then
+  mount -o remount,rw /sys/fs/cgroup 2>/dev/null || echo "[entrypoint] /sys/fs/cgroup stays read-only; set TERMINAL_CGROUPS=false or the backend won't start."
+fi
 
 # Create PostgreSQL dev role for user terminals (idempotent)
 if command -v psql >/dev/null 2>&1; then
@@ -133,4 +142,25 @@ if command -v tailscaled >/dev/null 2>&1 && ! pidof tailscaled >/dev/null 2>&1;
   echo "[entrypoint] tailscaled started ($(tailscale --socket="$TS_SOCK" version 2>/dev/null | head -1))"
 fi
 
-exec "$@"
+# Supervise the backend instead of exec'ing it. A deploy that only ships a new
+# binary swaps it in place and sends the backend TERM (see
+# .github/workflows/deploy.yml); the loop starts the new one while the
+# container stays up — and with it the pty-holders that keep users' shells
+# alive across the restart (TERMINAL_PTY_HOLDERS). Stopping the container
+# (TERM from tini) stops the backend for good.
+BACKEND_PID_FILE="/run/nebulide-backend.pid"
+stopping=
+trap 'stopping=1; [ -n "$backend" ] && kill -TERM "$backend" 2>/dev/null' TERM INT
+while :; do
+  "$@" &
+  backend=$!
+  echo "$backend" > "$BACKEND_PID_FILE"
+  wait "$backend"
+  status=$?
+  if [ -n "$stopping" ]; then
+    wait "$backend" 2>/dev/null
+    exit 0
+  fi
+  echo "[entrypoint] backend exited ($status), restarting..."
+  sleep 1
+done
@@ -30,11 +30,42 @@ const payload = {
   transcript_path: inp.transcript_path,
 };
 
+// PermissionRequest ждёт решения с веба/Telegram (бэкенд держит запрос до таймаута) —
+// поэтому таймаут почти час, как и "timeout" хука в settings.json. PreToolUse — проверка
+// политики: 30с (дефолтный таймаут хука у claude — 60с); остальные события — 2с.
+const waitsDecision = payload.event === 'PermissionRequest';
+const checksPolicy = payload.event === 'PreToolUse';
+const wantsOutput = waitsDecision || checksPolicy;
 const ctrl = new AbortController();
-const t = setTimeout(() => ctrl.abort(), 2000);
+const t = setTimeout(() => ctrl.abort(), waitsDecision ? 3600_000 : checksPolicy ? 30_000 : 2000);
+
+// Политика fail-closed: бэкенд не ответил (лежит, таймаут, не 2xx) — НЕ пропускаем инструмент
+// молча мимо deny-правил, а просим claude спросить пользователя. Так же отвечает и сам бэкенд,
+// если не смог прочитать правила из БД (services/claude_policy.go).
+const policyUnavailable = {
+  hookSpecificOutput: {
+    hookEventName: 'PreToolUse',
+    permissionDecision: 'ask',
+    permissionDecisionReason: 'Nebulide could not check its policy rules',
+  },
+};
+
 fetch(NEBULIDE_HOOK_URL, {
   method: 'POST',
   headers: { 'Authorization': `Bearer ${NEBULIDE_HOOK_TOKEN}`, 'Content-Type': 'application/json' },
   body: JSON.stringify(payload),
   signal: ctrl.signal,
-}).catch(() => {}).finally(() => clearTimeout(t)); // без process.exit — выходим естественно
+})
+  .then((r) => {
+    if (!wantsOutput) return null;
+    if (!r.ok) throw new Error(`HTTP ${r.status}`);
+    return r.json();
+  })
+  .then((res) => {
+    // hook_output — готовый JSON решения для claude; нет его — claude действует как обычно.
+    if (res && res.hook_output) process.stdout.write(JSON.stringify(res.hook_output));
+  })
+  .catch(() => {
+    if (checksPolicy) process.stdout.write(JSON.stringify(policyUnavailable));
+  })
+  .finally(() => clearTimeout(t)); // без process.exit — выходим естественно